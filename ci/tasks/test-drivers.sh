@@ -18,6 +18,8 @@ export AWS_DESTINATION_REGION=${copy_region?'must be set'}
 export AWS_KMS_KEY_ID=${kms_key_id?'must be set'}
 export MULTI_REGION_KEY=${kms_multi_region_key?'must be set'}
 export MULTI_REGION_KEY_REPLICATION_TEST=${kms_multi_region_key_replication_test?'must be set'}
+# Optional role in another account for the cross-account copy spec
+export AWS_DESTINATION_ROLE_ARN=${destination_role_arn:-}
 
 # Fixtures
 export S3_MACHINE_IMAGE_URL=${uploaded_machine_image_url?'must be set'}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"light-stemcell-builder/cleanup"
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/driver"
+)
+
+// runCleanup deregisters stale AMIs and deletes their snapshots in every region
+// of the account, then writes a JSON report of what it removed
+func runCleanup(sharedWriter io.Writer, args []string) {
+	flags := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	region := flags.String("region", os.Getenv("AWS_REGION"), "Region to list the enabled regions of the account from. Defaults to $AWS_REGION.")
+	roleArn := flags.String("role-arn", "", "ARN of a role to assume for every AWS call")
+	olderThanDays := flags.Int("older-than-days", 60, "Only remove AMIs created more than this many days ago")
+	keepLatest := flags.Int("keep-latest", 5, "Number of most recent past due AMIs to keep for --os-name and --snapshot-id")
+	osName := flags.String("os-name", "", "Remove unpublished AMIs with this distro tag, e.g. ubuntu-jammy")
+	snapshotID := flags.String("snapshot-id", "", "Remove AMIs registered from this snapshot. The snapshot itself is kept.")
+	removePublicImages := flags.Bool("remove-public-images", false, "Remove every past due public AMI, regardless of --keep-latest")
+	dryRun := flags.Bool("dry-run", false, "List the AMIs and snapshots that would be removed without removing them")
+	reportPath := flags.String("report", "", "Path to write the JSON report to. Defaults to stdout.")
+	timeout := flags.Duration("timeout", 0, "Maximum duration of the cleanup, e.g. 1h. Defaults to no limit.")
+	logOptions := addLogFlags(flags)
+
+	flags.Parse(args) //nolint:errcheck
+
+	cleanupUsage := func(message string) {
+		fmt.Fprintln(os.Stderr, message)                                           //nolint:errcheck
+		fmt.Fprintln(os.Stderr, "Usage of light-stemcell-builder/main.go cleanup") //nolint:errcheck
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *region == "" {
+		cleanupUsage("--region flag is required")
+	}
+	if *osName == "" && *snapshotID == "" && !*removePublicImages {
+		cleanupUsage("at least one of --os-name, --snapshot-id or --remove-public-images is required")
+	}
+	if *olderThanDays < 0 {
+		cleanupUsage("--older-than-days flag must not be negative")
+	}
+	if *keepLatest < 0 {
+		cleanupUsage("--keep-latest flag must not be negative")
+	}
+
+	logger := logOptions.logger(sharedWriter)
+
+	creds := config.Credentials{
+		Source:   config.DefaultChainCredentialsSource,
+		RoleArn:  *roleArn,
+		Region:   *region,
+		Endpoint: os.Getenv("AWS_ENDPOINT_URL"),
+	}
+
+	c := cleanup.New(logger, driver.NewAmiCleanupDriver(logger, creds), cleanup.Options{
+		CreatedBefore:      time.Now().AddDate(0, 0, -*olderThanDays),
+		KeepLatest:         *keepLatest,
+		OSName:             *osName,
+		SnapshotID:         *snapshotID,
+		RemovePublicImages: *removePublicImages,
+		DryRun:             *dryRun,
+	})
+
+	ctx, cancel := publishContext(*timeout)
+	defer cancel()
+
+	report, cleanupErr := c.Run(ctx)
+
+	err := writeCleanupReport(*reportPath, report)
+	if err != nil {
+		fatal(logger, "Error writing cleanup report: %s", err)
+	}
+
+	if cleanupErr != nil {
+		fatal(logger, "Cleanup failed: %s", cleanupErr)
+	}
+	logger.Info("Cleanup finished", "deregistered_amis", len(report.DeregisteredAmis), "deleted_snapshots", len(report.DeletedSnapshots))
+}
+
+func writeCleanupReport(path string, report cleanup.Report) error {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling report: %s", err)
+	}
+	contents = append(contents, '\n')
+
+	if path == "" {
+		_, err = os.Stdout.Write(contents)
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0644)
+}
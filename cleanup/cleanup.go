@@ -0,0 +1,209 @@
+// Package cleanup removes stale AMIs and their snapshots from every region of an account.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"light-stemcell-builder/collection"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+)
+
+// BoshAmiNamePattern matches the names of the AMIs published by the builder
+const BoshAmiNamePattern = "BOSH*"
+
+// Options select which AMIs are removed
+type Options struct {
+	// CreatedBefore excludes AMIs created at or after this time
+	CreatedBefore time.Time
+
+	// KeepLatest is the number of most recent matching AMIs to keep for OSName and SnapshotID
+	KeepLatest int
+
+	// OSName selects unpublished AMIs with a matching distro tag
+	OSName string
+
+	// SnapshotID selects AMIs registered from this snapshot. The snapshot itself is kept.
+	SnapshotID string
+
+	// RemovePublicImages selects every public AMI, regardless of KeepLatest
+	RemovePublicImages bool
+
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+}
+
+// Report lists the AMIs and snapshots that were removed, or would be removed in a dry run
+type Report struct {
+	DryRun           bool                 `json:"dry_run"`
+	DeregisteredAmis []resources.AmiImage `json:"deregistered_amis"`
+	DeletedSnapshots []DeletedSnapshot    `json:"deleted_snapshots"`
+	Errors           []string             `json:"errors,omitempty"`
+}
+
+// DeletedSnapshot identifies a snapshot removed together with its AMI
+type DeletedSnapshot struct {
+	ID     string `json:"id"`
+	Region string `json:"region"`
+	AmiID  string `json:"ami_id"`
+}
+
+// Cleaner removes the AMIs selected by its Options
+type Cleaner struct {
+	driver  resources.AmiCleanupDriver
+	options Options
+	logger  *slog.Logger
+}
+
+// New creates a Cleaner that uses driver to find and remove AMIs
+func New(logger *slog.Logger, driver resources.AmiCleanupDriver, options Options) *Cleaner {
+	return &Cleaner{
+		driver:  driver,
+		options: options,
+		logger:  logger,
+	}
+}
+
+// Run removes the selected AMIs in every region. A failure in one region does not stop
+// the others; every failure is listed in the report and in the returned error.
+func (c *Cleaner) Run(ctx context.Context) (Report, error) {
+	report := Report{
+		DryRun:           c.options.DryRun,
+		DeregisteredAmis: []resources.AmiImage{},
+		DeletedSnapshots: []DeletedSnapshot{},
+	}
+
+	regions, err := c.driver.Regions(ctx)
+	if err != nil {
+		return report, fmt.Errorf("listing regions: %s", err)
+	}
+
+	errCol := collection.Error{}
+	for _, region := range regions {
+		amis, err := c.selectAmis(ctx, region)
+		if err != nil {
+			errCol.Add(err)
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+
+		for _, ami := range amis {
+			err = c.remove(ctx, ami, &report)
+			if err != nil {
+				errCol.Add(err)
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+	}
+
+	return report, errCol.Error()
+}
+
+// selectAmis returns the AMIs in region that match any of the options, without duplicates
+func (c *Cleaner) selectAmis(ctx context.Context, region string) ([]resources.AmiImage, error) {
+	var selected []resources.AmiImage
+	seen := map[string]bool{}
+	add := func(amis []resources.AmiImage) {
+		for _, ami := range amis {
+			if !seen[ami.ID] {
+				seen[ami.ID] = true
+				selected = append(selected, ami)
+			}
+		}
+	}
+
+	if c.options.RemovePublicImages {
+		amis, err := c.driver.FindAmis(ctx, resources.AmiFilter{
+			Region:      region,
+			NamePattern: BoshAmiNamePattern,
+			PublicOnly:  true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("finding public AMIs in %s: %s", region, err)
+		}
+		add(c.pastDue(amis))
+	}
+
+	if c.options.OSName != "" {
+		amis, err := c.driver.FindAmis(ctx, resources.AmiFilter{
+			Region:      region,
+			NamePattern: BoshAmiNamePattern,
+			Tags: map[string]string{
+				"published": "false",
+				"distro":    c.options.OSName,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("finding unpublished %s AMIs in %s: %s", c.options.OSName, region, err)
+		}
+		add(c.exceptLatest(c.pastDue(amis)))
+	}
+
+	if c.options.SnapshotID != "" {
+		amis, err := c.driver.FindAmis(ctx, resources.AmiFilter{
+			Region:     region,
+			SnapshotID: c.options.SnapshotID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("finding AMIs of snapshot %s in %s: %s", c.options.SnapshotID, region, err)
+		}
+		add(c.exceptLatest(c.pastDue(amis)))
+	}
+
+	return selected, nil
+}
+
+// pastDue returns the AMIs created before the cutoff, keeping their order
+func (c *Cleaner) pastDue(amis []resources.AmiImage) []resources.AmiImage {
+	var old []resources.AmiImage
+	for _, ami := range amis {
+		if ami.CreationDate.Before(c.options.CreatedBefore) {
+			old = append(old, ami)
+		}
+	}
+	return old
+}
+
+// exceptLatest drops the KeepLatest most recent AMIs from a list ordered by creation date
+func (c *Cleaner) exceptLatest(amis []resources.AmiImage) []resources.AmiImage {
+	if c.options.KeepLatest >= len(amis) {
+		return nil
+	}
+	return amis[:len(amis)-c.options.KeepLatest]
+}
+
+// remove deregisters an AMI and deletes its snapshots, except the snapshot selected by SnapshotID
+func (c *Cleaner) remove(ctx context.Context, ami resources.AmiImage, report *Report) error {
+	c.logger.InfoContext(ctx, "cleaning up AMI", logging.AmiID(ami.ID), "name", ami.Name, "version", ami.Version, "created", ami.CreationDate.Format(time.RFC3339), logging.Region(ami.Region))
+
+	if !c.options.DryRun {
+		err := c.driver.DeregisterAmi(ctx, ami)
+		if err != nil {
+			return fmt.Errorf("deregistering AMI %s in %s: %s", ami.ID, ami.Region, err)
+		}
+	}
+	report.DeregisteredAmis = append(report.DeregisteredAmis, ami)
+
+	for _, snapshotID := range ami.SnapshotIDs {
+		if snapshotID == c.options.SnapshotID {
+			continue
+		}
+
+		if !c.options.DryRun {
+			err := c.driver.DeleteSnapshot(ctx, ami.Region, snapshotID)
+			if err != nil {
+				return fmt.Errorf("deleting snapshot %s of AMI %s in %s: %s", snapshotID, ami.ID, ami.Region, err)
+			}
+		}
+		report.DeletedSnapshots = append(report.DeletedSnapshots, DeletedSnapshot{
+			ID:     snapshotID,
+			Region: ami.Region,
+			AmiID:  ami.ID,
+		})
+	}
+
+	return nil
+}
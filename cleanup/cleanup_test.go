@@ -0,0 +1,200 @@
+package cleanup_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"light-stemcell-builder/cleanup"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/resources/resourcesfakes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cleaner", func() {
+	const (
+		fakeRegion      = "fake region"
+		fakeOtherRegion = "fake other region"
+	)
+
+	var (
+		fakeDriver *resourcesfakes.FakeAmiCleanupDriver
+		cutoff     time.Time
+	)
+
+	fakeAmi := func(id string, daysBeforeCutoff int, snapshotIDs ...string) resources.AmiImage {
+		return resources.AmiImage{
+			ID:           id,
+			Region:       fakeRegion,
+			Name:         "BOSH-" + id,
+			CreationDate: cutoff.AddDate(0, 0, -daysBeforeCutoff),
+			SnapshotIDs:  snapshotIDs,
+		}
+	}
+
+	BeforeEach(func() {
+		cutoff = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+		fakeDriver = &resourcesfakes.FakeAmiCleanupDriver{}
+		fakeDriver.RegionsReturns([]string{fakeRegion}, nil)
+	})
+
+	It("removes unpublished AMIs of an OS that are past due, except the latest ones", func() {
+		oldest := fakeAmi("ami-oldest", 3, "snap-oldest")
+		older := fakeAmi("ami-older", 2, "snap-older")
+		old := fakeAmi("ami-old", 1, "snap-old")
+		recent := fakeAmi("ami-recent", -1, "snap-recent")
+		fakeDriver.FindAmisReturns([]resources.AmiImage{oldest, older, old, recent}, nil)
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore: cutoff,
+			KeepLatest:    1,
+			OSName:        "ubuntu-jammy",
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeDriver.FindAmisCallCount()).To(Equal(1), "Expected AmiCleanupDriver.FindAmis to be called once")
+		_, filter := fakeDriver.FindAmisArgsForCall(0)
+		Expect(filter).To(Equal(resources.AmiFilter{
+			Region:      fakeRegion,
+			NamePattern: "BOSH*",
+			Tags:        map[string]string{"published": "false", "distro": "ubuntu-jammy"},
+		}))
+
+		Expect(fakeDriver.DeregisterAmiCallCount()).To(Equal(2))
+		_, firstDeregistered := fakeDriver.DeregisterAmiArgsForCall(0)
+		Expect(firstDeregistered).To(Equal(oldest))
+		_, secondDeregistered := fakeDriver.DeregisterAmiArgsForCall(1)
+		Expect(secondDeregistered).To(Equal(older))
+
+		Expect(fakeDriver.DeleteSnapshotCallCount()).To(Equal(2))
+		_, region, snapshotID := fakeDriver.DeleteSnapshotArgsForCall(0)
+		Expect(region).To(Equal(fakeRegion))
+		Expect(snapshotID).To(Equal("snap-oldest"))
+
+		Expect(report).To(Equal(cleanup.Report{
+			DeregisteredAmis: []resources.AmiImage{oldest, older},
+			DeletedSnapshots: []cleanup.DeletedSnapshot{
+				{ID: "snap-oldest", Region: fakeRegion, AmiID: "ami-oldest"},
+				{ID: "snap-older", Region: fakeRegion, AmiID: "ami-older"},
+			},
+		}))
+	})
+
+	It("removes every past due public AMI regardless of how many to keep", func() {
+		public := fakeAmi("ami-public", 1, "snap-public")
+		fakeDriver.FindAmisReturns([]resources.AmiImage{public}, nil)
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore:      cutoff,
+			KeepLatest:         5,
+			RemovePublicImages: true,
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		_, filter := fakeDriver.FindAmisArgsForCall(0)
+		Expect(filter).To(Equal(resources.AmiFilter{
+			Region:      fakeRegion,
+			NamePattern: "BOSH*",
+			PublicOnly:  true,
+		}))
+		Expect(report.DeregisteredAmis).To(Equal([]resources.AmiImage{public}))
+	})
+
+	It("keeps the snapshot that AMIs are selected by", func() {
+		first := fakeAmi("ami-first", 2, "snap-fixture", "snap-data")
+		second := fakeAmi("ami-second", 1, "snap-fixture")
+		fakeDriver.FindAmisReturns([]resources.AmiImage{first, second}, nil)
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore: cutoff,
+			SnapshotID:    "snap-fixture",
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		_, filter := fakeDriver.FindAmisArgsForCall(0)
+		Expect(filter).To(Equal(resources.AmiFilter{Region: fakeRegion, SnapshotID: "snap-fixture"}))
+
+		Expect(fakeDriver.DeregisterAmiCallCount()).To(Equal(2))
+		Expect(fakeDriver.DeleteSnapshotCallCount()).To(Equal(1))
+		_, _, snapshotID := fakeDriver.DeleteSnapshotArgsForCall(0)
+		Expect(snapshotID).To(Equal("snap-data"))
+		Expect(report.DeletedSnapshots).To(Equal([]cleanup.DeletedSnapshot{
+			{ID: "snap-data", Region: fakeRegion, AmiID: "ami-first"},
+		}))
+	})
+
+	It("removes an AMI matched by several options only once", func() {
+		ami := fakeAmi("ami-both", 1, "snap-both")
+		fakeDriver.FindAmisReturns([]resources.AmiImage{ami}, nil)
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore:      cutoff,
+			OSName:             "ubuntu-jammy",
+			RemovePublicImages: true,
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeDriver.FindAmisCallCount()).To(Equal(2))
+		Expect(fakeDriver.DeregisterAmiCallCount()).To(Equal(1))
+		Expect(report.DeregisteredAmis).To(HaveLen(1))
+	})
+
+	It("only reports what it would remove in a dry run", func() {
+		fakeDriver.FindAmisReturns([]resources.AmiImage{fakeAmi("ami-old", 1, "snap-old")}, nil)
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore: cutoff,
+			OSName:        "ubuntu-jammy",
+			DryRun:        true,
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeDriver.DeregisterAmiCallCount()).To(Equal(0))
+		Expect(fakeDriver.DeleteSnapshotCallCount()).To(Equal(0))
+		Expect(report.DryRun).To(BeTrue())
+		Expect(report.DeregisteredAmis).To(HaveLen(1))
+		Expect(report.DeletedSnapshots).To(HaveLen(1))
+	})
+
+	It("continues with other regions and reports failures", func() {
+		fakeDriver.RegionsReturns([]string{fakeRegion, fakeOtherRegion}, nil)
+		fakeDriver.FindAmisStub = func(_ context.Context, filter resources.AmiFilter) ([]resources.AmiImage, error) {
+			if filter.Region == fakeRegion {
+				return nil, errors.New("error finding AMIs")
+			}
+			ami := fakeAmi("ami-old", 1, "snap-old")
+			ami.Region = fakeOtherRegion
+			return []resources.AmiImage{ami}, nil
+		}
+		fakeDriver.DeleteSnapshotReturns(errors.New("snapshot in use"))
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{
+			CreatedBefore: cutoff,
+			OSName:        "ubuntu-jammy",
+		})
+		report, err := c.Run(context.Background())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("error finding AMIs"))
+		Expect(err.Error()).To(ContainSubstring("snapshot in use"))
+
+		Expect(report.DeregisteredAmis).To(HaveLen(1))
+		Expect(report.DeletedSnapshots).To(BeEmpty())
+		Expect(report.Errors).To(HaveLen(2))
+	})
+
+	It("returns an error if the regions cannot be listed", func() {
+		fakeDriver.RegionsReturns(nil, errors.New("error describing regions"))
+
+		c := cleanup.New(logger, fakeDriver, cleanup.Options{OSName: "ubuntu-jammy"})
+		_, err := c.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("error describing regions")))
+	})
+})
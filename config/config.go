@@ -1,17 +1,15 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 
+	"light-stemcell-builder/tracing"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
-	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
-	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -24,9 +22,15 @@ const (
 	HardwareAssistedVirtualization = "hvm"
 )
 
-var isolated = map[string]bool{
-	"cn-north-1": true,
-}
+const (
+	X86Architecture   = "x86_64"
+	Arm64Architecture = "arm64"
+)
+
+const (
+	ImportSnapshotMethod    = "import"
+	EbsDirectSnapshotMethod = "ebs-direct"
+)
 
 // Convention:
 // 1. required
@@ -38,6 +42,10 @@ type AmiConfiguration struct {
 	VirtualizationType string `json:"virtualization_type"`
 	Efi                bool   `json:"efi"`
 
+	// Architecture of the machine image, either 'x86_64' or 'arm64'. It defaults to the
+	// architecture in the cloud_properties of the stemcell manifest. arm64 AMIs always boot with UEFI.
+	Architecture string `json:"architecture,omitempty"`
+
 	// Encrypted has to be set to true if encrypted stemcells should be created.
 	// If set to true, then the EBS key, that is assigned to the AWS account, is used for the encryption by default.
 	Encrypted bool `json:"encrypted"`
@@ -60,7 +68,8 @@ type AmiConfiguration struct {
 	// The Visibility can be 'public' or 'private' but it defaults to public.
 	Visibility string `json:"visibility"`
 
-	// Tags that should be set on the created light stemcell.
+	// Tags that should be set on the created light stemcell: its AMIs and snapshots, and the volumes and
+	// S3 objects it is created from. Values are Go templates of TagValues, e.g. "{{.Version}}".
 	Tags map[string]string `json:"tags,omitempty"`
 
 	// SharedWithAccounts allows to provide a list of AWS account IDs.
@@ -68,6 +77,99 @@ type AmiConfiguration struct {
 	SharedWithAccounts []string `json:"shared_with_accounts"`
 }
 
+// AmiOverrides replaces the fields of an AmiConfiguration that are set in it, so that a
+// region or a copy destination can publish with a different visibility, encryption, KMS key,
+// sharing list or tags. Fields that are left out keep the value they inherit.
+type AmiOverrides struct {
+	AmiName            *string            `json:"name,omitempty"`
+	Description        *string            `json:"description,omitempty"`
+	VirtualizationType *string            `json:"virtualization_type,omitempty"`
+	Efi                *bool              `json:"efi,omitempty"`
+	Architecture       *string            `json:"architecture,omitempty"`
+	Encrypted          *bool              `json:"encrypted,omitempty"`
+	KmsKeyId           *string            `json:"kms_key_id,omitempty"`
+	KmsKeyAliasName    *string            `json:"kms_key_alias_name,omitempty"`
+	Visibility         *string            `json:"visibility,omitempty"`
+	Tags               *map[string]string `json:"tags,omitempty"`
+	SharedWithAccounts *[]string          `json:"shared_with_accounts,omitempty"`
+}
+
+// Apply returns a with the overrides applied. A nil *AmiOverrides returns a unchanged.
+func (o *AmiOverrides) Apply(a AmiConfiguration) AmiConfiguration {
+	if o == nil {
+		return a
+	}
+
+	if o.AmiName != nil {
+		a.AmiName = *o.AmiName
+	}
+	if o.Description != nil {
+		a.Description = *o.Description
+	}
+	if o.VirtualizationType != nil {
+		a.VirtualizationType = *o.VirtualizationType
+	}
+	if o.Efi != nil {
+		a.Efi = *o.Efi
+	}
+	if o.Architecture != nil {
+		a.Architecture = *o.Architecture
+	}
+	if o.Encrypted != nil {
+		a.Encrypted = *o.Encrypted
+	}
+	if o.KmsKeyId != nil {
+		a.KmsKeyId = *o.KmsKeyId
+	}
+	if o.KmsKeyAliasName != nil {
+		a.KmsKeyAliasName = *o.KmsKeyAliasName
+	}
+	if o.Visibility != nil {
+		a.Visibility = *o.Visibility
+	}
+	if o.Tags != nil {
+		a.Tags = *o.Tags
+	}
+	if o.SharedWithAccounts != nil {
+		a.SharedWithAccounts = *o.SharedWithAccounts
+	}
+
+	return a
+}
+
+// Destination is a region that the AMI of an ami_regions entry is copied to. It is given
+// either as the name of the region or as an object with the name, AMI overrides and the
+// credentials of the account the copy is published in.
+type Destination struct {
+	RegionName string `json:"name"`
+
+	// Credentials allows to publish the copy in another AWS account. The source AMI is shared
+	// with that account and copied from inside it.
+	Credentials *Credentials `json:"credentials,omitempty"`
+
+	// RoleArn is a role assumed for the copy, with Credentials if they are given and with the
+	// credentials of the source region otherwise.
+	RoleArn string `json:"role_arn,omitempty"`
+
+	// EndpointBase overrides the AWS endpoint domain of the destination region, see AmiRegion.EndpointBase.
+	EndpointBase string `json:"endpoint_base,omitempty"`
+
+	// AmiConfiguration overrides the AMI configuration of the source region for this copy.
+	// The architecture, virtualization_type, efi and kms_key_alias_name of a copy cannot differ from its source.
+	AmiConfiguration *AmiOverrides `json:"ami_configuration,omitempty"`
+}
+
+func (d *Destination) UnmarshalJSON(b []byte) error {
+	var regionName string
+	if json.Unmarshal(b, &regionName) == nil {
+		*d = Destination{RegionName: regionName}
+		return nil
+	}
+
+	type destination Destination
+	return json.Unmarshal(b, (*destination)(d))
+}
+
 type AmiRegion struct {
 	// RegionName allows to configures the region where a stemcell should be produced.
 	RegionName string `json:"name"`
@@ -81,7 +183,18 @@ type AmiRegion struct {
 	ServerSideEncryption string `json:"server_side_encryption"`
 
 	// Destinations allows to configure multiple regions where produced stemcells should be copied to.
-	Destinations []string `json:"destinations"`
+	Destinations []Destination `json:"destinations"`
+
+	// AmiConfiguration overrides the global ami_configuration for this region and its copy destinations.
+	AmiConfiguration *AmiOverrides `json:"ami_configuration,omitempty"`
+
+	// SnapshotMethod selects how the machine image becomes a snapshot: 'import' (default) uploads it to
+	// BucketName and imports it with VM Import, 'ebs-direct' writes it with the EBS direct APIs and needs
+	// neither a bucket nor the vmimport role. ebs-direct only supports RAW images in standard regions.
+	SnapshotMethod string `json:"snapshot_method,omitempty"`
+
+	// Isolated marks the region as isolated, see Partition.Isolated. It defaults to the isolation of the partition of the region.
+	Isolated *bool `json:"isolated,omitempty"`
 
 	IsolatedRegion bool `json:"-"`
 
@@ -89,15 +202,81 @@ type AmiRegion struct {
 	// that use a non-standard domain (e.g. "amazonaws.eu" for EUSC regions).
 	// Service endpoints are constructed as https://<service>.<region>.<endpoint_base>
 	EndpointBase string `json:"endpoint_base"`
+
+	// Endpoint allows to send every AWS API call for this region to a single URL,
+	// e.g. a local stand-in such as the fakeaws test server. It takes precedence over EndpointBase.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// DestinationNames returns the names of the regions the AMI is copied to
+func (r *AmiRegion) DestinationNames() []string {
+	var names []string
+	for _, destination := range r.Destinations {
+		names = append(names, destination.RegionName)
+	}
+	return names
 }
 
 type Credentials struct {
+	// Source selects where the base credentials come from: 'static' keys, the AWS SDK 'default_chain',
+	// a 'profile' of the shared config files, a 'web_identity' token or the EC2 instance role ('imds').
+	// It defaults to 'static' when both keys are given and to 'imds' otherwise.
+	Source string `json:"source,omitempty"`
+
 	AccessKey    string `json:"access_key"`
 	SecretKey    string `json:"secret_key"`
 	SessionToken string `json:"session_token"`
-	RoleArn      string `json:"role_arn"`
+
+	// Profile is the profile of source 'profile', AWS_PROFILE or 'default' when empty.
+	Profile string `json:"profile,omitempty"`
+
+	// WebIdentityTokenFile and WebIdentityRoleArn configure source 'web_identity'. They default to
+	// AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN.
+	WebIdentityTokenFile string `json:"web_identity_token_file,omitempty"`
+	WebIdentityRoleArn   string `json:"web_identity_role_arn,omitempty"`
+
+	// RoleArn is a role assumed with the base credentials, with an optional external ID, session name and duration.
+	RoleArn             string `json:"role_arn"`
+	ExternalID          string `json:"external_id,omitempty"`
+	RoleSessionName     string `json:"role_session_name,omitempty"`
+	RoleDurationSeconds int    `json:"role_duration_seconds,omitempty"`
+
+	// RoleChain lists roles that are assumed in order after RoleArn, each with the credentials of the previous one.
+	RoleChain []AssumedRole `json:"role_chain,omitempty"`
+
 	Region       string `json:"-"`
 	EndpointBase string `json:"-"`
+	Endpoint     string `json:"-"`
+
+	// Destinations holds the credentials of the copy destinations that configure their own
+	// credentials, role_arn or endpoint_base, by region name.
+	Destinations map[string]Credentials `json:"-"`
+}
+
+// ForRegion returns the credentials for calling AWS in another region. The endpoint_base
+// only applies to the region it is configured for.
+func (configCredentials Credentials) ForRegion(region string) Credentials {
+	regionCredentials := configCredentials
+	regionCredentials.Region = region
+	regionCredentials.Destinations = nil
+	if region != configCredentials.Region {
+		regionCredentials.EndpointBase = ""
+	}
+	return regionCredentials
+}
+
+// ForDestination returns the credentials for publishing a copy in the destination region
+func (configCredentials Credentials) ForDestination(region string) Credentials {
+	if destinationCredentials, ok := configCredentials.Destinations[region]; ok {
+		return destinationCredentials
+	}
+	return configCredentials.ForRegion(region)
+}
+
+// HasDestinationCredentials reports whether copies to region use credentials of their own
+func (configCredentials Credentials) HasDestinationCredentials(region string) bool {
+	_, ok := configCredentials.Destinations[region]
+	return ok
 }
 
 type Config struct {
@@ -108,6 +287,37 @@ type Config struct {
 	// AmiRegion allows to configure region specific properties.
 	// For example the region where a light stemcell should be produced or where it should be copied to.
 	AmiRegions []AmiRegion `json:"ami_regions"`
+
+	// Upload tunes the multipart upload of the machine image to S3
+	Upload UploadConfiguration `json:"upload"`
+}
+
+// Limits of S3 multipart uploads
+const (
+	MinUploadPartSizeMB = 5
+	MaxUploadPartSizeMB = 5 * 1024
+
+	DefaultUploadProgressIntervalSeconds = 30
+)
+
+type UploadConfiguration struct {
+	// PartSizeMB is the size of each part in MiB. Defaults to the size the AWS SDK picks.
+	PartSizeMB int64 `json:"part_size_mb,omitempty"`
+
+	// Concurrency is the number of parts of an upload that are sent in parallel. Defaults to the AWS SDK default.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// MaxMBPerSecond caps the combined rate of all uploads in MiB per second. Defaults to no limit.
+	MaxMBPerSecond float64 `json:"max_mb_per_second,omitempty"`
+
+	// ProgressIntervalSeconds is the interval of progress reports during an upload
+	ProgressIntervalSeconds int `json:"progress_interval_seconds,omitempty"`
+
+	// VerifySnapshotSize fails a publish when a snapshot is not the size of the volume of the machine image
+	VerifySnapshotSize bool `json:"verify_snapshot_size,omitempty"`
+
+	// KeepUploadedImage leaves the uploaded machine image in the bucket, so later runs can reuse it
+	KeepUploadedImage bool `json:"keep_uploaded_image,omitempty"`
 }
 
 func NewFromReader(r io.Reader) (Config, error) {
@@ -138,11 +348,31 @@ func NewFromReader(r io.Reader) (Config, error) {
 		c.AmiConfiguration.Visibility = PublicVisibility
 	}
 
+	if c.Upload.ProgressIntervalSeconds == 0 {
+		c.Upload.ProgressIntervalSeconds = DefaultUploadProgressIntervalSeconds
+	}
+
 	for i := range c.AmiRegions {
 		region := &c.AmiRegions[i]
 		region.Credentials.Region = region.RegionName
 		region.Credentials.EndpointBase = region.EndpointBase
-		region.IsolatedRegion = isolated[region.RegionName]
+		region.Credentials.Endpoint = region.Endpoint
+		region.IsolatedRegion = PartitionForRegion(region.RegionName).Isolated
+		if region.Isolated != nil {
+			region.IsolatedRegion = *region.Isolated
+		}
+		for _, destination := range region.Destinations {
+			if destination.Credentials == nil && destination.RoleArn == "" && destination.EndpointBase == "" {
+				continue
+			}
+			if region.Credentials.Destinations == nil {
+				region.Credentials.Destinations = map[string]Credentials{}
+			}
+			region.Credentials.Destinations[destination.RegionName] = destination.credentials(region.Credentials)
+		}
+		if region.SnapshotMethod == "" {
+			region.SnapshotMethod = ImportSnapshotMethod
+		}
 	}
 
 	err = c.validate()
@@ -153,38 +383,170 @@ func NewFromReader(r io.Reader) (Config, error) {
 	return c, nil
 }
 
+// RegionAmiConfiguration returns the AMI configuration of a region, with its overrides applied to the global one
+func (config *Config) RegionAmiConfiguration(r AmiRegion) AmiConfiguration {
+	return r.AmiConfiguration.Apply(config.AmiConfiguration)
+}
+
+// Secrets returns the keys, session tokens and external IDs of the credentials of every region, so that
+// they can be kept out of the log
+func (config *Config) Secrets() []string {
+	var secrets []string
+	for i := range config.AmiRegions {
+		secrets = append(secrets, config.AmiRegions[i].Credentials.secrets()...)
+	}
+	return secrets
+}
+
 func (config *Config) validate() error {
-	if config.AmiConfiguration.Description == "" {
+	err := config.AmiConfiguration.validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.Upload.validate()
+	if err != nil {
+		return fmt.Errorf("upload: %s", err)
+	}
+
+	regions := config.AmiRegions
+	if len(regions) == 0 {
+		return errors.New("ami_regions must be specified")
+	}
+
+	for i := range regions {
+		err := regions[i].validate()
+		if err != nil {
+			return err
+		}
+
+		regionAmiConfig := config.RegionAmiConfiguration(regions[i])
+		err = regionAmiConfig.validate()
+		if err != nil {
+			return fmt.Errorf("ami_configuration of %s: %s", regions[i].RegionName, err)
+		}
+
+		err = validateArnPartition("kms_key_id", regionAmiConfig.KmsKeyId, regions[i].RegionName)
+		if err != nil {
+			return fmt.Errorf("ami_configuration of %s: %s", regions[i].RegionName, err)
+		}
+
+		for _, destination := range regions[i].Destinations {
+			err = destination.validate(regionAmiConfig)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (u *UploadConfiguration) validate() error {
+	if u.PartSizeMB != 0 && (u.PartSizeMB < MinUploadPartSizeMB || u.PartSizeMB > MaxUploadPartSizeMB) {
+		return fmt.Errorf("part_size_mb must be between %d and %d", MinUploadPartSizeMB, MaxUploadPartSizeMB)
+	}
+
+	if u.Concurrency < 0 {
+		return errors.New("concurrency must not be negative")
+	}
+
+	if u.MaxMBPerSecond < 0 {
+		return errors.New("max_mb_per_second must not be negative")
+	}
+
+	if u.ProgressIntervalSeconds < 0 {
+		return errors.New("progress_interval_seconds must not be negative")
+	}
+
+	return nil
+}
+
+func (a *AmiConfiguration) validate() error {
+	if a.Description == "" {
 		return errors.New("description must be specified for ami_configuration")
 	}
 
 	validVirtualization := map[string]bool{
 		HardwareAssistedVirtualization: true,
 	}
-	if !validVirtualization[config.AmiConfiguration.VirtualizationType] {
+	if !validVirtualization[a.VirtualizationType] {
 		return errors.New("virtualization_type must be one of: ['hvm']")
 	}
 
+	validArchitecture := map[string]bool{
+		"":                true,
+		X86Architecture:   true,
+		Arm64Architecture: true,
+	}
+	if !validArchitecture[a.Architecture] {
+		return errors.New("architecture must be one of: ['x86_64', 'arm64']")
+	}
+
 	validVisibility := map[string]bool{
 		PublicVisibility:  true,
 		PrivateVisibility: true,
 	}
-	if !validVisibility[config.AmiConfiguration.Visibility] {
+	if !validVisibility[a.Visibility] {
 		return errors.New("visibility must be one of: ['public', 'private']")
 	}
 
-	regions := config.AmiRegions
-	if len(regions) == 0 {
-		return errors.New("ami_regions must be specified")
+	err := validateTags(a.Tags)
+	if err != nil {
+		return fmt.Errorf("tags: %s", err)
 	}
 
-	for i := range regions {
-		err := regions[i].validate()
+	return nil
+}
+
+// credentials returns the credentials of the destination, starting from those of its source region
+func (d *Destination) credentials(sourceCredentials Credentials) Credentials {
+	destinationCredentials := sourceCredentials.ForRegion(d.RegionName)
+	if d.Credentials != nil {
+		ownCredentials := *d.Credentials
+		ownCredentials.Region = destinationCredentials.Region
+		ownCredentials.Endpoint = destinationCredentials.Endpoint
+		destinationCredentials = ownCredentials
+	}
+	if d.RoleArn != "" {
+		destinationCredentials.RoleArn = d.RoleArn
+	}
+	destinationCredentials.EndpointBase = d.EndpointBase
+	return destinationCredentials
+}
+
+func (d *Destination) validate(sourceAmiConfig AmiConfiguration) error {
+	if d.Credentials != nil {
+		if (d.Credentials.AccessKey == "") != (d.Credentials.SecretKey == "") {
+			return fmt.Errorf("credentials of copy destination %s: access_key and secret_key must be specified together", d.RegionName)
+		}
+
+		err := d.Credentials.validate()
 		if err != nil {
-			return err
+			return fmt.Errorf("credentials of copy destination %s: %s", d.RegionName, err)
 		}
 	}
 
+	if d.AmiConfiguration == nil {
+		return nil
+	}
+
+	o := d.AmiConfiguration
+	if o.Architecture != nil || o.VirtualizationType != nil || o.Efi != nil || o.KmsKeyAliasName != nil {
+		return fmt.Errorf("ami_configuration of copy destination %s: architecture, virtualization_type, efi and kms_key_alias_name cannot be overridden for a copy", d.RegionName)
+	}
+
+	destinationAmiConfig := o.Apply(sourceAmiConfig)
+	err := destinationAmiConfig.validate()
+	if err != nil {
+		return fmt.Errorf("ami_configuration of copy destination %s: %s", d.RegionName, err)
+	}
+
+	err = validateArnPartition("kms_key_id", destinationAmiConfig.KmsKeyId, d.RegionName)
+	if err != nil {
+		return fmt.Errorf("ami_configuration of copy destination %s: %s", d.RegionName, err)
+	}
+
 	return nil
 }
 
@@ -193,7 +555,19 @@ func (r *AmiRegion) validate() error {
 		return errors.New("name must be specified for ami_regions entries")
 	}
 
-	if r.BucketName == "" {
+	validSnapshotMethod := map[string]bool{
+		ImportSnapshotMethod:    true,
+		EbsDirectSnapshotMethod: true,
+	}
+	if !validSnapshotMethod[r.SnapshotMethod] {
+		return errors.New("snapshot_method must be one of: ['import', 'ebs-direct']")
+	}
+
+	if r.SnapshotMethod == EbsDirectSnapshotMethod && r.IsolatedRegion {
+		return fmt.Errorf("%s is an isolated region and does not support snapshot_method ebs-direct", r.RegionName)
+	}
+
+	if r.BucketName == "" && r.SnapshotMethod != EbsDirectSnapshotMethod {
 		return errors.New("bucket_name must be specified for ami_regions entries")
 	}
 
@@ -201,52 +575,56 @@ func (r *AmiRegion) validate() error {
 		return errors.New("region must be specified for credentials")
 	}
 
-	for _, destinationRegion := range r.Destinations {
-		if isolated[destinationRegion] {
+	err := r.Credentials.validate()
+	if err != nil {
+		return fmt.Errorf("credentials of %s: %s", r.RegionName, err)
+	}
+
+	if r.IsolatedRegion && len(r.Destinations) != 0 {
+		return fmt.Errorf("%s is an isolated region and cannot specify copy destinations", r.RegionName)
+	}
+
+	for _, destination := range r.Destinations {
+		destinationRegion := destination.RegionName
+		if destinationRegion == "" {
+			return errors.New("name must be specified for destinations entries")
+		}
+
+		if PartitionForRegion(destinationRegion).Isolated {
 			return fmt.Errorf("%s is an isolated region and cannot be specified as a copy destination", destinationRegion)
 		}
 
+		sourcePartition, destinationPartition := PartitionForRegion(r.RegionName), PartitionForRegion(destinationRegion)
+		if sourcePartition != destinationPartition {
+			return fmt.Errorf("%s is in partition %s and cannot be a copy destination of %s in partition %s", destinationRegion, destinationPartition.ID, r.RegionName, sourcePartition.ID)
+		}
+
 		if r.RegionName == destinationRegion {
 			return fmt.Errorf("%s specified as both a source and a copy destination", destinationRegion)
 		}
 	}
 
-	if isolated[r.RegionName] && len(r.Destinations) != 0 {
-		return fmt.Errorf("%s is an isolated region and cannot specify copy destinations", r.RegionName)
-	}
-
 	return nil
 }
 
 // GetAwsConfig builds an aws.Config from the Credentials.
 func (configCredentials *Credentials) GetAwsConfig() aws.Config {
-	var credProvider aws.CredentialsProvider
-
-	if configCredentials.AccessKey != "" && configCredentials.SecretKey != "" {
-		credProvider = credentials.NewStaticCredentialsProvider(
-			configCredentials.AccessKey,
-			configCredentials.SecretKey,
-			configCredentials.SessionToken,
-		)
-	} else {
-		imdsClient := imds.New(imds.Options{})
-		credProvider = aws.NewCredentialsCache(ec2rolecreds.New(func(o *ec2rolecreds.Options) {
-			o.Client = imdsClient
-		}))
-	}
-
 	cfg := aws.Config{
-		Region:      configCredentials.Region,
-		Credentials: credProvider,
-	}
-
-	if configCredentials.RoleArn != "" {
-		stsClient := sts.NewFromConfig(cfg)
-		roleProvider := stscreds.NewAssumeRoleProvider(stsClient, configCredentials.RoleArn)
-		cfg.Credentials = aws.NewCredentialsCache(roleProvider)
+		Region: configCredentials.Region,
 	}
 
-	if configCredentials.EndpointBase != "" {
+	if configCredentials.Endpoint != "" {
+		endpoint := configCredentials.Endpoint
+		cfg.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc( //nolint:staticcheck
+			func(service, reg string, options ...interface{}) (aws.Endpoint, error) { //nolint:staticcheck
+				return aws.Endpoint{ //nolint:staticcheck
+					URL:               endpoint,
+					SigningRegion:     reg,
+					HostnameImmutable: true,
+				}, nil
+			},
+		)
+	} else if configCredentials.EndpointBase != "" {
 		endpointBase := configCredentials.EndpointBase
 		region := configCredentials.Region
 		cfg.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc( //nolint:staticcheck
@@ -262,5 +640,17 @@ func (configCredentials *Credentials) GetAwsConfig() aws.Config {
 		)
 	}
 
+	tracing.ConfigureSDK(&cfg)
+
+	// The credentials are resolved after the endpoints are set up so STS is called on them as well.
+	// A credentials configuration that cannot be resolved fails the first AWS call.
+	credProvider, err := configCredentials.credentialsProvider(cfg)
+	if err != nil {
+		credProvider = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{}, fmt.Errorf("resolving credentials: %s", err)
+		})
+	}
+	cfg.Credentials = credProvider
+
 	return cfg
 }
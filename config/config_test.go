@@ -84,6 +84,13 @@ var _ = Describe("Config", func() {
 				Expect(err).To(MatchError("virtualization_type must be one of: ['hvm']"))
 			})
 
+			It("returns an error when 'architecture' is not valid", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiConfiguration.Architecture = "i386"
+				})
+				Expect(err).To(MatchError("architecture must be one of: ['x86_64', 'arm64']"))
+			})
+
 			It("returns an error when 'visibility' is not valid", func() {
 				_, err := parseConfig(baseJSON, func(c *config.Config) {
 					c.AmiConfiguration.Visibility = "bogus"
@@ -115,7 +122,7 @@ var _ = Describe("Config", func() {
 			It("returns an error", func() {
 				_, err := parseConfig(baseJSON, func(c *config.Config) {
 					c.AmiRegions[0].RegionName = "us-east-1"
-					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, "us-east-1")
+					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, config.Destination{RegionName: "us-east-1"})
 				})
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(MatchError("us-east-1 specified as both a source and a copy destination"))
@@ -131,6 +138,38 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Context("when a 'snapshot_method' is given for a region", func() {
+			It("defaults to import", func() {
+				c, err := parseConfig(baseJSON, identityModifier)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.AmiRegions[0].SnapshotMethod).To(Equal(config.ImportSnapshotMethod))
+			})
+
+			It("returns an error when the method is not valid", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].SnapshotMethod = "foo"
+				})
+				Expect(err).To(MatchError("snapshot_method must be one of: ['import', 'ebs-direct']"))
+			})
+
+			It("does not require a 'bucket_name' for ebs-direct", func() {
+				c, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].BucketName = ""
+					c.AmiRegions[0].SnapshotMethod = config.EbsDirectSnapshotMethod
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.AmiRegions[0].SnapshotMethod).To(Equal(config.EbsDirectSnapshotMethod))
+			})
+
+			It("returns an error for ebs-direct in an isolated region", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].RegionName = "cn-north-1"
+					c.AmiRegions[0].SnapshotMethod = config.EbsDirectSnapshotMethod
+				})
+				Expect(err).To(MatchError("cn-north-1 is an isolated region and does not support snapshot_method ebs-direct"))
+			})
+		})
+
 		Context("when given a standard region", func() {
 			It("sets IsolatedRegion to false", func() {
 				standardRegions := []string{"us-east-1", "eu-central-1", "ap-northeast-1"}
@@ -158,19 +197,370 @@ var _ = Describe("Config", func() {
 
 			It("returns an error if an isolated region is specified in copy destinations", func() {
 				_, err := parseConfig(baseJSON, func(c *config.Config) {
-					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, "cn-north-1")
+					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, config.Destination{RegionName: "cn-north-1"})
 				})
 				Expect(err).To(MatchError("cn-north-1 is an isolated region and cannot be specified as a copy destination"))
 			})
 
+			It("treats every region of the China partition as isolated", func() {
+				c, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].RegionName = "cn-northwest-1"
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.AmiRegions[0].IsolatedRegion).To(BeTrue())
+			})
+
+			It("lets the config mark a region as isolated or not", func() {
+				c, err := parseConfig(baseJSON, func(c *config.Config) {
+					isolated, notIsolated := true, false
+					c.AmiRegions[0].RegionName = "cn-northwest-1"
+					c.AmiRegions[0].Isolated = &notIsolated
+					c.AmiRegions = append(c.AmiRegions, config.AmiRegion{
+						RegionName:  "us-gov-west-1",
+						BucketName:  "gov-bucket",
+						Isolated:    &isolated,
+						Credentials: c.AmiRegions[0].Credentials,
+					})
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.AmiRegions[0].IsolatedRegion).To(BeFalse())
+				Expect(c.AmiRegions[1].IsolatedRegion).To(BeTrue())
+			})
+
 			It("returns an error if copy destinations are specified for an isolated region", func() {
 				_, err := parseConfig(baseJSON, func(c *config.Config) {
 					c.AmiRegions[0].RegionName = "cn-north-1"
-					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, "anything")
+					c.AmiRegions[0].Destinations = append(c.AmiRegions[0].Destinations, config.Destination{RegionName: "anything"})
 				})
 				Expect(err).To(MatchError("cn-north-1 is an isolated region and cannot specify copy destinations"))
 			})
 		})
+
+		Context("when regions are in different partitions", func() {
+			It("returns an error if a copy destination is in another partition", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].RegionName = "us-gov-west-1"
+					c.AmiRegions[0].Destinations = []config.Destination{{RegionName: "us-gov-east-1"}, {RegionName: "us-east-1"}}
+				})
+				Expect(err).To(MatchError("us-east-1 is in partition aws and cannot be a copy destination of us-gov-west-1 in partition aws-us-gov"))
+			})
+
+			It("returns an error if the kms_key_id is an ARN of another partition", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].RegionName = "eusc-de-east-1"
+					c.AmiConfiguration.KmsKeyId = "arn:aws:kms:eusc-de-east-1:123456789012:key/key-id"
+				})
+				Expect(err).To(MatchError("ami_configuration of eusc-de-east-1: kms_key_id arn:aws:kms:eusc-de-east-1:123456789012:key/key-id is in partition aws, but eusc-de-east-1 is in partition aws-eusc"))
+			})
+
+			It("accepts a kms_key_id in the partition of the region", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].RegionName = "eusc-de-east-1"
+					c.AmiConfiguration.KmsKeyId = "arn:aws-eusc:kms:eusc-de-east-1:123456789012:key/key-id"
+				})
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+		Context("when a region overrides the 'ami_configuration'", func() {
+			overridesJSON := `
+    {
+      "ami_configuration": {
+        "description": "Example AMI",
+        "shared_with_accounts": ["111111111111"],
+        "tags": {"team": "bosh"}
+      },
+      "ami_regions": [
+        {
+          "name": "eu-central-1",
+          "bucket_name": "ami-bucket",
+          "ami_configuration": {
+            "visibility": "private",
+            "encrypted": true,
+            "kms_key_id": "arn:aws:kms:eu-central-1:123456789012:key/region-key",
+            "shared_with_accounts": []
+          },
+          "destinations": [
+            "eu-west-1",
+            {
+              "name": "eu-north-1",
+              "ami_configuration": {
+                "shared_with_accounts": ["222222222222"],
+                "tags": {"team": "other"}
+              }
+            }
+          ]
+        }
+      ]
+    }
+  `
+
+			It("applies the overrides of the region to the global configuration", func() {
+				c, err := config.NewFromReader(bytes.NewBufferString(overridesJSON))
+				Expect(err).ToNot(HaveOccurred())
+
+				regionAmiConfig := c.RegionAmiConfiguration(c.AmiRegions[0])
+				Expect(regionAmiConfig.Description).To(Equal("Example AMI"))
+				Expect(regionAmiConfig.Visibility).To(Equal(config.PrivateVisibility))
+				Expect(regionAmiConfig.Encrypted).To(BeTrue())
+				Expect(regionAmiConfig.KmsKeyId).To(Equal("arn:aws:kms:eu-central-1:123456789012:key/region-key"))
+				Expect(regionAmiConfig.SharedWithAccounts).To(BeEmpty())
+				Expect(regionAmiConfig.Tags).To(Equal(map[string]string{"team": "bosh"}))
+
+				Expect(c.AmiConfiguration.Visibility).To(Equal(config.PublicVisibility))
+				Expect(c.AmiConfiguration.SharedWithAccounts).To(Equal([]string{"111111111111"}))
+			})
+
+			It("reads destinations given by name and with overrides", func() {
+				c, err := config.NewFromReader(bytes.NewBufferString(overridesJSON))
+				Expect(err).ToNot(HaveOccurred())
+
+				destinations := c.AmiRegions[0].Destinations
+				Expect(c.AmiRegions[0].DestinationNames()).To(Equal([]string{"eu-west-1", "eu-north-1"}))
+				Expect(destinations[0].AmiConfiguration).To(BeNil())
+
+				destinationAmiConfig := destinations[1].AmiConfiguration.Apply(c.RegionAmiConfiguration(c.AmiRegions[0]))
+				Expect(destinationAmiConfig.Visibility).To(Equal(config.PrivateVisibility))
+				Expect(destinationAmiConfig.SharedWithAccounts).To(Equal([]string{"222222222222"}))
+				Expect(destinationAmiConfig.Tags).To(Equal(map[string]string{"team": "other"}))
+			})
+
+			It("returns an error when the merged configuration is not valid", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					visibility := "foo"
+					c.AmiRegions[0].AmiConfiguration = &config.AmiOverrides{Visibility: &visibility}
+				})
+				Expect(err).To(MatchError("ami_configuration of ami-region: visibility must be one of: ['public', 'private']"))
+			})
+
+			It("returns an error when a destination overrides a property of the source AMI", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					architecture := config.Arm64Architecture
+					c.AmiRegions[0].Destinations = []config.Destination{
+						{RegionName: "us-west-1", AmiConfiguration: &config.AmiOverrides{Architecture: &architecture}},
+					}
+				})
+				Expect(err).To(MatchError(ContainSubstring("ami_configuration of copy destination us-west-1: architecture, virtualization_type, efi and kms_key_alias_name cannot be overridden")))
+			})
+
+			It("returns an error when a destination has no name", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].Destinations = []config.Destination{{AmiConfiguration: &config.AmiOverrides{}}}
+				})
+				Expect(err).To(MatchError("name must be specified for destinations entries"))
+			})
+		})
+
+		Context("when destinations are published in other accounts", func() {
+			accountsJSON := `
+    {
+      "ami_configuration": {
+        "description": "Example AMI"
+      },
+      "ami_regions": [
+        {
+          "name": "eu-central-1",
+          "bucket_name": "ami-bucket",
+          "endpoint": "http://127.0.0.1:8080",
+          "credentials": {
+            "access_key": "access-key",
+            "secret_key": "secret-key",
+            "session_token": "session-token"
+          },
+          "destinations": [
+            "eu-west-1",
+            {
+              "name": "eu-north-1",
+              "credentials": {
+                "access_key": "other-access-key",
+                "secret_key": "other-secret-key"
+              }
+            },
+            {
+              "name": "eu-west-3",
+              "role_arn": "arn:aws:iam::222222222222:role/publisher",
+              "endpoint_base": "amazonaws.com"
+            }
+          ]
+        }
+      ]
+    }
+  `
+
+			It("builds the credentials of each destination that configures its own", func() {
+				c, err := config.NewFromReader(bytes.NewBufferString(accountsJSON))
+				Expect(err).ToNot(HaveOccurred())
+
+				regionCreds := c.AmiRegions[0].Credentials
+				Expect(regionCreds.Destinations).To(HaveLen(2))
+				Expect(regionCreds.HasDestinationCredentials("eu-west-1")).To(BeFalse())
+
+				Expect(regionCreds.ForDestination("eu-north-1")).To(Equal(config.Credentials{
+					AccessKey: "other-access-key",
+					SecretKey: "other-secret-key",
+					Region:    "eu-north-1",
+					Endpoint:  "http://127.0.0.1:8080",
+				}))
+				Expect(regionCreds.ForDestination("eu-west-3")).To(Equal(config.Credentials{
+					AccessKey:    "access-key",
+					SecretKey:    "secret-key",
+					SessionToken: "session-token",
+					RoleArn:      "arn:aws:iam::222222222222:role/publisher",
+					Region:       "eu-west-3",
+					EndpointBase: "amazonaws.com",
+					Endpoint:     "http://127.0.0.1:8080",
+				}))
+			})
+
+			It("returns the secrets of the credentials of the regions and their destinations", func() {
+				c, err := config.NewFromReader(bytes.NewBufferString(accountsJSON))
+				Expect(err).ToNot(HaveOccurred())
+
+				secrets := c.Secrets()
+				Expect(secrets).To(ContainElements("access-key", "secret-key", "session-token", "other-access-key", "other-secret-key"))
+				Expect(secrets).ToNot(ContainElement("arn:aws:iam::222222222222:role/publisher"))
+			})
+
+			It("returns an error when the credentials of a destination have no secret_key", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].Destinations = []config.Destination{
+						{RegionName: "us-west-1", Credentials: &config.Credentials{AccessKey: "other-access-key"}},
+					}
+				})
+				Expect(err).To(MatchError("credentials of copy destination us-west-1: access_key and secret_key must be specified together"))
+			})
+		})
+
+		Context("when 'upload' settings are given", func() {
+			It("defaults the progress interval", func() {
+				c, err := parseConfig(baseJSON, identityModifier)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.Upload).To(Equal(config.UploadConfiguration{ProgressIntervalSeconds: config.DefaultUploadProgressIntervalSeconds}))
+			})
+
+			It("keeps the given settings", func() {
+				c, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.Upload = config.UploadConfiguration{PartSizeMB: 64, Concurrency: 8, MaxMBPerSecond: 12.5, ProgressIntervalSeconds: 5, VerifySnapshotSize: true, KeepUploadedImage: true}
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.Upload).To(Equal(config.UploadConfiguration{PartSizeMB: 64, Concurrency: 8, MaxMBPerSecond: 12.5, ProgressIntervalSeconds: 5, VerifySnapshotSize: true, KeepUploadedImage: true}))
+			})
+
+			It("returns an error when the part size is outside of the S3 limits", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.Upload.PartSizeMB = 4
+				})
+				Expect(err).To(MatchError("upload: part_size_mb must be between 5 and 5120"))
+			})
+
+			It("returns an error when the concurrency is negative", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.Upload.Concurrency = -1
+				})
+				Expect(err).To(MatchError("upload: concurrency must not be negative"))
+			})
+
+			It("returns an error when the bandwidth cap is negative", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.Upload.MaxMBPerSecond = -1
+				})
+				Expect(err).To(MatchError("upload: max_mb_per_second must not be negative"))
+			})
+		})
+
+		Context("when 'tags' are given", func() {
+			It("returns an error when a tag value is not a valid template", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiConfiguration.Tags = map[string]string{"build": "{{.Version"}
+				})
+				Expect(err).To(MatchError(ContainSubstring("tags: parsing value of tag build: ")))
+			})
+
+			It("returns an error when a tag value refers to an unknown value", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					tags := map[string]string{"build": "{{.Build}}"}
+					c.AmiRegions[0].AmiConfiguration = &config.AmiOverrides{Tags: &tags}
+				})
+				Expect(err).To(MatchError(ContainSubstring("ami_configuration of ami-region: tags: rendering value of tag build: ")))
+			})
+
+			It("returns an error when a tag key is reserved for AWS", func() {
+				_, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiConfiguration.Tags = map[string]string{"aws:team": "bosh"}
+				})
+				Expect(err).To(MatchError("tags: tag aws:team: keys starting with 'aws:' are reserved for AWS"))
+			})
+		})
+
+		Context("when an 'endpoint' is given for a region", func() {
+			It("passes the endpoint to the region credentials", func() {
+				c, err := parseConfig(baseJSON, func(c *config.Config) {
+					c.AmiRegions[0].Endpoint = "http://127.0.0.1:8080"
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.AmiRegions[0].Credentials.Endpoint).To(Equal("http://127.0.0.1:8080"))
+			})
+		})
+	})
+
+	Describe("RenderTags", func() {
+		tagsJSON := `
+    {
+      "ami_configuration": {
+        "description": "Example AMI",
+        "tags": {"build-url": "https://ci.example.com/{{.Distro}}/{{.Version}}", "version": "v{{.Version}}"}
+      },
+      "ami_regions": [
+        {
+          "name": "eu-central-1",
+          "bucket_name": "ami-bucket",
+          "ami_configuration": {
+            "tags": {"line": "{{.Name}}-{{.Architecture}}"}
+          },
+          "destinations": [
+            {"name": "eu-north-1", "ami_configuration": {"tags": {"team": "other"}}}
+          ]
+        },
+        {
+          "name": "us-east-1",
+          "bucket_name": "ami-bucket"
+        }
+      ]
+    }
+  `
+		values := config.TagValues{Name: "bosh-aws-xen-hvm-ubuntu-jammy-go_agent", Version: "1.2", Distro: "ubuntu-jammy", Architecture: "x86_64"}
+		defaults := map[string]string{"distro": "ubuntu-jammy", "version": "1.2"}
+
+		It("renders the tags of the configuration, the regions and the destinations and adds the defaults", func() {
+			c, err := config.NewFromReader(bytes.NewBufferString(tagsJSON))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(c.RenderTags(values, defaults)).To(Succeed())
+
+			Expect(c.RegionAmiConfiguration(c.AmiRegions[1]).Tags).To(Equal(map[string]string{
+				"build-url": "https://ci.example.com/ubuntu-jammy/1.2",
+				"distro":    "ubuntu-jammy",
+				"version":   "v1.2",
+			}))
+
+			regionAmiConfig := c.RegionAmiConfiguration(c.AmiRegions[0])
+			Expect(regionAmiConfig.Tags).To(Equal(map[string]string{
+				"line":    "bosh-aws-xen-hvm-ubuntu-jammy-go_agent-x86_64",
+				"distro":  "ubuntu-jammy",
+				"version": "1.2",
+			}))
+
+			destinationAmiConfig := c.AmiRegions[0].Destinations[0].AmiConfiguration.Apply(regionAmiConfig)
+			Expect(destinationAmiConfig.Tags).To(Equal(map[string]string{"team": "other", "distro": "ubuntu-jammy", "version": "1.2"}))
+		})
+
+		It("sets the defaults when no tags are configured", func() {
+			c, err := parseConfig(baseJSON, identityModifier)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(c.RenderTags(values, defaults)).To(Succeed())
+			Expect(c.AmiConfiguration.Tags).To(Equal(defaults))
+		})
 	})
 
 	Describe("GetAwsConfig", func() {
@@ -391,5 +781,52 @@ var _ = Describe("Config", func() {
 				Expect(ep.URL).To(Equal("https://ec2.us-east-1.amazonaws.eu"))
 			})
 		})
+
+		Context("when endpoint is set", func() {
+			It("resolves every service and region to the endpoint", func() {
+				creds := config.Credentials{
+					AccessKey:    keyID,
+					SecretKey:    keyValue,
+					Region:       "us-east-1",
+					Endpoint:     "http://127.0.0.1:8080",
+					EndpointBase: "amazonaws.eu",
+				}
+
+				awsCfg := creds.GetAwsConfig()
+
+				for _, service := range []string{"ec2", "s3", "kms"} {
+					for _, reg := range []string{"us-east-1", "us-west-2"} {
+						ep, err := awsCfg.EndpointResolverWithOptions.ResolveEndpoint(service, reg) //nolint:staticcheck
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ep.URL).To(Equal("http://127.0.0.1:8080"))
+						Expect(ep.SigningRegion).To(Equal(reg))
+						Expect(ep.HostnameImmutable).To(BeTrue())
+					}
+				}
+			})
+		})
+	})
+
+	Describe("ForDestination", func() {
+		creds := config.Credentials{
+			AccessKey:    "access-key",
+			SecretKey:    "secret-key",
+			SessionToken: "session-token",
+			RoleArn:      "arn:aws:iam::123456789012:role/TestRole",
+			Region:       "eusc-de-east-1",
+			EndpointBase: "amazonaws.eu",
+		}
+
+		It("keeps the session token and role of the source region for destinations without credentials", func() {
+			destinationCreds := creds.ForDestination("eusc-de-west-1")
+			Expect(destinationCreds.SessionToken).To(Equal("session-token"))
+			Expect(destinationCreds.RoleArn).To(Equal("arn:aws:iam::123456789012:role/TestRole"))
+			Expect(destinationCreds.Region).To(Equal("eusc-de-west-1"))
+		})
+
+		It("only keeps the endpoint_base for the region it is configured for", func() {
+			Expect(creds.ForRegion("eusc-de-east-1").EndpointBase).To(Equal("amazonaws.eu"))
+			Expect(creds.ForDestination("us-east-1").EndpointBase).To(BeEmpty())
+		})
 	})
 })
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Sources of the base credentials, before any role is assumed
+const (
+	StaticCredentialsSource       = "static"
+	DefaultChainCredentialsSource = "default_chain"
+	ProfileCredentialsSource      = "profile"
+	WebIdentityCredentialsSource  = "web_identity"
+	ImdsCredentialsSource         = "imds"
+)
+
+// AssumedRole is a role assumed with the credentials of the previous step of a role chain
+type AssumedRole struct {
+	RoleArn             string `json:"role_arn"`
+	ExternalID          string `json:"external_id,omitempty"`
+	RoleSessionName     string `json:"role_session_name,omitempty"`
+	RoleDurationSeconds int    `json:"role_duration_seconds,omitempty"`
+}
+
+func (r AssumedRole) validate() error {
+	if r.RoleArn == "" {
+		return errors.New("role_arn must be specified for role_chain entries")
+	}
+
+	if r.RoleDurationSeconds != 0 && (r.RoleDurationSeconds < 900 || r.RoleDurationSeconds > 43200) {
+		return fmt.Errorf("role_duration_seconds of %s must be between 900 and 43200", r.RoleArn)
+	}
+
+	return nil
+}
+
+// source returns the configured source, defaulting to static credentials when both keys are
+// given and to the EC2 instance role otherwise
+func (configCredentials *Credentials) source() string {
+	if configCredentials.Source != "" {
+		return configCredentials.Source
+	}
+
+	if configCredentials.AccessKey != "" && configCredentials.SecretKey != "" {
+		return StaticCredentialsSource
+	}
+	return ImdsCredentialsSource
+}
+
+// roles returns the roles assumed on top of the base credentials, in order
+func (configCredentials *Credentials) roles() []AssumedRole {
+	var roles []AssumedRole
+	if configCredentials.RoleArn != "" {
+		roles = append(roles, AssumedRole{
+			RoleArn:             configCredentials.RoleArn,
+			ExternalID:          configCredentials.ExternalID,
+			RoleSessionName:     configCredentials.RoleSessionName,
+			RoleDurationSeconds: configCredentials.RoleDurationSeconds,
+		})
+	}
+	return append(roles, configCredentials.RoleChain...)
+}
+
+// secrets returns the keys, session token and external IDs of the credentials and of the credentials of
+// their copy destinations
+func (configCredentials *Credentials) secrets() []string {
+	secrets := []string{configCredentials.AccessKey, configCredentials.SecretKey, configCredentials.SessionToken}
+	for _, role := range configCredentials.roles() {
+		secrets = append(secrets, role.ExternalID)
+	}
+	for _, destinationCredentials := range configCredentials.Destinations {
+		secrets = append(secrets, destinationCredentials.secrets()...)
+	}
+	return secrets
+}
+
+func (configCredentials *Credentials) validate() error {
+	validSource := map[string]bool{
+		StaticCredentialsSource:       true,
+		DefaultChainCredentialsSource: true,
+		ProfileCredentialsSource:      true,
+		WebIdentityCredentialsSource:  true,
+		ImdsCredentialsSource:         true,
+	}
+	if !validSource[configCredentials.source()] {
+		return errors.New("source must be one of: ['static', 'default_chain', 'profile', 'web_identity', 'imds']")
+	}
+
+	hasKeys := configCredentials.AccessKey != "" || configCredentials.SecretKey != ""
+	if configCredentials.Source == StaticCredentialsSource && (configCredentials.AccessKey == "" || configCredentials.SecretKey == "") {
+		return errors.New("access_key and secret_key must be specified for source 'static'")
+	}
+	if configCredentials.Source != "" && configCredentials.Source != StaticCredentialsSource && hasKeys {
+		return fmt.Errorf("access_key and secret_key cannot be specified for source '%s'", configCredentials.Source)
+	}
+
+	if configCredentials.Profile != "" && configCredentials.source() != ProfileCredentialsSource {
+		return errors.New("profile can only be specified for source 'profile'")
+	}
+
+	webIdentity := configCredentials.WebIdentityTokenFile != "" || configCredentials.WebIdentityRoleArn != ""
+	if webIdentity && configCredentials.source() != WebIdentityCredentialsSource {
+		return errors.New("web_identity_token_file and web_identity_role_arn can only be specified for source 'web_identity'")
+	}
+
+	for _, role := range configCredentials.roles() {
+		err := role.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// credentialsProvider returns the provider of the base credentials, followed by the role chain.
+// cfg carries the region and endpoints that STS is called on.
+func (configCredentials *Credentials) credentialsProvider(cfg aws.Config) (aws.CredentialsProvider, error) {
+	var provider aws.CredentialsProvider
+	var err error
+
+	switch configCredentials.source() {
+	case StaticCredentialsSource:
+		provider = credentials.NewStaticCredentialsProvider(
+			configCredentials.AccessKey,
+			configCredentials.SecretKey,
+			configCredentials.SessionToken,
+		)
+	case ImdsCredentialsSource:
+		provider = imdsProvider()
+	case WebIdentityCredentialsSource:
+		roleArn := firstNonEmpty(configCredentials.WebIdentityRoleArn, os.Getenv("AWS_ROLE_ARN"))
+		tokenFile := firstNonEmpty(configCredentials.WebIdentityTokenFile, os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+		if roleArn == "" || tokenFile == "" {
+			return nil, errors.New("source 'web_identity' needs web_identity_role_arn and web_identity_token_file, or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+		provider, err = webIdentityProvider(cfg, roleArn, tokenFile)
+	case ProfileCredentialsSource:
+		profile := firstNonEmpty(configCredentials.Profile, os.Getenv("AWS_PROFILE"), "default")
+		provider, err = defaultChainProvider(cfg, awsconfig.WithSharedConfigProfile(profile))
+	case DefaultChainCredentialsSource:
+		provider, err = defaultChainProvider(cfg)
+	default:
+		err = fmt.Errorf("unknown credentials source '%s'", configCredentials.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range configCredentials.roles() {
+		provider = assumeRoleProvider(cfg, provider, role)
+	}
+
+	return provider, nil
+}
+
+// defaultChainProvider returns the credentials the AWS SDK resolves from the environment, the shared
+// config files (including SSO, credential_process and source_profile), web identity, ECS container
+// credentials and the EC2 instance role. optFns select e.g. a profile of the shared config files.
+func defaultChainProvider(cfg aws.Config, optFns ...func(*awsconfig.LoadOptions) error) (aws.CredentialsProvider, error) {
+	loadedCfg, err := loadDefaultConfig(cfg, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadedCfg.Credentials, nil
+}
+
+// loadDefaultConfig loads the AWS SDK default configuration, with the region, endpoints and middleware
+// of cfg so the STS and SSO calls of the credential providers use them as well
+func loadDefaultConfig(cfg aws.Config, optFns ...func(*awsconfig.LoadOptions) error) (aws.Config, error) {
+	loadOptions := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(cfg.Region),
+		awsconfig.WithAPIOptions(cfg.APIOptions),
+	}
+	if cfg.EndpointResolverWithOptions != nil { //nolint:staticcheck
+		loadOptions = append(loadOptions, awsconfig.WithEndpointResolverWithOptions(cfg.EndpointResolverWithOptions)) //nolint:staticcheck
+	}
+
+	loadedCfg, err := awsconfig.LoadDefaultConfig(context.Background(), append(loadOptions, optFns...)...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("loading AWS SDK config: %s", err)
+	}
+	return loadedCfg, nil
+}
+
+func imdsProvider() aws.CredentialsProvider {
+	imdsClient := imds.New(imds.Options{})
+	return aws.NewCredentialsCache(ec2rolecreds.New(func(o *ec2rolecreds.Options) {
+		o.Client = imdsClient
+	}))
+}
+
+// webIdentityProvider exchanges the token of tokenFile for the credentials of roleArn. The AWS SDK
+// only reads the token file of web identity from AWS_WEB_IDENTITY_TOKEN_FILE or a profile, so the
+// provider is built on the STS client of the loaded SDK config.
+func webIdentityProvider(cfg aws.Config, roleArn string, tokenFile string) (aws.CredentialsProvider, error) {
+	loadedCfg, err := loadDefaultConfig(cfg, awsconfig.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(loadedCfg), roleArn, stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+		o.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+	})
+	return aws.NewCredentialsCache(provider), nil
+}
+
+func assumeRoleProvider(cfg aws.Config, sourceProvider aws.CredentialsProvider, role AssumedRole) aws.CredentialsProvider {
+	stsCfg := cfg.Copy()
+	stsCfg.Credentials = sourceProvider
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(stsCfg), role.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+		if role.RoleSessionName != "" {
+			o.RoleSessionName = role.RoleSessionName
+		}
+		if role.RoleDurationSeconds != 0 {
+			o.Duration = time.Duration(role.RoleDurationSeconds) * time.Second
+		}
+	})
+	return aws.NewCredentialsCache(provider)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,327 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"light-stemcell-builder/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// stsCall is a request received by stubSTS, with the access key that signed it
+type stsCall struct {
+	accessKey string
+	form      url.Values
+}
+
+// stubSTS answers AssumeRole and AssumeRoleWithWebIdentity, and the GetRoleCredentials of SSO, with
+// numbered temporary credentials
+type stubSTS struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls []stsCall
+}
+
+func newStubSTS() *stubSTS {
+	stub := &stubSTS{}
+	stub.Server = httptest.NewServer(stub)
+	return stub
+}
+
+func (stub *stubSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	Expect(err).ToNot(HaveOccurred())
+
+	accessKey := ""
+	authorization := r.Header.Get("Authorization")
+	if i := strings.Index(authorization, "Credential="); i >= 0 {
+		accessKey = strings.SplitN(authorization[i+len("Credential="):], "/", 2)[0]
+	}
+
+	stub.mu.Lock()
+	stub.calls = append(stub.calls, stsCall{accessKey: accessKey, form: r.Form})
+	temporaryKey := fmt.Sprintf("ASIA-STUB-%d", len(stub.calls))
+	stub.mu.Unlock()
+
+	if r.URL.Path == "/federation/credentials" {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"roleCredentials": {"accessKeyId": "%s", "secretAccessKey": "secret", "sessionToken": "token", "expiration": 4102444800000}}`, temporaryKey) //nolint:errcheck
+		return
+	}
+
+	action := r.Form.Get("Action")
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><%[1]sResult>
+<Credentials><AccessKeyId>%[2]s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration></Credentials>
+<AssumedRoleUser><Arn>%[3]s/session</Arn><AssumedRoleId>AROA:session</AssumedRoleId></AssumedRoleUser>
+</%[1]sResult></%[1]sResponse>`, action, temporaryKey, r.Form.Get("RoleArn")) //nolint:errcheck
+}
+
+func (stub *stubSTS) received() []stsCall {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	return append([]stsCall(nil), stub.calls...)
+}
+
+// setenv sets an environment variable for the current spec
+func setenv(key, value string) {
+	previous, ok := os.LookupEnv(key)
+	os.Setenv(key, value) //nolint:errcheck
+	DeferCleanup(func() {
+		if ok {
+			os.Setenv(key, previous) //nolint:errcheck
+		} else {
+			os.Unsetenv(key) //nolint:errcheck
+		}
+	})
+}
+
+var _ = Describe("Credentials", func() {
+	var stub *stubSTS
+	var tempDir string
+
+	BeforeEach(func() {
+		stub = newStubSTS()
+		DeferCleanup(stub.Close)
+
+		tempDir = GinkgoT().TempDir()
+		setenv("AWS_CONFIG_FILE", filepath.Join(tempDir, "config"))
+		setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(tempDir, "credentials"))
+	})
+
+	retrieve := func(creds config.Credentials) (string, error) {
+		creds.Region = "us-east-1"
+		creds.Endpoint = stub.URL
+
+		awsCfg := creds.GetAwsConfig()
+		v, err := awsCfg.Credentials.Retrieve(context.Background())
+		return v.AccessKeyID, err
+	}
+
+	Context("with a role chain", func() {
+		It("assumes each role with the credentials of the previous one", func() {
+			accessKey, err := retrieve(config.Credentials{
+				AccessKey:           "base-key",
+				SecretKey:           "base-secret",
+				RoleArn:             "arn:aws:iam::111111111111:role/first",
+				ExternalID:          "external-id",
+				RoleSessionName:     "publisher",
+				RoleDurationSeconds: 1800,
+				RoleChain: []config.AssumedRole{
+					{RoleArn: "arn:aws:iam::222222222222:role/second"},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("ASIA-STUB-2"))
+
+			calls := stub.received()
+			Expect(calls).To(HaveLen(2))
+
+			Expect(calls[0].accessKey).To(Equal("base-key"))
+			Expect(calls[0].form.Get("Action")).To(Equal("AssumeRole"))
+			Expect(calls[0].form.Get("RoleArn")).To(Equal("arn:aws:iam::111111111111:role/first"))
+			Expect(calls[0].form.Get("ExternalId")).To(Equal("external-id"))
+			Expect(calls[0].form.Get("RoleSessionName")).To(Equal("publisher"))
+			Expect(calls[0].form.Get("DurationSeconds")).To(Equal("1800"))
+
+			Expect(calls[1].accessKey).To(Equal("ASIA-STUB-1"))
+			Expect(calls[1].form.Get("RoleArn")).To(Equal("arn:aws:iam::222222222222:role/second"))
+			Expect(calls[1].form.Get("ExternalId")).To(BeEmpty())
+		})
+	})
+
+	Context("with source 'web_identity'", func() {
+		It("exchanges the token of the file for the role", func() {
+			tokenFile := filepath.Join(tempDir, "token")
+			Expect(os.WriteFile(tokenFile, []byte("web-identity-token"), 0600)).To(Succeed())
+
+			accessKey, err := retrieve(config.Credentials{
+				Source:               config.WebIdentityCredentialsSource,
+				WebIdentityTokenFile: tokenFile,
+				WebIdentityRoleArn:   "arn:aws:iam::111111111111:role/web",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("ASIA-STUB-1"))
+
+			calls := stub.received()
+			Expect(calls).To(HaveLen(1))
+			Expect(calls[0].form.Get("Action")).To(Equal("AssumeRoleWithWebIdentity"))
+			Expect(calls[0].form.Get("RoleArn")).To(Equal("arn:aws:iam::111111111111:role/web"))
+			Expect(calls[0].form.Get("WebIdentityToken")).To(Equal("web-identity-token"))
+		})
+
+		It("fails without a token file", func() {
+			setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+
+			_, err := retrieve(config.Credentials{
+				Source:             config.WebIdentityCredentialsSource,
+				WebIdentityRoleArn: "arn:aws:iam::111111111111:role/web",
+			})
+			Expect(err).To(MatchError(ContainSubstring("source 'web_identity' needs web_identity_role_arn and web_identity_token_file")))
+		})
+	})
+
+	Context("with source 'profile'", func() {
+		BeforeEach(func() {
+			Expect(os.WriteFile(filepath.Join(tempDir, "credentials"), []byte(`
+[base]
+aws_access_key_id = base-key
+aws_secret_access_key = base-secret
+`), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(tempDir, "config"), []byte(`
+[default]
+region = us-east-1
+
+[profile publisher]
+role_arn = arn:aws:iam::111111111111:role/publisher
+source_profile = base
+external_id = profile-external-id
+s3 =
+  max_concurrent_requests = 10
+
+[profile sso]
+sso_session = company
+sso_account_id = 111111111111
+sso_role_name = publisher
+
+[sso-session company]
+sso_start_url = https://company.awsapps.com/start
+sso_region = us-east-1
+`), 0600)).To(Succeed())
+		})
+
+		It("reads the keys of the profile", func() {
+			accessKey, err := retrieve(config.Credentials{Source: config.ProfileCredentialsSource, Profile: "base"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("base-key"))
+			Expect(stub.received()).To(BeEmpty())
+		})
+
+		It("assumes the role of the profile with the credentials of its source_profile", func() {
+			accessKey, err := retrieve(config.Credentials{Source: config.ProfileCredentialsSource, Profile: "publisher"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("ASIA-STUB-1"))
+
+			calls := stub.received()
+			Expect(calls).To(HaveLen(1))
+			Expect(calls[0].accessKey).To(Equal("base-key"))
+			Expect(calls[0].form.Get("RoleArn")).To(Equal("arn:aws:iam::111111111111:role/publisher"))
+			Expect(calls[0].form.Get("ExternalId")).To(Equal("profile-external-id"))
+		})
+
+		It("defaults to AWS_PROFILE", func() {
+			setenv("AWS_PROFILE", "base")
+
+			accessKey, err := retrieve(config.Credentials{Source: config.ProfileCredentialsSource})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("base-key"))
+		})
+
+		It("exchanges the cached SSO token of an SSO profile for the role credentials", func() {
+			setenv("HOME", tempDir)
+			cacheDir := filepath.Join(tempDir, ".aws", "sso", "cache")
+			Expect(os.MkdirAll(cacheDir, 0700)).To(Succeed())
+			cacheKey := sha1.Sum([]byte("company"))
+			Expect(os.WriteFile(filepath.Join(cacheDir, hex.EncodeToString(cacheKey[:])+".json"), []byte(`{
+  "accessToken": "sso-access-token",
+  "expiresAt": "2100-01-01T00:00:00Z",
+  "region": "us-east-1",
+  "startUrl": "https://company.awsapps.com/start"
+}`), 0600)).To(Succeed())
+
+			accessKey, err := retrieve(config.Credentials{Source: config.ProfileCredentialsSource, Profile: "sso"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("ASIA-STUB-1"))
+
+			calls := stub.received()
+			Expect(calls).To(HaveLen(1))
+			Expect(calls[0].form.Get("account_id")).To(Equal("111111111111"))
+			Expect(calls[0].form.Get("role_name")).To(Equal("publisher"))
+		})
+
+		It("fails for a missing profile", func() {
+			_, err := retrieve(config.Credentials{Source: config.ProfileCredentialsSource, Profile: "missing"})
+			Expect(err).To(MatchError(ContainSubstring("failed to get shared config profile, missing")))
+		})
+	})
+
+	Context("with source 'default_chain'", func() {
+		It("prefers the keys of the environment", func() {
+			setenv("AWS_ACCESS_KEY_ID", "env-key")
+			setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+			accessKey, err := retrieve(config.Credentials{Source: config.DefaultChainCredentialsSource})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("env-key"))
+		})
+
+		It("uses the AWS_PROFILE profile without keys in the environment", func() {
+			setenv("AWS_ACCESS_KEY_ID", "")
+			setenv("AWS_SECRET_ACCESS_KEY", "")
+			setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+			setenv("AWS_PROFILE", "base")
+			Expect(os.WriteFile(filepath.Join(tempDir, "credentials"), []byte("[base]\naws_access_key_id = base-key\naws_secret_access_key = base-secret\n"), 0600)).To(Succeed())
+
+			accessKey, err := retrieve(config.Credentials{Source: config.DefaultChainCredentialsSource})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessKey).To(Equal("base-key"))
+		})
+	})
+
+	Describe("validation", func() {
+		parse := func(credentialsJSON string) error {
+			_, err := config.NewFromReader(bytes.NewBufferString(fmt.Sprintf(`{
+  "ami_configuration": {"description": "Example AMI"},
+  "ami_regions": [{"name": "ami-region", "bucket_name": "ami-bucket", "credentials": %s}]
+}`, credentialsJSON)))
+			return err
+		}
+
+		It("accepts every source", func() {
+			Expect(parse(`{"source": "static", "access_key": "a", "secret_key": "s"}`)).To(Succeed())
+			Expect(parse(`{"source": "default_chain"}`)).To(Succeed())
+			Expect(parse(`{"source": "profile", "profile": "publisher"}`)).To(Succeed())
+			Expect(parse(`{"source": "web_identity", "web_identity_token_file": "/token"}`)).To(Succeed())
+			Expect(parse(`{"source": "imds", "role_arn": "arn:aws:iam::111111111111:role/publisher"}`)).To(Succeed())
+		})
+
+		It("returns an error for an unknown source", func() {
+			Expect(parse(`{"source": "sso"}`)).To(MatchError("credentials of ami-region: source must be one of: ['static', 'default_chain', 'profile', 'web_identity', 'imds']"))
+		})
+
+		It("returns an error when static credentials have no keys", func() {
+			Expect(parse(`{"source": "static"}`)).To(MatchError("credentials of ami-region: access_key and secret_key must be specified for source 'static'"))
+		})
+
+		It("returns an error when keys are given for another source", func() {
+			Expect(parse(`{"source": "default_chain", "access_key": "a", "secret_key": "s"}`)).To(MatchError("credentials of ami-region: access_key and secret_key cannot be specified for source 'default_chain'"))
+		})
+
+		It("returns an error when a profile is given for another source", func() {
+			Expect(parse(`{"source": "imds", "profile": "publisher"}`)).To(MatchError("credentials of ami-region: profile can only be specified for source 'profile'"))
+		})
+
+		It("returns an error for a role_chain entry without role_arn", func() {
+			Expect(parse(`{"role_chain": [{"external_id": "x"}]}`)).To(MatchError("credentials of ami-region: role_arn must be specified for role_chain entries"))
+		})
+
+		It("returns an error for a role duration out of range", func() {
+			Expect(parse(`{"role_arn": "arn:aws:iam::111111111111:role/publisher", "role_duration_seconds": 60}`)).To(MatchError("credentials of ami-region: role_duration_seconds of arn:aws:iam::111111111111:role/publisher must be between 900 and 43200"))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// Partition is a group of AWS regions that share accounts, ARNs and an endpoint domain
+type Partition struct {
+	// ID is the partition in ARNs, e.g. 'aws-cn' in arn:aws-cn:kms:cn-north-1:123456789012:key/...
+	ID        string
+	DNSSuffix string
+
+	// Isolated is set when the regions of the partition do not support importing snapshots from S3,
+	// so AMIs are built from imported volumes instead and cannot be copied to other regions.
+	Isolated bool
+}
+
+var (
+	StandardPartition = Partition{ID: "aws", DNSSuffix: "amazonaws.com"}
+	ChinaPartition    = Partition{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn", Isolated: true}
+	GovCloudPartition = Partition{ID: "aws-us-gov", DNSSuffix: "amazonaws.com"}
+	EuscPartition     = Partition{ID: "aws-eusc", DNSSuffix: "amazonaws.eu"}
+	IsoPartition      = Partition{ID: "aws-iso", DNSSuffix: "c2s.ic.gov"}
+	IsoBPartition     = Partition{ID: "aws-iso-b", DNSSuffix: "sc2s.sgov.gov"}
+	IsoEPartition     = Partition{ID: "aws-iso-e", DNSSuffix: "cloud.adc-e.uk"}
+	IsoFPartition     = Partition{ID: "aws-iso-f", DNSSuffix: "csp.hci.ic.gov"}
+)
+
+// partitionRegionPrefixes maps region name prefixes to their partition. Longer prefixes come first.
+var partitionRegionPrefixes = []struct {
+	prefix    string
+	partition Partition
+}{
+	{"us-gov-", GovCloudPartition},
+	{"us-isob-", IsoBPartition},
+	{"us-isof-", IsoFPartition},
+	{"us-iso-", IsoPartition},
+	{"eu-isoe-", IsoEPartition},
+	{"eusc-", EuscPartition},
+	{"cn-", ChinaPartition},
+}
+
+// PartitionForRegion returns the partition of a region, the standard partition for unknown regions
+func PartitionForRegion(region string) Partition {
+	for _, p := range partitionRegionPrefixes {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return StandardPartition
+}
+
+// Arn builds an ARN in the partition
+func (p Partition) Arn(service, region, accountID, resource string) string {
+	return arn.ARN{
+		Partition: p.ID,
+		Service:   service,
+		Region:    region,
+		AccountID: accountID,
+		Resource:  resource,
+	}.String()
+}
+
+// validateArnPartition checks that identifier, when it is an ARN, belongs to the partition of region
+func validateArnPartition(field string, identifier string, region string) error {
+	if !arn.IsARN(identifier) {
+		return nil
+	}
+
+	parsed, err := arn.Parse(identifier)
+	if err != nil {
+		return fmt.Errorf("%s: %s", field, err)
+	}
+
+	partition := PartitionForRegion(region)
+	if parsed.Partition != partition.ID {
+		return fmt.Errorf("%s %s is in partition %s, but %s is in partition %s", field, identifier, parsed.Partition, region, partition.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package config_test
+
+import (
+	"light-stemcell-builder/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Partition", func() {
+	DescribeTable("PartitionForRegion",
+		func(region string, id string, isolated bool) {
+			partition := config.PartitionForRegion(region)
+			Expect(partition.ID).To(Equal(id))
+			Expect(partition.Isolated).To(Equal(isolated))
+		},
+		Entry("a standard region", "eu-central-1", "aws", false),
+		Entry("a China region", "cn-north-1", "aws-cn", true),
+		Entry("another China region", "cn-northwest-1", "aws-cn", true),
+		Entry("a GovCloud region", "us-gov-west-1", "aws-us-gov", false),
+		Entry("an EUSC region", "eusc-de-east-1", "aws-eusc", false),
+		Entry("an ISO region", "us-iso-east-1", "aws-iso", false),
+		Entry("an ISO-B region", "us-isob-east-1", "aws-iso-b", false),
+		Entry("an ISO-E region", "eu-isoe-west-1", "aws-iso-e", false),
+		Entry("an ISO-F region", "us-isof-south-1", "aws-iso-f", false),
+	)
+
+	It("builds ARNs with the partition prefix", func() {
+		Expect(config.PartitionForRegion("cn-north-1").Arn("kms", "cn-north-1", "123456789012", "alias/light-stemcell-builder")).
+			To(Equal("arn:aws-cn:kms:cn-north-1:123456789012:alias/light-stemcell-builder"))
+	})
+})
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// TagValues are the values the tags of an ami_configuration can refer to as Go templates, e.g. "{{.Version}}"
+type TagValues struct {
+	// Name is the name of the stemcell
+	Name string
+	// Version is the version of the stemcell
+	Version string
+	// Distro is the operating system of the stemcell
+	Distro string
+	// Architecture is the architecture of the AMIs
+	Architecture string
+}
+
+// RenderTags renders the tags of the ami_configuration and of the overrides of the regions and copy destinations
+// with values, and adds the defaults that they do not configure.
+func (config *Config) RenderTags(values TagValues, defaults map[string]string) error {
+	tags, err := renderTags(config.AmiConfiguration.Tags, values, defaults)
+	if err != nil {
+		return fmt.Errorf("tags of ami_configuration: %s", err)
+	}
+	config.AmiConfiguration.Tags = tags
+
+	for i := range config.AmiRegions {
+		region := &config.AmiRegions[i]
+		err = region.AmiConfiguration.renderTags(values, defaults)
+		if err != nil {
+			return fmt.Errorf("tags of ami_configuration of %s: %s", region.RegionName, err)
+		}
+
+		for j := range region.Destinations {
+			err = region.Destinations[j].AmiConfiguration.renderTags(values, defaults)
+			if err != nil {
+				return fmt.Errorf("tags of ami_configuration of copy destination %s: %s", region.Destinations[j].RegionName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o *AmiOverrides) renderTags(values TagValues, defaults map[string]string) error {
+	if o == nil || o.Tags == nil {
+		return nil
+	}
+
+	tags, err := renderTags(*o.Tags, values, defaults)
+	if err != nil {
+		return err
+	}
+	o.Tags = &tags
+	return nil
+}
+
+func renderTags(tags map[string]string, values TagValues, defaults map[string]string) (map[string]string, error) {
+	rendered := make(map[string]string, len(tags)+len(defaults))
+	for key, value := range defaults {
+		rendered[key] = value
+	}
+
+	for key, value := range tags {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing value of tag %s: %s", key, err)
+		}
+
+		var b strings.Builder
+		err = tmpl.Execute(&b, values)
+		if err != nil {
+			return nil, fmt.Errorf("rendering value of tag %s: %s", key, err)
+		}
+		rendered[key] = b.String()
+	}
+
+	return rendered, nil
+}
+
+// validateTags checks that the tags are valid templates of TagValues
+func validateTags(tags map[string]string) error {
+	for key := range tags {
+		if key == "" {
+			return errors.New("tag keys must not be empty")
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return fmt.Errorf("tag %s: keys starting with 'aws:' are reserved for AWS", key)
+		}
+	}
+
+	_, err := renderTags(tags, TagValues{}, nil)
+	return err
+}
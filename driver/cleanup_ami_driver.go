@@ -0,0 +1,168 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var _ resources.AmiCleanupDriver = &SDKAmiCleanupDriver{}
+
+// SDKAmiCleanupDriver uses the AWS SDK to find and remove AMIs owned by the account
+type SDKAmiCleanupDriver struct {
+	creds  config.Credentials
+	logger *slog.Logger
+}
+
+// NewAmiCleanupDriver creates a SDKAmiCleanupDriver for removing stale AMIs in EC2
+func NewAmiCleanupDriver(logger *slog.Logger, creds config.Credentials) *SDKAmiCleanupDriver {
+	return &SDKAmiCleanupDriver{creds: creds, logger: logger.With(logging.Driver("SDKAmiCleanupDriver"))}
+}
+
+// Regions lists the regions that are enabled for the account
+func (d *SDKAmiCleanupDriver) Regions(ctx context.Context) ([]string, error) {
+	ec2Client := d.ec2Client(d.creds.Region)
+
+	output, err := ec2Client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("describing regions: %s", err)
+	}
+
+	var regions []string
+	for _, region := range output.Regions {
+		if region.RegionName != nil {
+			regions = append(regions, *region.RegionName)
+		}
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// FindAmis returns the AMIs owned by the account that match filter, oldest first
+func (d *SDKAmiCleanupDriver) FindAmis(ctx context.Context, filter resources.AmiFilter) ([]resources.AmiImage, error) {
+	ec2Client := d.ec2Client(filter.Region)
+
+	var filters []ec2types.Filter
+	if filter.NamePattern != "" {
+		filters = append(filters, ec2types.Filter{Name: aws.String("name"), Values: []string{filter.NamePattern}})
+	}
+	if filter.PublicOnly {
+		filters = append(filters, ec2types.Filter{Name: aws.String("is-public"), Values: []string{"true"}})
+	}
+	if filter.SnapshotID != "" {
+		filters = append(filters, ec2types.Filter{Name: aws.String("block-device-mapping.snapshot-id"), Values: []string{filter.SnapshotID}})
+	}
+	tagKeys := make([]string, 0, len(filter.Tags))
+	for key := range filter.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		filters = append(filters, ec2types.Filter{Name: aws.String("tag:" + key), Values: []string{filter.Tags[key]}})
+	}
+
+	var amis []resources.AmiImage
+	paginator := ec2.NewDescribeImagesPaginator(ec2Client, &ec2.DescribeImagesInput{
+		Owners:  []string{"self"},
+		Filters: filters,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing images in region %s: %s", filter.Region, err)
+		}
+
+		for _, image := range output.Images {
+			ami, err := amiImage(filter.Region, image)
+			if err != nil {
+				return nil, err
+			}
+			amis = append(amis, ami)
+		}
+	}
+
+	sort.SliceStable(amis, func(i, j int) bool {
+		return amis[i].CreationDate.Before(amis[j].CreationDate)
+	})
+
+	return amis, nil
+}
+
+// DeregisterAmi deregisters an AMI. The snapshots backing it are left in place.
+func (d *SDKAmiCleanupDriver) DeregisterAmi(ctx context.Context, ami resources.AmiImage) error {
+	ec2Client := d.ec2Client(ami.Region)
+
+	d.logger.InfoContext(ctx, "deregistering AMI", logging.AmiID(ami.ID), logging.Region(ami.Region))
+	_, err := ec2Client.DeregisterImage(ctx, &ec2.DeregisterImageInput{
+		ImageId: aws.String(ami.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("deregistering AMI %s: %s", ami.ID, err)
+	}
+
+	return nil
+}
+
+// DeleteSnapshot deletes a snapshot in region
+func (d *SDKAmiCleanupDriver) DeleteSnapshot(ctx context.Context, region string, snapshotID string) error {
+	ec2Client := d.ec2Client(region)
+
+	d.logger.InfoContext(ctx, "deleting snapshot", "snapshot_id", snapshotID, logging.Region(region))
+	_, err := ec2Client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{
+		SnapshotId: aws.String(snapshotID),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting snapshot %s: %s", snapshotID, err)
+	}
+
+	return nil
+}
+
+func (d *SDKAmiCleanupDriver) ec2Client(region string) *ec2.Client {
+	regionCreds := d.creds.ForDestination(region)
+	cfg := regionCreds.GetAwsConfig()
+	logging.ConfigureSDK(&cfg, d.logger.With(logging.Region(region)))
+
+	return ec2.NewFromConfig(cfg)
+}
+
+func amiImage(region string, image ec2types.Image) (resources.AmiImage, error) {
+	ami := resources.AmiImage{
+		ID:     aws.ToString(image.ImageId),
+		Region: region,
+		Name:   aws.ToString(image.Name),
+	}
+
+	if image.CreationDate != nil {
+		creationDate, err := time.Parse(time.RFC3339, *image.CreationDate)
+		if err != nil {
+			return resources.AmiImage{}, fmt.Errorf("parsing creation date of AMI %s: %s", ami.ID, err)
+		}
+		ami.CreationDate = creationDate
+	}
+
+	for _, tag := range image.Tags {
+		if aws.ToString(tag.Key) == "version" {
+			ami.Version = aws.ToString(tag.Value)
+		}
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+			ami.SnapshotIDs = append(ami.SnapshotIDs, *mapping.Ebs.SnapshotId)
+		}
+	}
+
+	return ami, nil
+}
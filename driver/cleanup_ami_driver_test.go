@@ -0,0 +1,79 @@
+package driver_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/driver"
+	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	uuid "github.com/satori/go.uuid"
+)
+
+var _ = Describe("AmiCleanupDriver", func() {
+	It("finds unpublished AMIs by their tags, deregisters them and deletes their snapshots", func() {
+		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+
+		snapshotOutput, err := ec2Client.CreateSnapshot(context.Background(), &ec2.CreateSnapshotInput{
+			VolumeId: aws.String(ebsVolumeID),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		snapshotID := *snapshotOutput.SnapshotId
+
+		err = ec2.NewSnapshotCompletedWaiter(ec2Client).Wait(context.Background(), &ec2.DescribeSnapshotsInput{
+			SnapshotIds: []string{snapshotID},
+		}, 30*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		distro := fmt.Sprintf("cleanup-test-%s", uuid.NewV4().String())
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
+		ami, err := ds.CreateAmiDriver().Create(context.Background(), resources.AmiDriverConfig{
+			SnapshotID: snapshotID,
+			AmiProperties: resources.AmiProperties{
+				Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+				VirtualizationType: resources.HvmAmiVirtualization,
+				Accessibility:      resources.PrivateAmiAccessibility,
+				Description:        "bosh cpi test ami",
+				Tags:               map[string]string{"distro": distro, "version": "1.0"},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		cleanupDriver := driver.NewAmiCleanupDriver(logger, creds)
+
+		regions, err := cleanupDriver.Regions(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(regions).To(ContainElement(creds.Region))
+
+		filter := resources.AmiFilter{
+			Region:      creds.Region,
+			NamePattern: "BOSH*",
+			Tags:        map[string]string{"published": "false", "distro": distro},
+		}
+		amis, err := cleanupDriver.FindAmis(context.Background(), filter)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(amis).To(HaveLen(1))
+		Expect(amis[0].ID).To(Equal(ami.ID))
+		Expect(amis[0].Region).To(Equal(creds.Region))
+		Expect(amis[0].Version).To(Equal("1.0"))
+		Expect(amis[0].SnapshotIDs).To(Equal([]string{snapshotID}))
+		Expect(amis[0].CreationDate).To(BeTemporally("~", time.Now(), time.Hour))
+
+		err = cleanupDriver.DeregisterAmi(context.Background(), amis[0])
+		Expect(err).ToNot(HaveOccurred())
+
+		err = cleanupDriver.DeleteSnapshot(context.Background(), creds.Region, snapshotID)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() ([]resources.AmiImage, error) {
+			return cleanupDriver.FindAmis(context.Background(), filter)
+		}, 10*time.Minute, 10*time.Second).Should(BeEmpty(), "Expected AMI %s to be deregistered", ami.ID)
+	})
+})
@@ -0,0 +1,15 @@
+package driver
+
+import (
+	"context"
+	"time"
+)
+
+// cleanupTimeout bounds the removal of what a driver created or granted for a step that is over
+const cleanupTimeout = 5 * time.Minute
+
+// cleanupContext returns a context for removing what a driver created or granted. It is not
+// cancelled along with ctx, so the removal still runs after an interrupt or a failed step.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
@@ -4,74 +4,119 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
+	"slices"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/metrics"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // SDKCopyAmiDriver uses the AWS SDK to register an AMI from an existing snapshot in EC2
 type SDKCopyAmiDriver struct {
 	creds  config.Credentials
-	logger *log.Logger
+	logger *slog.Logger
 }
 
 // NewCopyAmiDriver creates a SDKCopyAmiDriver for copying AMIs in EC2
-func NewCopyAmiDriver(logDest io.Writer, creds config.Credentials) *SDKCopyAmiDriver {
-	logger := log.New(logDest, "SDKCopyAmiDriver ", log.LstdFlags)
-	return &SDKCopyAmiDriver{creds: creds, logger: logger}
+func NewCopyAmiDriver(logger *slog.Logger, creds config.Credentials) *SDKCopyAmiDriver {
+	return &SDKCopyAmiDriver{creds: creds, logger: logger.With(logging.Driver("SDKCopyAmiDriver"), logging.Region(creds.Region))}
 }
 
 // Create creates an AMI, copied from a source AMI, and optionally makes the AMI publicly available
-func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resources.Ami, error) {
+func (d *SDKCopyAmiDriver) Create(ctx context.Context, driverConfig resources.AmiDriverConfig) (resources.Ami, error) {
 	srcRegion := d.creds.Region
 	dstRegion := driverConfig.DestinationRegion
 
-	destinationCreds := config.Credentials{
-		AccessKey: d.creds.AccessKey,
-		SecretKey: d.creds.SecretKey,
-		RoleArn:   d.creds.RoleArn,
-		Region:    dstRegion,
-	}
+	destinationCreds := d.creds.ForDestination(dstRegion)
 	cfg := destinationCreds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(d.logger)
+	logging.ConfigureSDK(&cfg, d.logger.With("destination_region", dstRegion))
 
 	ec2Client := ec2.NewFromConfig(cfg)
-	ctx := context.Background()
 
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	d.logger.Printf("copying AMI from source AMI: %s\n", driverConfig.ExistingAmiID)
-	input := &ec2.CopyImageInput{
-		Description:   &driverConfig.Description,
-		Name:          &driverConfig.Name,
-		SourceImageId: &driverConfig.ExistingAmiID,
-		SourceRegion:  &srcRegion,
-		Encrypted:     &driverConfig.Encrypted,
+	existingImage, err := findExistingAmi(ctx, ec2Client, driverConfig)
+	if err != nil {
+		return resources.Ami{}, err
 	}
-	if driverConfig.KmsKeyId != "" {
-		input.KmsKeyId = &driverConfig.KmsKey.ARN //nolint:staticcheck
+
+	if existingImage == nil && d.creds.HasDestinationCredentials(dstRegion) {
+		sourceCfg := d.creds.GetAwsConfig()
+		logging.ConfigureSDK(&sourceCfg, d.logger)
+
+		destinationAccount, err := d.otherAccount(ctx, sourceCfg, cfg)
+		if err != nil {
+			return resources.Ami{}, err
+		}
+
+		if destinationAccount != "" {
+			sourceEc2Client := ec2.NewFromConfig(sourceCfg)
+			share, err := d.shareSourceAmi(ctx, sourceEc2Client, driverConfig.ExistingAmiID, destinationAccount)
+			// an account the AMIs are shared with keeps its access to the source AMI
+			if slices.Contains(driverConfig.SharedWithAccounts, destinationAccount) {
+				d.logger.InfoContext(ctx, "keeping the share of source AMI with an account it is shared with", logging.AmiID(driverConfig.ExistingAmiID), "account", destinationAccount)
+			} else {
+				defer d.unshareSourceAmi(ctx, sourceEc2Client, share)
+			}
+			if err != nil {
+				return resources.Ami{}, err
+			}
+		}
 	}
-	output, err := ec2Client.CopyImage(ctx, input)
-	if err != nil {
-		return resources.Ami{}, fmt.Errorf("copying AMI: %s", err)
+
+	architecture := driverConfig.Architecture
+	if architecture == "" {
+		architecture = resources.AmiArchitecture
 	}
+	amiTags := stemcellTags(driverConfig.Tags,
+		ec2types.Tag{Key: aws.String("architecture"), Value: aws.String(architecture)},
+		ec2types.Tag{Key: aws.String("published"), Value: aws.String("false")},
+	)
 
-	amiIDptr := output.ImageId
-	if amiIDptr == nil {
-		return resources.Ami{}, errors.New("AMI id nil")
+	var amiIDptr *string
+	copyStartTime := time.Now()
+	if existingImage != nil {
+		amiIDptr = existingImage.ImageId
+		d.logger.InfoContext(ctx, "adopting existing AMI", logging.AmiID(*amiIDptr), "name", driverConfig.Name, "destination_region", dstRegion)
+	} else {
+		d.logger.InfoContext(ctx, "copying AMI from source AMI", "source_ami_id", driverConfig.ExistingAmiID, "destination_region", dstRegion)
+		input := &ec2.CopyImageInput{
+			Description:   &driverConfig.Description,
+			Name:          &driverConfig.Name,
+			SourceImageId: &driverConfig.ExistingAmiID,
+			SourceRegion:  &srcRegion,
+			Encrypted:     &driverConfig.Encrypted,
+			TagSpecifications: []ec2types.TagSpecification{
+				tagSpecification(ec2types.ResourceTypeImage, amiTags),
+				tagSpecification(ec2types.ResourceTypeSnapshot, stemcellTags(driverConfig.Tags)),
+			},
+		}
+		if driverConfig.KmsKeyId != "" {
+			input.KmsKeyId = &driverConfig.KmsKey.ARN //nolint:staticcheck
+		}
+		output, err := ec2Client.CopyImage(ctx, input)
+		if err != nil {
+			return resources.Ami{}, fmt.Errorf("copying AMI: %s", err)
+		}
+
+		amiIDptr = output.ImageId
+		if amiIDptr == nil {
+			return resources.Ami{}, errors.New("AMI id nil")
+		}
 	}
 
-	d.logger.Printf("waiting for AMI %s to be available in region %s\n", *amiIDptr, dstRegion)
+	d.logger.InfoContext(ctx, "waiting for AMI to be available", logging.AmiID(*amiIDptr), "destination_region", dstRegion)
 	imageAvailableWaiter := ec2.NewImageAvailableWaiter(ec2Client, func(o *ec2.ImageAvailableWaiterOptions) {
 		o.MinDelay = 15 * time.Second
 		o.MaxDelay = 15 * time.Second
@@ -83,22 +128,26 @@ func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resou
 		return resources.Ami{}, fmt.Errorf("waiting for AMI %s to be available: %s", *amiIDptr, err)
 	}
 
-	name := aws.String(driverConfig.Tags["distro"] + "-" + driverConfig.Tags["version"])
-	distro := aws.String(driverConfig.Tags["distro"])
-	version := aws.String(driverConfig.Tags["version"])
-	tags := &ec2.CreateTagsInput{
-		Resources: []string{*amiIDptr},
-		Tags: []ec2types.Tag{
-			{Key: aws.String("Name"), Value: name},
-			{Key: aws.String("distro"), Value: distro},
-			{Key: aws.String("version"), Value: version},
-			{Key: aws.String("published"), Value: aws.String("false")},
-		},
-	}
-	d.logger.Printf("tagging AMI: %s, with %v", *amiIDptr, tags)
-	_, err = ec2Client.CreateTags(ctx, tags)
-	if err != nil {
-		d.logger.Printf("Error tagging AMI: %s, Error: %s ", *amiIDptr, err.Error())
+	// an adopted AMI was not copied by this run
+	if existingImage == nil {
+		copyDuration := time.Since(copyStartTime)
+		d.logger.InfoContext(ctx, "copied AMI", logging.AmiID(*amiIDptr), "destination_region", dstRegion, "duration", copyDuration)
+		metrics.ObserveCopy(srcRegion, dstRegion, copyDuration)
+	}
+
+	// a copied AMI is tagged by CopyImage, an adopted one only gets the tags it is missing
+	if existingImage != nil {
+		tags := missingTags(existingImage, amiTags)
+		if len(tags) > 0 {
+			d.logger.InfoContext(ctx, "tagging AMI", logging.AmiID(*amiIDptr), "tags", formatTags(tags))
+			_, err = ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+				Resources: []string{*amiIDptr},
+				Tags:      tags,
+			})
+			if err != nil {
+				return resources.Ami{}, fmt.Errorf("tagging AMI %s: %s", *amiIDptr, err)
+			}
+		}
 	}
 
 	for _, account := range driverConfig.SharedWithAccounts {
@@ -117,7 +166,7 @@ func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resou
 	}
 
 	if driverConfig.Accessibility == resources.PublicAmiAccessibility {
-		d.logger.Printf("making AMI: %s public", *amiIDptr)
+		d.logger.InfoContext(ctx, "making AMI public", logging.AmiID(*amiIDptr))
 		_, err = ec2Client.ModifyImageAttribute(ctx, &ec2.ModifyImageAttributeInput{
 			ImageId: amiIDptr,
 			LaunchPermission: &ec2types.LaunchPermissionModifications{
@@ -167,28 +216,30 @@ func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resou
 			deviceMappings,
 		)
 
-		time.Sleep(5 * time.Second)
-		d.logger.Printf("waiting for snapshot to be available for AMI ID: %s...\n", *amiIDptr)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return resources.Ami{}, fmt.Errorf("waiting for snapshot of AMI %s: %s", *amiIDptr, ctx.Err())
+		}
+		d.logger.InfoContext(ctx, "waiting for snapshot to be available", logging.AmiID(*amiIDptr))
 	}
 
 	if snapshotIDptr == nil {
 		return resources.Ami{}, snapshotErr
 	}
 
-	d.logger.Printf("snapshot %s for image %s found\n", *snapshotIDptr, *amiIDptr)
+	d.logger.InfoContext(ctx, "snapshot of AMI found", "snapshot_id", *snapshotIDptr, logging.AmiID(*amiIDptr))
 	snapshotTags := &ec2.CreateTagsInput{
 		Resources: []string{*snapshotIDptr},
-		Tags: []ec2types.Tag{
-			{Key: aws.String("Name"), Value: amiIDptr},
-			{Key: aws.String("ami_id"), Value: amiIDptr},
-			{Key: aws.String("distro"), Value: distro},
-			{Key: aws.String("version"), Value: version},
-		},
-	}
-	d.logger.Printf("tagging Snapshot: %s, with %v", *snapshotIDptr, snapshotTags)
+		Tags: stemcellTags(driverConfig.Tags,
+			ec2types.Tag{Key: aws.String("Name"), Value: amiIDptr},
+			ec2types.Tag{Key: aws.String("ami_id"), Value: amiIDptr},
+		),
+	}
+	d.logger.InfoContext(ctx, "tagging snapshot", "snapshot_id", *snapshotIDptr, logging.AmiID(*amiIDptr), "tags", formatTags(snapshotTags.Tags))
 	_, err = ec2Client.CreateTags(ctx, snapshotTags)
 	if err != nil {
-		d.logger.Printf("Error tagging Snapshot: %s, Error: %s ", *snapshotIDptr, err.Error())
+		return resources.Ami{}, fmt.Errorf("tagging snapshot %s: %s", *snapshotIDptr, err)
 	}
 
 	for _, account := range driverConfig.SharedWithAccounts {
@@ -205,8 +256,9 @@ func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resou
 		}
 	}
 
+	ami := resources.Ami{ID: *amiIDptr, Region: dstRegion, Adopted: existingImage != nil}
 	if driverConfig.Encrypted {
-		return resources.Ami{ID: *amiIDptr, Region: dstRegion}, nil
+		return ami, nil
 	}
 
 	modifySnapshotAttributeInput := &ec2.ModifySnapshotAttributeInput{
@@ -220,7 +272,135 @@ func (d *SDKCopyAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resou
 		return resources.Ami{}, fmt.Errorf("making snapshot with id %s public: %v", *snapshotIDptr, err)
 	}
 
-	d.logger.Printf("snapshot %s is public\n", *snapshotIDptr)
+	d.logger.InfoContext(ctx, "snapshot is public", "snapshot_id", *snapshotIDptr)
+
+	return ami, nil
+}
 
-	return resources.Ami{ID: *amiIDptr, Region: dstRegion}, nil
+// otherAccount returns the account of the destination credentials if it is not the account of the source credentials
+func (d *SDKCopyAmiDriver) otherAccount(ctx context.Context, sourceCfg aws.Config, destinationCfg aws.Config) (string, error) {
+	sourceIdentity, err := sts.NewFromConfig(sourceCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("getting the account of the source region: %s", err)
+	}
+
+	destinationIdentity, err := sts.NewFromConfig(destinationCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("getting the account of the destination region: %s", err)
+	}
+
+	if aws.ToString(sourceIdentity.Account) == aws.ToString(destinationIdentity.Account) {
+		return "", nil
+	}
+	return aws.ToString(destinationIdentity.Account), nil
+}
+
+// sourceAmiShare is what shareSourceAmi granted account on the source AMI and its snapshots
+type sourceAmiShare struct {
+	amiID       string
+	account     string
+	image       bool
+	snapshotIDs []string
+}
+
+// shareSourceAmi lets account launch the source AMI and read its snapshots, which it needs to copy the AMI.
+// Permissions account had before are left out of the returned share, so that they are not revoked. The share
+// holds what was granted, even when granting the rest failed.
+func (d *SDKCopyAmiDriver) shareSourceAmi(ctx context.Context, ec2Client *ec2.Client, amiID string, account string) (sourceAmiShare, error) {
+	share := sourceAmiShare{amiID: amiID, account: account}
+
+	describeOutput, err := ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{amiID},
+	})
+	if err != nil {
+		return share, fmt.Errorf("describing source AMI %s: %s", amiID, err)
+	}
+	if len(describeOutput.Images) == 0 {
+		return share, fmt.Errorf("source AMI %s not found", amiID)
+	}
+
+	launchPermissionOutput, err := ec2Client.DescribeImageAttribute(ctx, &ec2.DescribeImageAttributeInput{
+		ImageId:   aws.String(amiID),
+		Attribute: ec2types.ImageAttributeNameLaunchPermission,
+	})
+	if err != nil {
+		return share, fmt.Errorf("describing launch permissions of source AMI %s: %s", amiID, err)
+	}
+	if slices.ContainsFunc(launchPermissionOutput.LaunchPermissions, func(p ec2types.LaunchPermission) bool { return aws.ToString(p.UserId) == account }) {
+		d.logger.InfoContext(ctx, "source AMI is already shared with the account", logging.AmiID(amiID), "account", account)
+	} else {
+		d.logger.InfoContext(ctx, "sharing source AMI for the copy", logging.AmiID(amiID), "account", account)
+		_, err = ec2Client.ModifyImageAttribute(ctx, &ec2.ModifyImageAttributeInput{
+			ImageId: aws.String(amiID),
+			LaunchPermission: &ec2types.LaunchPermissionModifications{
+				Add: []ec2types.LaunchPermission{{UserId: aws.String(account)}},
+			},
+		})
+		if err != nil {
+			return share, fmt.Errorf("sharing source AMI %s with account %s: %s", amiID, account, err)
+		}
+		share.image = true
+	}
+
+	for _, mapping := range describeOutput.Images[0].BlockDeviceMappings {
+		if mapping.Ebs == nil || mapping.Ebs.SnapshotId == nil {
+			continue
+		}
+
+		volumePermissionOutput, err := ec2Client.DescribeSnapshotAttribute(ctx, &ec2.DescribeSnapshotAttributeInput{
+			SnapshotId: mapping.Ebs.SnapshotId,
+			Attribute:  ec2types.SnapshotAttributeNameCreateVolumePermission,
+		})
+		if err != nil {
+			return share, fmt.Errorf("describing create volume permissions of snapshot %s: %s", *mapping.Ebs.SnapshotId, err)
+		}
+		if slices.ContainsFunc(volumePermissionOutput.CreateVolumePermissions, func(p ec2types.CreateVolumePermission) bool { return aws.ToString(p.UserId) == account }) {
+			continue
+		}
+
+		_, err = ec2Client.ModifySnapshotAttribute(ctx, &ec2.ModifySnapshotAttributeInput{
+			SnapshotId:    mapping.Ebs.SnapshotId,
+			Attribute:     ec2types.SnapshotAttributeNameCreateVolumePermission,
+			OperationType: ec2types.OperationTypeAdd,
+			UserIds:       []string{account},
+		})
+		if err != nil {
+			return share, fmt.Errorf("sharing snapshot %s of source AMI %s with account %s: %s", *mapping.Ebs.SnapshotId, amiID, account, err)
+		}
+		share.snapshotIDs = append(share.snapshotIDs, *mapping.Ebs.SnapshotId)
+	}
+
+	return share, nil
+}
+
+// unshareSourceAmi revokes the permissions granted by shareSourceAmi. It also runs once ctx is cancelled, and
+// failures are only logged, as the copy is owned by the account and does not depend on them.
+func (d *SDKCopyAmiDriver) unshareSourceAmi(ctx context.Context, ec2Client *ec2.Client, share sourceAmiShare) {
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	if share.image {
+		d.logger.InfoContext(ctx, "revoking the share of source AMI", logging.AmiID(share.amiID), "account", share.account)
+		_, err := ec2Client.ModifyImageAttribute(cleanupCtx, &ec2.ModifyImageAttributeInput{
+			ImageId: aws.String(share.amiID),
+			LaunchPermission: &ec2types.LaunchPermissionModifications{
+				Remove: []ec2types.LaunchPermission{{UserId: aws.String(share.account)}},
+			},
+		})
+		if err != nil {
+			d.logger.ErrorContext(ctx, "revoking the share of source AMI failed", logging.AmiID(share.amiID), "account", share.account, "error", err)
+		}
+	}
+
+	for _, snapshotID := range share.snapshotIDs {
+		_, err := ec2Client.ModifySnapshotAttribute(cleanupCtx, &ec2.ModifySnapshotAttributeInput{
+			SnapshotId:    aws.String(snapshotID),
+			Attribute:     ec2types.SnapshotAttributeNameCreateVolumePermission,
+			OperationType: ec2types.OperationTypeRemove,
+			UserIds:       []string{share.account},
+		})
+		if err != nil {
+			d.logger.ErrorContext(ctx, "revoking the share of snapshot failed", "snapshot_id", snapshotID, "account", share.account, "error", err)
+		}
+	}
 }
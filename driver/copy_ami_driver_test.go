@@ -23,6 +23,7 @@ type AmiCopyConfig struct {
 	encrypted          bool
 	kmsKeyId           string
 	sharedWithAccounts []string
+	tags               map[string]string
 }
 
 var _ = Describe("CopyAmiDriver", func() {
@@ -128,6 +129,188 @@ var _ = Describe("CopyAmiDriver", func() {
 				})
 		})
 	})
+	Context("when tags are configured", func() {
+		It("tags the copy and its snapshot with the configured tags", func() {
+			copyAmi(
+				AmiCopyConfig{
+					amiId: amiFixtureID,
+					tags:  map[string]string{"distro": "ubuntu-jammy", "version": "1.2", "cost-center": "bosh"},
+				},
+				func(ec2Client *ec2.Client, reqOutput *ec2.DescribeImagesOutput) {
+					Expect(reqOutput.Images[0].Tags).To(ContainElements(
+						ec2types.Tag{Key: aws.String("Name"), Value: aws.String("ubuntu-jammy-1.2")},
+						ec2types.Tag{Key: aws.String("cost-center"), Value: aws.String("bosh")},
+						ec2types.Tag{Key: aws.String("published"), Value: aws.String("false")},
+					))
+
+					snapshotIDptr := getSnapshotID(reqOutput)
+					snapshotOutput, err := ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{*snapshotIDptr}})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(snapshotOutput.Snapshots[0].Tags).To(ContainElements(
+						ec2types.Tag{Key: aws.String("Name"), Value: reqOutput.Images[0].ImageId},
+						ec2types.Tag{Key: aws.String("ami_id"), Value: reqOutput.Images[0].ImageId},
+						ec2types.Tag{Key: aws.String("cost-center"), Value: aws.String("bosh")},
+					))
+				})
+		})
+	})
+
+	Context("when the AMI was already copied to the destination", func() {
+		It("adopts the existing copy", func() {
+			amiDriverConfig := resources.AmiDriverConfig{
+				ExistingAmiID:     amiFixtureID,
+				DestinationRegion: destinationRegion,
+				AmiProperties: resources.AmiProperties{
+					Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+					VirtualizationType: resources.HvmAmiVirtualization,
+					Description:        "bosh cpi test ami",
+					Accessibility:      resources.PrivateAmiAccessibility,
+				},
+			}
+
+			amiCopyDriver := driverset.NewStandardRegionDriverSet(logger, creds).CopyAmiDriver()
+			copiedAmi, err := amiCopyDriver.Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(copiedAmi.Adopted).To(BeFalse())
+
+			adoptedAmi, err := amiCopyDriver.Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(adoptedAmi.ID).To(Equal(copiedAmi.ID))
+			Expect(adoptedAmi.Adopted).To(BeTrue())
+
+			amiDriverConfig.Encrypted = true
+			_, err = amiCopyDriver.Create(context.Background(), amiDriverConfig)
+			Expect(err).To(MatchError(ContainSubstring("encryption false instead of true")))
+
+			destinationCreds := creds.ForRegion(destinationRegion)
+			ec2Client := ec2.NewFromConfig(destinationCreds.GetAwsConfig())
+			_, err = ec2Client.DeregisterImage(context.Background(), &ec2.DeregisterImageInput{ImageId: aws.String(copiedAmi.ID)})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when the destination is in another account", func() {
+		BeforeEach(func() {
+			if destinationRoleArn == "" {
+				Skip("Skipping test, AWS_DESTINATION_ROLE_ARN is not set")
+			}
+		})
+
+		It("shares the source AMI with that account for the copy and publishes the copy in it", func() {
+			destinationCreds := creds.ForRegion(destinationRegion)
+			destinationCreds.RoleArn = destinationRoleArn
+			sourceCreds := creds
+			sourceCreds.Destinations = map[string]config.Credentials{destinationRegion: destinationCreds}
+
+			amiDriverConfig := resources.AmiDriverConfig{
+				ExistingAmiID:     privateAmiFixtureID,
+				DestinationRegion: destinationRegion,
+				AmiProperties: resources.AmiProperties{
+					Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+					VirtualizationType: resources.HvmAmiVirtualization,
+					Description:        "bosh cpi test ami",
+					Accessibility:      resources.PrivateAmiAccessibility,
+					Encrypted:          true,
+				},
+			}
+
+			amiCopyDriver := driverset.NewStandardRegionDriverSet(logger, sourceCreds).CopyAmiDriver()
+			copiedAmi, err := amiCopyDriver.Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			destinationAccount := strings.Split(destinationRoleArn, ":")[4]
+			ec2Client := ec2.NewFromConfig(destinationCreds.GetAwsConfig())
+			reqOutput, err := ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{ImageIds: []string{copiedAmi.ID}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*reqOutput.Images[0].OwnerId).To(Equal(destinationAccount))
+
+			sourceEc2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+			output, err := sourceEc2Client.DescribeImageAttribute(context.Background(), &ec2.DescribeImageAttributeInput{
+				ImageId:   aws.String(privateAmiFixtureID),
+				Attribute: ec2types.ImageAttributeNameLaunchPermission,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			for _, permission := range output.LaunchPermissions {
+				Expect(aws.ToString(permission.UserId)).ToNot(Equal(destinationAccount), "the temporary share of the source AMI should be revoked")
+			}
+		})
+
+		Context("when the source AMI is shared with that account", func() {
+			var (
+				sourceCreds        config.Credentials
+				sourceEc2Client    *ec2.Client
+				destinationAccount string
+				amiDriverConfig    resources.AmiDriverConfig
+			)
+
+			BeforeEach(func() {
+				destinationCreds := creds.ForRegion(destinationRegion)
+				destinationCreds.RoleArn = destinationRoleArn
+				sourceCreds = creds
+				sourceCreds.Destinations = map[string]config.Credentials{destinationRegion: destinationCreds}
+				sourceEc2Client = ec2.NewFromConfig(creds.GetAwsConfig())
+				destinationAccount = strings.Split(destinationRoleArn, ":")[4]
+
+				amiDriverConfig = resources.AmiDriverConfig{
+					ExistingAmiID:     privateAmiFixtureID,
+					DestinationRegion: destinationRegion,
+					AmiProperties: resources.AmiProperties{
+						Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+						VirtualizationType: resources.HvmAmiVirtualization,
+						Description:        "bosh cpi test ami",
+						Accessibility:      resources.PrivateAmiAccessibility,
+						Encrypted:          true,
+					},
+				}
+
+				DeferCleanup(func() {
+					sourceEc2Client.ModifyImageAttribute(context.Background(), &ec2.ModifyImageAttributeInput{ //nolint:errcheck
+						ImageId: aws.String(privateAmiFixtureID),
+						LaunchPermission: &ec2types.LaunchPermissionModifications{
+							Remove: []ec2types.LaunchPermission{{UserId: aws.String(destinationAccount)}},
+						},
+					})
+				})
+			})
+
+			sharesWithDestination := func() bool {
+				output, err := sourceEc2Client.DescribeImageAttribute(context.Background(), &ec2.DescribeImageAttributeInput{
+					ImageId:   aws.String(privateAmiFixtureID),
+					Attribute: ec2types.ImageAttributeNameLaunchPermission,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				for _, permission := range output.LaunchPermissions {
+					if aws.ToString(permission.UserId) == destinationAccount {
+						return true
+					}
+				}
+				return false
+			}
+
+			It("keeps a share that existed before the copy", func() {
+				_, err := sourceEc2Client.ModifyImageAttribute(context.Background(), &ec2.ModifyImageAttributeInput{
+					ImageId: aws.String(privateAmiFixtureID),
+					LaunchPermission: &ec2types.LaunchPermissionModifications{
+						Add: []ec2types.LaunchPermission{{UserId: aws.String(destinationAccount)}},
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = driverset.NewStandardRegionDriverSet(logger, sourceCreds).CopyAmiDriver().Create(context.Background(), amiDriverConfig)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sharesWithDestination()).To(BeTrue(), "the share that existed before the copy should be kept")
+			})
+
+			It("keeps the share when the AMIs are shared with that account", func() {
+				amiDriverConfig.SharedWithAccounts = []string{destinationAccount}
+
+				_, err := driverset.NewStandardRegionDriverSet(logger, sourceCreds).CopyAmiDriver().Create(context.Background(), amiDriverConfig)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sharesWithDestination()).To(BeTrue(), "the share with an account the AMIs are shared with should be kept")
+			})
+		})
+	})
+
 	Context("when making an AMI public", func() {
 		It("will return an error if it can't make the AMI public", func() {
 			amiProperties := resources.AmiProperties{
@@ -150,8 +333,8 @@ var _ = Describe("CopyAmiDriver", func() {
 				AmiProperties:     amiProperties,
 				KmsKey:            resources.KmsKey{ARN: amiCopyConfig.kmsKeyId},
 			}
-			amiCopyDriver := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds).CopyAmiDriver()
-			_, err := amiCopyDriver.Create(amiDriverConfig)
+			amiCopyDriver := driverset.NewStandardRegionDriverSet(logger, creds).CopyAmiDriver()
+			_, err := amiCopyDriver.Create(context.Background(), amiDriverConfig)
 			Expect(err).To(HaveOccurred())
 		})
 	})
@@ -170,6 +353,7 @@ func copyAmi(amiCopyConfig AmiCopyConfig, cb ...func(*ec2.Client, *ec2.DescribeI
 		Accessibility:      accessibility,
 		Encrypted:          amiCopyConfig.encrypted,
 		KmsKeyId:           amiCopyConfig.kmsKeyId,
+		Tags:               amiCopyConfig.tags,
 	}
 	if len(amiCopyConfig.sharedWithAccounts) > 0 {
 		amiProperties.SharedWithAccounts = amiCopyConfig.sharedWithAccounts
@@ -182,14 +366,15 @@ func copyAmi(amiCopyConfig AmiCopyConfig, cb ...func(*ec2.Client, *ec2.DescribeI
 		KmsKey:            resources.KmsKey{ARN: amiCopyConfig.kmsKeyId},
 	}
 
-	amiCopyDriver := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds).CopyAmiDriver()
-	copiedAmi, err := amiCopyDriver.Create(amiDriverConfig)
+	amiCopyDriver := driverset.NewStandardRegionDriverSet(logger, creds).CopyAmiDriver()
+	copiedAmi, err := amiCopyDriver.Create(context.Background(), amiDriverConfig)
 	Expect(err).ToNot(HaveOccurred())
 
 	destinationCreds := config.Credentials{
 		AccessKey: creds.AccessKey,
 		SecretKey: creds.SecretKey,
 		RoleArn:   creds.RoleArn,
+		Endpoint:  creds.Endpoint,
 		Region:    destinationRegion,
 	}
 	ec2Client := ec2.NewFromConfig(destinationCreds.GetAwsConfig())
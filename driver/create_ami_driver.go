@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"sort"
 	"time"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driver/reqinputs"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -22,50 +22,76 @@ import (
 type SDKCreateAmiDriver struct {
 	ec2Client *ec2.Client
 	region    string
-	logger    *log.Logger
+	logger    *slog.Logger
 }
 
 // NewCreateAmiDriver creates a SDKCreateAmiDriver for an AMI from a snapshot in EC2
-func NewCreateAmiDriver(logDest io.Writer, creds config.Credentials) *SDKCreateAmiDriver {
-	logger := log.New(logDest, "SDKCreateAmiDriver ", log.LstdFlags)
+func NewCreateAmiDriver(logger *slog.Logger, creds config.Credentials) *SDKCreateAmiDriver {
+	logger = logger.With(logging.Driver("SDKCreateAmiDriver"), logging.Region(creds.Region))
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 
 	ec2Client := ec2.NewFromConfig(cfg)
 	return &SDKCreateAmiDriver{ec2Client: ec2Client, region: creds.Region, logger: logger}
 }
 
 // Create registers an AMI from an existing snapshot and optionally makes the AMI publicly available
-func (d *SDKCreateAmiDriver) Create(driverConfig resources.AmiDriverConfig) (resources.Ami, error) {
+func (d *SDKCreateAmiDriver) Create(ctx context.Context, driverConfig resources.AmiDriverConfig) (resources.Ami, error) {
 	var err error
 
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
-
-	d.logger.Printf("creating AMI from snapshot: %s\n", driverConfig.SnapshotID)
+	d.logger.InfoContext(ctx, "creating AMI from snapshot", "snapshot_id", driverConfig.SnapshotID)
 	amiName := driverConfig.Name
 
-	var reqInput *ec2.RegisterImageInput
-	switch driverConfig.VirtualizationType {
-	case resources.HvmAmiVirtualization:
-		reqInput = reqinputs.NewHVMAmiRequestInput(amiName, driverConfig.Description, driverConfig.SnapshotID, driverConfig.Efi)
+	existingImage, err := findExistingAmi(ctx, d.ec2Client, driverConfig)
+	if err != nil {
+		return resources.Ami{}, err
 	}
 
-	reqOutput, err := d.ec2Client.RegisterImage(ctx, reqInput)
-	if err != nil {
-		return resources.Ami{}, fmt.Errorf("registering AMI: %s", err)
+	architecture := driverConfig.Architecture
+	if architecture == "" {
+		architecture = resources.AmiArchitecture
 	}
+	amiTags := stemcellTags(driverConfig.Tags,
+		ec2types.Tag{Key: aws.String("architecture"), Value: aws.String(architecture)},
+		ec2types.Tag{Key: aws.String("published"), Value: aws.String("false")},
+	)
 
-	amiIDptr := reqOutput.ImageId
-	if amiIDptr == nil {
-		return resources.Ami{}, errors.New("AMI id nil")
+	var amiIDptr *string
+	snapshotID := driverConfig.SnapshotID
+	if existingImage != nil {
+		amiIDptr = existingImage.ImageId
+		d.logger.InfoContext(ctx, "adopting existing AMI", logging.AmiID(*amiIDptr), "name", amiName)
+		if existingSnapshotID := rootSnapshotID(*existingImage); existingSnapshotID != snapshotID {
+			if snapshotID != "" {
+				d.deleteUnusedSnapshot(ctx, snapshotID, *amiIDptr)
+			}
+			snapshotID = existingSnapshotID
+		}
+	} else {
+		var reqInput *ec2.RegisterImageInput
+		switch driverConfig.VirtualizationType {
+		case resources.HvmAmiVirtualization:
+			reqInput = reqinputs.NewHVMAmiRequestInput(amiName, driverConfig.Description, snapshotID, driverConfig.Efi, driverConfig.Architecture)
+		}
+		reqInput.TagSpecifications = []ec2types.TagSpecification{tagSpecification(ec2types.ResourceTypeImage, amiTags)}
+
+		reqOutput, err := d.ec2Client.RegisterImage(ctx, reqInput)
+		if err != nil {
+			return resources.Ami{}, fmt.Errorf("registering AMI: %s", err)
+		}
+
+		amiIDptr = reqOutput.ImageId
+		if amiIDptr == nil {
+			return resources.Ami{}, errors.New("AMI id nil")
+		}
 	}
 
-	d.logger.Printf("waiting for AMI: %s to exist\n", *amiIDptr)
+	d.logger.InfoContext(ctx, "waiting for AMI to exist", logging.AmiID(*amiIDptr))
 	imageExistsWaiter := ec2.NewImageExistsWaiter(d.ec2Client)
 	err = imageExistsWaiter.Wait(ctx, &ec2.DescribeImagesInput{
 		ImageIds: []string{*amiIDptr},
@@ -74,37 +100,29 @@ func (d *SDKCreateAmiDriver) Create(driverConfig resources.AmiDriverConfig) (res
 		return resources.Ami{}, fmt.Errorf("waiting for AMI %s to exist: %s", *amiIDptr, err)
 	}
 
-	name := aws.String(driverConfig.Tags["distro"] + "-" + driverConfig.Tags["version"])
-	distro := aws.String(driverConfig.Tags["distro"])
-	version := aws.String(driverConfig.Tags["version"])
-	tags := &ec2.CreateTagsInput{
-		Resources: []string{*amiIDptr},
-		Tags: []ec2types.Tag{
-			{Key: aws.String("Name"), Value: name},
-			{Key: aws.String("distro"), Value: distro},
-			{Key: aws.String("version"), Value: version},
-			{Key: aws.String("published"), Value: aws.String("false")},
-		},
-	}
-	d.logger.Printf("tagging AMI: %s, with %v", *amiIDptr, tags)
-	_, err = d.ec2Client.CreateTags(ctx, tags)
-	if err != nil {
-		d.logger.Printf("Error tagging AMI: %s, Error: %s ", *amiIDptr, err.Error())
+	// a registered AMI is tagged by RegisterImage, an adopted one only gets the tags it is missing
+	if existingImage != nil {
+		tags := missingTags(existingImage, amiTags)
+		if len(tags) > 0 {
+			d.logger.InfoContext(ctx, "tagging AMI", logging.AmiID(*amiIDptr), "tags", formatTags(tags))
+			_, err = d.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+				Resources: []string{*amiIDptr},
+				Tags:      tags,
+			})
+			if err != nil {
+				return resources.Ami{}, fmt.Errorf("tagging AMI %s: %s", *amiIDptr, err)
+			}
+		}
 	}
 
 	snapshotTags := &ec2.CreateTagsInput{
-		Resources: []string{driverConfig.SnapshotID},
-		Tags: []ec2types.Tag{
-			{Key: aws.String("Name"), Value: name},
-			{Key: aws.String("distro"), Value: distro},
-			{Key: aws.String("version"), Value: version},
-			{Key: aws.String("ami_id"), Value: amiIDptr},
-		},
+		Resources: []string{snapshotID},
+		Tags:      stemcellTags(driverConfig.Tags, ec2types.Tag{Key: aws.String("ami_id"), Value: amiIDptr}),
 	}
-	d.logger.Printf("tagging Snapshot: %s, with %v", driverConfig.SnapshotID, snapshotTags)
+	d.logger.InfoContext(ctx, "tagging snapshot", "snapshot_id", snapshotID, logging.AmiID(*amiIDptr), "tags", formatTags(snapshotTags.Tags))
 	_, err = d.ec2Client.CreateTags(ctx, snapshotTags)
 	if err != nil {
-		d.logger.Printf("Error tagging Snapshot: %s, Error: %s ", driverConfig.SnapshotID, err.Error())
+		return resources.Ami{}, fmt.Errorf("tagging snapshot %s: %s", snapshotID, err)
 	}
 
 	for i := range driverConfig.SharedWithAccounts {
@@ -123,18 +141,18 @@ func (d *SDKCreateAmiDriver) Create(driverConfig resources.AmiDriverConfig) (res
 		}
 
 		modifySnapshotAttributeInput := &ec2.ModifySnapshotAttributeInput{
-			SnapshotId:    aws.String(driverConfig.SnapshotID),
+			SnapshotId:    aws.String(snapshotID),
 			Attribute:     ec2types.SnapshotAttributeNameCreateVolumePermission,
 			OperationType: ec2types.OperationTypeAdd,
 			UserIds:       []string{account},
 		}
 		_, err = d.ec2Client.ModifySnapshotAttribute(ctx, modifySnapshotAttributeInput)
 		if err != nil {
-			return resources.Ami{}, fmt.Errorf("sharing snapshot with id %s with account %s: %v", driverConfig.SnapshotID, account, err)
+			return resources.Ami{}, fmt.Errorf("sharing snapshot with id %s with account %s: %v", snapshotID, account, err)
 		}
 	}
 
-	d.logger.Printf("waiting for AMI: %s to be available\n", *amiIDptr)
+	d.logger.InfoContext(ctx, "waiting for AMI to be available", logging.AmiID(*amiIDptr))
 	imageAvailableWaiter := ec2.NewImageAvailableWaiter(d.ec2Client)
 	err = imageAvailableWaiter.Wait(ctx, &ec2.DescribeImagesInput{
 		ImageIds: []string{*amiIDptr},
@@ -144,7 +162,7 @@ func (d *SDKCreateAmiDriver) Create(driverConfig resources.AmiDriverConfig) (res
 	}
 
 	if driverConfig.Accessibility == resources.PublicAmiAccessibility {
-		d.logger.Printf("making AMI: %s public", *amiIDptr)
+		d.logger.InfoContext(ctx, "making AMI public", logging.AmiID(*amiIDptr))
 		d.ec2Client.ModifyImageAttribute(ctx, &ec2.ModifyImageAttributeInput{ //nolint:errcheck
 			ImageId: amiIDptr,
 			LaunchPermission: &ec2types.LaunchPermissionModifications{
@@ -159,13 +177,44 @@ func (d *SDKCreateAmiDriver) Create(driverConfig resources.AmiDriverConfig) (res
 		ID:                 *amiIDptr,
 		Region:             d.region,
 		VirtualizationType: driverConfig.VirtualizationType,
+		Adopted:            existingImage != nil,
 	}
 
 	return ami, nil
 }
 
-func (d *SDKCreateAmiDriver) findLatestKernelImage() (string, error) { //nolint:unused
-	describeImagesOutput, err := d.ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{
+// FindExisting returns the AMI named like properties that the account owns, when a Create with properties would
+// adopt it. An AMI with the name but other properties is an error.
+func (d *SDKCreateAmiDriver) FindExisting(ctx context.Context, properties resources.AmiProperties) (resources.Ami, bool, error) {
+	image, err := findExistingAmi(ctx, d.ec2Client, resources.AmiDriverConfig{AmiProperties: properties})
+	if err != nil || image == nil {
+		return resources.Ami{}, false, err
+	}
+	d.logger.InfoContext(ctx, "adopting existing AMI", logging.AmiID(aws.ToString(image.ImageId)), "name", properties.Name)
+
+	return resources.Ami{
+		ID:                 aws.ToString(image.ImageId),
+		Region:             d.region,
+		VirtualizationType: properties.VirtualizationType,
+		Adopted:            true,
+	}, true, nil
+}
+
+// deleteUnusedSnapshot deletes the snapshot that was created for an AMI that turned out to exist already. It is
+// deleted also when ctx is cancelled, as nothing else removes it.
+func (d *SDKCreateAmiDriver) deleteUnusedSnapshot(ctx context.Context, snapshotID string, amiID string) {
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	d.logger.InfoContext(ctx, "deleting unused snapshot, as the adopted AMI uses another snapshot", "snapshot_id", snapshotID, logging.AmiID(amiID))
+	_, err := d.ec2Client.DeleteSnapshot(cleanupCtx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshotID)})
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to delete unused snapshot", "snapshot_id", snapshotID, "error", err)
+	}
+}
+
+func (d *SDKCreateAmiDriver) findLatestKernelImage(ctx context.Context) (string, error) { //nolint:unused
+	describeImagesOutput, err := d.ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
 		Owners: []string{"amazon"},
 		Filters: []ec2types.Filter{
 			{
@@ -20,7 +20,7 @@ import (
 
 var _ = Describe("CreateAmiDriver", func() {
 	It("creates a bootable HVM AMI from an existing snapshot", func() {
-		logger := log.New(GinkgoWriter, "CreateAmiDriver - Bootable HVM Test: ", log.LstdFlags)
+		vmLogger := log.New(GinkgoWriter, "CreateAmiDriver - Bootable HVM Test: ", log.LstdFlags)
 
 		amiDriverConfig := resources.AmiDriverConfig{
 			SnapshotID: ebsSnapshotID,
@@ -32,10 +32,10 @@ var _ = Describe("CreateAmiDriver", func() {
 			},
 		}
 
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 
 		amiDriver := ds.CreateAmiDriver()
-		ami, err := amiDriver.Create(amiDriverConfig)
+		ami, err := amiDriver.Create(context.Background(), amiDriverConfig)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(ami.VirtualizationType).To(Equal(resources.HvmAmiVirtualization))
 
@@ -69,7 +69,7 @@ var _ = Describe("CreateAmiDriver", func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		instanceID := instanceReservation.Instances[0].InstanceId
-		logger.Printf("Created VM with instance ID: %s", *instanceID)
+		vmLogger.Printf("Created VM with instance ID: %s", *instanceID)
 
 		instanceRunningWaiter := ec2.NewInstanceRunningWaiter(ec2Client)
 		Eventually(func() error {
@@ -79,7 +79,7 @@ var _ = Describe("CreateAmiDriver", func() {
 		instanceStatusOkWaiter := ec2.NewInstanceStatusOkWaiter(ec2Client)
 		err = instanceStatusOkWaiter.Wait(context.Background(), &ec2.DescribeInstanceStatusInput{InstanceIds: []string{*instanceID}}, 30*time.Minute)
 		if err != nil {
-			logger.Printf("Encountered error waiting for VM to boot, retrying once: %s", err)
+			vmLogger.Printf("Encountered error waiting for VM to boot, retrying once: %s", err)
 			err = instanceStatusOkWaiter.Wait(context.Background(), &ec2.DescribeInstanceStatusInput{InstanceIds: []string{*instanceID}}, 30*time.Minute)
 			Expect(err).ToNot(HaveOccurred())
 		}
@@ -95,6 +95,83 @@ var _ = Describe("CreateAmiDriver", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	Context("when the architecture is arm64", func() {
+		It("registers an arm64 AMI that boots with UEFI and tags it with the architecture", func() {
+			amiDriverConfig := resources.AmiDriverConfig{
+				SnapshotID: ebsSnapshotID,
+				AmiProperties: resources.AmiProperties{
+					Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+					VirtualizationType: resources.HvmAmiVirtualization,
+					Architecture:       resources.Arm64AmiArchitecture,
+					Accessibility:      resources.PrivateAmiAccessibility,
+					Description:        "bosh cpi test ami",
+				},
+			}
+
+			ds := driverset.NewStandardRegionDriverSet(logger, creds)
+
+			ami, err := ds.CreateAmiDriver().Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+
+			reqOutput, err := ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{ImageIds: []string{ami.ID}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reqOutput.Images).To(HaveLen(1))
+
+			image := reqOutput.Images[0]
+			Expect(image.Architecture).To(Equal(ec2types.ArchitectureValuesArm64))
+			Expect(image.BootMode).To(Equal(ec2types.BootModeValuesUefi))
+			Expect(image.Tags).To(ContainElement(ec2types.Tag{Key: aws.String("architecture"), Value: aws.String("arm64")}))
+
+			_, err = ec2Client.DeregisterImage(context.Background(), &ec2.DeregisterImageInput{ImageId: &ami.ID})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when tags are configured", func() {
+		It("tags the AMI when it is registered and its snapshot with the configured tags", func() {
+			amiDriverConfig := resources.AmiDriverConfig{
+				SnapshotID: ebsSnapshotID,
+				AmiProperties: resources.AmiProperties{
+					Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+					VirtualizationType: resources.HvmAmiVirtualization,
+					Accessibility:      resources.PrivateAmiAccessibility,
+					Description:        "bosh cpi test ami",
+					Tags:               map[string]string{"distro": "ubuntu-jammy", "version": "1.2", "cost-center": "bosh"},
+				},
+			}
+
+			ds := driverset.NewStandardRegionDriverSet(logger, creds)
+
+			ami, err := ds.CreateAmiDriver().Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+			DeferCleanup(func() {
+				ec2Client.DeregisterImage(context.Background(), &ec2.DeregisterImageInput{ImageId: &ami.ID}) //nolint:errcheck
+			})
+
+			reqOutput, err := ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{ImageIds: []string{ami.ID}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reqOutput.Images[0].Tags).To(ConsistOf(
+				ec2types.Tag{Key: aws.String("Name"), Value: aws.String("ubuntu-jammy-1.2")},
+				ec2types.Tag{Key: aws.String("distro"), Value: aws.String("ubuntu-jammy")},
+				ec2types.Tag{Key: aws.String("version"), Value: aws.String("1.2")},
+				ec2types.Tag{Key: aws.String("cost-center"), Value: aws.String("bosh")},
+				ec2types.Tag{Key: aws.String("architecture"), Value: aws.String(resources.AmiArchitecture)},
+				ec2types.Tag{Key: aws.String("published"), Value: aws.String("false")},
+			))
+
+			snapshotOutput, err := ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{ebsSnapshotID}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotOutput.Snapshots[0].Tags).To(ContainElements(
+				ec2types.Tag{Key: aws.String("cost-center"), Value: aws.String("bosh")},
+				ec2types.Tag{Key: aws.String("ami_id"), Value: aws.String(ami.ID)},
+			))
+		})
+	})
+
 	Context("when shared_with_accounts is provided", func() {
 		It("shares the AMI with other accounts", func() {
 			amiDriverConfig := resources.AmiDriverConfig{
@@ -107,10 +184,10 @@ var _ = Describe("CreateAmiDriver", func() {
 				},
 			}
 
-			ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+			ds := driverset.NewStandardRegionDriverSet(logger, creds)
 
 			amiDriver := ds.CreateAmiDriver()
-			ami, err := amiDriver.Create(amiDriverConfig)
+			ami, err := amiDriver.Create(context.Background(), amiDriverConfig)
 			Expect(err).ToNot(HaveOccurred())
 
 			ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
@@ -126,4 +203,132 @@ var _ = Describe("CreateAmiDriver", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 	})
+	Context("when an AMI with the name already exists", func() {
+		var (
+			ec2Client       *ec2.Client
+			amiDriverConfig resources.AmiDriverConfig
+		)
+
+		BeforeEach(func() {
+			ec2Client = ec2.NewFromConfig(creds.GetAwsConfig())
+			amiDriverConfig = resources.AmiDriverConfig{
+				SnapshotID: ebsSnapshotID,
+				AmiProperties: resources.AmiProperties{
+					Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+					VirtualizationType: resources.HvmAmiVirtualization,
+					Accessibility:      resources.PrivateAmiAccessibility,
+					Description:        "bosh cpi test ami",
+					SharedWithAccounts: []string{awsAccount},
+					Tags:               map[string]string{"distro": "ubuntu-jammy", "version": "1.2"},
+				},
+			}
+		})
+
+		registerImage := func(architecture ec2types.ArchitectureValues, bootMode ec2types.BootModeValues) string {
+			output, err := ec2Client.RegisterImage(context.Background(), &ec2.RegisterImageInput{
+				Name:               aws.String(amiDriverConfig.Name),
+				Architecture:       architecture,
+				BootMode:           bootMode,
+				VirtualizationType: aws.String(resources.HvmAmiVirtualization),
+				RootDeviceName:     aws.String("/dev/xvda"),
+				BlockDeviceMappings: []ec2types.BlockDeviceMapping{
+					{DeviceName: aws.String("/dev/xvda"), Ebs: &ec2types.EbsBlockDevice{SnapshotId: aws.String(ebsSnapshotID)}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(func() {
+				ec2Client.DeregisterImage(context.Background(), &ec2.DeregisterImageInput{ImageId: output.ImageId}) //nolint:errcheck
+			})
+			return aws.ToString(output.ImageId)
+		}
+
+		tagImage := func(imageID string, tags ...ec2types.Tag) {
+			_, err := ec2Client.CreateTags(context.Background(), &ec2.CreateTagsInput{
+				Resources: []string{imageID},
+				Tags:      tags,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		stemcellTags := []ec2types.Tag{
+			{Key: aws.String("distro"), Value: aws.String("ubuntu-jammy")},
+			{Key: aws.String("version"), Value: aws.String("1.2")},
+		}
+
+		It("adopts it and only fills in the missing tags and sharing", func() {
+			existingID := registerImage(ec2types.ArchitectureValuesX8664, ec2types.BootModeValuesLegacyBios)
+			tagImage(existingID, append(stemcellTags, ec2types.Tag{Key: aws.String("published"), Value: aws.String("true")})...)
+
+			ami, err := driverset.NewStandardRegionDriverSet(logger, creds).CreateAmiDriver().Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ami.ID).To(Equal(existingID))
+			Expect(ami.Adopted).To(BeTrue())
+
+			reqOutput, err := ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{ImageIds: []string{existingID}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reqOutput.Images[0].Tags).To(ContainElement(ec2types.Tag{Key: aws.String("distro"), Value: aws.String("ubuntu-jammy")}))
+			Expect(reqOutput.Images[0].Tags).To(ContainElement(ec2types.Tag{Key: aws.String("published"), Value: aws.String("true")}))
+
+			output, err := ec2Client.DescribeImageAttribute(context.Background(), &ec2.DescribeImageAttributeInput{
+				ImageId:   aws.String(existingID),
+				Attribute: ec2types.ImageAttributeNameLaunchPermission,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.LaunchPermissions).To(HaveLen(1))
+			Expect(aws.ToString(output.LaunchPermissions[0].UserId)).To(Equal(awsAccount))
+		})
+
+		It("deletes the snapshot created for the AMI when the adopted AMI uses another snapshot", func() {
+			existingID := registerImage(ec2types.ArchitectureValuesX8664, ec2types.BootModeValuesLegacyBios)
+			tagImage(existingID, stemcellTags...)
+
+			snapshotOutput, err := ec2Client.CreateSnapshot(context.Background(), &ec2.CreateSnapshotInput{VolumeId: aws.String(ebsVolumeID)})
+			Expect(err).ToNot(HaveOccurred())
+			amiDriverConfig.SnapshotID = aws.ToString(snapshotOutput.SnapshotId)
+
+			ami, err := driverset.NewStandardRegionDriverSet(logger, creds).CreateAmiDriver().Create(context.Background(), amiDriverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ami.ID).To(Equal(existingID))
+
+			_, err = ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{amiDriverConfig.SnapshotID}})
+			Expect(err).To(MatchError(ContainSubstring("InvalidSnapshot.NotFound")))
+		})
+
+		It("finds it before the snapshot is created", func() {
+			existingID := registerImage(ec2types.ArchitectureValuesX8664, ec2types.BootModeValuesLegacyBios)
+			tagImage(existingID, stemcellTags...)
+
+			ami, found, err := driverset.NewStandardRegionDriverSet(logger, creds).ExistingAmiDriver().FindExisting(context.Background(), amiDriverConfig.AmiProperties)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(ami).To(Equal(resources.Ami{
+				ID:                 existingID,
+				Region:             creds.Region,
+				VirtualizationType: resources.HvmAmiVirtualization,
+				Adopted:            true,
+			}))
+		})
+
+		It("finds nothing when no AMI has the name", func() {
+			_, found, err := driverset.NewStandardRegionDriverSet(logger, creds).ExistingAmiDriver().FindExisting(context.Background(), amiDriverConfig.AmiProperties)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("returns an error when the AMI has other properties", func() {
+			existingID := registerImage(ec2types.ArchitectureValuesArm64, ec2types.BootModeValuesUefi)
+
+			_, err := driverset.NewStandardRegionDriverSet(logger, creds).CreateAmiDriver().Create(context.Background(), amiDriverConfig)
+			Expect(err).To(MatchError(ContainSubstring("AMI %s named %s already exists, but has architecture arm64 instead of x86_64", existingID, amiDriverConfig.Name)))
+			Expect(err).To(MatchError(ContainSubstring(`boot mode "uefi" instead of "legacy-bios"`)))
+		})
+
+		It("returns an error when the AMI does not have the stemcell tags", func() {
+			existingID := registerImage(ec2types.ArchitectureValuesX8664, ec2types.BootModeValuesLegacyBios)
+			tagImage(existingID, stemcellTags[0])
+
+			_, _, err := driverset.NewStandardRegionDriverSet(logger, creds).ExistingAmiDriver().FindExisting(context.Background(), amiDriverConfig.AmiProperties)
+			Expect(err).To(MatchError(fmt.Sprintf("AMI %s named %s already exists, but has no tag version instead of 1.2", existingID, amiDriverConfig.Name)))
+		})
+	})
 })
@@ -3,35 +3,32 @@ package driver
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // The SDKCreateMachineImageDriver uploads a machine image to S3 and creates a presigned URL for GET operations
 type SDKCreateMachineImageDriver struct {
 	s3Client      *s3.Client
 	presignClient *s3.PresignClient
-	logger        *log.Logger
+	logger        *slog.Logger
 }
 
 // NewCreateMachineImageDriver creates a MachineImageDriver for S3 uploads
-func NewCreateMachineImageDriver(logDest io.Writer, creds config.Credentials) *SDKCreateMachineImageDriver {
-	logger := log.New(logDest, "SDKCreateMachineImageDriver ", log.LstdFlags)
+func NewCreateMachineImageDriver(logger *slog.Logger, creds config.Credentials) *SDKCreateMachineImageDriver {
+	logger = logger.With(logging.Driver("SDKCreateMachineImageDriver"), logging.Region(creds.Region))
 
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 	cfg.Retryer = func() aws.Retryer {
-		return NewS3RetryerWithRetries(50).AsAWSRetryer()
+		return NewS3RetryerWithRetries(50, creds.Region).AsAWSRetryer()
 	}
 
 	s3Client := s3.NewFromConfig(cfg)
@@ -44,43 +41,33 @@ func NewCreateMachineImageDriver(logDest io.Writer, creds config.Credentials) *S
 }
 
 // Create uploads a machine image to S3 and returns a presigned URL
-func (d *SDKCreateMachineImageDriver) Create(driverConfig resources.MachineImageDriverConfig) (resources.MachineImage, error) {
+func (d *SDKCreateMachineImageDriver) Create(ctx context.Context, driverConfig resources.MachineImageDriverConfig) (resources.MachineImage, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	d.logger.Printf("opening image for upload to S3: %s\n", driverConfig.MachineImagePath)
-
-	f, err := os.Open(driverConfig.MachineImagePath)
+	keyName := machineImageKey(driverConfig)
+	checksum, reused, err := uploadMachineImage(ctx, d.logger, d.s3Client, driverConfig, keyName)
 	if err != nil {
-		return resources.MachineImage{}, fmt.Errorf("opening machine image for upload: %s", err)
+		return resources.MachineImage{}, err
 	}
-	defer f.Close() //nolint:errcheck
 
-	keyName := fmt.Sprintf("bosh-machine-image-%d", time.Now().UnixNano())
-	d.logger.Printf("uploading image to s3://%s/%s\n", driverConfig.BucketName, keyName)
+	machineImageGetURL := fmt.Sprintf("s3://%s/%s", driverConfig.BucketName, keyName)
+	d.logger.InfoContext(ctx, "generated GET URL", "url", machineImageGetURL)
 
-	ctx := context.Background()
-	uploadStartTime := time.Now()
-	uploader := manager.NewUploader(d.s3Client) //nolint:staticcheck
-	input := &s3.PutObjectInput{
-		Body:   f,
-		Bucket: aws.String(driverConfig.BucketName),
-		Key:    aws.String(keyName),
-	}
-	if driverConfig.ServerSideEncryption != "" {
-		input.ServerSideEncryption = s3types.ServerSideEncryption(driverConfig.ServerSideEncryption)
-	}
-	_, err = uploader.Upload(ctx, input) //nolint:staticcheck
-	if err != nil {
-		return resources.MachineImage{}, fmt.Errorf("uploading machine image to S3: %s", err)
+	machineImage := resources.MachineImage{
+		GetURL: machineImageGetURL,
+		Key:    keyName,
+		SHA256: checksum,
+		Reused: reused,
 	}
 
-	d.logger.Printf("finished uploaded image to s3 after %f minutes\n", time.Since(uploadStartTime).Minutes())
-
-	machineImageGetURL := fmt.Sprintf("s3://%s/%s", driverConfig.BucketName, keyName)
-	d.logger.Printf("generated GET URL %s\n", machineImageGetURL)
+	// an image an earlier run uploaded may still be in use by it
+	if reused || driverConfig.KeepUploadedImage {
+		d.logger.InfoContext(ctx, "keeping machine image once the AMI is created", "bucket", driverConfig.BucketName, "key", keyName)
+		return machineImage, nil
+	}
 
 	deleteReq, err := d.presignClient.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(driverConfig.BucketName),
@@ -91,12 +78,9 @@ func (d *SDKCreateMachineImageDriver) Create(driverConfig resources.MachineImage
 	}
 
 	machineImageDeleteURL := deleteReq.URL
-	d.logger.Printf("generated presigned DELETE URL %s\n", machineImageDeleteURL)
+	d.logger.InfoContext(ctx, "generated presigned DELETE URL", "object", objectLocation(machineImageDeleteURL))
 
-	machineImage := resources.MachineImage{
-		GetURL:     machineImageGetURL,
-		DeleteURLs: []string{machineImageDeleteURL},
-	}
+	machineImage.DeleteURLs = []string{machineImageDeleteURL}
 
 	return machineImage, nil
 }
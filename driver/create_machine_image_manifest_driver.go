@@ -6,14 +6,13 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"math"
-	"os"
 	"time"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driver/manifests"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -28,18 +27,18 @@ const gbInBytes = 1 << 30
 type SDKCreateMachineImageManifestDriver struct {
 	s3Client      *s3.Client
 	presignClient *s3.PresignClient
-	logger        *log.Logger
+	logger        *slog.Logger
 	genManifest   bool //nolint:unused
 }
 
 // NewCreateMachineImageManifestDriver creates a MachineImageDriver machine image manifest generation
-func NewCreateMachineImageManifestDriver(logDest io.Writer, creds config.Credentials) *SDKCreateMachineImageManifestDriver {
-	logger := log.New(logDest, "SDKCreateMachineImageManifestDriver ", log.LstdFlags)
+func NewCreateMachineImageManifestDriver(logger *slog.Logger, creds config.Credentials) *SDKCreateMachineImageManifestDriver {
+	logger = logger.With(logging.Driver("SDKCreateMachineImageManifestDriver"), logging.Region(creds.Region))
 
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 	cfg.Retryer = func() aws.Retryer {
-		return NewS3RetryerWithRetries(50).AsAWSRetryer()
+		return NewS3RetryerWithRetries(50, creds.Region).AsAWSRetryer()
 	}
 
 	s3Client := s3.NewFromConfig(cfg)
@@ -52,41 +51,18 @@ func NewCreateMachineImageManifestDriver(logDest io.Writer, creds config.Credent
 }
 
 // Create uploads a machine image to S3 and returns a presigned URL to an import volume manifest
-func (d *SDKCreateMachineImageManifestDriver) Create(driverConfig resources.MachineImageDriverConfig) (resources.MachineImage, error) {
+func (d *SDKCreateMachineImageManifestDriver) Create(ctx context.Context, driverConfig resources.MachineImageDriverConfig) (resources.MachineImage, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	d.logger.Printf("opening image for upload to S3: %s\n", driverConfig.MachineImagePath)
-
-	f, err := os.Open(driverConfig.MachineImagePath)
-	if err != nil {
-		return resources.MachineImage{}, fmt.Errorf("opening machine image for upload: %s", err)
-	}
-	defer f.Close() //nolint:errcheck
-
-	keyName := fmt.Sprintf("bosh-machine-image-%d", time.Now().UnixNano())
-	d.logger.Printf("uploading image to s3://%s/%s\n", driverConfig.BucketName, keyName)
-
-	ctx := context.Background()
-	uploadStartTime := time.Now()
-	uploader := manager.NewUploader(d.s3Client) //nolint:staticcheck
-	input := &s3.PutObjectInput{
-		Body:   f,
-		Bucket: aws.String(driverConfig.BucketName),
-		Key:    aws.String(keyName),
-	}
-	if driverConfig.ServerSideEncryption != "" {
-		input.ServerSideEncryption = s3types.ServerSideEncryption(driverConfig.ServerSideEncryption)
-	}
-	_, err = uploader.Upload(ctx, input) //nolint:staticcheck
+	keyName := machineImageKey(driverConfig)
+	checksum, reused, err := uploadMachineImage(ctx, d.logger, d.s3Client, driverConfig, keyName)
 	if err != nil {
-		return resources.MachineImage{}, fmt.Errorf("uploading machine image to S3: %s", err)
+		return resources.MachineImage{}, err
 	}
 
-	d.logger.Printf("finished uploaded image to s3 after %f minutes\n", time.Since(uploadStartTime).Minutes())
-
 	headReqOutput, err := d.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(driverConfig.BucketName),
 		Key:    aws.String(keyName),
@@ -110,14 +86,24 @@ func (d *SDKCreateMachineImageManifestDriver) Create(driverConfig resources.Mach
 		return resources.MachineImage{}, fmt.Errorf("Failed to generate machine image manifest: %s", err) //nolint:staticcheck
 	}
 
-	manifestURL, err := d.uploadManifest(ctx, driverConfig.BucketName, driverConfig.ServerSideEncryption, m)
+	manifestURL, err := d.uploadManifest(ctx, driverConfig.BucketName, driverConfig.ServerSideEncryption, driverConfig.Tags, m)
 	if err != nil {
 		return resources.MachineImage{}, fmt.Errorf("uploading machine image manifest: %s", err)
 	}
 
 	machineImage := resources.MachineImage{
 		GetURL:     manifestURL,
-		DeleteURLs: []string{m.SelfDestructURL, m.Parts.Part.DeleteURL},
+		DeleteURLs: []string{m.SelfDestructURL},
+		Key:        keyName,
+		SHA256:     checksum,
+		Reused:     reused,
+	}
+
+	// an image an earlier run uploaded may still be in use by it
+	if reused || driverConfig.KeepUploadedImage {
+		d.logger.InfoContext(ctx, "keeping machine image once the AMI is created", "bucket", driverConfig.BucketName, "key", keyName)
+	} else {
+		machineImage.DeleteURLs = append(machineImage.DeleteURLs, m.Parts.Part.DeleteURL)
 	}
 
 	return machineImage, nil
@@ -133,7 +119,7 @@ func (d *SDKCreateMachineImageManifestDriver) generateManifest(ctx context.Conte
 	}
 	presignedGetURL := getReq.URL
 
-	d.logger.Printf("generated presigned GET URL %s\n", presignedGetURL)
+	d.logger.InfoContext(ctx, "generated presigned GET URL", "object", objectLocation(presignedGetURL))
 
 	headReq, err := d.presignClient.PresignHeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(bucketName),
@@ -144,7 +130,7 @@ func (d *SDKCreateMachineImageManifestDriver) generateManifest(ctx context.Conte
 	}
 	presignedHeadURL := headReq.URL
 
-	d.logger.Printf("generated presigned HEAD URL %s\n", presignedHeadURL)
+	d.logger.InfoContext(ctx, "generated presigned HEAD URL", "object", objectLocation(presignedHeadURL))
 
 	deleteReq, err := d.presignClient.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucketName),
@@ -155,7 +141,7 @@ func (d *SDKCreateMachineImageManifestDriver) generateManifest(ctx context.Conte
 	}
 	presignedDeleteURL := deleteReq.URL
 
-	d.logger.Printf("generated presigned DELETE URL %s\n", presignedDeleteURL)
+	d.logger.InfoContext(ctx, "generated presigned DELETE URL", "object", objectLocation(presignedDeleteURL))
 
 	imageProps := manifests.MachineImageProperties{
 		KeyName:      keyName,
@@ -170,7 +156,7 @@ func (d *SDKCreateMachineImageManifestDriver) generateManifest(ctx context.Conte
 	return manifests.New(imageProps), nil
 }
 
-func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context, bucketName, serverSideEncryption string, m *manifests.ImportVolumeManifest) (string, error) {
+func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context, bucketName, serverSideEncryption string, tags map[string]string, m *manifests.ImportVolumeManifest) (string, error) {
 	manifestKey := fmt.Sprintf("bosh-machine-image-manifest-%d", time.Now().UnixNano())
 
 	getReq, err := d.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
@@ -182,7 +168,7 @@ func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context
 	}
 	manifestGetURL := getReq.URL
 
-	d.logger.Printf("generated presigned manifest GET URL %s\n", manifestGetURL)
+	d.logger.InfoContext(ctx, "generated presigned manifest GET URL", "object", objectLocation(manifestGetURL))
 
 	deleteReq, err := d.presignClient.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucketName),
@@ -193,7 +179,7 @@ func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context
 	}
 	manifestDeleteURL := deleteReq.URL
 
-	d.logger.Printf("generated presigned manifest DELETE URL %s\n", manifestDeleteURL)
+	d.logger.InfoContext(ctx, "generated presigned manifest DELETE URL", "object", objectLocation(manifestDeleteURL))
 
 	m.SelfDestructURL = manifestDeleteURL
 
@@ -207,9 +193,10 @@ func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context
 	uploadStartTime := time.Now()
 	uploader := manager.NewUploader(d.s3Client) //nolint:staticcheck
 	uploadInput := &s3.PutObjectInput{
-		Body:   manifestReader,
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(manifestKey),
+		Body:    manifestReader,
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(manifestKey),
+		Tagging: objectTagging(tags),
 	}
 	if serverSideEncryption != "" {
 		uploadInput.ServerSideEncryption = s3types.ServerSideEncryption(serverSideEncryption)
@@ -219,7 +206,7 @@ func (d *SDKCreateMachineImageManifestDriver) uploadManifest(ctx context.Context
 		return "", fmt.Errorf("uploading machine image manifest to S3: %s", err)
 	}
 
-	d.logger.Printf("finished uploaded machine image manifest to s3 after %f seconds\n", time.Since(uploadStartTime).Seconds())
+	d.logger.InfoContext(ctx, "finished upload of machine image manifest to s3", "duration", time.Since(uploadStartTime))
 
 	return manifestGetURL, nil
 }
@@ -5,14 +5,18 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driver/manifests"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/metrics"
+	"light-stemcell-builder/redact"
 	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -24,56 +28,124 @@ import (
 type SDKCreateVolumeDriver struct {
 	ec2Client *ec2.Client
 	region    string
-	logger    *log.Logger
+	logger    *slog.Logger
 }
 
 // NewCreateVolumeDriver creates a SDKCreateVolumeDriver for importing a volume from a machine image url
-func NewCreateVolumeDriver(logDest io.Writer, creds config.Credentials) *SDKCreateVolumeDriver {
-	logger := log.New(logDest, "SDKCreateVolumeDriver ", log.LstdFlags)
+func NewCreateVolumeDriver(logger *slog.Logger, creds config.Credentials) *SDKCreateVolumeDriver {
+	logger = logger.With(logging.Driver("SDKCreateVolumeDriver"), logging.Region(creds.Region))
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 
 	ec2Client := ec2.NewFromConfig(cfg)
 	return &SDKCreateVolumeDriver{ec2Client: ec2Client, region: creds.Region, logger: logger}
 }
 
 // Create makes an EBS volume from a machine image URL in the first availability zone returned from DescribeAvailabilityZones
-func (d *SDKCreateVolumeDriver) Create(driverConfig resources.VolumeDriverConfig) (resources.Volume, error) {
+func (d *SDKCreateVolumeDriver) Create(ctx context.Context, driverConfig resources.VolumeDriverConfig) (resources.Volume, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
+	conversionTaskID := driverConfig.ConversionTaskID
+	if conversionTaskID != "" {
+		d.logger.InfoContext(ctx, "resuming ImportVolume task", logging.TaskID(conversionTaskID))
+	} else {
+		var err error
+		conversionTaskID, err = d.startImportVolume(ctx, driverConfig)
+		if err != nil {
+			return resources.Volume{}, err
+		}
+
+		if driverConfig.ConversionTaskStarted != nil {
+			err = driverConfig.ConversionTaskStarted(conversionTaskID)
+			if err != nil {
+				return resources.Volume{}, fmt.Errorf("recording import volume task %s: %s", conversionTaskID, err)
+			}
+		}
+	}
+
+	d.logger.InfoContext(ctx, "waiting on ImportVolume task", logging.TaskID(conversionTaskID))
+	tracing.SetAttributes(ctx, tracing.TaskID(conversionTaskID))
+
+	taskFilter := &ec2.DescribeConversionTasksInput{
+		ConversionTaskIds: []string{conversionTaskID},
+	}
 
+	waitStartTime := time.Now()
+	err := d.waitUntilConversionTaskCompleted(ctx, taskFilter)
+	waitDuration := time.Since(waitStartTime)
+	d.logger.InfoContext(ctx, "waited on ImportVolume task", logging.TaskID(conversionTaskID), "duration", waitDuration)
+
+	if err != nil {
+		return resources.Volume{}, fmt.Errorf("waiting for volume to be imported: %s", err)
+	}
+	metrics.ObserveImportWait(d.region, metrics.ImportVolumeTask, waitDuration)
+
+	taskOutput, err := d.ec2Client.DescribeConversionTasks(ctx, taskFilter)
+	if err != nil {
+		return resources.Volume{}, fmt.Errorf("fetching volume ID from conversion task %s", conversionTaskID)
+	}
+
+	volumeIDptr := taskOutput.ConversionTasks[0].ImportVolume.Volume.Id
+	if volumeIDptr == nil {
+		return resources.Volume{}, fmt.Errorf("volume ID nil")
+	}
+
+	// ImportVolume cannot tag the volume it creates, so it is tagged once it exists
+	_, err = d.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{*volumeIDptr},
+		Tags: stemcellTags(driverConfig.Tags,
+			ec2types.Tag{Key: aws.String(resources.CreatedByTagKey), Value: aws.String(resources.CreatedByTagValue)},
+		),
+	})
+	if err != nil {
+		return resources.Volume{}, fmt.Errorf("tagging volume %s: %s", *volumeIDptr, err)
+	}
+
+	d.logger.InfoContext(ctx, "waiting for volume to be available", "volume_id", *volumeIDptr)
+	waitStartTime = time.Now()
+	volumeAvailableWaiter := ec2.NewVolumeAvailableWaiter(d.ec2Client)
+	err = volumeAvailableWaiter.Wait(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{*volumeIDptr}}, 30*time.Minute)
+	d.logger.InfoContext(ctx, "waited on volume", "volume_id", *volumeIDptr, "duration", time.Since(waitStartTime))
+	if err != nil {
+		return resources.Volume{}, fmt.Errorf("waiting for volume %s to be available: %w", *volumeIDptr, err)
+	}
+
+	return resources.Volume{ID: *volumeIDptr}, nil
+}
+
+// startImportVolume starts an ImportVolume task for the machine image manifest and returns its ID
+func (d *SDKCreateVolumeDriver) startImportVolume(ctx context.Context, driverConfig resources.VolumeDriverConfig) (string, error) {
 	availabilityZoneOutput, err := d.ec2Client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
 		Filters: []ec2types.Filter{
 			{Name: aws.String("state"), Values: []string{"available"}},
 		},
 	})
 	if err != nil {
-		return resources.Volume{}, fmt.Errorf("listing availability zones: %s", err)
+		return "", fmt.Errorf("listing availability zones: %s", err)
 	}
 
 	if len(availabilityZoneOutput.AvailabilityZones) == 0 {
-		return resources.Volume{}, fmt.Errorf("finding any available availability zones in region %s", d.region)
+		return "", fmt.Errorf("finding any available availability zones in region %s", d.region)
 	}
 
 	availabilityZone := availabilityZoneOutput.AvailabilityZones[0].ZoneName
 	fetchManifestResp, err := http.Get(driverConfig.MachineImageManifestURL)
 	if err != nil {
-		return resources.Volume{}, fmt.Errorf("fetching import volume manifest: %s", err)
+		return "", fmt.Errorf("fetching import volume manifest: %s", redact.String(err.Error()))
 	}
 
 	defer fetchManifestResp.Body.Close() //nolint:errcheck
 	manifestBytes, err := io.ReadAll(fetchManifestResp.Body)
 	if err != nil {
-		return resources.Volume{}, fmt.Errorf("reading import volume manifest from response: %s", err)
+		return "", fmt.Errorf("reading import volume manifest from response: %s", err)
 	}
 	if fetchManifestResp.StatusCode < 200 || fetchManifestResp.StatusCode >= 300 {
-		return resources.Volume{}, fmt.Errorf("Received invalid response code '%d' fetching resource '%s': %s", //nolint:staticcheck
+		return "", fmt.Errorf("Received invalid response code '%d' fetching resource '%s': %s", //nolint:staticcheck
 			fetchManifestResp.StatusCode,
-			driverConfig.MachineImageManifestURL,
+			objectLocation(driverConfig.MachineImageManifestURL),
 			manifestBytes)
 	}
 
@@ -81,7 +153,7 @@ func (d *SDKCreateVolumeDriver) Create(driverConfig resources.VolumeDriverConfig
 
 	err = xml.Unmarshal(manifestBytes, &m)
 	if err != nil {
-		return resources.Volume{}, fmt.Errorf("deserializing import volume manifest. Bytes:\n%s\nError: %s", manifestBytes, err)
+		return "", fmt.Errorf("deserializing import volume manifest. Bytes:\n%s\nError: %s", manifestBytes, err)
 	}
 
 	reqOutput, err := d.ec2Client.ImportVolume(ctx, &ec2.ImportVolumeInput{
@@ -96,48 +168,15 @@ func (d *SDKCreateVolumeDriver) Create(driverConfig resources.VolumeDriverConfig
 		},
 	})
 	if err != nil {
-		return resources.Volume{}, fmt.Errorf("creating import volume task: %s", err)
+		return "", fmt.Errorf("creating import volume task: %s", err)
 	}
 
 	conversionTaskIDptr := reqOutput.ConversionTask.ConversionTaskId
 	if conversionTaskIDptr == nil {
-		return resources.Volume{}, fmt.Errorf("conversion task ID nil")
-	}
-
-	d.logger.Printf("waiting on ImportVolume task %s\n", *conversionTaskIDptr)
-
-	taskFilter := &ec2.DescribeConversionTasksInput{
-		ConversionTaskIds: []string{*conversionTaskIDptr},
-	}
-
-	waitStartTime := time.Now()
-	err = d.waitUntilConversionTaskCompleted(ctx, taskFilter)
-	d.logger.Printf("waited on import task %s for %f minutes\n", *conversionTaskIDptr, time.Since(waitStartTime).Minutes())
-
-	if err != nil {
-		return resources.Volume{}, fmt.Errorf("waiting for volume to be imported: %s", err)
-	}
-
-	taskOutput, err := d.ec2Client.DescribeConversionTasks(ctx, taskFilter)
-	if err != nil {
-		return resources.Volume{}, fmt.Errorf("fetching volume ID from conversion task %s", *conversionTaskIDptr)
-	}
-
-	volumeIDptr := taskOutput.ConversionTasks[0].ImportVolume.Volume.Id
-	if volumeIDptr == nil {
-		return resources.Volume{}, fmt.Errorf("volume ID nil")
+		return "", fmt.Errorf("conversion task ID nil")
 	}
 
-	d.logger.Printf("waiting for volume to be available: %s\n", *volumeIDptr)
-	waitStartTime = time.Now()
-	volumeAvailableWaiter := ec2.NewVolumeAvailableWaiter(d.ec2Client)
-	err = volumeAvailableWaiter.Wait(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{*volumeIDptr}}, 30*time.Minute)
-	d.logger.Printf("waited on volume %s for %f seconds\n", *volumeIDptr, time.Since(waitStartTime).Seconds())
-	if err != nil {
-		return resources.Volume{}, fmt.Errorf("waiting for volume %s to be available: %w", *volumeIDptr, err)
-	}
-
-	return resources.Volume{ID: *volumeIDptr}, nil
+	return *conversionTaskIDptr, nil
 }
 
 // waitUntilConversionTaskCompleted polls until the conversion task is complete.
@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var _ resources.DeleteAmiDriver = &SDKDeleteAmiDriver{}
+
+// SDKDeleteAmiDriver uses the AWS SDK to remove an AMI and the snapshots backing it
+type SDKDeleteAmiDriver struct {
+	creds  config.Credentials
+	logger *slog.Logger
+}
+
+// NewDeleteAmiDriver creates a SDKDeleteAmiDriver for removing AMIs in EC2
+func NewDeleteAmiDriver(logger *slog.Logger, creds config.Credentials) *SDKDeleteAmiDriver {
+	return &SDKDeleteAmiDriver{creds: creds, logger: logger.With(logging.Driver("SDKDeleteAmiDriver"))}
+}
+
+// Delete revokes the launch permissions of an AMI, deregisters it and deletes its snapshots.
+// Launch permissions are revoked first so the AMI is no longer shared even if a later step fails.
+func (d *SDKDeleteAmiDriver) Delete(ctx context.Context, ami resources.Ami) error {
+	deleteStartTime := time.Now()
+	defer func(startTime time.Time) {
+		d.logger.InfoContext(ctx, "completed Delete()", "duration", time.Since(startTime))
+	}(deleteStartTime)
+
+	regionCreds := d.creds.ForDestination(ami.Region)
+	cfg := regionCreds.GetAwsConfig()
+	logging.ConfigureSDK(&cfg, d.logger.With(logging.Region(ami.Region)))
+
+	ec2Client := ec2.NewFromConfig(cfg)
+
+	describeOutput, err := ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{ami.ID},
+	})
+	if err != nil {
+		return fmt.Errorf("describing AMI %s: %s", ami.ID, err)
+	}
+	if len(describeOutput.Images) == 0 {
+		return fmt.Errorf("AMI %s not found in region %s", ami.ID, ami.Region)
+	}
+
+	var snapshotIDs []string
+	for _, mapping := range describeOutput.Images[0].BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+			snapshotIDs = append(snapshotIDs, *mapping.Ebs.SnapshotId)
+		}
+	}
+
+	d.logger.InfoContext(ctx, "revoking launch permissions of AMI", logging.AmiID(ami.ID), logging.Region(ami.Region))
+	_, err = ec2Client.ResetImageAttribute(ctx, &ec2.ResetImageAttributeInput{
+		ImageId:   aws.String(ami.ID),
+		Attribute: ec2types.ResetImageAttributeNameLaunchPermission,
+	})
+	if err != nil {
+		return fmt.Errorf("revoking launch permissions of AMI %s: %s", ami.ID, err)
+	}
+
+	d.logger.InfoContext(ctx, "deregistering AMI", logging.AmiID(ami.ID), logging.Region(ami.Region))
+	_, err = ec2Client.DeregisterImage(ctx, &ec2.DeregisterImageInput{
+		ImageId: aws.String(ami.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("deregistering AMI %s: %s", ami.ID, err)
+	}
+
+	for _, snapshotID := range snapshotIDs {
+		d.logger.InfoContext(ctx, "deleting snapshot of AMI", "snapshot_id", snapshotID, logging.AmiID(ami.ID), logging.Region(ami.Region))
+		_, err = ec2Client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(snapshotID),
+		})
+		if err != nil {
+			return fmt.Errorf("deleting snapshot %s of deregistered AMI %s: %s", snapshotID, ami.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package driver_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	uuid "github.com/satori/go.uuid"
+)
+
+var _ = Describe("DeleteAmiDriver", func() {
+	It("deregisters a public AMI and deletes its snapshot", func() {
+		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+
+		snapshotOutput, err := ec2Client.CreateSnapshot(context.Background(), &ec2.CreateSnapshotInput{
+			VolumeId: aws.String(ebsVolumeID),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		snapshotID := *snapshotOutput.SnapshotId
+
+		err = ec2.NewSnapshotCompletedWaiter(ec2Client).Wait(context.Background(), &ec2.DescribeSnapshotsInput{
+			SnapshotIds: []string{snapshotID},
+		}, 30*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
+
+		ami, err := ds.CreateAmiDriver().Create(context.Background(), resources.AmiDriverConfig{
+			SnapshotID: snapshotID,
+			AmiProperties: resources.AmiProperties{
+				Name:               fmt.Sprintf("BOSH-%s", strings.ToUpper(uuid.NewV4().String())),
+				VirtualizationType: resources.HvmAmiVirtualization,
+				Accessibility:      resources.PublicAmiAccessibility,
+				Description:        "bosh cpi test ami",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ds.DeleteAmiDriver().Delete(context.Background(), ami)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() bool {
+			reqOutput, err := ec2Client.DescribeImages(context.Background(), &ec2.DescribeImagesInput{ImageIds: []string{ami.ID}})
+			if err != nil {
+				return strings.Contains(err.Error(), "InvalidAMIID.NotFound")
+			}
+			return len(reqOutput.Images) == 0
+		}, 10*time.Minute, 10*time.Second).Should(BeTrue(), "Expected AMI %s to be deregistered", ami.ID)
+
+		Eventually(func() error {
+			_, err := ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{snapshotID}})
+			return err
+		}, 10*time.Minute, 10*time.Second).Should(MatchError(ContainSubstring("InvalidSnapshot.NotFound")))
+	})
+})
@@ -1,25 +1,28 @@
 package driver
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/redact"
 	"light-stemcell-builder/resources"
 )
 
 // The SDKDeleteMachineImageDriver deletes a previously uploaded machine image and manifest from S3
 type SDKDeleteMachineImageDriver struct {
-	logger *log.Logger
+	logger *slog.Logger
 }
 
 // NewDeleteMachineImageDriver deletes a previously uploaded machine image and manifest from S3
-func NewDeleteMachineImageDriver(logDest io.Writer, _ config.Credentials) *SDKDeleteMachineImageDriver {
-	logger := log.New(logDest, "SDKDeleteMachineImageDriver ", log.LstdFlags)
+func NewDeleteMachineImageDriver(logger *slog.Logger, creds config.Credentials) *SDKDeleteMachineImageDriver {
+	logger = logger.With(logging.Driver("SDKDeleteMachineImageDriver"), logging.Region(creds.Region))
 
 	return &SDKDeleteMachineImageDriver{
 		logger: logger,
@@ -27,32 +30,36 @@ func NewDeleteMachineImageDriver(logDest io.Writer, _ config.Credentials) *SDKDe
 }
 
 // Delete will perform DELETE requests to all DeleteURLs on the machineImage
-func (d *SDKDeleteMachineImageDriver) Delete(machineImage resources.MachineImage) error {
+func (d *SDKDeleteMachineImageDriver) Delete(ctx context.Context, machineImage resources.MachineImage) error {
 	deleteStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Delete() in %f minutes\n", time.Since(deleteStartTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Delete()", "duration", time.Since(deleteStartTime))
 	}(deleteStartTime)
 
-	d.logger.Printf("starting delete for the following resources: %s\n", strings.Join(machineImage.DeleteURLs, ", "))
+	locations := make([]string, 0, len(machineImage.DeleteURLs))
+	for _, deleteURL := range machineImage.DeleteURLs {
+		locations = append(locations, objectLocation(deleteURL))
+	}
+	d.logger.InfoContext(ctx, "starting delete of machine image", "objects", strings.Join(locations, ", "))
 
 	client := http.Client{
 		Timeout: time.Duration(30 * time.Second),
 	}
 
 	for _, deleteURL := range machineImage.DeleteURLs {
-		deleteReq, err := http.NewRequest(http.MethodDelete, deleteURL, nil)
+		deleteReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, deleteURL, nil)
 		if err != nil {
-			return fmt.Errorf("Failed to create DELETE request for '%s': %s", deleteURL, err) //nolint:staticcheck
+			return fmt.Errorf("Failed to create DELETE request for '%s': %s", objectLocation(deleteURL), redact.String(err.Error())) //nolint:staticcheck
 		}
 
 		resp, err := client.Do(deleteReq)
 		if err != nil {
-			return fmt.Errorf("Failed to delete resource '%s': %s", deleteURL, err) //nolint:staticcheck
+			return fmt.Errorf("Failed to delete resource '%s': %s", objectLocation(deleteURL), redact.String(err.Error())) //nolint:staticcheck
 		}
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			defer resp.Body.Close()                                                                                                   //nolint:errcheck
-			respBody, _ := io.ReadAll(resp.Body)                                                                                      //nolint:errcheck
-			return fmt.Errorf("Received invalid response code '%d' deleting resource '%s': %s", resp.StatusCode, deleteURL, respBody) //nolint:staticcheck
+			defer resp.Body.Close()                                                                                                                   //nolint:errcheck
+			respBody, _ := io.ReadAll(resp.Body)                                                                                                      //nolint:errcheck
+			return fmt.Errorf("Received invalid response code '%d' deleting resource '%s': %s", resp.StatusCode, objectLocation(deleteURL), respBody) //nolint:staticcheck
 		}
 	}
 
@@ -2,11 +2,11 @@ package driver
 
 import (
 	"context"
-	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -16,27 +16,27 @@ import (
 // SDKDeleteVolumeDriver handles deletion of a volume from a machine image on AWS
 type SDKDeleteVolumeDriver struct {
 	ec2Client *ec2.Client
-	logger    *log.Logger
+	logger    *slog.Logger
 }
 
 // NewDeleteVolumeDriver deletes a previously created Volume
-func NewDeleteVolumeDriver(logDest io.Writer, creds config.Credentials) *SDKDeleteVolumeDriver {
-	logger := log.New(logDest, "SDKDeleteVolumeDriver ", log.LstdFlags)
+func NewDeleteVolumeDriver(logger *slog.Logger, creds config.Credentials) *SDKDeleteVolumeDriver {
+	logger = logger.With(logging.Driver("SDKDeleteVolumeDriver"), logging.Region(creds.Region))
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 
 	ec2Client := ec2.NewFromConfig(cfg)
 	return &SDKDeleteVolumeDriver{ec2Client: ec2Client, logger: logger}
 }
 
 // Delete makes a request to delete the Volume
-func (d *SDKDeleteVolumeDriver) Delete(volume resources.Volume) error {
+func (d *SDKDeleteVolumeDriver) Delete(ctx context.Context, volume resources.Volume) error {
 	deleteStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Delete() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Delete()", "duration", time.Since(startTime))
 	}(deleteStartTime)
 
-	_, err := d.ec2Client.DeleteVolume(context.Background(), &ec2.DeleteVolumeInput{VolumeId: aws.String(volume.ID)})
+	_, err := d.ec2Client.DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: aws.String(volume.ID)})
 	if err != nil {
 		return err
 	}
@@ -1,15 +1,23 @@
 package driver_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
 	"testing"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/fakeaws"
+	"light-stemcell-builder/logging"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+// logger writes the log of the specs to the GinkgoWriter
+var logger = logging.New(GinkgoWriter, logging.TextFormat, slog.LevelInfo)
+
 var creds config.Credentials
 
 var destinationRegion string
@@ -24,16 +32,42 @@ var kmsKeyId, multiRegionKey, multiRegionKeyReplicationTest string
 
 var awsAccount string
 
+// destinationRoleArn is an optional role in another account that copies are published in
+var destinationRoleArn string
+
 var amiFixtureID, privateAmiFixtureID string
 
+// fakeAWS is only set on the first parallel node, and only when the suite runs
+// without AWS credentials.
+var fakeAWS *fakeaws.Server
+var fakeMachineImagePath string
+
 func TestDrivers(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Drivers Suite")
 }
 
 var _ = SynchronizedBeforeSuite(
-	func() []byte { return []byte{} },
-	func([]byte) {
+	func() []byte {
+		if os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+			return []byte{}
+		}
+
+		env, err := json.Marshal(startFakeAWS())
+		Expect(err).ToNot(HaveOccurred())
+		return env
+	},
+	func(fakeEnv []byte) {
+		if len(fakeEnv) > 0 {
+			env := map[string]string{}
+			err := json.Unmarshal(fakeEnv, &env)
+			Expect(err).ToNot(HaveOccurred())
+
+			for key, value := range env {
+				os.Setenv(key, value) //nolint:errcheck
+			}
+		}
+
 		creds = constructCredentials()
 
 		// Destination Region
@@ -86,9 +120,77 @@ var _ = SynchronizedBeforeSuite(
 
 		awsAccount = os.Getenv("AWS_ACCOUNT")
 		Expect(awsAccount).ToNot(BeEmpty(), "AWS_ACCOUNT must be set")
+
+		destinationRoleArn = os.Getenv("AWS_DESTINATION_ROLE_ARN")
+	},
+)
+
+var _ = SynchronizedAfterSuite(
+	func() {},
+	func() {
+		if fakeAWS != nil {
+			fakeAWS.Close()
+			os.Remove(fakeMachineImagePath) //nolint:errcheck
+		}
 	},
 )
 
+// startFakeAWS starts a local fake AWS server, seeds it with the fixtures the
+// driver specs expect and returns the environment that points the specs at it.
+func startFakeAWS() map[string]string {
+	const region = "us-east-1"
+	const destination = "us-west-2"
+	const bucket = "light-stemcell-builder-fake"
+
+	fakeAWS = fakeaws.NewServer()
+	fakeAWS.CreateBucket(region, bucket)
+
+	// larger than the default part size so uploads exercise multipart
+	machineImage := make([]byte, 6*1024*1024)
+	for i := range machineImage {
+		machineImage[i] = byte(i)
+	}
+
+	machineImageFile, err := os.CreateTemp("", "fake-machine-image")
+	Expect(err).ToNot(HaveOccurred())
+	defer machineImageFile.Close() //nolint:errcheck
+
+	_, err = machineImageFile.Write(machineImage)
+	Expect(err).ToNot(HaveOccurred())
+	fakeMachineImagePath = machineImageFile.Name()
+
+	err = fakeAWS.PutObject(bucket, "fixture-machine-image", machineImage)
+	Expect(err).ToNot(HaveOccurred())
+
+	fakeAWS.CreateRole("vmimport", "vmie.amazonaws.com")
+
+	multiRegionKey := fakeAWS.CreateKey(region, true)
+	err = fakeAWS.ReplicateKey(multiRegionKey, destination)
+	Expect(err).ToNot(HaveOccurred())
+
+	return map[string]string{
+		"AWS_ENDPOINT_URL":                  fakeAWS.URL,
+		"AWS_ACCESS_KEY_ID":                 "fake-access-key-id",
+		"AWS_SECRET_ACCESS_KEY":             "fake-secret-access-key",
+		"AWS_REGION":                        region,
+		"AWS_DESTINATION_REGION":            destination,
+		"AWS_BUCKET_NAME":                   bucket,
+		"AWS_ACCOUNT":                       fakeaws.AccountID,
+		"AWS_DESTINATION_ROLE_ARN":          "arn:aws:iam::210987654321:role/light-stemcell-builder",
+		"EBS_VOLUME_ID":                     fakeAWS.CreateVolume(region, 1),
+		"EBS_SNAPSHOT_ID":                   fakeAWS.CreateSnapshot(region, 1),
+		"MACHINE_IMAGE_PATH":                fakeMachineImagePath,
+		"MACHINE_IMAGE_FORMAT":              "RAW",
+		"S3_MACHINE_IMAGE_URL":              fmt.Sprintf("s3://%s/fixture-machine-image", bucket),
+		"S3_MACHINE_IMAGE_FORMAT":           "RAW",
+		"AMI_FIXTURE_ID":                    fakeAWS.CreateImage(region, fakeaws.ImageFixture{Name: "fixture-ami", Public: true}),
+		"PRIVATE_AMI_FIXTURE_ID":            fakeAWS.CreateImage(region, fakeaws.ImageFixture{Name: "private-fixture-ami", Encrypted: true, KmsKeyID: multiRegionKey}),
+		"AWS_KMS_KEY_ID":                    fakeAWS.CreateKey(region, false),
+		"MULTI_REGION_KEY":                  multiRegionKey,
+		"MULTI_REGION_KEY_REPLICATION_TEST": fakeAWS.CreateKey(region, true),
+	}
+}
+
 func constructCredentials() config.Credentials {
 	// Credentials
 	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
@@ -104,11 +206,14 @@ func constructCredentials() config.Credentials {
 
 	roleArn := os.Getenv("AWS_ROLE_ARN")
 
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+
 	return config.Credentials{
 		AccessKey:    accessKey,
 		SecretKey:    secretKey,
 		SessionToken: sessionToken,
 		Region:       region,
 		RoleArn:      roleArn,
+		Endpoint:     endpoint,
 	}
 }
@@ -0,0 +1,152 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// findExistingAmi returns the AMI named like the AMI of driverConfig that the account of ec2Client owns, or nil
+// when there is none. An AMI that exists but does not have the properties of driverConfig is an error, as its
+// name cannot be registered again.
+func findExistingAmi(ctx context.Context, ec2Client *ec2.Client, driverConfig resources.AmiDriverConfig) (*ec2types.Image, error) {
+	output, err := ec2Client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners: []string{"self"},
+		Filters: []ec2types.Filter{
+			{Name: aws.String("name"), Values: []string{driverConfig.Name}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("looking up existing AMI named %s: %s", driverConfig.Name, err)
+	}
+
+	for _, image := range output.Images {
+		if image.State != ec2types.ImageStateAvailable && image.State != ec2types.ImageStatePending {
+			continue
+		}
+
+		err = checkExistingAmi(image, driverConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return &image, nil
+	}
+
+	return nil, nil
+}
+
+// checkExistingAmi returns an error when image differs from the AMI driverConfig describes in its boot mode,
+// encryption, architecture or stemcell tags, or lacks the stemcell tags
+func checkExistingAmi(image ec2types.Image, driverConfig resources.AmiDriverConfig) error {
+	var mismatches []string
+
+	architecture := driverConfig.Architecture
+	if architecture == "" {
+		architecture = resources.AmiArchitecture
+	}
+	if string(image.Architecture) != architecture {
+		mismatches = append(mismatches, fmt.Sprintf("architecture %s instead of %s", image.Architecture, architecture))
+	}
+
+	// registered images boot the way NewHVMAmiRequestInput sets up, and copies keep the boot mode of their source
+	bootModes := []ec2types.BootModeValues{ec2types.BootModeValuesLegacyBios, ""}
+	switch {
+	case architecture == resources.Arm64AmiArchitecture:
+		bootModes = []ec2types.BootModeValues{ec2types.BootModeValuesUefi}
+	case driverConfig.Efi:
+		bootModes = []ec2types.BootModeValues{ec2types.BootModeValuesUefiPreferred}
+	}
+	if !containsBootMode(bootModes, image.BootMode) {
+		mismatches = append(mismatches, fmt.Sprintf("boot mode %q instead of %q", image.BootMode, bootModes[0]))
+	}
+
+	root := rootDevice(image)
+	encrypted := root != nil && aws.ToBool(root.Ebs.Encrypted)
+	if encrypted != driverConfig.Encrypted {
+		mismatches = append(mismatches, fmt.Sprintf("encryption %t instead of %t", encrypted, driverConfig.Encrypted))
+	}
+	if encrypted && driverConfig.KmsKey.ARN != "" && aws.ToString(root.Ebs.KmsKeyId) != "" && aws.ToString(root.Ebs.KmsKeyId) != driverConfig.KmsKey.ARN {
+		mismatches = append(mismatches, fmt.Sprintf("KMS key %s instead of %s", aws.ToString(root.Ebs.KmsKeyId), driverConfig.KmsKey.ARN))
+	}
+
+	// an AMI without the stemcell tags may be any image that happens to have the name, so it is not adopted either
+	for _, key := range []string{"distro", "version"} {
+		expected := driverConfig.Tags[key]
+		if expected == "" {
+			continue
+		}
+
+		value, ok := imageTag(image, key)
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("no tag %s instead of %s", key, expected))
+		case value != expected:
+			mismatches = append(mismatches, fmt.Sprintf("tag %s=%s instead of %s", key, value, expected))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("AMI %s named %s already exists, but has %s", aws.ToString(image.ImageId), driverConfig.Name, strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+// missingTags returns the tags that image does not have yet. Tags it has keep their value, e.g. a published tag a
+// later step set.
+func missingTags(image *ec2types.Image, tags []ec2types.Tag) []ec2types.Tag {
+	if image == nil {
+		return tags
+	}
+
+	var missing []ec2types.Tag
+	for _, tag := range tags {
+		if _, ok := imageTag(*image, aws.ToString(tag.Key)); !ok {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// rootSnapshotID returns the snapshot of the root device of image
+func rootSnapshotID(image ec2types.Image) string {
+	root := rootDevice(image)
+	if root == nil {
+		return ""
+	}
+	return aws.ToString(root.Ebs.SnapshotId)
+}
+
+func rootDevice(image ec2types.Image) *ec2types.BlockDeviceMapping {
+	for i, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs != nil && aws.ToString(mapping.DeviceName) == aws.ToString(image.RootDeviceName) {
+			return &image.BlockDeviceMappings[i]
+		}
+	}
+	return nil
+}
+
+func imageTag(image ec2types.Image, key string) (string, bool) {
+	for _, tag := range image.Tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value), true
+		}
+	}
+	return "", false
+}
+
+func containsBootMode(bootModes []ec2types.BootModeValues, bootMode ec2types.BootModeValues) bool {
+	for _, mode := range bootModes {
+		if mode == bootMode {
+			return true
+		}
+	}
+	return false
+}
@@ -4,43 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
 )
 
 type SDKKmsDriver struct {
 	creds  config.Credentials
-	logger *log.Logger
+	logger *slog.Logger
 }
 
-func NewKmsDriver(logDest io.Writer, creds config.Credentials) *SDKKmsDriver {
-	logger := log.New(logDest, "KmsDriver ", log.LstdFlags)
-
-	return &SDKKmsDriver{creds: creds, logger: logger}
+func NewKmsDriver(logger *slog.Logger, creds config.Credentials) *SDKKmsDriver {
+	return &SDKKmsDriver{creds: creds, logger: logger.With(logging.Driver("KmsDriver"), logging.Region(creds.Region))}
 }
 
-func (d *SDKKmsDriver) CreateAlias(driverConfig resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error) {
+func (d *SDKKmsDriver) CreateAlias(ctx context.Context, driverConfig resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error) {
 	if driverConfig.KmsKeyId == "" {
 		return resources.KmsAlias{}, nil
 	}
 
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("Completed CreateKeyAlias() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed CreateKeyAlias()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
 	kmsClient := d.createKmsClient(driverConfig.Region)
 
-	d.logger.Printf("Creating alias: %s\n", driverConfig.KmsKeyAliasName)
+	d.logger.InfoContext(ctx, "creating alias", "alias", driverConfig.KmsKeyAliasName)
+	created := true
 	_, err := kmsClient.CreateAlias(ctx, &kms.CreateAliasInput{
 		AliasName:   &driverConfig.KmsKeyAliasName,
 		TargetKeyId: &driverConfig.KmsKeyId,
@@ -48,13 +47,14 @@ func (d *SDKKmsDriver) CreateAlias(driverConfig resources.KmsCreateAliasDriverCo
 	if err != nil {
 		var alreadyExistsErr *kmstypes.AlreadyExistsException
 		if errors.As(err, &alreadyExistsErr) {
-			d.logger.Printf("Alias %s already exists\n", driverConfig.KmsKeyAliasName)
+			d.logger.InfoContext(ctx, "alias already exists", "alias", driverConfig.KmsKeyAliasName)
+			created = false
 		} else {
 			return resources.KmsAlias{}, fmt.Errorf("failed to create alias: %s", err)
 		}
 	}
 
-	d.logger.Printf("Checking existence of alias: %s\n", driverConfig.KmsKeyAliasName)
+	d.logger.InfoContext(ctx, "checking existence of alias", "alias", driverConfig.KmsKeyAliasName)
 	listAliasResult, err := kmsClient.ListAliases(ctx, &kms.ListAliasesInput{
 		KeyId: &driverConfig.KmsKeyId,
 	})
@@ -64,10 +64,11 @@ func (d *SDKKmsDriver) CreateAlias(driverConfig resources.KmsCreateAliasDriverCo
 
 	for i := range listAliasResult.Aliases {
 		if *listAliasResult.Aliases[i].AliasName == driverConfig.KmsKeyAliasName {
-			d.logger.Printf("Reusing existing alias: %s\n", driverConfig.KmsKeyAliasName)
+			d.logger.InfoContext(ctx, "reusing existing alias", "alias", driverConfig.KmsKeyAliasName)
 			return resources.KmsAlias{
 				TargetKeyId: *listAliasResult.Aliases[i].TargetKeyId,
 				ARN:         *listAliasResult.Aliases[i].AliasArn,
+				Created:     created,
 			}, nil
 		}
 	}
@@ -75,22 +76,20 @@ func (d *SDKKmsDriver) CreateAlias(driverConfig resources.KmsCreateAliasDriverCo
 	return resources.KmsAlias{}, fmt.Errorf("could not find existing alias: %s", err)
 }
 
-func (d *SDKKmsDriver) ReplicateKey(driverConfig resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error) {
+func (d *SDKKmsDriver) ReplicateKey(ctx context.Context, driverConfig resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error) {
 	if driverConfig.KmsKeyId == "" {
 		return resources.KmsKey{}, nil
 	}
 
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("Completed ReplicateKey() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed ReplicateKey()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
-
-	d.logger.Printf("Replicating kms key: %s from region %s to region %s\n",
-		driverConfig.KmsKeyId,
-		driverConfig.SourceRegion,
-		driverConfig.TargetRegion)
+	d.logger.InfoContext(ctx, "replicating kms key",
+		"kms_key_id", driverConfig.KmsKeyId,
+		"source_region", driverConfig.SourceRegion,
+		"destination_region", driverConfig.TargetRegion)
 	_, err := d.createKmsClient(driverConfig.SourceRegion).ReplicateKey(ctx, &kms.ReplicateKeyInput{
 		KeyId:         &driverConfig.KmsKeyId,
 		ReplicaRegion: &driverConfig.TargetRegion,
@@ -98,37 +97,50 @@ func (d *SDKKmsDriver) ReplicateKey(driverConfig resources.KmsReplicateKeyDriver
 	if err != nil {
 		var alreadyExistsErr *kmstypes.AlreadyExistsException
 		if errors.As(err, &alreadyExistsErr) {
-			d.logger.Printf("Kms key %s already replicated\n", driverConfig.KmsKeyId)
+			d.logger.InfoContext(ctx, "kms key already replicated", "kms_key_id", driverConfig.KmsKeyId)
 		} else {
 			return resources.KmsKey{}, fmt.Errorf("failed to replicate key: %s", err)
 		}
 	}
 
-	listKeyResult, err := d.createKmsClient(driverConfig.TargetRegion).ListKeys(ctx, &kms.ListKeysInput{})
-	if err != nil {
-		return resources.KmsKey{}, fmt.Errorf("listing keys: %s", err)
+	// A replica has the key ID of its primary key, and KMS reports its ARN in the partition of the target region
+	keyID := driverConfig.KmsKeyId
+	if keyArn, err := arn.Parse(keyID); err == nil {
+		keyID = strings.TrimPrefix(keyArn.Resource, "key/")
 	}
-	for i := range listKeyResult.Keys {
-		if strings.HasSuffix(driverConfig.KmsKeyId, *listKeyResult.Keys[i].KeyId) {
-			return resources.KmsKey{
-				ARN: *listKeyResult.Keys[i].KeyArn,
-			}, nil
-		}
+	describeKeyResult, err := d.createKmsClient(driverConfig.TargetRegion).DescribeKey(ctx, &kms.DescribeKeyInput{
+		KeyId: &keyID,
+	})
+	if err != nil {
+		return resources.KmsKey{}, fmt.Errorf("describing replica of kms key %s in region %s: %s", driverConfig.KmsKeyId, driverConfig.TargetRegion, err)
 	}
 
-	return resources.KmsKey{}, fmt.Errorf("could not replicated kms key: %s", err)
+	return resources.KmsKey{
+		ARN: *describeKeyResult.KeyMetadata.Arn,
+	}, nil
 }
 
-func (d *SDKKmsDriver) createKmsClient(region string) *kms.Client {
-	creds := config.Credentials{
-		AccessKey: d.creds.AccessKey,
-		SecretKey: d.creds.SecretKey,
-		RoleArn:   d.creds.RoleArn,
-		Region:    region,
+func (d *SDKKmsDriver) DeleteAlias(ctx context.Context, driverConfig resources.KmsDeleteAliasDriverConfig) error {
+	deleteStartTime := time.Now()
+	defer func(startTime time.Time) {
+		d.logger.InfoContext(ctx, "completed DeleteAlias()", "duration", time.Since(startTime))
+	}(deleteStartTime)
+
+	d.logger.InfoContext(ctx, "deleting alias", "alias", driverConfig.KmsKeyAliasName, logging.Region(driverConfig.Region))
+	_, err := d.createKmsClient(driverConfig.Region).DeleteAlias(ctx, &kms.DeleteAliasInput{
+		AliasName: &driverConfig.KmsKeyAliasName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete alias: %s", err)
 	}
 
+	return nil
+}
+
+func (d *SDKKmsDriver) createKmsClient(region string) *kms.Client {
+	creds := d.creds.ForRegion(region)
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(d.logger)
+	logging.ConfigureSDK(&cfg, d.logger)
 
 	return kms.NewFromConfig(cfg)
 }
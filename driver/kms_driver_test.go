@@ -30,10 +30,10 @@ var _ = Describe("KmsDriver", func() {
 			KmsKeyId:        kmsKeyId,
 			Region:          creds.Region,
 		}
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 		driver := ds.KmsDriver()
 
-		aliasCreationResult, err := driver.CreateAlias(driverConfig)
+		aliasCreationResult, err := driver.CreateAlias(context.Background(), driverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		//defer cleanup of the created alias
@@ -59,25 +59,62 @@ var _ = Describe("KmsDriver", func() {
 		Expect(aliasCount).To(Equal(1))
 	})
 
+	It("reports whether it created an alias and deletes it again", func() {
+		aliasName := "alias/" + strconv.Itoa(rand.Int())
+
+		driverConfig := resources.KmsCreateAliasDriverConfig{
+			KmsKeyAliasName: aliasName,
+			KmsKeyId:        kmsKeyId,
+			Region:          creds.Region,
+		}
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
+		driver := ds.KmsDriver()
+
+		createdAlias, err := driver.CreateAlias(context.Background(), driverConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(createdAlias.Created).To(BeTrue())
+
+		existingAlias, err := driver.CreateAlias(context.Background(), driverConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(existingAlias.Created).To(BeFalse())
+		Expect(existingAlias.ARN).To(Equal(createdAlias.ARN))
+
+		err = driver.DeleteAlias(context.Background(), resources.KmsDeleteAliasDriverConfig{
+			KmsKeyAliasName: aliasName,
+			Region:          creds.Region,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		kmsClient := kms.NewFromConfig(creds.GetAwsConfig())
+		listAliasResult, err := kmsClient.ListAliases(context.Background(), &kms.ListAliasesInput{
+			KeyId: &kmsKeyId,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := range listAliasResult.Aliases {
+			Expect(*listAliasResult.Aliases[i].AliasName).ToNot(Equal(aliasName))
+		}
+	})
+
 	It("replicates a given kms key to another region", func() {
 		driverConfig := resources.KmsReplicateKeyDriverConfig{
 			KmsKeyId:     multiRegionKeyReplicationTest,
 			SourceRegion: creds.Region,
 			TargetRegion: destinationRegion,
 		}
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 		driver := ds.KmsDriver()
 
-		replicateKeyResult, err := driver.ReplicateKey(driverConfig)
+		replicateKeyResult, err := driver.ReplicateKey(context.Background(), driverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
-		originalRegion := creds.Region
-		creds.Region = destinationRegion
+		destinationCreds := creds
+		destinationCreds.Region = destinationRegion
 
 		//defer cleanup of the created key replica
 		defer func(aliasCreationResult resources.KmsKey) {
-			destinationKeyId := strings.ReplaceAll(multiRegionKeyReplicationTest, originalRegion, destinationRegion)
-			kmsClient := kms.NewFromConfig(creds.GetAwsConfig())
+			destinationKeyId := strings.ReplaceAll(multiRegionKeyReplicationTest, creds.Region, destinationRegion)
+			kmsClient := kms.NewFromConfig(destinationCreds.GetAwsConfig())
 
 			kmsClient.ScheduleKeyDeletion(context.Background(), &kms.ScheduleKeyDeletionInput{ //nolint:errcheck
 				KeyId:               &destinationKeyId,
@@ -85,7 +122,7 @@ var _ = Describe("KmsDriver", func() {
 			})
 		}(replicateKeyResult)
 
-		kmsClient := kms.NewFromConfig(creds.GetAwsConfig())
+		kmsClient := kms.NewFromConfig(destinationCreds.GetAwsConfig())
 		listKeyResult, err := kmsClient.ListKeys(context.Background(), &kms.ListKeysInput{})
 		Expect(err).ToNot(HaveOccurred())
 
@@ -2,11 +2,14 @@ package driver_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 
 	"light-stemcell-builder/driver"
@@ -51,7 +54,7 @@ var _ = Describe("Machine Image Lifecycle", func() {
 
 				params := &s3.HeadObjectInput{
 					Bucket: aws.String(bucketName),
-					Key:    aws.String(strings.TrimPrefix(imageURL.Path, "/")),
+					Key:    aws.String(objectKey(imageURL)),
 				}
 				headResp, err := s3Client.HeadObject(context.Background(), params)
 				Expect(err).ToNot(HaveOccurred())
@@ -61,6 +64,147 @@ var _ = Describe("Machine Image Lifecycle", func() {
 		})
 	})
 
+	Context("when tags are configured", func() {
+		It("tags the uploaded machine image", func() {
+			driverConfig := resources.MachineImageDriverConfig{
+				MachineImagePath: machineImagePath,
+				BucketName:       bucketName,
+				Tags:             map[string]string{"cost-center": "bosh", "build-url": "https://ci.example.com/1?a=b"},
+			}
+
+			testMachineImageLifecycle(driverConfig, func(machineImage resources.MachineImage) {
+				imageURL, err := url.Parse(machineImage.GetURL)
+				Expect(err).ToNot(HaveOccurred())
+
+				tagging, err := s3Client.GetObjectTagging(context.Background(), &s3.GetObjectTaggingInput{
+					Bucket: aws.String(bucketName),
+					Key:    aws.String(objectKey(imageURL)),
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tagging.TagSet).To(ConsistOf(
+					s3types.Tag{Key: aws.String("build-url"), Value: aws.String("https://ci.example.com/1?a=b")},
+					s3types.Tag{Key: aws.String("cost-center"), Value: aws.String("bosh")},
+				))
+			})
+		})
+	})
+
+	Context("when upload settings are specified", func() {
+		It("uploads the machine image it opens in parts and reports the progress", func() {
+			opened := false
+			var progress []resources.UploadProgress
+			driverConfig := resources.MachineImageDriverConfig{
+				MachineImagePath: machineImagePath,
+				BucketName:       bucketName,
+				OpenMachineImage: func() (io.ReadCloser, error) {
+					opened = true
+					return os.Open(machineImagePath)
+				},
+				Upload: resources.UploadSettings{
+					PartSize:    5 << 20,
+					Concurrency: 2,
+				},
+				UploadProgress: func(p resources.UploadProgress) {
+					progress = append(progress, p)
+				},
+			}
+
+			testMachineImageLifecycle(driverConfig)
+
+			info, err := os.Stat(machineImagePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(opened).To(BeTrue())
+			Expect(progress).To(HaveLen(1))
+			Expect(progress[0].BytesSent).To(Equal(info.Size()))
+			Expect(progress[0].TotalBytes).To(Equal(info.Size()))
+			Expect(progress[0].ETA).To(BeZero())
+		})
+	})
+
+	Context("when the checksum of the machine image is given", func() {
+		var driverConfig resources.MachineImageDriverConfig
+
+		BeforeEach(func() {
+			driverConfig = resources.MachineImageDriverConfig{
+				MachineImagePath: machineImagePath,
+				FileFormat:       machineImageFormat,
+				BucketName:       bucketName,
+				VolumeSizeGB:     3,
+				ImageSHA256:      machineImageSHA256(),
+			}
+		})
+
+		It("uploads the machine image to a key derived from the checksum and reuses it", func() {
+			createDriver := driver.NewCreateMachineImageDriver(logger, creds)
+			deleteDriver := driver.NewDeleteMachineImageDriver(logger, creds)
+
+			uploaded, err := createDriver.Create(context.Background(), driverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(uploaded.Key).To(Equal("bosh-machine-image-sha256-" + machineImageSHA256()))
+			Expect(uploaded.Reused).To(BeFalse())
+			Expect(uploaded.DeleteURLs).To(HaveLen(1))
+
+			driverConfig.OpenMachineImage = func() (io.ReadCloser, error) {
+				Fail("the machine image was uploaded again")
+				return nil, nil
+			}
+			reused, err := createDriver.Create(context.Background(), driverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reused.Key).To(Equal(uploaded.Key))
+			Expect(reused.SHA256).To(Equal(machineImageSHA256()))
+			Expect(reused.Reused).To(BeTrue())
+			Expect(reused.DeleteURLs).To(BeEmpty())
+
+			manifestDriver := driver.NewCreateMachineImageManifestDriver(logger, creds)
+			reusedWithManifest, err := manifestDriver.Create(context.Background(), driverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reusedWithManifest.Reused).To(BeTrue())
+			Expect(reusedWithManifest.DeleteURLs).To(HaveLen(1))
+
+			Expect(deleteDriver.Delete(context.Background(), reused)).To(Succeed())
+			Expect(deleteDriver.Delete(context.Background(), reusedWithManifest)).To(Succeed())
+			Expect(checkUploadedUrl(uploaded.GetURL)).To(Equal(http.StatusOK))
+
+			Expect(deleteDriver.Delete(context.Background(), uploaded)).To(Succeed())
+			Expect(checkUploadedUrl(uploaded.GetURL)).To(Equal(http.StatusNotFound))
+		})
+
+		It("keeps the uploaded machine image when asked to", func() {
+			driverConfig.KeepUploadedImage = true
+
+			createDriver := driver.NewCreateMachineImageDriver(logger, creds)
+			machineImage, err := createDriver.Create(context.Background(), driverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(machineImage.Reused).To(BeFalse())
+			Expect(machineImage.DeleteURLs).To(BeEmpty())
+
+			deleteDriver := driver.NewDeleteMachineImageDriver(logger, creds)
+			Expect(deleteDriver.Delete(context.Background(), machineImage)).To(Succeed())
+			Expect(checkUploadedUrl(machineImage.GetURL)).To(Equal(http.StatusOK))
+
+			_, err = s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    aws.String(machineImage.Key),
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns an error and removes the upload when the machine image does not have the checksum", func() {
+			driverConfig.ImageSHA256 = strings.Repeat("0", 64)
+
+			createDriver := driver.NewCreateMachineImageDriver(logger, creds)
+			_, err := createDriver.Create(context.Background(), driverConfig)
+			Expect(err).To(MatchError(ContainSubstring("machine image changed during the upload")))
+
+			_, err = s3Client.HeadObject(context.Background(), &s3.HeadObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    aws.String("bosh-machine-image-sha256-" + driverConfig.ImageSHA256),
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	It("uploads a machine image w/manifest to S3 with pre-signed URLs for GET and DELETE", func() {
 		driverConfig := resources.MachineImageDriverConfig{
 			MachineImagePath: machineImagePath,
@@ -88,7 +232,7 @@ var _ = Describe("Machine Image Lifecycle", func() {
 
 				params := &s3.HeadObjectInput{
 					Bucket: aws.String(bucketName),
-					Key:    aws.String(strings.TrimPrefix(imageURL.Path, "/")),
+					Key:    aws.String(objectKey(imageURL)),
 				}
 				headResp, err := s3Client.HeadObject(context.Background(), params)
 				Expect(err).ToNot(HaveOccurred())
@@ -100,7 +244,7 @@ var _ = Describe("Machine Image Lifecycle", func() {
 
 				params = &s3.HeadObjectInput{
 					Bucket: aws.String(bucketName),
-					Key:    aws.String(strings.TrimPrefix(imageURL.Path, "/")),
+					Key:    aws.String(objectKey(imageURL)),
 				}
 				headResp, err = s3Client.HeadObject(context.Background(), params)
 				Expect(err).ToNot(HaveOccurred())
@@ -111,6 +255,12 @@ var _ = Describe("Machine Image Lifecycle", func() {
 	})
 })
 
+// objectKey returns the key of an S3 object URL. Against a custom endpoint the
+// URL is path-style, so the bucket name leads the path.
+func objectKey(objectURL *url.URL) string {
+	return strings.TrimPrefix(strings.TrimPrefix(objectURL.Path, "/"), bucketName+"/")
+}
+
 func checkUploadedUrl(getUrl string) int {
 	parsedUrl, err := url.Parse(getUrl)
 	Expect(err).ToNot(HaveOccurred())
@@ -142,11 +292,20 @@ func checkUploadedUrl(getUrl string) int {
 	return -1
 }
 
+func machineImageSHA256() string {
+	contents, err := os.ReadFile(machineImagePath)
+	Expect(err).ToNot(HaveOccurred())
+
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
 func testMachineImageLifecycle(driverConfig resources.MachineImageDriverConfig, cb ...func(resources.MachineImage)) {
-	createDriver := driver.NewCreateMachineImageDriver(GinkgoWriter, creds)
+	createDriver := driver.NewCreateMachineImageDriver(logger, creds)
 
-	machineImage, err := createDriver.Create(driverConfig)
+	machineImage, err := createDriver.Create(context.Background(), driverConfig)
 	Expect(err).ToNot(HaveOccurred())
+	Expect(machineImage.SHA256).To(Equal(machineImageSHA256()))
 
 	statusCode := checkUploadedUrl(machineImage.GetURL)
 	Expect(statusCode).To(Equal(http.StatusOK))
@@ -155,9 +314,9 @@ func testMachineImageLifecycle(driverConfig resources.MachineImageDriverConfig,
 		cb[0](machineImage)
 	}
 
-	deleteDriver := driver.NewDeleteMachineImageDriver(GinkgoWriter, creds)
+	deleteDriver := driver.NewDeleteMachineImageDriver(logger, creds)
 
-	err = deleteDriver.Delete(machineImage)
+	err = deleteDriver.Delete(context.Background(), machineImage)
 	Expect(err).ToNot(HaveOccurred())
 
 	statusCode = checkUploadedUrl(machineImage.GetURL)
@@ -165,10 +324,11 @@ func testMachineImageLifecycle(driverConfig resources.MachineImageDriverConfig,
 }
 
 func testMachineImageManifestLifecycle(driverConfig resources.MachineImageDriverConfig, cb ...func(resources.MachineImage, manifests.ImportVolumeManifest)) {
-	createDriver := driver.NewCreateMachineImageManifestDriver(GinkgoWriter, creds)
+	createDriver := driver.NewCreateMachineImageManifestDriver(logger, creds)
 
-	machineImage, err := createDriver.Create(driverConfig)
+	machineImage, err := createDriver.Create(context.Background(), driverConfig)
 	Expect(err).ToNot(HaveOccurred())
+	Expect(machineImage.SHA256).To(Equal(machineImageSHA256()))
 
 	resp, err := http.Get(machineImage.GetURL)
 	Expect(err).ToNot(HaveOccurred())
@@ -196,9 +356,9 @@ func testMachineImageManifestLifecycle(driverConfig resources.MachineImageDriver
 		cb[0](machineImage, m)
 	}
 
-	deleteDriver := driver.NewDeleteMachineImageDriver(GinkgoWriter, creds)
+	deleteDriver := driver.NewDeleteMachineImageDriver(logger, creds)
 
-	err = deleteDriver.Delete(machineImage)
+	err = deleteDriver.Delete(context.Background(), machineImage)
 	Expect(err).ToNot(HaveOccurred())
 
 	resp, err = http.Get(machineImage.GetURL)
@@ -0,0 +1,395 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"light-stemcell-builder/metrics"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	mbInBytes = 1 << 20
+
+	// sha256MetadataKey is the user metadata of an uploaded machine image that holds its SHA-256 checksum
+	sha256MetadataKey = "sha256"
+	// keepMetadataKey is the user metadata that marks an uploaded machine image kept for later runs, which sweep leaves alone
+	keepMetadataKey = "keep"
+)
+
+// machineImageKey returns the S3 key to upload the machine image of driverConfig to. The key is derived
+// from the checksum of the image when it is known, so that identical images share a key.
+func machineImageKey(driverConfig resources.MachineImageDriverConfig) string {
+	if driverConfig.ImageSHA256 != "" {
+		return fmt.Sprintf("%ssha256-%s", machineImageKeyPrefix, driverConfig.ImageSHA256)
+	}
+	return fmt.Sprintf("%s%d", machineImageKeyPrefix, time.Now().UnixNano())
+}
+
+// uploadMachineImage uploads the machine image of driverConfig to key and returns its SHA-256 checksum.
+// When an earlier run already uploaded the same image to key, the upload is skipped and reused is true.
+func uploadMachineImage(ctx context.Context, logger *slog.Logger, client *s3.Client, driverConfig resources.MachineImageDriverConfig, key string) (checksum string, reused bool, err error) {
+	reused, err = findUploadedMachineImage(ctx, logger, client, driverConfig, key)
+	if err != nil {
+		return "", false, err
+	}
+	if reused {
+		return driverConfig.ImageSHA256, true, nil
+	}
+
+	logger.InfoContext(ctx, "opening image for upload to S3", "path", driverConfig.MachineImagePath)
+
+	f, imageSize, err := openMachineImage(driverConfig)
+	if err != nil {
+		return "", false, fmt.Errorf("opening machine image for upload: %s", err)
+	}
+	defer f.Close() //nolint:errcheck
+	tracing.SetAttributes(ctx, tracing.ImageSize(imageSize))
+
+	logger.InfoContext(ctx, "uploading image to S3", "bucket", driverConfig.BucketName, "key", key)
+
+	uploadStartTime := time.Now()
+	uploader := newMachineImageUploader(client, driverConfig.Upload, imageSize)
+	progress := startUploadProgress(ctx, logger, f, imageSize, driverConfig.Upload.ProgressInterval, driverConfig.UploadProgress)
+	checksums := newUploadChecksums(uploader.PartSize)
+	input := &s3.PutObjectInput{
+		Body:              io.TeeReader(progress, checksums),
+		Bucket:            aws.String(driverConfig.BucketName),
+		Key:               aws.String(key),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+		Tagging:           objectTagging(driverConfig.Tags),
+	}
+	if driverConfig.ServerSideEncryption != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryption(driverConfig.ServerSideEncryption)
+	}
+	input.Metadata = map[string]string{}
+	if driverConfig.ImageSHA256 != "" {
+		input.Metadata[sha256MetadataKey] = driverConfig.ImageSHA256
+	}
+	if driverConfig.KeepUploadedImage {
+		input.Metadata[keepMetadataKey] = "true"
+	}
+	_, err = uploader.Upload(ctx, input) //nolint:staticcheck
+	if err != nil {
+		progress.Stop()
+		return "", false, fmt.Errorf("uploading machine image to S3: %s", err)
+	}
+	progress.Finish()
+
+	err = verifyMachineImageUpload(ctx, logger, client, driverConfig.BucketName, key, checksums)
+	if err != nil {
+		return "", false, fmt.Errorf("verifying uploaded machine image: %s", err)
+	}
+
+	if driverConfig.ImageSHA256 != "" && checksums.SHA256() != driverConfig.ImageSHA256 {
+		_, deleteErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(driverConfig.BucketName), Key: aws.String(key)})
+		if deleteErr != nil {
+			logger.ErrorContext(ctx, "failed to delete changed upload", "bucket", driverConfig.BucketName, "key", key, "error", deleteErr)
+		}
+		return "", false, fmt.Errorf("machine image changed during the upload: uploaded SHA-256 checksum %s, expected %s", checksums.SHA256(), driverConfig.ImageSHA256)
+	}
+
+	uploadDuration := time.Since(uploadStartTime)
+	logger.InfoContext(ctx, "finished upload of image to S3", "duration", uploadDuration)
+	metrics.ObserveUpload(client.Options().Region, imageSize, uploadDuration)
+
+	return checksums.SHA256(), false, nil
+}
+
+// findUploadedMachineImage reports whether the object at key holds the machine image of driverConfig. Only
+// objects of the same size, which record the checksum of the image and have the requested encryption are reused.
+func findUploadedMachineImage(ctx context.Context, logger *slog.Logger, client *s3.Client, driverConfig resources.MachineImageDriverConfig, key string) (bool, error) {
+	if driverConfig.ImageSHA256 == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(driverConfig.MachineImagePath)
+	if err != nil {
+		return false, fmt.Errorf("opening machine image for upload: %s", err)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(driverConfig.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var responseErr *awshttp.ResponseError
+		if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == 404 {
+			return false, nil
+		}
+		return false, fmt.Errorf("checking for machine image s3://%s/%s: %s", driverConfig.BucketName, key, err)
+	}
+
+	switch {
+	case head.Metadata[sha256MetadataKey] != driverConfig.ImageSHA256:
+		logger.InfoContext(ctx, "replacing upload, which does not record the checksum of the machine image", "bucket", driverConfig.BucketName, "key", key)
+	case aws.ToInt64(head.ContentLength) != info.Size():
+		logger.InfoContext(ctx, "replacing upload, which has another size", "bucket", driverConfig.BucketName, "key", key, "bytes", aws.ToInt64(head.ContentLength), "expected_bytes", info.Size())
+	case driverConfig.ServerSideEncryption != "" && string(head.ServerSideEncryption) != driverConfig.ServerSideEncryption:
+		logger.InfoContext(ctx, "replacing upload, which is encrypted differently", "bucket", driverConfig.BucketName, "key", key, "server_side_encryption", driverConfig.ServerSideEncryption)
+	default:
+		logger.InfoContext(ctx, "reusing machine image uploaded by an earlier run", "bucket", driverConfig.BucketName, "key", key)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// openMachineImage opens the machine image of driverConfig for its upload and returns its size
+func openMachineImage(driverConfig resources.MachineImageDriverConfig) (io.ReadCloser, int64, error) {
+	info, err := os.Stat(driverConfig.MachineImagePath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	open := driverConfig.OpenMachineImage
+	if open == nil {
+		open = func() (io.ReadCloser, error) { return os.Open(driverConfig.MachineImagePath) }
+	}
+
+	image, err := open()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return image, info.Size(), nil
+}
+
+// newMachineImageUploader returns an uploader with the part size and concurrency of settings.
+// The body of the upload cannot be seeked, so the part size grows with the image to stay
+// within the number of parts S3 allows.
+func newMachineImageUploader(client *s3.Client, settings resources.UploadSettings, totalBytes int64) *manager.Uploader { //nolint:staticcheck
+	return manager.NewUploader(client, func(u *manager.Uploader) { //nolint:staticcheck
+		if settings.PartSize > 0 {
+			u.PartSize = settings.PartSize
+		}
+		if minPartSize := totalBytes/int64(manager.MaxUploadParts) + 1; u.PartSize < minPartSize { //nolint:staticcheck
+			u.PartSize = minPartSize
+		}
+		if settings.Concurrency > 0 {
+			u.Concurrency = settings.Concurrency
+		}
+	})
+}
+
+// uploadProgress counts the bytes read from a machine image for its upload, and
+// logs and reports the progress of the upload at an interval
+type uploadProgress struct {
+	body       io.Reader
+	totalBytes int64
+	sent       atomic.Int64
+	startTime  time.Time
+	ctx        context.Context
+	logger     *slog.Logger
+	report     func(resources.UploadProgress)
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func startUploadProgress(ctx context.Context, logger *slog.Logger, body io.Reader, totalBytes int64, interval time.Duration, report func(resources.UploadProgress)) *uploadProgress {
+	u := &uploadProgress{
+		body:       body,
+		totalBytes: totalBytes,
+		startTime:  time.Now(),
+		ctx:        ctx,
+		logger:     logger,
+		report:     report,
+		stop:       make(chan struct{}),
+	}
+
+	if interval > 0 {
+		u.stopped.Add(1)
+		go func() {
+			defer u.stopped.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					u.emit()
+				case <-u.stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return u
+}
+
+func (u *uploadProgress) Read(p []byte) (int, error) {
+	n, err := u.body.Read(p)
+	u.sent.Add(int64(n))
+	return n, err
+}
+
+// Stop ends the progress reports
+func (u *uploadProgress) Stop() {
+	close(u.stop)
+	u.stopped.Wait()
+}
+
+// Finish ends the progress reports with a last one of the completed upload
+func (u *uploadProgress) Finish() {
+	u.Stop()
+	u.emit()
+}
+
+func (u *uploadProgress) emit() {
+	progress := resources.UploadProgress{
+		BytesSent:  u.sent.Load(),
+		TotalBytes: u.totalBytes,
+	}
+
+	elapsed := time.Since(u.startTime)
+	if elapsed > 0 {
+		progress.BytesPerSecond = float64(progress.BytesSent) / elapsed.Seconds()
+	}
+	if progress.BytesPerSecond > 0 && progress.TotalBytes > progress.BytesSent {
+		progress.ETA = time.Duration(float64(progress.TotalBytes-progress.BytesSent) / progress.BytesPerSecond * float64(time.Second)).Round(time.Second)
+	}
+
+	percent := 100.0
+	if progress.TotalBytes > 0 {
+		percent = float64(progress.BytesSent) / float64(progress.TotalBytes) * 100
+	}
+	u.logger.InfoContext(u.ctx, fmt.Sprintf("uploaded %.1f of %.1f MiB (%.0f%%) at %.1f MiB/s, ETA %s",
+		float64(progress.BytesSent)/mbInBytes, float64(progress.TotalBytes)/mbInBytes, percent, progress.BytesPerSecond/mbInBytes, progress.ETA))
+
+	if u.report != nil {
+		u.report(progress)
+	}
+}
+
+// uploadChecksums computes the SHA-256 checksum of a machine image while it is uploaded, and the
+// checksum S3 computes of a multipart upload in parts of partSize: the checksum of the checksums of the parts
+type uploadChecksums struct {
+	partSize int64
+
+	whole         hash.Hash
+	part          hash.Hash
+	partBytes     int64
+	partChecksums hash.Hash
+	parts         int32
+	size          int64
+}
+
+func newUploadChecksums(partSize int64) *uploadChecksums {
+	return &uploadChecksums{
+		partSize:      partSize,
+		whole:         sha256.New(),
+		part:          sha256.New(),
+		partChecksums: sha256.New(),
+	}
+}
+
+func (c *uploadChecksums) Write(p []byte) (int, error) {
+	c.whole.Write(p)
+	c.size += int64(len(p))
+
+	for written := 0; written < len(p); {
+		n := int(min(int64(len(p)-written), c.partSize-c.partBytes))
+		c.part.Write(p[written : written+n])
+		c.partBytes += int64(n)
+		written += n
+
+		if c.partBytes == c.partSize {
+			c.finishPart()
+		}
+	}
+
+	return len(p), nil
+}
+
+func (c *uploadChecksums) finishPart() {
+	c.partChecksums.Write(c.part.Sum(nil))
+	c.part.Reset()
+	c.partBytes = 0
+	c.parts++
+}
+
+// SHA256 returns the hex encoded SHA-256 checksum of the uploaded bytes
+func (c *uploadChecksums) SHA256() string {
+	return hex.EncodeToString(c.whole.Sum(nil))
+}
+
+// verify compares the checksum and size S3 reports for the uploaded object with the uploaded bytes
+func (c *uploadChecksums) verify(attributes *s3.GetObjectAttributesOutput) error {
+	if attributes.ObjectSize == nil || *attributes.ObjectSize != c.size {
+		return fmt.Errorf("uploaded object has %d bytes, but %d bytes were sent", aws.ToInt64(attributes.ObjectSize), c.size)
+	}
+
+	if attributes.Checksum == nil || attributes.Checksum.ChecksumSHA256 == nil {
+		return fmt.Errorf("uploaded object has no SHA-256 checksum")
+	}
+
+	expected := base64.StdEncoding.EncodeToString(c.whole.Sum(nil))
+	if attributes.ObjectParts != nil && aws.ToInt32(attributes.ObjectParts.TotalPartsCount) > 0 {
+		if c.partBytes > 0 {
+			c.finishPart()
+		}
+		if parts := aws.ToInt32(attributes.ObjectParts.TotalPartsCount); parts != c.parts {
+			return fmt.Errorf("uploaded object has %d parts, but %d parts were sent", parts, c.parts)
+		}
+		expected = base64.StdEncoding.EncodeToString(c.partChecksums.Sum(nil))
+	}
+
+	// checksums of multipart uploads can have a -<parts count> suffix
+	actual, _, _ := strings.Cut(*attributes.Checksum.ChecksumSHA256, "-")
+	if actual != expected {
+		return fmt.Errorf("SHA-256 checksum %s of uploaded object does not match checksum %s of the machine image", actual, expected)
+	}
+
+	return nil
+}
+
+// verifyMachineImageUpload checks that the object uploaded to bucket and key has the checksums of the machine
+// image. An object that does not is deleted.
+func verifyMachineImageUpload(ctx context.Context, logger *slog.Logger, client *s3.Client, bucket string, key string, checksums *uploadChecksums) error {
+	attributes, err := client.GetObjectAttributes(ctx, &s3.GetObjectAttributesInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		ObjectAttributes: []s3types.ObjectAttributes{
+			s3types.ObjectAttributesChecksum,
+			s3types.ObjectAttributesObjectParts,
+			s3types.ObjectAttributesObjectSize,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("fetching checksum of s3://%s/%s: %s", bucket, key, err)
+	}
+
+	err = checksums.verify(attributes)
+	if err != nil {
+		_, deleteErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if deleteErr != nil {
+			logger.ErrorContext(ctx, "failed to delete corrupted upload", "bucket", bucket, "key", key, "error", deleteErr)
+		}
+		return fmt.Errorf("verifying s3://%s/%s: %s", bucket, key, err)
+	}
+
+	logger.InfoContext(ctx, "verified SHA-256 checksum of upload", "sha256", checksums.SHA256(), "bucket", bucket, "key", key)
+	return nil
+}
@@ -0,0 +1,17 @@
+package driver
+
+import (
+	"net/url"
+
+	"light-stemcell-builder/redact"
+)
+
+// objectLocation returns a presigned URL without its query, which holds the credentials of the URL
+func objectLocation(presignedURL string) string {
+	u, err := url.Parse(presignedURL)
+	if err != nil {
+		return redact.String(presignedURL)
+	}
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,240 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// vmimportRoleName is the service role VM Import imports snapshots and volumes with
+const vmimportRoleName = "vmimport"
+
+// vmimportPrincipal is the service that has to be trusted to assume the vmimport role
+const vmimportPrincipal = "vmie.amazonaws.com"
+
+// s3BucketActions are the S3 actions that apply to a bucket rather than to its objects
+var s3BucketActions = map[string]bool{
+	"s3:GetBucketLocation": true,
+	"s3:ListBucket":        true,
+}
+
+var _ resources.PreflightDriver = &SDKPreflightDriver{}
+
+// SDKPreflightDriver uses the AWS SDK to check the prerequisites of a publish
+type SDKPreflightDriver struct {
+	creds  config.Credentials
+	logger *slog.Logger
+}
+
+// NewPreflightDriver creates a SDKPreflightDriver for checking the prerequisites of a publish
+func NewPreflightDriver(logger *slog.Logger, creds config.Credentials) *SDKPreflightDriver {
+	return &SDKPreflightDriver{creds: creds, logger: logger.With(logging.Driver("SDKPreflightDriver"))}
+}
+
+// CheckBucket checks that the bucket exists and is located in region
+func (d *SDKPreflightDriver) CheckBucket(ctx context.Context, region string, bucketName string) (string, error) {
+	d.logger.InfoContext(ctx, "checking bucket", "bucket", bucketName, logging.Region(region))
+	output, err := s3.NewFromConfig(d.regionConfig(region)).GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("getting location of bucket %s: %s", bucketName, err)
+	}
+
+	// buckets in us-east-1 have no location constraint, and the oldest buckets in eu-west-1 have 'EU'
+	location := string(output.LocationConstraint)
+	switch location {
+	case "":
+		location = "us-east-1"
+	case "EU":
+		location = "eu-west-1"
+	}
+	if location != region {
+		return "", fmt.Errorf("bucket %s is located in %s instead of %s", bucketName, location, region)
+	}
+
+	return fmt.Sprintf("s3://%s is located in %s", bucketName, location), nil
+}
+
+// CheckVmimportRole checks that the vmimport role exists and that VM Import may assume it
+func (d *SDKPreflightDriver) CheckVmimportRole(ctx context.Context, region string) (string, error) {
+	d.logger.InfoContext(ctx, "checking vmimport role", logging.Region(region))
+	output, err := iam.NewFromConfig(d.regionConfig(region)).GetRole(ctx, &iam.GetRoleInput{
+		RoleName: aws.String(vmimportRoleName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("getting role %s: %s", vmimportRoleName, err)
+	}
+
+	// the trust policy is URL encoded
+	trustPolicy, err := url.QueryUnescape(aws.ToString(output.Role.AssumeRolePolicyDocument))
+	if err != nil {
+		return "", fmt.Errorf("decoding trust policy of role %s: %s", vmimportRoleName, err)
+	}
+	if !strings.Contains(trustPolicy, vmimportPrincipal) {
+		return "", fmt.Errorf("role %s does not trust %s", vmimportRoleName, vmimportPrincipal)
+	}
+
+	return aws.ToString(output.Role.Arn), nil
+}
+
+// CheckKmsKey checks that the key is enabled and, when it is replicated, that it is a multi-Region primary key
+func (d *SDKPreflightDriver) CheckKmsKey(ctx context.Context, check resources.KmsKeyCheck) (string, error) {
+	d.logger.InfoContext(ctx, "checking kms key", "kms_key_id", check.KmsKeyId, logging.Region(check.Region))
+	output, err := kms.NewFromConfig(d.regionConfig(check.Region)).DescribeKey(ctx, &kms.DescribeKeyInput{
+		KeyId: aws.String(check.KmsKeyId),
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing kms key %s: %s", check.KmsKeyId, err)
+	}
+
+	key := output.KeyMetadata
+	keyArn := aws.ToString(key.Arn)
+	if key.KeyState != kmstypes.KeyStateEnabled {
+		return "", fmt.Errorf("kms key %s is %s", keyArn, key.KeyState)
+	}
+	if !check.Replicate {
+		return fmt.Sprintf("%s is enabled", keyArn), nil
+	}
+
+	if !aws.ToBool(key.MultiRegion) {
+		return "", fmt.Errorf("kms key %s is not a multi-Region key and cannot be replicated to the copy destinations", keyArn)
+	}
+	if key.MultiRegionConfiguration != nil && key.MultiRegionConfiguration.MultiRegionKeyType != kmstypes.MultiRegionKeyTypePrimary {
+		primary := aws.ToString(key.MultiRegionConfiguration.PrimaryKey.Arn)
+		return "", fmt.Errorf("kms key %s is a replica and cannot be replicated, use its primary key %s", keyArn, primary)
+	}
+
+	return fmt.Sprintf("%s is an enabled multi-Region primary key", keyArn), nil
+}
+
+// CheckAmiName checks that an AMI named like properties that the account owns in region would be adopted by a
+// publish, i.e. that it has the properties. A publish registers the AMI when there is none.
+func (d *SDKPreflightDriver) CheckAmiName(ctx context.Context, region string, properties resources.AmiProperties) (string, error) {
+	d.logger.InfoContext(ctx, "checking ami name", "name", properties.Name, logging.Region(region))
+	image, err := findExistingAmi(ctx, ec2.NewFromConfig(d.regionConfig(region)), resources.AmiDriverConfig{AmiProperties: properties})
+	if err != nil {
+		return "", err
+	}
+	if image != nil {
+		return fmt.Sprintf("would adopt %s", aws.ToString(image.ImageId)), nil
+	}
+
+	return fmt.Sprintf("no AMI named %s", properties.Name), nil
+}
+
+// CheckPermissions simulates the policies of the principal of the credentials of the region, and lists the
+// actions they do not allow
+func (d *SDKPreflightDriver) CheckPermissions(ctx context.Context, check resources.PermissionsCheck) (string, error) {
+	cfg := d.regionConfig(check.Region)
+
+	d.logger.InfoContext(ctx, "checking permissions", logging.Region(check.Region))
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("getting caller identity: %s", err)
+	}
+	callerArn, err := arn.Parse(aws.ToString(identity.Arn))
+	if err != nil {
+		return "", fmt.Errorf("parsing caller identity %s: %s", aws.ToString(identity.Arn), err)
+	}
+
+	iamClient := iam.NewFromConfig(cfg)
+
+	principal, err := d.principal(ctx, iamClient, callerArn)
+	if err != nil {
+		return "", err
+	}
+	if principal == "" {
+		return fmt.Sprintf("%s is not restricted by IAM policies", callerArn), nil
+	}
+
+	// the actions are simulated on the resources they are called on
+	actionsByResource := map[string][]string{}
+	var resourceArns []string
+	for _, action := range check.Actions {
+		resource := "*"
+		if strings.HasPrefix(action, "s3:") {
+			resource = fmt.Sprintf("arn:%s:s3:::%s", callerArn.Partition, check.BucketName)
+			if !s3BucketActions[action] {
+				resource += "/*"
+			}
+		}
+		if _, ok := actionsByResource[resource]; !ok {
+			resourceArns = append(resourceArns, resource)
+		}
+		actionsByResource[resource] = append(actionsByResource[resource], action)
+	}
+
+	var denied []string
+	for _, resource := range resourceArns {
+		paginator := iam.NewSimulatePrincipalPolicyPaginator(iamClient, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     actionsByResource[resource],
+			ResourceArns:    []string{resource},
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return "", fmt.Errorf("simulating policies of %s: %s", principal, err)
+			}
+
+			for _, result := range output.EvaluationResults {
+				if result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+					denied = append(denied, fmt.Sprintf("%s (%s)", aws.ToString(result.EvalActionName), result.EvalDecision))
+				}
+			}
+		}
+	}
+
+	if len(denied) > 0 {
+		return "", fmt.Errorf("%s is not allowed %s", principal, strings.Join(denied, ", "))
+	}
+
+	return fmt.Sprintf("%s is allowed all %d actions", principal, len(check.Actions)), nil
+}
+
+// principal returns the ARN of the user or role whose policies apply to the caller, or an empty string for the
+// root user, to whom no policies apply
+func (d *SDKPreflightDriver) principal(ctx context.Context, iamClient *iam.Client, callerArn arn.ARN) (string, error) {
+	kind, name, _ := strings.Cut(callerArn.Resource, "/")
+	switch kind {
+	case "root":
+		return "", nil
+	case "user", "role":
+		return callerArn.String(), nil
+	case "assumed-role":
+		// the session of an assumed role has the policies of the role, whose ARN includes its path
+		roleName, _, _ := strings.Cut(name, "/")
+		output, err := iamClient.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return "", fmt.Errorf("getting role %s of %s: %s", roleName, callerArn, err)
+		}
+		return aws.ToString(output.Role.Arn), nil
+	default:
+		return "", fmt.Errorf("cannot simulate the policies of %s", callerArn)
+	}
+}
+
+func (d *SDKPreflightDriver) regionConfig(region string) aws.Config {
+	regionCreds := d.creds.ForDestination(region)
+	cfg := regionCreds.GetAwsConfig()
+	logging.ConfigureSDK(&cfg, d.logger.With(logging.Region(region)))
+
+	return cfg
+}
@@ -0,0 +1,143 @@
+package driver_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"light-stemcell-builder/driver"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PreflightDriver", func() {
+	var preflightDriver *driver.SDKPreflightDriver
+
+	BeforeEach(func() {
+		preflightDriver = driver.NewPreflightDriver(logger, creds)
+	})
+
+	Describe("CheckBucket", func() {
+		It("passes for a bucket located in the region", func() {
+			detail, err := preflightDriver.CheckBucket(context.Background(), creds.Region, bucketName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(ContainSubstring(bucketName))
+		})
+
+		It("fails for a bucket located in another region", func() {
+			_, err := preflightDriver.CheckBucket(context.Background(), destinationRegion, bucketName)
+			Expect(err).To(MatchError(fmt.Sprintf("bucket %s is located in %s instead of %s", bucketName, creds.Region, destinationRegion)))
+		})
+
+		It("fails for a bucket that does not exist", func() {
+			_, err := preflightDriver.CheckBucket(context.Background(), creds.Region, fmt.Sprintf("%s-missing-%d", bucketName, time.Now().UnixNano()))
+			Expect(err).To(MatchError(ContainSubstring("getting location of bucket")))
+		})
+	})
+
+	Describe("CheckVmimportRole", func() {
+		It("passes when the vmimport role exists", func() {
+			detail, err := preflightDriver.CheckVmimportRole(context.Background(), creds.Region)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(HaveSuffix(":role/vmimport"))
+		})
+	})
+
+	Describe("CheckKmsKey", func() {
+		It("passes for a multi-Region primary key that is replicated", func() {
+			detail, err := preflightDriver.CheckKmsKey(context.Background(), resources.KmsKeyCheck{
+				Region:    creds.Region,
+				KmsKeyId:  multiRegionKey,
+				Replicate: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(ContainSubstring("multi-Region primary key"))
+		})
+
+		It("passes for a single-Region key that is not replicated", func() {
+			_, err := preflightDriver.CheckKmsKey(context.Background(), resources.KmsKeyCheck{
+				Region:   creds.Region,
+				KmsKeyId: kmsKeyId,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("fails for a single-Region key that is replicated", func() {
+			_, err := preflightDriver.CheckKmsKey(context.Background(), resources.KmsKeyCheck{
+				Region:    creds.Region,
+				KmsKeyId:  kmsKeyId,
+				Replicate: true,
+			})
+			Expect(err).To(MatchError(ContainSubstring("is not a multi-Region key")))
+		})
+	})
+
+	Describe("CheckAmiName", func() {
+		var properties resources.AmiProperties
+
+		BeforeEach(func() {
+			properties = resources.AmiProperties{
+				Name:               fmt.Sprintf("BOSH-preflight-%d", time.Now().UnixNano()),
+				VirtualizationType: resources.HvmAmiVirtualization,
+			}
+		})
+
+		registerImage := func() string {
+			ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+			output, err := ec2Client.RegisterImage(context.Background(), &ec2.RegisterImageInput{
+				Name:               aws.String(properties.Name),
+				Architecture:       ec2types.ArchitectureValuesX8664,
+				BootMode:           ec2types.BootModeValuesLegacyBios,
+				VirtualizationType: aws.String(resources.HvmAmiVirtualization),
+				RootDeviceName:     aws.String("/dev/xvda"),
+				BlockDeviceMappings: []ec2types.BlockDeviceMapping{
+					{DeviceName: aws.String("/dev/xvda"), Ebs: &ec2types.EbsBlockDevice{SnapshotId: aws.String(ebsSnapshotID)}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(func() {
+				ec2Client.DeregisterImage(context.Background(), &ec2.DeregisterImageInput{ImageId: output.ImageId}) //nolint:errcheck
+			})
+			return aws.ToString(output.ImageId)
+		}
+
+		It("passes when no AMI has the name", func() {
+			detail, err := preflightDriver.CheckAmiName(context.Background(), creds.Region, properties)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(Equal("no AMI named " + properties.Name))
+		})
+
+		It("passes with the AMI a publish would adopt when an AMI of the account has the name and properties", func() {
+			existingID := registerImage()
+
+			detail, err := preflightDriver.CheckAmiName(context.Background(), creds.Region, properties)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(Equal("would adopt " + existingID))
+		})
+
+		It("fails when an AMI of the account has the name but other properties", func() {
+			existingID := registerImage()
+			properties.Architecture = resources.Arm64AmiArchitecture
+
+			_, err := preflightDriver.CheckAmiName(context.Background(), creds.Region, properties)
+			Expect(err).To(MatchError(ContainSubstring("AMI %s named %s already exists, but has architecture x86_64 instead of arm64", existingID, properties.Name)))
+		})
+	})
+
+	Describe("CheckPermissions", func() {
+		It("passes when the policies of the caller allow the actions", func() {
+			detail, err := preflightDriver.CheckPermissions(context.Background(), resources.PermissionsCheck{
+				Region:     creds.Region,
+				BucketName: bucketName,
+				Actions:    []string{"s3:PutObject", "s3:ListBucket", "ec2:DescribeImages"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(detail).To(ContainSubstring("is allowed all 3 actions"))
+		})
+	})
+})
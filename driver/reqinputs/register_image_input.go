@@ -13,15 +13,23 @@ const (
 	firstDeviceNamePVAmi  = "/dev/sda"
 )
 
-// NewHVMAmiRequestInput builds the required input to create an HVM AMI
-func NewHVMAmiRequestInput(amiName string, amiDescription string, snapshotID string, efi bool) *ec2.RegisterImageInput {
+// NewHVMAmiRequestInput builds the required input to create an HVM AMI. arm64 AMIs
+// always boot with UEFI, as Graviton instances do not support legacy BIOS.
+func NewHVMAmiRequestInput(amiName string, amiDescription string, snapshotID string, efi bool, architecture string) *ec2.RegisterImageInput {
 	bootMode := ec2types.BootModeValuesLegacyBios
 	if efi {
 		bootMode = ec2types.BootModeValuesUefiPreferred
 	}
+
+	amiArchitecture := ec2types.ArchitectureValuesX8664
+	if architecture == resources.Arm64AmiArchitecture {
+		amiArchitecture = ec2types.ArchitectureValuesArm64
+		bootMode = ec2types.BootModeValuesUefi
+	}
+
 	return &ec2.RegisterImageInput{
 		SriovNetSupport:    aws.String("simple"),
-		Architecture:       ec2types.ArchitectureValuesX8664,
+		Architecture:       amiArchitecture,
 		Description:        aws.String(amiDescription),
 		VirtualizationType: aws.String(resources.HvmAmiVirtualization),
 		Name:               aws.String(amiName),
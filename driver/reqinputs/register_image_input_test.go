@@ -13,7 +13,7 @@ import (
 var _ = Describe("building inputs for register image", func() {
 	Describe("NewHVMAmiRequestInput", func() {
 		It("builds valid request input for building an HVM AMI", func() {
-			input := reqinputs.NewHVMAmiRequestInput("some-ami-name", "some-ami-description", "some-snapshot-id", false)
+			input := reqinputs.NewHVMAmiRequestInput("some-ami-name", "some-ami-description", "some-snapshot-id", false, "")
 			Expect(input).To(BeAssignableToTypeOf(&ec2.RegisterImageInput{}))
 			Expect(*input.SriovNetSupport).To(Equal("simple"))
 			Expect(string(input.Architecture)).To(Equal(resources.AmiArchitecture))
@@ -29,8 +29,14 @@ var _ = Describe("building inputs for register image", func() {
 		})
 
 		It("sets bootmode correctly when efi is true", func() {
-			input := reqinputs.NewHVMAmiRequestInput("some-ami-name", "some-ami-description", "some-snapshot-id", true)
+			input := reqinputs.NewHVMAmiRequestInput("some-ami-name", "some-ami-description", "some-snapshot-id", true, "")
 			Expect(input.BootMode).To(Equal(ec2types.BootModeValuesUefiPreferred))
 		})
+
+		It("registers arm64 AMIs with UEFI boot mode", func() {
+			input := reqinputs.NewHVMAmiRequestInput("some-ami-name", "some-ami-description", "some-snapshot-id", false, resources.Arm64AmiArchitecture)
+			Expect(input.Architecture).To(Equal(ec2types.ArchitectureValuesArm64))
+			Expect(input.BootMode).To(Equal(ec2types.BootModeValuesUefi))
+		})
 	})
 })
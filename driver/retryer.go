@@ -2,14 +2,18 @@ package driver
 
 import (
 	"strings"
+	"time"
+
+	"light-stemcell-builder/metrics"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 )
 
-// NewS3RetryerWithRetries returns an S3Retryer configured with the specified number of max retries.
-func NewS3RetryerWithRetries(numRetries int) S3Retryer {
-	return S3Retryer{NumMaxRetries: numRetries}
+// NewS3RetryerWithRetries returns an S3Retryer configured with the specified number of max retries,
+// that counts its retries in the metrics of region.
+func NewS3RetryerWithRetries(numRetries int, region string) S3Retryer {
+	return S3Retryer{NumMaxRetries: numRetries, Region: region}
 }
 
 // S3Retryer handles more error conditions than the default retryer when
@@ -17,6 +21,8 @@ func NewS3RetryerWithRetries(numRetries int) S3Retryer {
 // the standard retry conditions.
 type S3Retryer struct {
 	NumMaxRetries int
+	// Region is the region the retries are counted for in the metrics
+	Region string
 }
 
 // MaxRetries returns the configured number of NumMaxRetries, defaults to 3.
@@ -47,8 +53,25 @@ func (r S3Retryer) AsAWSRetryer() aws.Retryer {
 		}
 		return aws.UnknownTernary
 	})
-	return retry.NewStandard(func(o *retry.StandardOptions) {
+	standard := retry.NewStandard(func(o *retry.StandardOptions) {
 		o.MaxAttempts = maxAttempts
 		o.Retryables = append([]retry.IsErrorRetryable{serializationChecker}, o.Retryables...)
 	})
+	metrics.AddS3Retries(r.Region, 0)
+	return countingRetryer{RetryerV2: standard, region: r.Region}
+}
+
+// countingRetryer counts the retries of the retryer it wraps in the metrics of its region
+type countingRetryer struct {
+	aws.RetryerV2
+	region string
+}
+
+// RetryDelay is called once for every request that is retried, before the retry
+func (r countingRetryer) RetryDelay(attempt int, err error) (time.Duration, error) {
+	delay, delayErr := r.RetryerV2.RetryDelay(attempt, err)
+	if delayErr == nil {
+		metrics.AddS3Retries(r.region, 1)
+	}
+	return delay, delayErr
 }
@@ -2,8 +2,11 @@ package driver_test
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 
 	"light-stemcell-builder/driver"
+	"light-stemcell-builder/metrics"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -12,8 +15,9 @@ import (
 var _ = Describe("Retryer", func() {
 	Describe("NewS3RetryerWithRetries", func() {
 		It("sets the number of max retries", func() {
-			r := driver.NewS3RetryerWithRetries(33)
+			r := driver.NewS3RetryerWithRetries(33, "us-east-1")
 			Expect(r.MaxRetries()).To(Equal(33))
+			Expect(r.Region).To(Equal("us-east-1"))
 		})
 	})
 
@@ -41,5 +45,22 @@ var _ = Describe("Retryer", func() {
 			// Delegates to Standard which returns false for plain errors
 			Expect(r.IsErrorRetryable(err)).To(BeFalse())
 		})
+
+		It("counts the retries of its region in the metrics", func() {
+			retryer := driver.NewS3RetryerWithRetries(5, "retryer-test-region").AsAWSRetryer()
+			err := errors.New("SerializationError: failed to decode S3 XML error response")
+			Expect(retryer.IsErrorRetryable(err)).To(BeTrue())
+
+			_, delayErr := retryer.RetryDelay(1, err)
+			Expect(delayErr).NotTo(HaveOccurred())
+			_, delayErr = retryer.RetryDelay(2, err)
+			Expect(delayErr).NotTo(HaveOccurred())
+
+			path := filepath.Join(GinkgoT().TempDir(), "metrics.prom")
+			Expect(metrics.WriteTextfile(path)).To(Succeed())
+			contents, readErr := os.ReadFile(path)
+			Expect(readErr).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(`light_stemcell_builder_s3_retries_total{region="retryer-test-region"} 2`))
+		})
 	})
 })
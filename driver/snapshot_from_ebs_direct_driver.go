@@ -0,0 +1,273 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ebs"
+	ebstypes "github.com/aws/aws-sdk-go-v2/service/ebs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	ebsDirectUploadWorkers    = 16
+	ebsDirectMaxAttempts      = 5
+	ebsDirectDefaultBlockSize = 512 * 1024
+)
+
+var _ resources.SnapshotDriver = &SDKSnapshotFromEbsDirectDriver{}
+
+// SDKSnapshotFromEbsDirectDriver creates a snapshot by writing a local RAW machine image
+// with the EBS direct APIs, without an S3 bucket or the VM Import service role
+type SDKSnapshotFromEbsDirectDriver struct {
+	ec2Client *ec2.Client
+	ebsClient *ebs.Client
+	logger    *slog.Logger
+}
+
+// NewSnapshotFromEbsDirectDriver creates a SDKSnapshotFromEbsDirectDriver for creating snapshots in EC2
+func NewSnapshotFromEbsDirectDriver(logger *slog.Logger, creds config.Credentials) *SDKSnapshotFromEbsDirectDriver {
+	logger = logger.With(logging.Driver("SDKSnapshotFromEbsDirectDriver"), logging.Region(creds.Region))
+	cfg := creds.GetAwsConfig()
+	logging.ConfigureSDK(&cfg, logger)
+
+	// throttled and failed requests are retried more often, as a snapshot is written with many of them
+	ebsClient := ebs.NewFromConfig(cfg, func(o *ebs.Options) { o.RetryMaxAttempts = ebsDirectMaxAttempts })
+
+	ec2Client := ec2.NewFromConfig(cfg)
+	return &SDKSnapshotFromEbsDirectDriver{ec2Client: ec2Client, ebsClient: ebsClient, logger: logger}
+}
+
+// Create writes the machine image at MachineImagePath to a new snapshot. Blocks that only
+// contain zeros are skipped, the others are written in parallel along with their checksums.
+func (d *SDKSnapshotFromEbsDirectDriver) Create(ctx context.Context, driverConfig resources.SnapshotDriverConfig) (_ resources.Snapshot, err error) {
+	createStartTime := time.Now()
+	defer func(startTime time.Time) {
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
+	}(createStartTime)
+
+	if driverConfig.FileFormat != resources.VolumeRawFormat {
+		return resources.Snapshot{}, fmt.Errorf("snapshots can only be written directly from %s images, not %s", resources.VolumeRawFormat, driverConfig.FileFormat)
+	}
+
+	image, err := os.Open(driverConfig.MachineImagePath)
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("opening machine image: %s", err)
+	}
+	defer image.Close() //nolint:errcheck
+
+	info, err := image.Stat()
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("reading machine image: %s", err)
+	}
+
+	volumeSizeGB := (info.Size() + gbInBytes - 1) / gbInBytes
+	if volumeSizeGB < 1 {
+		volumeSizeGB = 1
+	}
+
+	input := &ebs.StartSnapshotInput{
+		VolumeSize:  aws.Int64(volumeSizeGB),
+		Description: aws.String(fmt.Sprintf("bosh-light-stemcell-builder-%d", time.Now().UnixNano())),
+		Encrypted:   aws.Bool(driverConfig.Encrypted),
+	}
+	if driverConfig.KmsAlias.ARN != "" { //nolint:staticcheck
+		input.KmsKeyArn = aws.String(driverConfig.KmsAlias.ARN) //nolint:staticcheck
+	}
+	for _, tag := range stemcellTags(driverConfig.Tags, ec2types.Tag{Key: aws.String(resources.CreatedByTagKey), Value: aws.String(resources.CreatedByTagValue)}) {
+		input.Tags = append(input.Tags, ebstypes.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	d.logger.InfoContext(ctx, "starting snapshot for machine image", "volume_size_gb", volumeSizeGB, "path", driverConfig.MachineImagePath)
+	started, err := d.ebsClient.StartSnapshot(ctx, input)
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("starting snapshot: %s", err)
+	}
+	snapshotID := aws.ToString(started.SnapshotId)
+
+	// a snapshot that could not be written is of no use, and is deleted also when ctx was cancelled
+	defer func() {
+		if err != nil {
+			d.deleteSnapshot(ctx, snapshotID)
+		}
+	}()
+
+	blockSize := int(aws.ToInt32(started.BlockSize))
+	if blockSize == 0 {
+		blockSize = ebsDirectDefaultBlockSize
+	}
+
+	checksums, err := d.putBlocks(ctx, snapshotID, image, info.Size(), blockSize)
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("writing blocks to snapshot %s: %s", snapshotID, err)
+	}
+
+	var changedBlocks int64
+	aggregate := sha256.New()
+	for _, checksum := range checksums {
+		if checksum != nil {
+			changedBlocks++
+			aggregate.Write(checksum)
+		}
+	}
+
+	d.logger.InfoContext(ctx, "completing snapshot", "snapshot_id", snapshotID, "blocks_written", changedBlocks, "blocks", len(checksums))
+	_, err = d.ebsClient.CompleteSnapshot(ctx, &ebs.CompleteSnapshotInput{
+		SnapshotId:                aws.String(snapshotID),
+		ChangedBlocksCount:        aws.Int32(int32(changedBlocks)),
+		Checksum:                  aws.String(base64.StdEncoding.EncodeToString(aggregate.Sum(nil))),
+		ChecksumAlgorithm:         ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256,
+		ChecksumAggregationMethod: ebstypes.ChecksumAggregationMethodChecksumAggregationLinear,
+	})
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("completing snapshot %s: %s", snapshotID, err)
+	}
+
+	d.logger.InfoContext(ctx, "waiting for snapshot to be completed", "snapshot_id", snapshotID)
+	snapshotCompletedWaiter := ec2.NewSnapshotCompletedWaiter(d.ec2Client)
+	err = snapshotCompletedWaiter.Wait(ctx, &ec2.DescribeSnapshotsInput{
+		SnapshotIds: []string{snapshotID},
+	}, 30*time.Minute)
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("waiting for snapshot %s to be completed: %s", snapshotID, err)
+	}
+
+	d.logger.InfoContext(ctx, "created snapshot", "snapshot_id", snapshotID)
+
+	if driverConfig.Accessibility != resources.PrivateAmiAccessibility {
+		_, err = d.ec2Client.ModifySnapshotAttribute(ctx, &ec2.ModifySnapshotAttributeInput{
+			SnapshotId:    aws.String(snapshotID),
+			Attribute:     ec2types.SnapshotAttributeNameCreateVolumePermission,
+			OperationType: ec2types.OperationTypeAdd,
+			GroupNames:    []string{"all"},
+		})
+		if err != nil {
+			return resources.Snapshot{}, fmt.Errorf("making snapshot with id %s public: %s", snapshotID, err)
+		}
+
+		d.logger.InfoContext(ctx, "snapshot is public", "snapshot_id", snapshotID)
+	}
+
+	createdVolumeSizeGB, err := snapshotVolumeSizeGB(ctx, d.ec2Client, snapshotID)
+	if err != nil {
+		return resources.Snapshot{}, err
+	}
+
+	return resources.Snapshot{ID: snapshotID, VolumeSizeGB: createdVolumeSizeGB}, nil
+}
+
+// deleteSnapshot deletes a snapshot that failed to be written. Failures are only logged, sweep
+// removes the snapshots that are left behind.
+func (d *SDKSnapshotFromEbsDirectDriver) deleteSnapshot(ctx context.Context, snapshotID string) {
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	d.logger.InfoContext(ctx, "deleting snapshot that could not be written", "snapshot_id", snapshotID)
+	_, err := d.ec2Client.DeleteSnapshot(cleanupCtx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshotID)})
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to delete snapshot", "snapshot_id", snapshotID, "error", err)
+	}
+}
+
+// putBlocks writes every block of image that is not all zeros and returns the SHA-256
+// sum of each block by index, nil for the blocks that were skipped
+func (d *SDKSnapshotFromEbsDirectDriver) putBlocks(ctx context.Context, snapshotID string, image io.ReaderAt, size int64, blockSize int) ([][]byte, error) {
+	blockCount := (size + int64(blockSize) - 1) / int64(blockSize)
+	checksums := make([][]byte, blockCount)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var written int64
+	indices := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < ebsDirectUploadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			block := make([]byte, blockSize)
+			zeros := make([]byte, blockSize)
+			for index := range indices {
+				n, err := image.ReadAt(block, index*int64(blockSize))
+				if err != nil && !errors.Is(err, io.EOF) {
+					fail(fmt.Errorf("reading block %d: %s", index, err))
+					continue
+				}
+				clear(block[n:])
+
+				if bytes.Equal(block, zeros) {
+					continue
+				}
+
+				sum := sha256.Sum256(block)
+				err = d.putBlock(ctx, snapshotID, index, block, base64.StdEncoding.EncodeToString(sum[:]))
+				if err != nil {
+					fail(fmt.Errorf("writing block %d: %s", index, err))
+					continue
+				}
+				checksums[index] = sum[:]
+
+				if count := atomic.AddInt64(&written, 1); count%1000 == 0 {
+					d.logger.InfoContext(ctx, "wrote blocks to snapshot", "blocks_written", count, "snapshot_id", snapshotID)
+				}
+			}
+		}()
+	}
+
+	for index := int64(0); index < blockCount && ctx.Err() == nil; index++ {
+		select {
+		case indices <- index:
+		case <-ctx.Done():
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return checksums, nil
+}
+
+// putBlock writes a block. Throttled requests and server errors are retried by the client.
+func (d *SDKSnapshotFromEbsDirectDriver) putBlock(ctx context.Context, snapshotID string, index int64, block []byte, checksum string) error {
+	_, err := d.ebsClient.PutSnapshotBlock(ctx, &ebs.PutSnapshotBlockInput{
+		SnapshotId:        aws.String(snapshotID),
+		BlockIndex:        aws.Int32(int32(index)),
+		BlockData:         bytes.NewReader(block),
+		DataLength:        aws.Int32(int32(len(block))),
+		Checksum:          aws.String(checksum),
+		ChecksumAlgorithm: ebstypes.ChecksumAlgorithmChecksumAlgorithmSha256,
+	})
+	return err
+}
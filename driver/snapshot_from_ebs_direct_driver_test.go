@@ -0,0 +1,102 @@
+package driver_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/fakeaws"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SnapshotFromEbsDirectDriver", func() {
+	const blockSize = 512 * 1024
+
+	It("writes the non-empty blocks of a RAW machine image to a new snapshot", func() {
+		// block 0 and the partial block 3 have data, blocks 1 and 2 are empty
+		image := make([]byte, 3*blockSize+1000)
+		copy(image, bytes.Repeat([]byte("bosh"), 1024))
+		copy(image[3*blockSize:], bytes.Repeat([]byte("x"), 1000))
+
+		imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+		Expect(os.WriteFile(imagePath, image, 0644)).To(Succeed())
+
+		ds := driverset.NewEbsDirectStandardRegionDriverSet(logger, creds)
+		snapshot, err := ds.CreateSnapshotDriver().Create(context.Background(), resources.SnapshotDriverConfig{
+			MachineImagePath: imagePath,
+			FileFormat:       resources.VolumeRawFormat,
+			AmiProperties:    resources.AmiProperties{Accessibility: resources.PrivateAmiAccessibility},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+		reqOutput, err := ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{snapshot.ID}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reqOutput.Snapshots).To(HaveLen(1))
+		Expect(reqOutput.Snapshots[0].State).To(Equal(ec2types.SnapshotStateCompleted))
+		Expect(aws.ToInt32(reqOutput.Snapshots[0].VolumeSize)).To(Equal(int32(1)))
+		Expect(snapshot.VolumeSizeGB).To(Equal(int64(1)))
+		Expect(reqOutput.Snapshots[0].Tags).To(ContainElement(ec2types.Tag{
+			Key:   aws.String(resources.CreatedByTagKey),
+			Value: aws.String(resources.CreatedByTagValue),
+		}))
+
+		if fakeAWS != nil {
+			Expect(fakeaws.EBSBlockSize).To(Equal(blockSize))
+
+			blocks := fakeAWS.SnapshotBlocks(creds.Region, snapshot.ID)
+			Expect(blocks).To(HaveLen(2))
+			Expect(blocks[0]).To(Equal(image[:blockSize]))
+			Expect(blocks[3]).To(Equal(append(image[3*blockSize:], make([]byte, blockSize-1000)...)))
+		}
+
+		_, err = ec2Client.DeleteSnapshot(context.Background(), &ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshot.ID)})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("deletes the snapshot when a block cannot be written", func() {
+		if fakeAWS == nil {
+			Skip("Skipping test, writing a block only fails against fakeaws")
+		}
+		fakeAWS.FailSnapshotBlocks("fail-blocks")
+
+		imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+		Expect(os.WriteFile(imagePath, bytes.Repeat([]byte("bosh"), blockSize/4), 0644)).To(Succeed())
+
+		ds := driverset.NewEbsDirectStandardRegionDriverSet(logger, creds)
+		_, err := ds.CreateSnapshotDriver().Create(context.Background(), resources.SnapshotDriverConfig{
+			MachineImagePath: imagePath,
+			FileFormat:       resources.VolumeRawFormat,
+			AmiProperties: resources.AmiProperties{
+				Accessibility: resources.PrivateAmiAccessibility,
+				Tags:          map[string]string{"fail-blocks": "true"},
+			},
+		})
+		Expect(err).To(MatchError(ContainSubstring("writing blocks to snapshot")))
+
+		snapshotID := regexp.MustCompile(`snap-[0-9a-z]+`).FindString(err.Error())
+		Expect(snapshotID).ToNot(BeEmpty())
+
+		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+		_, err = ec2Client.DescribeSnapshots(context.Background(), &ec2.DescribeSnapshotsInput{SnapshotIds: []string{snapshotID}})
+		Expect(err).To(MatchError(ContainSubstring("InvalidSnapshot.NotFound")))
+	})
+
+	It("only accepts RAW machine images", func() {
+		ds := driverset.NewEbsDirectStandardRegionDriverSet(logger, creds)
+		_, err := ds.CreateSnapshotDriver().Create(context.Background(), resources.SnapshotDriverConfig{
+			MachineImagePath: machineImagePath,
+			FileFormat:       resources.VolumeVMDKFormat,
+		})
+		Expect(err).To(MatchError("snapshots can only be written directly from RAW images, not vmdk"))
+	})
+})
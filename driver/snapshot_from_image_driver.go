@@ -3,12 +3,14 @@ package driver
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/metrics"
 	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -20,72 +22,98 @@ var _ resources.SnapshotDriver = &SDKSnapshotFromImageDriver{}
 // SDKSnapshotFromImageDriver creates an AMI directly from a machine image
 type SDKSnapshotFromImageDriver struct {
 	ec2Client *ec2.Client
-	logger    *log.Logger
+	region    string
+	logger    *slog.Logger
 }
 
 // NewSnapshotFromImageDriver creates a SDKSnapshotFromImageDriver for creating snapshots in EC2
-func NewSnapshotFromImageDriver(logDest io.Writer, creds config.Credentials) *SDKSnapshotFromImageDriver {
-	logger := log.New(logDest, "SDKSnapshotFromImageDriver ", log.LstdFlags)
+func NewSnapshotFromImageDriver(logger *slog.Logger, creds config.Credentials) *SDKSnapshotFromImageDriver {
+	logger = logger.With(logging.Driver("SDKSnapshotFromImageDriver"), logging.Region(creds.Region))
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 
 	ec2Client := ec2.NewFromConfig(cfg)
-	return &SDKSnapshotFromImageDriver{ec2Client: ec2Client, logger: logger}
+	return &SDKSnapshotFromImageDriver{ec2Client: ec2Client, region: creds.Region, logger: logger}
 }
 
 // Create produces a snapshot in EC2 from a machine image previously uploaded to S3
-func (d *SDKSnapshotFromImageDriver) Create(driverConfig resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+func (d *SDKSnapshotFromImageDriver) Create(ctx context.Context, driverConfig resources.SnapshotDriverConfig) (resources.Snapshot, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
-
-	d.logger.Printf("initiating ImportSnapshot task from image: %s\n", driverConfig.MachineImageURL)
+	importTaskID := driverConfig.ImportTaskID
+	if importTaskID != "" {
+		d.logger.InfoContext(ctx, "resuming ImportSnapshot task", logging.TaskID(importTaskID))
+	} else {
+		d.logger.InfoContext(ctx, "initiating ImportSnapshot task from image", "url", objectLocation(driverConfig.MachineImageURL))
+
+		input := &ec2.ImportSnapshotInput{
+			DiskContainer: &ec2types.SnapshotDiskContainer{
+				Url:    &driverConfig.MachineImageURL,
+				Format: aws.String(driverConfig.FileFormat),
+			},
+			Encrypted: &driverConfig.AmiProperties.Encrypted, //nolint:staticcheck
+		}
 
-	input := &ec2.ImportSnapshotInput{
-		DiskContainer: &ec2types.SnapshotDiskContainer{
-			Url:    &driverConfig.MachineImageURL,
-			Format: aws.String(driverConfig.FileFormat),
-		},
-		Encrypted: &driverConfig.AmiProperties.Encrypted, //nolint:staticcheck
-	}
+		if driverConfig.KmsAlias.ARN != "" { //nolint:staticcheck
+			input.KmsKeyId = &driverConfig.KmsAlias.ARN //nolint:staticcheck
+		}
 
-	if driverConfig.KmsAlias.ARN != "" { //nolint:staticcheck
-		input.KmsKeyId = &driverConfig.KmsAlias.ARN //nolint:staticcheck
-	}
+		reqOutput, err := d.ec2Client.ImportSnapshot(ctx, input)
+		if err != nil {
+			return resources.Snapshot{}, fmt.Errorf("creating import snapshot task: %s", err)
+		}
+		importTaskID = *reqOutput.ImportTaskId
 
-	reqOutput, err := d.ec2Client.ImportSnapshot(ctx, input)
-	if err != nil {
-		return resources.Snapshot{}, fmt.Errorf("creating import snapshot task: %s", err)
+		if driverConfig.ImportTaskStarted != nil {
+			err = driverConfig.ImportTaskStarted(importTaskID)
+			if err != nil {
+				return resources.Snapshot{}, fmt.Errorf("recording import snapshot task %s: %s", importTaskID, err)
+			}
+		}
 	}
 
-	d.logger.Printf("waiting on ImportSnapshot task %s\n", *reqOutput.ImportTaskId)
+	d.logger.InfoContext(ctx, "waiting on ImportSnapshot task", logging.TaskID(importTaskID))
+	tracing.SetAttributes(ctx, tracing.TaskID(importTaskID))
 
 	taskFilter := &ec2.DescribeImportSnapshotTasksInput{
-		ImportTaskIds: []string{*reqOutput.ImportTaskId},
+		ImportTaskIds: []string{importTaskID},
 	}
 
 	waitStartTime := time.Now()
-	err = d.waitUntilImportSnapshotTaskCompleted(ctx, taskFilter)
+	err := d.waitUntilImportSnapshotTaskCompleted(ctx, taskFilter)
 	if err != nil {
 		return resources.Snapshot{}, fmt.Errorf("waiting for snapshot to become available: %s", err)
 	}
 
-	d.logger.Printf("waited on import task %s for %f minutes\n", *reqOutput.ImportTaskId, time.Since(waitStartTime).Minutes())
+	waitDuration := time.Since(waitStartTime)
+	d.logger.InfoContext(ctx, "waited on ImportSnapshot task", logging.TaskID(importTaskID), "duration", waitDuration)
+	metrics.ObserveImportWait(d.region, metrics.ImportSnapshotTask, waitDuration)
 
 	describeOutput, err := d.ec2Client.DescribeImportSnapshotTasks(ctx, taskFilter)
 	if err != nil {
-		return resources.Snapshot{}, fmt.Errorf("describing snapshot from import snapshot task %s: %s", *reqOutput.ImportTaskId, err)
+		return resources.Snapshot{}, fmt.Errorf("describing snapshot from import snapshot task %s: %s", importTaskID, err)
 	}
 
 	snapshotIDptr := describeOutput.ImportSnapshotTasks[0].SnapshotTaskDetail.SnapshotId
 	if snapshotIDptr == nil {
-		return resources.Snapshot{}, fmt.Errorf("snapshot ID empty for import task: %s", *reqOutput.ImportTaskId)
+		return resources.Snapshot{}, fmt.Errorf("snapshot ID empty for import task: %s", importTaskID)
 	}
 
-	d.logger.Printf("created snapshot %s\n", *snapshotIDptr)
+	d.logger.InfoContext(ctx, "created snapshot", "snapshot_id", *snapshotIDptr, logging.TaskID(importTaskID))
+
+	// ImportSnapshot can only tag the import task, so the snapshot is tagged once it exists
+	_, err = d.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{*snapshotIDptr},
+		Tags: stemcellTags(driverConfig.Tags,
+			ec2types.Tag{Key: aws.String(resources.CreatedByTagKey), Value: aws.String(resources.CreatedByTagValue)},
+		),
+	})
+	if err != nil {
+		return resources.Snapshot{}, fmt.Errorf("tagging snapshot %s: %s", *snapshotIDptr, err)
+	}
 
 	if driverConfig.Accessibility != resources.PrivateAmiAccessibility {
 		modifySnapshotAttributeInput := &ec2.ModifySnapshotAttributeInput{
@@ -99,10 +127,15 @@ func (d *SDKSnapshotFromImageDriver) Create(driverConfig resources.SnapshotDrive
 			return resources.Snapshot{}, fmt.Errorf("making snapshot with id %s public: %s", *snapshotIDptr, err)
 		}
 
-		d.logger.Printf("snapshot %s is public\n", *snapshotIDptr)
+		d.logger.InfoContext(ctx, "snapshot is public", "snapshot_id", *snapshotIDptr)
+	}
+
+	volumeSizeGB, err := snapshotVolumeSizeGB(ctx, d.ec2Client, *snapshotIDptr)
+	if err != nil {
+		return resources.Snapshot{}, err
 	}
 
-	return resources.Snapshot{ID: *snapshotIDptr}, nil
+	return resources.Snapshot{ID: *snapshotIDptr, VolumeSizeGB: volumeSizeGB}, nil
 }
 
 // waitUntilImportSnapshotTaskCompleted polls until all import snapshot tasks are completed.
@@ -19,10 +19,10 @@ var _ = Describe("SnapshotFromImageDriver", func() {
 			FileFormat:      s3MachineImageFormat,
 		}
 
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 		driver := ds.CreateSnapshotDriver()
 
-		snapshot, err := driver.Create(driverConfig)
+		snapshot, err := driver.Create(context.Background(), driverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
@@ -31,6 +31,7 @@ var _ = Describe("SnapshotFromImageDriver", func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		Expect(len(reqOutput.Snapshots)).To(Equal(1))
+		Expect(snapshot.VolumeSizeGB).To(Equal(int64(aws.ToInt32(reqOutput.Snapshots[0].VolumeSize))))
 
 		snapshotAttributes, err := ec2Client.DescribeSnapshotAttribute(context.Background(), &ec2.DescribeSnapshotAttributeInput{
 			SnapshotId: aws.String(snapshot.ID),
@@ -55,10 +56,10 @@ var _ = Describe("SnapshotFromImageDriver", func() {
 
 		driverConfig.Accessibility = resources.PrivateAmiAccessibility
 
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 		driver := ds.CreateSnapshotDriver()
 
-		snapshot, err := driver.Create(driverConfig)
+		snapshot, err := driver.Create(context.Background(), driverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
@@ -81,4 +82,36 @@ var _ = Describe("SnapshotFromImageDriver", func() {
 		})
 		Expect(err).To(BeNil())
 	})
+
+	It("records a newly started import task and can resume waiting on it", func() {
+		var startedTaskID string
+		driverConfig := resources.SnapshotDriverConfig{
+			MachineImageURL: s3MachineImageUrl,
+			FileFormat:      s3MachineImageFormat,
+			ImportTaskStarted: func(importTaskID string) error {
+				startedTaskID = importTaskID
+				return nil
+			},
+		}
+
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
+		driver := ds.CreateSnapshotDriver()
+
+		snapshot, err := driver.Create(context.Background(), driverConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(startedTaskID).ToNot(BeEmpty())
+
+		resumedSnapshot, err := driver.Create(context.Background(), resources.SnapshotDriverConfig{
+			ImportTaskID: startedTaskID,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resumedSnapshot).To(Equal(snapshot))
+
+		//cleanup
+		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
+		_, err = ec2Client.DeleteSnapshot(context.Background(), &ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(snapshot.ID),
+		})
+		Expect(err).To(BeNil())
+	})
 })
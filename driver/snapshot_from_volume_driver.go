@@ -3,11 +3,11 @@ package driver
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/resources"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -20,32 +20,35 @@ var _ resources.SnapshotDriver = &SDKSnapshotFromVolumeDriver{}
 // SDKSnapshotFromVolumeDriver creates an AMI from a previously created EBS volume
 type SDKSnapshotFromVolumeDriver struct {
 	ec2Client *ec2.Client
-	logger    *log.Logger
+	logger    *slog.Logger
 }
 
 // NewSnapshotFromVolumeDriver creates a NewSnapshotFromVolumeDriver for creating snapshots in EC2
-func NewSnapshotFromVolumeDriver(logDest io.Writer, creds config.Credentials) *SDKSnapshotFromVolumeDriver {
-	logger := log.New(logDest, "SDKSnapshotFromVolumeDriver ", log.LstdFlags)
+func NewSnapshotFromVolumeDriver(logger *slog.Logger, creds config.Credentials) *SDKSnapshotFromVolumeDriver {
+	logger = logger.With(logging.Driver("SDKSnapshotFromVolumeDriver"), logging.Region(creds.Region))
 	cfg := creds.GetAwsConfig()
-	cfg.Logger = newDriverLogger(logger)
+	logging.ConfigureSDK(&cfg, logger)
 
 	ec2Client := ec2.NewFromConfig(cfg)
 	return &SDKSnapshotFromVolumeDriver{ec2Client: ec2Client, logger: logger}
 }
 
 // Create produces a snapshot in EC2 from a previously created EBS volume
-func (d *SDKSnapshotFromVolumeDriver) Create(driverConfig resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+func (d *SDKSnapshotFromVolumeDriver) Create(ctx context.Context, driverConfig resources.SnapshotDriverConfig) (resources.Snapshot, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		d.logger.Printf("completed Create() in %f minutes\n", time.Since(startTime).Minutes())
+		d.logger.InfoContext(ctx, "completed Create()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	ctx := context.Background()
-
-	d.logger.Printf("initiating CreateSnapshot task from volume: %s\n", driverConfig.VolumeID)
+	d.logger.InfoContext(ctx, "initiating CreateSnapshot task from volume", "volume_id", driverConfig.VolumeID)
 	reqOutput, err := d.ec2Client.CreateSnapshot(ctx, &ec2.CreateSnapshotInput{
 		VolumeId:    aws.String(driverConfig.VolumeID),
 		Description: aws.String(fmt.Sprintf("bosh-light-stemcell-builder-%d", time.Now().UnixNano())),
+		TagSpecifications: []ec2types.TagSpecification{
+			tagSpecification(ec2types.ResourceTypeSnapshot, stemcellTags(driverConfig.Tags,
+				ec2types.Tag{Key: aws.String(resources.CreatedByTagKey), Value: aws.String(resources.CreatedByTagValue)},
+			)),
+		},
 	})
 	if err != nil {
 		return resources.Snapshot{}, fmt.Errorf("creating snapshot from EBS volume: %s: %s", driverConfig.VolumeID, err)
@@ -62,7 +65,7 @@ func (d *SDKSnapshotFromVolumeDriver) Create(driverConfig resources.SnapshotDriv
 		return resources.Snapshot{}, fmt.Errorf("making snapshot with id %s public: %s", *reqOutput.SnapshotId, err)
 	}
 
-	d.logger.Printf("waiting on snapshot %s to be completed\n", *reqOutput.SnapshotId)
+	d.logger.InfoContext(ctx, "waiting on snapshot to be completed", "snapshot_id", *reqOutput.SnapshotId)
 	waitStartTime := time.Now()
 
 	snapshotCompletedWaiter := ec2.NewSnapshotCompletedWaiter(d.ec2Client, func(o *ec2.SnapshotCompletedWaiterOptions) {
@@ -76,8 +79,13 @@ func (d *SDKSnapshotFromVolumeDriver) Create(driverConfig resources.SnapshotDriv
 		return resources.Snapshot{}, fmt.Errorf("waiting for snapshot to complete: %s", err)
 	}
 
-	d.logger.Printf("waited for snapshot %s completion for %f minutes\n", *reqOutput.SnapshotId, time.Since(waitStartTime).Minutes())
-	d.logger.Printf("created snapshot %s\n", *reqOutput.SnapshotId)
+	d.logger.InfoContext(ctx, "waited for snapshot completion", "snapshot_id", *reqOutput.SnapshotId, "duration", time.Since(waitStartTime))
+	d.logger.InfoContext(ctx, "created snapshot", "snapshot_id", *reqOutput.SnapshotId)
+
+	volumeSizeGB, err := snapshotVolumeSizeGB(ctx, d.ec2Client, *reqOutput.SnapshotId)
+	if err != nil {
+		return resources.Snapshot{}, err
+	}
 
-	return resources.Snapshot{ID: *reqOutput.SnapshotId}, nil
+	return resources.Snapshot{ID: *reqOutput.SnapshotId, VolumeSizeGB: volumeSizeGB}, nil
 }
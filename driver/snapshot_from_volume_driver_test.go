@@ -16,10 +16,10 @@ var _ = Describe("SnapshotFromVolumeDriver", func() {
 	It("creates a public snapshot from an existing EBS volume", func() {
 		driverConfig := resources.SnapshotDriverConfig{VolumeID: ebsVolumeID}
 
-		ds := driverset.NewIsolatedRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewIsolatedRegionDriverSet(logger, creds)
 		driver := ds.CreateSnapshotDriver()
 
-		snapshot, err := driver.Create(driverConfig)
+		snapshot, err := driver.Create(context.Background(), driverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
@@ -28,6 +28,7 @@ var _ = Describe("SnapshotFromVolumeDriver", func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		Expect(len(reqOutput.Snapshots)).To(Equal(1))
+		Expect(snapshot.VolumeSizeGB).To(Equal(int64(aws.ToInt32(reqOutput.Snapshots[0].VolumeSize))))
 
 		snapshotAttributes, err := ec2Client.DescribeSnapshotAttribute(context.Background(), &ec2.DescribeSnapshotAttributeInput{
 			SnapshotId: aws.String(snapshot.ID),
@@ -0,0 +1,24 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// snapshotVolumeSizeGB returns the size of the volume of a snapshot, as EC2 reports it
+func snapshotVolumeSizeGB(ctx context.Context, client *ec2.Client, snapshotID string) (int64, error) {
+	output, err := client.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		SnapshotIds: []string{snapshotID},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("describing snapshot %s: %s", snapshotID, err)
+	}
+	if len(output.Snapshots) == 0 {
+		return 0, fmt.Errorf("snapshot %s not found", snapshotID)
+	}
+
+	return int64(aws.ToInt32(output.Snapshots[0].VolumeSize)), nil
+}
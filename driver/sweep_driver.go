@@ -0,0 +1,298 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Naming conventions of the resources created by the builder
+const (
+	machineImageKeyPrefix         = "bosh-machine-image-"
+	snapshotFromVolumeDescription = "bosh-light-stemcell-builder-*"
+)
+
+var _ resources.SweepDriver = &SDKSweepDriver{}
+
+// SDKSweepDriver uses the AWS SDK to find and remove resources left behind by failed runs
+type SDKSweepDriver struct {
+	creds  config.Credentials
+	logger *slog.Logger
+}
+
+// NewSweepDriver creates a SDKSweepDriver for removing orphaned resources
+func NewSweepDriver(logger *slog.Logger, creds config.Credentials) *SDKSweepDriver {
+	return &SDKSweepDriver{creds: creds, logger: logger.With(logging.Driver("SDKSweepDriver"))}
+}
+
+// FindOrphans returns the machine images in the bucket, the unattached import volumes, the
+// snapshots that no AMI uses and the KMS aliases that match filter
+func (d *SDKSweepDriver) FindOrphans(ctx context.Context, filter resources.SweepFilter) ([]resources.Orphan, error) {
+	cfg := d.regionConfig(filter.Region)
+
+	var orphans []resources.Orphan
+
+	if filter.BucketName != "" {
+		objects, err := d.findMachineImages(ctx, s3.NewFromConfig(cfg), filter)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, objects...)
+	}
+
+	ec2Client := ec2.NewFromConfig(cfg)
+
+	volumes, err := d.findVolumes(ctx, ec2Client, filter)
+	if err != nil {
+		return nil, err
+	}
+	orphans = append(orphans, volumes...)
+
+	snapshots, err := d.findSnapshots(ctx, ec2Client, filter)
+	if err != nil {
+		return nil, err
+	}
+	orphans = append(orphans, snapshots...)
+
+	if filter.KmsKeyAliasName != "" {
+		aliases, err := d.findKmsAliases(ctx, kms.NewFromConfig(cfg), filter)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, aliases...)
+	}
+
+	return orphans, nil
+}
+
+// Delete removes an orphan
+func (d *SDKSweepDriver) Delete(ctx context.Context, orphan resources.Orphan) error {
+	cfg := d.regionConfig(orphan.Region)
+
+	var err error
+	switch orphan.Kind {
+	case resources.OrphanS3Object:
+		d.logger.InfoContext(ctx, "deleting machine image", "bucket", orphan.Bucket, "key", orphan.ID)
+		_, err = s3.NewFromConfig(cfg).DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(orphan.Bucket),
+			Key:    aws.String(orphan.ID),
+		})
+	case resources.OrphanVolume:
+		d.logger.InfoContext(ctx, "deleting volume", "volume_id", orphan.ID, logging.Region(orphan.Region))
+		_, err = ec2.NewFromConfig(cfg).DeleteVolume(ctx, &ec2.DeleteVolumeInput{
+			VolumeId: aws.String(orphan.ID),
+		})
+	case resources.OrphanSnapshot:
+		d.logger.InfoContext(ctx, "deleting snapshot", "snapshot_id", orphan.ID, logging.Region(orphan.Region))
+		_, err = ec2.NewFromConfig(cfg).DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(orphan.ID),
+		})
+	case resources.OrphanKmsAlias:
+		d.logger.InfoContext(ctx, "deleting alias", "alias", orphan.ID, logging.Region(orphan.Region))
+		_, err = kms.NewFromConfig(cfg).DeleteAlias(ctx, &kms.DeleteAliasInput{
+			AliasName: aws.String(orphan.ID),
+		})
+	default:
+		return fmt.Errorf("unknown orphan kind %q", orphan.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("deleting %s %s: %s", orphan.Kind, orphan.ID, err)
+	}
+
+	return nil
+}
+
+func (d *SDKSweepDriver) findMachineImages(ctx context.Context, s3Client *s3.Client, filter resources.SweepFilter) ([]resources.Orphan, error) {
+	var orphans []resources.Orphan
+
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(filter.BucketName),
+		Prefix: aws.String(machineImageKeyPrefix),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing machine images in bucket %s: %s", filter.BucketName, err)
+		}
+
+		for _, object := range output.Contents {
+			lastModified := aws.ToTime(object.LastModified)
+			if !lastModified.Before(filter.CreatedBefore) {
+				continue
+			}
+			kept, err := d.isKeptMachineImage(ctx, s3Client, filter.BucketName, aws.ToString(object.Key))
+			if err != nil {
+				return nil, err
+			}
+			if kept {
+				continue
+			}
+			orphans = append(orphans, resources.Orphan{
+				Kind:      resources.OrphanS3Object,
+				ID:        aws.ToString(object.Key),
+				Region:    filter.Region,
+				Bucket:    filter.BucketName,
+				CreatedAt: lastModified,
+			})
+		}
+	}
+
+	return orphans, nil
+}
+
+// isKeptMachineImage reports whether the object at key was uploaded with keep_uploaded_image for later runs to reuse
+func (d *SDKSweepDriver) isKeptMachineImage(ctx context.Context, s3Client *s3.Client, bucketName string, key string) (bool, error) {
+	head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, fmt.Errorf("checking machine image s3://%s/%s: %s", bucketName, key, err)
+	}
+
+	return head.Metadata[keepMetadataKey] == "true", nil
+}
+
+func (d *SDKSweepDriver) findVolumes(ctx context.Context, ec2Client *ec2.Client, filter resources.SweepFilter) ([]resources.Orphan, error) {
+	var orphans []resources.Orphan
+
+	paginator := ec2.NewDescribeVolumesPaginator(ec2Client, &ec2.DescribeVolumesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("tag:" + resources.CreatedByTagKey), Values: []string{resources.CreatedByTagValue}},
+			{Name: aws.String("status"), Values: []string{"available"}},
+		},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing volumes in region %s: %s", filter.Region, err)
+		}
+
+		for _, volume := range output.Volumes {
+			createTime := aws.ToTime(volume.CreateTime)
+			if !createTime.Before(filter.CreatedBefore) {
+				continue
+			}
+			orphans = append(orphans, resources.Orphan{
+				Kind:      resources.OrphanVolume,
+				ID:        aws.ToString(volume.VolumeId),
+				Region:    filter.Region,
+				CreatedAt: createTime,
+			})
+		}
+	}
+
+	return orphans, nil
+}
+
+// findSnapshots returns the snapshots created by the builder that are not registered as part of any AMI
+func (d *SDKSweepDriver) findSnapshots(ctx context.Context, ec2Client *ec2.Client, filter resources.SweepFilter) ([]resources.Orphan, error) {
+	candidates := map[string]ec2types.Snapshot{}
+	for _, snapshotFilter := range []ec2types.Filter{
+		{Name: aws.String("tag:" + resources.CreatedByTagKey), Values: []string{resources.CreatedByTagValue}},
+		{Name: aws.String("description"), Values: []string{snapshotFromVolumeDescription}},
+	} {
+		paginator := ec2.NewDescribeSnapshotsPaginator(ec2Client, &ec2.DescribeSnapshotsInput{
+			OwnerIds: []string{"self"},
+			Filters:  []ec2types.Filter{snapshotFilter},
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("describing snapshots in region %s: %s", filter.Region, err)
+			}
+			for _, snapshot := range output.Snapshots {
+				candidates[aws.ToString(snapshot.SnapshotId)] = snapshot
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	usedSnapshots := map[string]bool{}
+	paginator := ec2.NewDescribeImagesPaginator(ec2Client, &ec2.DescribeImagesInput{
+		Owners: []string{"self"},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing images in region %s: %s", filter.Region, err)
+		}
+		for _, image := range output.Images {
+			for _, mapping := range image.BlockDeviceMappings {
+				if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+					usedSnapshots[*mapping.Ebs.SnapshotId] = true
+				}
+			}
+		}
+	}
+
+	var orphans []resources.Orphan
+	for id, snapshot := range candidates {
+		startTime := aws.ToTime(snapshot.StartTime)
+		if usedSnapshots[id] || !startTime.Before(filter.CreatedBefore) {
+			continue
+		}
+		orphans = append(orphans, resources.Orphan{
+			Kind:      resources.OrphanSnapshot,
+			ID:        id,
+			Region:    filter.Region,
+			CreatedAt: startTime,
+		})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].ID < orphans[j].ID })
+
+	return orphans, nil
+}
+
+func (d *SDKSweepDriver) findKmsAliases(ctx context.Context, kmsClient *kms.Client, filter resources.SweepFilter) ([]resources.Orphan, error) {
+	var orphans []resources.Orphan
+
+	paginator := kms.NewListAliasesPaginator(kmsClient, &kms.ListAliasesInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing KMS aliases in region %s: %s", filter.Region, err)
+		}
+
+		for _, alias := range output.Aliases {
+			if !strings.EqualFold(aws.ToString(alias.AliasName), filter.KmsKeyAliasName) {
+				continue
+			}
+			creationDate := aws.ToTime(alias.CreationDate)
+			if !creationDate.Before(filter.CreatedBefore) {
+				continue
+			}
+			orphans = append(orphans, resources.Orphan{
+				Kind:      resources.OrphanKmsAlias,
+				ID:        aws.ToString(alias.AliasName),
+				Region:    filter.Region,
+				CreatedAt: creationDate,
+			})
+		}
+	}
+
+	return orphans, nil
+}
+
+func (d *SDKSweepDriver) regionConfig(region string) aws.Config {
+	regionCreds := d.creds.ForDestination(region)
+	cfg := regionCreds.GetAwsConfig()
+	logging.ConfigureSDK(&cfg, d.logger.With(logging.Region(region)))
+
+	return cfg
+}
@@ -0,0 +1,132 @@
+package driver_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/driver"
+	"light-stemcell-builder/resources"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SweepDriver", func() {
+	It("finds and deletes machine images, unused snapshots and KMS aliases left behind by failed runs", func() {
+		cfg := creds.GetAwsConfig()
+		s3Client := s3.NewFromConfig(cfg)
+		ec2Client := ec2.NewFromConfig(cfg)
+		kmsClient := kms.NewFromConfig(cfg)
+
+		objectKey := fmt.Sprintf("bosh-machine-image-%d", time.Now().UnixNano())
+		_, err := s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(objectKey),
+			Body:   strings.NewReader("fake machine image"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		snapshotOutput, err := ec2Client.CreateSnapshot(context.Background(), &ec2.CreateSnapshotInput{
+			VolumeId: aws.String(ebsVolumeID),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		snapshotID := *snapshotOutput.SnapshotId
+
+		_, err = ec2Client.CreateTags(context.Background(), &ec2.CreateTagsInput{
+			Resources: []string{snapshotID},
+			Tags: []ec2types.Tag{
+				{Key: aws.String(resources.CreatedByTagKey), Value: aws.String(resources.CreatedByTagValue)},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		aliasName := "alias/" + strconv.Itoa(rand.Int())
+		_, err = kmsClient.CreateAlias(context.Background(), &kms.CreateAliasInput{
+			AliasName:   aws.String(aliasName),
+			TargetKeyId: aws.String(kmsKeyId),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		filter := resources.SweepFilter{
+			Region:          creds.Region,
+			BucketName:      bucketName,
+			KmsKeyAliasName: aliasName,
+			CreatedBefore:   time.Now().Add(time.Minute),
+		}
+
+		sweepDriver := driver.NewSweepDriver(logger, creds)
+		orphans, err := sweepDriver.FindOrphans(context.Background(), filter)
+		Expect(err).ToNot(HaveOccurred())
+
+		ours := map[string]resources.Orphan{}
+		for _, orphan := range orphans {
+			if orphan.ID == objectKey || orphan.ID == snapshotID || orphan.ID == aliasName {
+				ours[orphan.Kind] = orphan
+			}
+		}
+		Expect(ours).To(HaveLen(3))
+		Expect(ours[resources.OrphanS3Object].ID).To(Equal(objectKey))
+		Expect(ours[resources.OrphanS3Object].Bucket).To(Equal(bucketName))
+		Expect(ours[resources.OrphanSnapshot].ID).To(Equal(snapshotID))
+		Expect(ours[resources.OrphanSnapshot].Region).To(Equal(creds.Region))
+		Expect(ours[resources.OrphanKmsAlias].ID).To(Equal(aliasName))
+
+		filter.CreatedBefore = time.Now().Add(-time.Hour)
+		recentOrphans, err := sweepDriver.FindOrphans(context.Background(), filter)
+		Expect(err).ToNot(HaveOccurred())
+		for _, orphan := range recentOrphans {
+			Expect(orphan.ID).ToNot(BeElementOf(objectKey, snapshotID, aliasName), "Expected resources of runs in progress to be left alone")
+		}
+
+		for _, orphan := range ours {
+			Expect(sweepDriver.Delete(context.Background(), orphan)).To(Succeed())
+		}
+
+		filter.CreatedBefore = time.Now().Add(time.Minute)
+		Eventually(func() ([]string, error) {
+			remaining, err := sweepDriver.FindOrphans(context.Background(), filter)
+			var ids []string
+			for _, orphan := range remaining {
+				ids = append(ids, orphan.ID)
+			}
+			return ids, err
+		}, 10*time.Minute, 10*time.Second).ShouldNot(ContainElements(objectKey, snapshotID, aliasName))
+	})
+
+	It("leaves machine images kept for later runs alone", func() {
+		machineImage, err := driver.NewCreateMachineImageDriver(logger, creds).Create(context.Background(), resources.MachineImageDriverConfig{
+			MachineImagePath:  machineImagePath,
+			FileFormat:        machineImageFormat,
+			BucketName:        bucketName,
+			VolumeSizeGB:      3,
+			ImageSHA256:       machineImageSHA256(),
+			KeepUploadedImage: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(func() {
+			s3.NewFromConfig(creds.GetAwsConfig()).DeleteObject(context.Background(), &s3.DeleteObjectInput{ //nolint:errcheck
+				Bucket: aws.String(bucketName),
+				Key:    aws.String(machineImage.Key),
+			})
+		})
+
+		orphans, err := driver.NewSweepDriver(logger, creds).FindOrphans(context.Background(), resources.SweepFilter{
+			Region:        creds.Region,
+			BucketName:    bucketName,
+			CreatedBefore: time.Now().Add(time.Minute),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		for _, orphan := range orphans {
+			Expect(orphan.ID).ToNot(Equal(machineImage.Key), "Expected the kept machine image to be left alone")
+		}
+	})
+})
@@ -0,0 +1,61 @@
+package driver
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// stemcellTags returns the tags of an EC2 resource of the stemcell: the configured tags, a Name made of their
+// distro and version unless a Name is configured, and the fixed tags of the resource, which take precedence
+func stemcellTags(configured map[string]string, fixed ...ec2types.Tag) []ec2types.Tag {
+	values := map[string]string{"Name": configured["distro"] + "-" + configured["version"]}
+	for key, value := range configured {
+		values[key] = value
+	}
+	for _, tag := range fixed {
+		values[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make([]ec2types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(values[key])})
+	}
+	return tags
+}
+
+// tagSpecification applies tags to a resource of resourceType when it is created
+func tagSpecification(resourceType ec2types.ResourceType, tags []ec2types.Tag) ec2types.TagSpecification {
+	return ec2types.TagSpecification{ResourceType: resourceType, Tags: tags}
+}
+
+// objectTagging returns the configured tags as the URL encoded tag set of an S3 object, or nil when there are none
+func objectTagging(configured map[string]string) *string {
+	if len(configured) == 0 {
+		return nil
+	}
+
+	tagging := url.Values{}
+	for key, value := range configured {
+		tagging.Set(key, value)
+	}
+	return aws.String(tagging.Encode())
+}
+
+// formatTags returns tags as key=value pairs for the log
+func formatTags(tags []ec2types.Tag) string {
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		pairs = append(pairs, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -14,7 +14,7 @@ import (
 
 var _ = Describe("Volume Driver Lifecycle", func() {
 	It("creates and deletes an EBS Volume from a previously uploaded machine image", func() {
-		createMachineImageDriver := driver.NewCreateMachineImageManifestDriver(GinkgoWriter, creds)
+		createMachineImageDriver := driver.NewCreateMachineImageManifestDriver(logger, creds)
 		machineImageDriverConfig := resources.MachineImageDriverConfig{
 			MachineImagePath: machineImagePath,
 			FileFormat:       machineImageFormat,
@@ -22,16 +22,16 @@ var _ = Describe("Volume Driver Lifecycle", func() {
 			VolumeSizeGB:     3,
 		}
 
-		machineImage, err := createMachineImageDriver.Create(machineImageDriverConfig)
+		machineImage, err := createMachineImageDriver.Create(context.Background(), machineImageDriverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		volumeDriverConfig := resources.VolumeDriverConfig{
 			MachineImageManifestURL: machineImage.GetURL,
 		}
 
-		createVolumeDriver := driver.NewCreateVolumeDriver(GinkgoWriter, creds)
+		createVolumeDriver := driver.NewCreateVolumeDriver(logger, creds)
 
-		volume, err := createVolumeDriver.Create(volumeDriverConfig)
+		volume, err := createVolumeDriver.Create(context.Background(), volumeDriverConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		ec2Client := ec2.NewFromConfig(creds.GetAwsConfig())
@@ -41,9 +41,9 @@ var _ = Describe("Volume Driver Lifecycle", func() {
 
 		Expect(reqOutput.Volumes).To(HaveLen(1))
 
-		deleteVolumeDriver := driver.NewDeleteVolumeDriver(GinkgoWriter, creds)
+		deleteVolumeDriver := driver.NewDeleteVolumeDriver(logger, creds)
 
-		err = deleteVolumeDriver.Delete(volume)
+		err = deleteVolumeDriver.Delete(context.Background(), volume)
 		Expect(err).ToNot(HaveOccurred())
 
 		Eventually(func() error {
@@ -51,8 +51,8 @@ var _ = Describe("Volume Driver Lifecycle", func() {
 			return err
 		}, 10*time.Minute, 10*time.Second).Should(MatchError(ContainSubstring("InvalidVolume.NotFound")))
 
-		deleteMachineImageDriver := driver.NewDeleteMachineImageDriver(GinkgoWriter, creds)
+		deleteMachineImageDriver := driver.NewDeleteMachineImageDriver(logger, creds)
 		// ignore error on cleanup
-		deleteMachineImageDriver.Delete(machineImage) //nolint:errcheck
+		deleteMachineImageDriver.Delete(context.Background(), machineImage) //nolint:errcheck
 	})
 })
@@ -38,6 +38,26 @@ type FakeStandardRegionDriverSet struct {
 	createSnapshotDriverReturnsOnCall map[int]struct {
 		result1 resources.SnapshotDriver
 	}
+	DeleteAmiDriverStub        func() resources.DeleteAmiDriver
+	deleteAmiDriverMutex       sync.RWMutex
+	deleteAmiDriverArgsForCall []struct {
+	}
+	deleteAmiDriverReturns struct {
+		result1 resources.DeleteAmiDriver
+	}
+	deleteAmiDriverReturnsOnCall map[int]struct {
+		result1 resources.DeleteAmiDriver
+	}
+	ExistingAmiDriverStub        func() resources.ExistingAmiDriver
+	existingAmiDriverMutex       sync.RWMutex
+	existingAmiDriverArgsForCall []struct {
+	}
+	existingAmiDriverReturns struct {
+		result1 resources.ExistingAmiDriver
+	}
+	existingAmiDriverReturnsOnCall map[int]struct {
+		result1 resources.ExistingAmiDriver
+	}
 	KmsDriverStub        func() resources.KmsDriver
 	kmsDriverMutex       sync.RWMutex
 	kmsDriverArgsForCall []struct {
@@ -221,6 +241,112 @@ func (fake *FakeStandardRegionDriverSet) CreateSnapshotDriverReturnsOnCall(i int
 	}{result1}
 }
 
+func (fake *FakeStandardRegionDriverSet) DeleteAmiDriver() resources.DeleteAmiDriver {
+	fake.deleteAmiDriverMutex.Lock()
+	ret, specificReturn := fake.deleteAmiDriverReturnsOnCall[len(fake.deleteAmiDriverArgsForCall)]
+	fake.deleteAmiDriverArgsForCall = append(fake.deleteAmiDriverArgsForCall, struct {
+	}{})
+	stub := fake.DeleteAmiDriverStub
+	fakeReturns := fake.deleteAmiDriverReturns
+	fake.recordInvocation("DeleteAmiDriver", []interface{}{})
+	fake.deleteAmiDriverMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStandardRegionDriverSet) DeleteAmiDriverCallCount() int {
+	fake.deleteAmiDriverMutex.RLock()
+	defer fake.deleteAmiDriverMutex.RUnlock()
+	return len(fake.deleteAmiDriverArgsForCall)
+}
+
+func (fake *FakeStandardRegionDriverSet) DeleteAmiDriverCalls(stub func() resources.DeleteAmiDriver) {
+	fake.deleteAmiDriverMutex.Lock()
+	defer fake.deleteAmiDriverMutex.Unlock()
+	fake.DeleteAmiDriverStub = stub
+}
+
+func (fake *FakeStandardRegionDriverSet) DeleteAmiDriverReturns(result1 resources.DeleteAmiDriver) {
+	fake.deleteAmiDriverMutex.Lock()
+	defer fake.deleteAmiDriverMutex.Unlock()
+	fake.DeleteAmiDriverStub = nil
+	fake.deleteAmiDriverReturns = struct {
+		result1 resources.DeleteAmiDriver
+	}{result1}
+}
+
+func (fake *FakeStandardRegionDriverSet) DeleteAmiDriverReturnsOnCall(i int, result1 resources.DeleteAmiDriver) {
+	fake.deleteAmiDriverMutex.Lock()
+	defer fake.deleteAmiDriverMutex.Unlock()
+	fake.DeleteAmiDriverStub = nil
+	if fake.deleteAmiDriverReturnsOnCall == nil {
+		fake.deleteAmiDriverReturnsOnCall = make(map[int]struct {
+			result1 resources.DeleteAmiDriver
+		})
+	}
+	fake.deleteAmiDriverReturnsOnCall[i] = struct {
+		result1 resources.DeleteAmiDriver
+	}{result1}
+}
+
+func (fake *FakeStandardRegionDriverSet) ExistingAmiDriver() resources.ExistingAmiDriver {
+	fake.existingAmiDriverMutex.Lock()
+	ret, specificReturn := fake.existingAmiDriverReturnsOnCall[len(fake.existingAmiDriverArgsForCall)]
+	fake.existingAmiDriverArgsForCall = append(fake.existingAmiDriverArgsForCall, struct {
+	}{})
+	stub := fake.ExistingAmiDriverStub
+	fakeReturns := fake.existingAmiDriverReturns
+	fake.recordInvocation("ExistingAmiDriver", []interface{}{})
+	fake.existingAmiDriverMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStandardRegionDriverSet) ExistingAmiDriverCallCount() int {
+	fake.existingAmiDriverMutex.RLock()
+	defer fake.existingAmiDriverMutex.RUnlock()
+	return len(fake.existingAmiDriverArgsForCall)
+}
+
+func (fake *FakeStandardRegionDriverSet) ExistingAmiDriverCalls(stub func() resources.ExistingAmiDriver) {
+	fake.existingAmiDriverMutex.Lock()
+	defer fake.existingAmiDriverMutex.Unlock()
+	fake.ExistingAmiDriverStub = stub
+}
+
+func (fake *FakeStandardRegionDriverSet) ExistingAmiDriverReturns(result1 resources.ExistingAmiDriver) {
+	fake.existingAmiDriverMutex.Lock()
+	defer fake.existingAmiDriverMutex.Unlock()
+	fake.ExistingAmiDriverStub = nil
+	fake.existingAmiDriverReturns = struct {
+		result1 resources.ExistingAmiDriver
+	}{result1}
+}
+
+func (fake *FakeStandardRegionDriverSet) ExistingAmiDriverReturnsOnCall(i int, result1 resources.ExistingAmiDriver) {
+	fake.existingAmiDriverMutex.Lock()
+	defer fake.existingAmiDriverMutex.Unlock()
+	fake.ExistingAmiDriverStub = nil
+	if fake.existingAmiDriverReturnsOnCall == nil {
+		fake.existingAmiDriverReturnsOnCall = make(map[int]struct {
+			result1 resources.ExistingAmiDriver
+		})
+	}
+	fake.existingAmiDriverReturnsOnCall[i] = struct {
+		result1 resources.ExistingAmiDriver
+	}{result1}
+}
+
 func (fake *FakeStandardRegionDriverSet) KmsDriver() resources.KmsDriver {
 	fake.kmsDriverMutex.Lock()
 	ret, specificReturn := fake.kmsDriverReturnsOnCall[len(fake.kmsDriverArgsForCall)]
@@ -330,16 +456,6 @@ func (fake *FakeStandardRegionDriverSet) MachineImageDriverReturnsOnCall(i int,
 func (fake *FakeStandardRegionDriverSet) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.copyAmiDriverMutex.RLock()
-	defer fake.copyAmiDriverMutex.RUnlock()
-	fake.createAmiDriverMutex.RLock()
-	defer fake.createAmiDriverMutex.RUnlock()
-	fake.createSnapshotDriverMutex.RLock()
-	defer fake.createSnapshotDriverMutex.RUnlock()
-	fake.kmsDriverMutex.RLock()
-	defer fake.kmsDriverMutex.RUnlock()
-	fake.machineImageDriverMutex.RLock()
-	defer fake.machineImageDriverMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
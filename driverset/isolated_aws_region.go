@@ -4,7 +4,7 @@ package driverset
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
 
 import (
-	"io"
+	"log/slog"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driver"
@@ -17,6 +17,8 @@ type IsolatedRegionDriverSet interface {
 	VolumeDriver() resources.VolumeDriver
 	CreateSnapshotDriver() resources.SnapshotDriver
 	CreateAmiDriver() resources.AmiDriver
+	ExistingAmiDriver() resources.ExistingAmiDriver
+	DeleteAmiDriver() resources.DeleteAmiDriver
 }
 
 type isolatedRegionDriverSet struct {
@@ -24,26 +26,28 @@ type isolatedRegionDriverSet struct {
 	volumeDriver       resources.VolumeDriver
 	snapshotDriver     *driver.SDKSnapshotFromVolumeDriver
 	createAmiDriver    *driver.SDKCreateAmiDriver
+	deleteAmiDriver    *driver.SDKDeleteAmiDriver
 }
 
-func NewIsolatedRegionDriverSet(logDest io.Writer, creds config.Credentials) IsolatedRegionDriverSet {
+func NewIsolatedRegionDriverSet(logger *slog.Logger, creds config.Credentials) IsolatedRegionDriverSet {
 	return &isolatedRegionDriverSet{
 		machineImageDriver: struct {
 			*driver.SDKCreateMachineImageManifestDriver
 			*driver.SDKDeleteMachineImageDriver
 		}{
-			driver.NewCreateMachineImageManifestDriver(logDest, creds),
-			driver.NewDeleteMachineImageDriver(logDest, creds),
+			driver.NewCreateMachineImageManifestDriver(logger, creds),
+			driver.NewDeleteMachineImageDriver(logger, creds),
 		},
 		volumeDriver: struct {
 			*driver.SDKCreateVolumeDriver
 			*driver.SDKDeleteVolumeDriver
 		}{
-			driver.NewCreateVolumeDriver(logDest, creds),
-			driver.NewDeleteVolumeDriver(logDest, creds),
+			driver.NewCreateVolumeDriver(logger, creds),
+			driver.NewDeleteVolumeDriver(logger, creds),
 		},
-		snapshotDriver:  driver.NewSnapshotFromVolumeDriver(logDest, creds),
-		createAmiDriver: driver.NewCreateAmiDriver(logDest, creds),
+		snapshotDriver:  driver.NewSnapshotFromVolumeDriver(logger, creds),
+		createAmiDriver: driver.NewCreateAmiDriver(logger, creds),
+		deleteAmiDriver: driver.NewDeleteAmiDriver(logger, creds),
 	}
 }
 
@@ -62,3 +66,11 @@ func (s *isolatedRegionDriverSet) CreateSnapshotDriver() resources.SnapshotDrive
 func (s *isolatedRegionDriverSet) CreateAmiDriver() resources.AmiDriver {
 	return s.createAmiDriver
 }
+
+func (s *isolatedRegionDriverSet) ExistingAmiDriver() resources.ExistingAmiDriver {
+	return s.createAmiDriver
+}
+
+func (s *isolatedRegionDriverSet) DeleteAmiDriver() resources.DeleteAmiDriver {
+	return s.deleteAmiDriver
+}
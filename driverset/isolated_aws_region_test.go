@@ -12,7 +12,7 @@ import (
 var _ = Describe("IsolatedAwsRegion", func() {
 	It("returns drivers of the correct type", func() {
 		creds := config.Credentials{}
-		ds := driverset.NewIsolatedRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewIsolatedRegionDriverSet(logger, creds)
 
 		Expect(ds.MachineImageDriver()).To(BeAssignableToTypeOf(struct {
 			*driver.SDKCreateMachineImageManifestDriver
@@ -24,5 +24,6 @@ var _ = Describe("IsolatedAwsRegion", func() {
 		}{}))
 		Expect(ds.CreateSnapshotDriver()).To(BeAssignableToTypeOf(&driver.SDKSnapshotFromVolumeDriver{}))
 		Expect(ds.CreateAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKCreateAmiDriver{}))
+		Expect(ds.DeleteAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKDeleteAmiDriver{}))
 	})
 })
@@ -1,7 +1,7 @@
 package driverset
 
 import (
-	"io"
+	"log/slog"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driver"
@@ -13,31 +13,44 @@ type StandardRegionDriverSet interface {
 	MachineImageDriver() resources.MachineImageDriver
 	CreateSnapshotDriver() resources.SnapshotDriver
 	CreateAmiDriver() resources.AmiDriver
+	ExistingAmiDriver() resources.ExistingAmiDriver
 	CopyAmiDriver() resources.AmiDriver
+	DeleteAmiDriver() resources.DeleteAmiDriver
 	KmsDriver() resources.KmsDriver
 }
 
 type standardRegionDriverSet struct {
 	machineImageDriver resources.MachineImageDriver
-	snapshotDriver     *driver.SDKSnapshotFromImageDriver
+	snapshotDriver     resources.SnapshotDriver
 	amiDriver          *driver.SDKCreateAmiDriver
 	copyAmiDriver      *driver.SDKCopyAmiDriver
+	deleteAmiDriver    *driver.SDKDeleteAmiDriver
 	kmsDriver          *driver.SDKKmsDriver
 }
 
-func NewStandardRegionDriverSet(logDest io.Writer, creds config.Credentials) StandardRegionDriverSet {
+func NewStandardRegionDriverSet(logger *slog.Logger, creds config.Credentials) StandardRegionDriverSet {
+	return newStandardRegionDriverSet(logger, creds, driver.NewSnapshotFromImageDriver(logger, creds))
+}
+
+// NewEbsDirectStandardRegionDriverSet writes snapshots with the EBS direct APIs instead of importing them from S3
+func NewEbsDirectStandardRegionDriverSet(logger *slog.Logger, creds config.Credentials) StandardRegionDriverSet {
+	return newStandardRegionDriverSet(logger, creds, driver.NewSnapshotFromEbsDirectDriver(logger, creds))
+}
+
+func newStandardRegionDriverSet(logger *slog.Logger, creds config.Credentials, snapshotDriver resources.SnapshotDriver) StandardRegionDriverSet {
 	return &standardRegionDriverSet{
 		machineImageDriver: struct {
 			*driver.SDKCreateMachineImageDriver
 			*driver.SDKDeleteMachineImageDriver
 		}{
-			driver.NewCreateMachineImageDriver(logDest, creds),
-			driver.NewDeleteMachineImageDriver(logDest, creds),
+			driver.NewCreateMachineImageDriver(logger, creds),
+			driver.NewDeleteMachineImageDriver(logger, creds),
 		},
-		snapshotDriver: driver.NewSnapshotFromImageDriver(logDest, creds),
-		amiDriver:      driver.NewCreateAmiDriver(logDest, creds),
-		copyAmiDriver:  driver.NewCopyAmiDriver(logDest, creds),
-		kmsDriver:      driver.NewKmsDriver(logDest, creds),
+		snapshotDriver:  snapshotDriver,
+		amiDriver:       driver.NewCreateAmiDriver(logger, creds),
+		copyAmiDriver:   driver.NewCopyAmiDriver(logger, creds),
+		deleteAmiDriver: driver.NewDeleteAmiDriver(logger, creds),
+		kmsDriver:       driver.NewKmsDriver(logger, creds),
 	}
 }
 
@@ -57,6 +70,14 @@ func (s *standardRegionDriverSet) CopyAmiDriver() resources.AmiDriver {
 	return s.copyAmiDriver
 }
 
+func (s *standardRegionDriverSet) ExistingAmiDriver() resources.ExistingAmiDriver {
+	return s.amiDriver
+}
+
+func (s *standardRegionDriverSet) DeleteAmiDriver() resources.DeleteAmiDriver {
+	return s.deleteAmiDriver
+}
+
 func (s *standardRegionDriverSet) KmsDriver() resources.KmsDriver {
 	return s.kmsDriver
 }
@@ -13,7 +13,7 @@ var _ = Describe("StandardAwsRegion", func() {
 	It("returns drivers of the correct type", func() {
 
 		creds := config.Credentials{}
-		ds := driverset.NewStandardRegionDriverSet(GinkgoWriter, creds)
+		ds := driverset.NewStandardRegionDriverSet(logger, creds)
 
 		Expect(ds.MachineImageDriver()).To(BeAssignableToTypeOf(struct {
 			*driver.SDKCreateMachineImageDriver
@@ -22,6 +22,14 @@ var _ = Describe("StandardAwsRegion", func() {
 		Expect(ds.CreateSnapshotDriver()).To(BeAssignableToTypeOf(&driver.SDKSnapshotFromImageDriver{}))
 		Expect(ds.CreateAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKCreateAmiDriver{}))
 		Expect(ds.CopyAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKCopyAmiDriver{}))
+		Expect(ds.DeleteAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKDeleteAmiDriver{}))
 		Expect(ds.KmsDriver()).To(BeAssignableToTypeOf(&driver.SDKKmsDriver{}))
 	})
+
+	It("writes snapshots with the EBS direct APIs when asked to", func() {
+		ds := driverset.NewEbsDirectStandardRegionDriverSet(logger, config.Credentials{})
+
+		Expect(ds.CreateSnapshotDriver()).To(BeAssignableToTypeOf(&driver.SDKSnapshotFromEbsDirectDriver{}))
+		Expect(ds.CreateAmiDriver()).To(BeAssignableToTypeOf(&driver.SDKCreateAmiDriver{}))
+	})
 })
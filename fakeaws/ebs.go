@@ -0,0 +1,234 @@
+package fakeaws
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EBSBlockSize is the block size of snapshots written with the EBS direct APIs.
+const EBSBlockSize = 512 * 1024
+
+type ebsError struct {
+	Type    string `json:"-"`
+	Message string `json:"Message"`
+	status  int
+}
+
+func (e *ebsError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+func newEBSError(status int, errorType, format string, args ...interface{}) *ebsError {
+	return &ebsError{Type: errorType, Message: fmt.Sprintf(format, args...), status: status}
+}
+
+type ebsTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// FailSnapshotBlocks makes PutSnapshotBlock fail for the snapshots that have a tag with tagKey.
+func (s *Server) FailSnapshotBlocks(tagKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failingBlockTags[tagKey] = true
+}
+
+// SnapshotBlocks returns the blocks written to a snapshot with the EBS direct APIs, by block index.
+func (s *Server) SnapshotBlocks(region, snapshotID string) map[int64][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, ok := s.region(region).snapshots[snapshotID]
+	if !ok {
+		return nil
+	}
+
+	blocks := map[int64][]byte{}
+	for index, data := range snap.blocks {
+		blocks[index] = data
+	}
+	return blocks
+}
+
+// serveEBS handles StartSnapshot, PutSnapshotBlock and CompleteSnapshot.
+func (s *Server) serveEBS(w http.ResponseWriter, r *http.Request, region string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeEBS(w, http.StatusOK, nil, newEBSError(http.StatusBadRequest, "ValidationException", "%s", err))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "snapshots":
+		response, err := s.startSnapshot(region, body)
+		writeEBS(w, http.StatusCreated, response, err)
+	case r.Method == http.MethodPut && len(parts) == 4 && parts[0] == "snapshots" && parts[2] == "blocks":
+		err := s.putSnapshotBlock(region, parts[1], parts[3], r.Header, body)
+		if err == nil {
+			w.Header().Set("x-amz-Checksum", r.Header.Get("x-amz-Checksum"))
+			w.Header().Set("x-amz-Checksum-Algorithm", "SHA256")
+		}
+		writeEBS(w, http.StatusCreated, struct{}{}, err)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "snapshots" && parts[1] == "completion":
+		response, err := s.completeSnapshot(region, parts[2], r.Header)
+		writeEBS(w, http.StatusAccepted, response, err)
+	default:
+		writeEBS(w, http.StatusOK, nil, newEBSError(http.StatusBadRequest, "ValidationException", "%s %s is not supported by fakeaws", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) startSnapshot(region string, body []byte) (interface{}, error) {
+	input := struct {
+		VolumeSize  int64    `json:"VolumeSize"`
+		Description string   `json:"Description"`
+		Encrypted   bool     `json:"Encrypted"`
+		KmsKeyArn   string   `json:"KmsKeyArn"`
+		Tags        []ebsTag `json:"Tags"`
+	}{}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newEBSError(http.StatusBadRequest, "ValidationException", "%s", err)
+	}
+	if input.VolumeSize < 1 {
+		return nil, newEBSError(http.StatusBadRequest, "ValidationException", "VolumeSize must be at least 1")
+	}
+
+	snap := s.createSnapshot(region, "", input.VolumeSize, input.Encrypted || input.KmsKeyArn != "", input.KmsKeyArn)
+	snap.state = "pending"
+	snap.description = input.Description
+	snap.blocks = map[int64][]byte{}
+	for _, t := range input.Tags {
+		snap.tags = snap.tags.set(t.Key, t.Value)
+	}
+
+	return struct {
+		SnapshotID string   `json:"SnapshotId"`
+		BlockSize  int      `json:"BlockSize"`
+		Status     string   `json:"Status"`
+		VolumeSize int64    `json:"VolumeSize"`
+		StartTime  float64  `json:"StartTime"`
+		Tags       []ebsTag `json:"Tags,omitempty"`
+	}{
+		SnapshotID: snap.id,
+		BlockSize:  EBSBlockSize,
+		Status:     snap.state,
+		VolumeSize: snap.volumeSize,
+		StartTime:  float64(snap.startTime.Unix()),
+		Tags:       input.Tags,
+	}, nil
+}
+
+func (s *Server) pendingSnapshot(region, id string) (*snapshot, error) {
+	snap, ok := s.region(region).snapshots[id]
+	if !ok {
+		return nil, newEBSError(http.StatusNotFound, "ResourceNotFoundException", "The snapshot '%s' does not exist.", id)
+	}
+	if snap.blocks == nil || snap.state != "pending" {
+		return nil, newEBSError(http.StatusBadRequest, "ValidationException", "The snapshot '%s' is not pending.", id)
+	}
+	return snap, nil
+}
+
+func (s *Server) putSnapshotBlock(region, id, blockIndex string, header http.Header, body []byte) error {
+	snap, err := s.pendingSnapshot(region, id)
+	if err != nil {
+		return err
+	}
+
+	for key := range s.failingBlockTags {
+		if _, ok := snap.tags.get(key); ok {
+			return newEBSError(http.StatusBadRequest, "ValidationException", "writing blocks to snapshot %s failed", id)
+		}
+	}
+
+	index, err := strconv.ParseInt(blockIndex, 10, 64)
+	if err != nil || index < 0 || index >= snap.volumeSize*gbInBytes/EBSBlockSize {
+		return newEBSError(http.StatusBadRequest, "ValidationException", "BlockIndex %s is out of range", blockIndex)
+	}
+
+	if len(body) != EBSBlockSize || header.Get("x-amz-Data-Length") != strconv.Itoa(EBSBlockSize) {
+		return newEBSError(http.StatusBadRequest, "ValidationException", "DataLength must be %d", EBSBlockSize)
+	}
+
+	if header.Get("x-amz-Checksum-Algorithm") != "SHA256" {
+		return newEBSError(http.StatusBadRequest, "ValidationException", "ChecksumAlgorithm must be SHA256")
+	}
+	sum := sha256.Sum256(body)
+	if header.Get("x-amz-Checksum") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return newEBSError(http.StatusBadRequest, "ValidationException", "The checksum of block %d does not match", index)
+	}
+
+	snap.blocks[index] = body
+	return nil
+}
+
+func (s *Server) completeSnapshot(region, id string, header http.Header) (interface{}, error) {
+	snap, err := s.pendingSnapshot(region, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changedBlocks := header.Get("x-amz-ChangedBlocksCount")
+	if changedBlocks != strconv.Itoa(len(snap.blocks)) {
+		return nil, newEBSError(http.StatusBadRequest, "ValidationException", "ChangedBlocksCount %s does not match the %d blocks written", changedBlocks, len(snap.blocks))
+	}
+
+	if checksum := header.Get("x-amz-Checksum"); checksum != "" {
+		if header.Get("x-amz-Checksum-Aggregation-Method") != "LINEAR" {
+			return nil, newEBSError(http.StatusBadRequest, "ValidationException", "ChecksumAggregationMethod must be LINEAR")
+		}
+
+		indices := make([]int64, 0, len(snap.blocks))
+		for index := range snap.blocks {
+			indices = append(indices, index)
+		}
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+		aggregate := sha256.New()
+		for _, index := range indices {
+			sum := sha256.Sum256(snap.blocks[index])
+			aggregate.Write(sum[:])
+		}
+		if checksum != base64.StdEncoding.EncodeToString(aggregate.Sum(nil)) {
+			return nil, newEBSError(http.StatusBadRequest, "ValidationException", "The checksum of snapshot %s does not match", id)
+		}
+	}
+
+	snap.state = "completed"
+
+	return struct {
+		Status string `json:"Status"`
+	}{Status: "completed"}, nil
+}
+
+func writeEBS(w http.ResponseWriter, status int, body interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		ebsErr, ok := err.(*ebsError)
+		if !ok {
+			ebsErr = newEBSError(http.StatusInternalServerError, "InternalServerException", "%s", err)
+		}
+		w.Header().Set("x-amzn-ErrorType", ebsErr.Type)
+		w.WriteHeader(ebsErr.status)
+		json.NewEncoder(w).Encode(ebsErr) //nolint:errcheck
+		return
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) //nolint:errcheck
+}
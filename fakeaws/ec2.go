@@ -0,0 +1,1360 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ec2Namespace = "http://ec2.amazonaws.com/doc/2016-11-15/"
+
+type image struct {
+	id                 string
+	ownerID            string
+	name               string
+	description        string
+	state              string
+	architecture       string
+	virtualizationType string
+	rootDeviceName     string
+	bootMode           string
+	sriovNetSupport    string
+	enaSupport         bool
+	creationDate       time.Time
+	blockDevices       []blockDevice
+	launchPermissions  permissions
+	tags               tags
+}
+
+type blockDevice struct {
+	deviceName          string
+	snapshotID          string
+	encrypted           bool
+	volumeSize          int64
+	deleteOnTermination bool
+}
+
+type snapshot struct {
+	id          string
+	volumeID    string
+	description string
+	state       string
+	encrypted   bool
+	kmsKeyID    string
+	volumeSize  int64
+	startTime   time.Time
+	permissions permissions
+	tags        tags
+
+	// blocks holds the data written with the EBS direct APIs, by block index
+	blocks map[int64][]byte
+}
+
+type volume struct {
+	id               string
+	availabilityZone string
+	state            string
+	size             int64
+	createTime       time.Time
+	tags             tags
+}
+
+type instance struct {
+	id           string
+	imageID      string
+	instanceType string
+	state        string
+	tags         tags
+}
+
+type importSnapshotTask struct {
+	id            string
+	snapshotID    string
+	status        string
+	statusMessage string
+	url           string
+	format        string
+	encrypted     bool
+	kmsKeyID      string
+}
+
+type conversionTask struct {
+	id               string
+	volumeID         string
+	availabilityZone string
+	size             int64
+	state            string
+	statusMessage    string
+}
+
+type tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type tags []tag
+
+func (t tags) set(key, value string) tags {
+	for i := range t {
+		if t[i].Key == key {
+			t[i].Value = value
+			return t
+		}
+	}
+	return append(t, tag{Key: key, Value: value})
+}
+
+func (t tags) get(key string) (string, bool) {
+	for i := range t {
+		if t[i].Key == key {
+			return t[i].Value, true
+		}
+	}
+	return "", false
+}
+
+type permission struct {
+	Group  string `xml:"group,omitempty"`
+	UserID string `xml:"userId,omitempty"`
+}
+
+type permissions []permission
+
+func (p permissions) add(perm permission) permissions {
+	for _, existing := range p {
+		if existing == perm {
+			return p
+		}
+	}
+	return append(p, perm)
+}
+
+func (p permissions) remove(perm permission) permissions {
+	kept := permissions{}
+	for _, existing := range p {
+		if existing != perm {
+			kept = append(kept, existing)
+		}
+	}
+	return kept
+}
+
+// allows reports whether the permissions let accountID use the resource
+func (p permissions) allows(accountID string) bool {
+	for _, existing := range p {
+		if existing.Group == "all" || existing.UserID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p permissions) public() bool {
+	for _, existing := range p {
+		if existing.Group == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+type ec2Error struct {
+	Code    string
+	Message string
+}
+
+func (e *ec2Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newEC2Error(code, format string, args ...interface{}) *ec2Error {
+	return &ec2Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type ec2Handler func(s *Server, region string, form url.Values) (interface{}, error)
+
+var ec2Actions = map[string]ec2Handler{
+	"CopyImage":                   (*Server).copyImage,
+	"CreateSnapshot":              (*Server).createSnapshotAction,
+	"CreateTags":                  (*Server).createTags,
+	"DeleteSnapshot":              (*Server).deleteSnapshot,
+	"DeleteVolume":                (*Server).deleteVolume,
+	"DeregisterImage":             (*Server).deregisterImage,
+	"DescribeAvailabilityZones":   (*Server).describeAvailabilityZones,
+	"DescribeConversionTasks":     (*Server).describeConversionTasks,
+	"DescribeRegions":             (*Server).describeRegions,
+	"DescribeImageAttribute":      (*Server).describeImageAttribute,
+	"DescribeImages":              (*Server).describeImages,
+	"DescribeImportSnapshotTasks": (*Server).describeImportSnapshotTasks,
+	"DescribeInstanceStatus":      (*Server).describeInstanceStatus,
+	"DescribeInstances":           (*Server).describeInstances,
+	"DescribeSnapshotAttribute":   (*Server).describeSnapshotAttribute,
+	"DescribeSnapshots":           (*Server).describeSnapshots,
+	"DescribeVolumes":             (*Server).describeVolumes,
+	"ImportSnapshot":              (*Server).importSnapshot,
+	"ImportVolume":                (*Server).importVolume,
+	"ModifyImageAttribute":        (*Server).modifyImageAttribute,
+	"ModifySnapshotAttribute":     (*Server).modifySnapshotAttribute,
+	"RegisterImage":               (*Server).registerImageAction,
+	"ResetImageAttribute":         (*Server).resetImageAttribute,
+	"RunInstances":                (*Server).runInstances,
+	"TerminateInstances":          (*Server).terminateInstances,
+}
+
+func (s *Server) serveEC2(w http.ResponseWriter, r *http.Request, region string) {
+	err := r.ParseForm()
+	if err != nil {
+		writeEC2Error(w, http.StatusBadRequest, newEC2Error("MalformedQueryString", "%s", err))
+		return
+	}
+
+	action := r.Form.Get("Action")
+	handler, ok := ec2Actions[action]
+	if !ok {
+		writeEC2Error(w, http.StatusBadRequest, newEC2Error("InvalidAction", "The action %s is not valid for this web service.", action))
+		return
+	}
+
+	s.mu.Lock()
+	s.caller = s.account(accessKey(r))
+	body, err := handler(s, region, r.Form)
+	s.mu.Unlock()
+
+	if err != nil {
+		ec2Err, ok := err.(*ec2Error)
+		if !ok {
+			ec2Err = newEC2Error("InternalError", "%s", err)
+		}
+		writeEC2Error(w, http.StatusBadRequest, ec2Err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	start := xml.StartElement{
+		Name: xml.Name{Local: action + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: ec2Namespace}},
+	}
+	xml.NewEncoder(w).EncodeElement(body, start) //nolint:errcheck
+}
+
+func writeEC2Error(w http.ResponseWriter, status int, err *ec2Error) {
+	response := struct {
+		XMLName   xml.Name   `xml:"Response"`
+		Errors    []ec2Error `xml:"Errors>Error"`
+		RequestID string     `xml:"RequestID"`
+	}{
+		Errors:    []ec2Error{*err},
+		RequestID: "fakeaws",
+	}
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(response) //nolint:errcheck
+}
+
+// indexed returns the values of a serialized EC2 Query list, e.g. ImageId.1, ImageId.2, ...
+func indexed(form url.Values, prefix string) []string {
+	var values []string
+	for i := 1; ; i++ {
+		key := fmt.Sprintf("%s.%d", prefix, i)
+		if _, ok := form[key]; !ok {
+			return values
+		}
+		values = append(values, form.Get(key))
+	}
+}
+
+// indexedPrefixes returns the prefixes of a serialized list of structures, e.g. Filter.1, Filter.2, ...
+func indexedPrefixes(form url.Values, prefix string) []string {
+	var prefixes []string
+	for i := 1; ; i++ {
+		itemPrefix := fmt.Sprintf("%s.%d", prefix, i)
+		found := false
+		for key := range form {
+			if strings.HasPrefix(key, itemPrefix+".") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return prefixes
+		}
+		prefixes = append(prefixes, itemPrefix)
+	}
+}
+
+func filters(form url.Values, listName string) map[string][]string {
+	result := map[string][]string{}
+	for _, prefix := range indexedPrefixes(form, listName) {
+		name := form.Get(prefix + ".Name")
+		result[name] = append(result[name], indexed(form, prefix+".Value")...)
+	}
+	return result
+}
+
+// matchesFilters applies the filters this fake understands; tag:<key> filters
+// are matched against resourceTags and any other unknown filter is ignored.
+func matchesFilters(f map[string][]string, known map[string]string, resourceTags tags) bool {
+	for name, values := range f {
+		actual, ok := known[name]
+		if strings.HasPrefix(name, "tag:") {
+			actual, ok = resourceTags.get(strings.TrimPrefix(name, "tag:"))
+			if !ok {
+				return false
+			}
+		}
+		if !ok {
+			continue
+		}
+		if !matchesAny(actual, values) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(actual string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == actual {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(actual, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func boolValue(form url.Values, key string) bool {
+	b, _ := strconv.ParseBool(form.Get(key)) //nolint:errcheck
+	return b
+}
+
+func int64Value(form url.Values, key string) int64 {
+	i, _ := strconv.ParseInt(form.Get(key), 10, 64) //nolint:errcheck
+	return i
+}
+
+func formTags(form url.Values, prefix string) tags {
+	var t tags
+	for _, itemPrefix := range indexedPrefixes(form, prefix) {
+		t = t.set(form.Get(itemPrefix+".Key"), form.Get(itemPrefix+".Value"))
+	}
+	return t
+}
+
+// tagSpecifications returns the tags of the TagSpecification parameters of a request that are for resourceType
+func tagSpecifications(form url.Values, resourceType string) tags {
+	var t tags
+	for _, prefix := range indexedPrefixes(form, "TagSpecification") {
+		if form.Get(prefix+".ResourceType") != resourceType {
+			continue
+		}
+		for _, specTag := range formTags(form, prefix+".Tag") {
+			t = t.set(specTag.Key, specTag.Value)
+		}
+	}
+	return t
+}
+
+// Images
+
+type xmlBlockDevice struct {
+	DeviceName string `xml:"deviceName"`
+	Ebs        struct {
+		SnapshotID          string `xml:"snapshotId"`
+		VolumeSize          int64  `xml:"volumeSize"`
+		DeleteOnTermination bool   `xml:"deleteOnTermination"`
+		Encrypted           bool   `xml:"encrypted"`
+	} `xml:"ebs"`
+}
+
+type xmlImage struct {
+	ImageID             string           `xml:"imageId"`
+	Name                string           `xml:"name"`
+	Description         string           `xml:"description,omitempty"`
+	State               string           `xml:"imageState"`
+	OwnerID             string           `xml:"imageOwnerId"`
+	Public              bool             `xml:"isPublic"`
+	Architecture        string           `xml:"architecture"`
+	VirtualizationType  string           `xml:"virtualizationType"`
+	RootDeviceName      string           `xml:"rootDeviceName"`
+	RootDeviceType      string           `xml:"rootDeviceType"`
+	BootMode            string           `xml:"bootMode,omitempty"`
+	SriovNetSupport     string           `xml:"sriovNetSupport,omitempty"`
+	EnaSupport          bool             `xml:"enaSupport"`
+	CreationDate        string           `xml:"creationDate"`
+	BlockDeviceMappings []xmlBlockDevice `xml:"blockDeviceMapping>item"`
+	Tags                []tag            `xml:"tagSet>item"`
+}
+
+func (img *image) toXML() xmlImage {
+	x := xmlImage{
+		ImageID:            img.id,
+		Name:               img.name,
+		Description:        img.description,
+		State:              img.state,
+		OwnerID:            img.ownerID,
+		Public:             img.launchPermissions.public(),
+		Architecture:       img.architecture,
+		VirtualizationType: img.virtualizationType,
+		RootDeviceName:     img.rootDeviceName,
+		RootDeviceType:     "ebs",
+		BootMode:           img.bootMode,
+		SriovNetSupport:    img.sriovNetSupport,
+		EnaSupport:         img.enaSupport,
+		CreationDate:       img.creationDate.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Tags:               img.tags,
+	}
+	for _, device := range img.blockDevices {
+		mapping := xmlBlockDevice{DeviceName: device.deviceName}
+		mapping.Ebs.SnapshotID = device.snapshotID
+		mapping.Ebs.VolumeSize = device.volumeSize
+		mapping.Ebs.DeleteOnTermination = device.deleteOnTermination
+		mapping.Ebs.Encrypted = device.encrypted
+		x.BlockDeviceMappings = append(x.BlockDeviceMappings, mapping)
+	}
+	return x
+}
+
+func (s *Server) registerImage(region string, img *image) *image {
+	img.id = s.newID("ami")
+	img.ownerID = s.caller
+	if img.ownerID == "" {
+		img.ownerID = AccountID
+	}
+	img.state = "available"
+	img.creationDate = time.Now()
+	s.region(region).images[img.id] = img
+	return img
+}
+
+func (s *Server) findImage(region, id string) (*image, error) {
+	img, ok := s.region(region).images[id]
+	if !ok {
+		return nil, newEC2Error("InvalidAMIID.NotFound", "The image id '[%s]' does not exist", id)
+	}
+	return img, nil
+}
+
+func (s *Server) imageNameTaken(region, name string) bool {
+	for _, img := range s.region(region).images {
+		if img.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) registerImageAction(region string, form url.Values) (interface{}, error) {
+	name := form.Get("Name")
+	if name == "" {
+		return nil, newEC2Error("MissingParameter", "The request must contain the parameter name")
+	}
+	if s.imageNameTaken(region, name) {
+		return nil, newEC2Error("InvalidAMIName.Duplicate", "AMI name %s is already in use by AMI", name)
+	}
+
+	img := &image{
+		name:               name,
+		description:        form.Get("Description"),
+		architecture:       form.Get("Architecture"),
+		virtualizationType: form.Get("VirtualizationType"),
+		rootDeviceName:     form.Get("RootDeviceName"),
+		bootMode:           form.Get("BootMode"),
+		sriovNetSupport:    form.Get("SriovNetSupport"),
+		enaSupport:         boolValue(form, "EnaSupport"),
+		tags:               tagSpecifications(form, "image"),
+	}
+	if img.architecture == "" {
+		img.architecture = "x86_64"
+	}
+
+	for _, prefix := range indexedPrefixes(form, "BlockDeviceMapping") {
+		snapshotID := form.Get(prefix + ".Ebs.SnapshotId")
+		snap, ok := s.region(region).snapshots[snapshotID]
+		if !ok {
+			return nil, newEC2Error("InvalidSnapshot.NotFound", "The snapshot '%s' does not exist.", snapshotID)
+		}
+		img.blockDevices = append(img.blockDevices, blockDevice{
+			deviceName:          form.Get(prefix + ".DeviceName"),
+			snapshotID:          snap.id,
+			encrypted:           snap.encrypted,
+			volumeSize:          snap.volumeSize,
+			deleteOnTermination: boolValue(form, prefix+".Ebs.DeleteOnTermination"),
+		})
+	}
+
+	s.registerImage(region, img)
+
+	return struct {
+		ImageID string `xml:"imageId"`
+	}{img.id}, nil
+}
+
+func (s *Server) copyImage(region string, form url.Values) (interface{}, error) {
+	sourceRegion := form.Get("SourceRegion")
+	source, err := s.findImage(sourceRegion, form.Get("SourceImageId"))
+	if err != nil {
+		return nil, err
+	}
+	if source.ownerID != s.caller && !source.launchPermissions.allows(s.caller) {
+		return nil, newEC2Error("InvalidAMIID.NotFound", "The image id '[%s]' does not exist", source.id)
+	}
+
+	name := form.Get("Name")
+	if s.imageNameTaken(region, name) {
+		return nil, newEC2Error("InvalidAMIName.Duplicate", "AMI name %s is already in use by AMI", name)
+	}
+
+	encrypted := boolValue(form, "Encrypted")
+	kmsKeyID := form.Get("KmsKeyId")
+
+	img := &image{
+		name:               name,
+		description:        form.Get("Description"),
+		architecture:       source.architecture,
+		virtualizationType: source.virtualizationType,
+		rootDeviceName:     source.rootDeviceName,
+		bootMode:           source.bootMode,
+		sriovNetSupport:    source.sriovNetSupport,
+		enaSupport:         source.enaSupport,
+		tags:               tagSpecifications(form, "image"),
+	}
+	for _, device := range source.blockDevices {
+		sourceSnapshot := s.region(sourceRegion).snapshots[device.snapshotID]
+		snapEncrypted := encrypted || device.encrypted
+		snapKmsKeyID := kmsKeyID
+		if snapKmsKeyID == "" && sourceSnapshot != nil {
+			snapKmsKeyID = sourceSnapshot.kmsKeyID
+		}
+		snap := s.createSnapshot(region, "", device.volumeSize, snapEncrypted, snapKmsKeyID)
+		snap.description = fmt.Sprintf("Copied for DestinationAmi %s from SourceAmi %s", "pending", source.id)
+		snap.tags = tagSpecifications(form, "snapshot")
+
+		device.snapshotID = snap.id
+		device.encrypted = snapEncrypted
+		img.blockDevices = append(img.blockDevices, device)
+	}
+
+	s.registerImage(region, img)
+	for _, device := range img.blockDevices {
+		s.region(region).snapshots[device.snapshotID].description = fmt.Sprintf("Copied for DestinationAmi %s from SourceAmi %s", img.id, source.id)
+	}
+
+	return struct {
+		ImageID string `xml:"imageId"`
+	}{img.id}, nil
+}
+
+func (s *Server) describeImages(region string, form url.Values) (interface{}, error) {
+	ids := indexed(form, "ImageId")
+	f := filters(form, "Filter")
+	owners := indexed(form, "Owner")
+
+	for _, id := range ids {
+		if _, err := s.findImage(region, id); err != nil {
+			return nil, err
+		}
+	}
+
+	result := struct {
+		Images []xmlImage `xml:"imagesSet>item"`
+	}{}
+
+	for _, img := range s.sortedImages(region) {
+		if len(ids) > 0 && !matchesAny(img.id, ids) {
+			continue
+		}
+		if len(owners) > 0 && !matchesAny(img.ownerID, owners) && !(matchesAny("self", owners) && img.ownerID == s.caller) {
+			continue
+		}
+
+		known := map[string]string{
+			"image-id":     img.id,
+			"name":         img.name,
+			"state":        img.state,
+			"architecture": img.architecture,
+			"is-public":    strconv.FormatBool(img.launchPermissions.public()),
+		}
+		if len(img.blockDevices) > 0 {
+			known["block-device-mapping.snapshot-id"] = img.blockDevices[0].snapshotID
+		}
+		if !matchesFilters(f, known, img.tags) {
+			continue
+		}
+
+		result.Images = append(result.Images, img.toXML())
+	}
+
+	return result, nil
+}
+
+func (s *Server) deregisterImage(region string, form url.Values) (interface{}, error) {
+	img, err := s.findImage(region, form.Get("ImageId"))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.region(region).images, img.id)
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (s *Server) describeImageAttribute(region string, form url.Values) (interface{}, error) {
+	img, err := s.findImage(region, form.Get("ImageId"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch form.Get("Attribute") {
+	case "launchPermission":
+		return struct {
+			ImageID           string       `xml:"imageId"`
+			LaunchPermissions []permission `xml:"launchPermission>item"`
+		}{img.id, img.launchPermissions}, nil
+	default:
+		return nil, newEC2Error("InvalidParameterValue", "Attribute %s is not supported by fakeaws", form.Get("Attribute"))
+	}
+}
+
+func (s *Server) modifyImageAttribute(region string, form url.Values) (interface{}, error) {
+	img, err := s.findImage(region, form.Get("ImageId"))
+	if err != nil {
+		return nil, err
+	}
+
+	add, remove := permissionChanges(form, "LaunchPermission")
+
+	for _, perm := range add {
+		if perm.Group == "all" && img.encrypted() {
+			return nil, newEC2Error("InvalidParameter", "Images with EBS-backed volumes that are encrypted cannot be made public.")
+		}
+		img.launchPermissions = img.launchPermissions.add(perm)
+	}
+	for _, perm := range remove {
+		img.launchPermissions = img.launchPermissions.remove(perm)
+	}
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (s *Server) resetImageAttribute(region string, form url.Values) (interface{}, error) {
+	img, err := s.findImage(region, form.Get("ImageId"))
+	if err != nil {
+		return nil, err
+	}
+
+	if form.Get("Attribute") != "launchPermission" {
+		return nil, newEC2Error("InvalidParameterValue", "Attribute %s cannot be reset", form.Get("Attribute"))
+	}
+	img.launchPermissions = nil
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (img *image) encrypted() bool {
+	for _, device := range img.blockDevices {
+		if device.encrypted {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionChanges reads both the structured (LaunchPermission.Add.1.UserId)
+// and the flat (OperationType, UserId.1, UserGroup.1) forms of a permission change.
+func permissionChanges(form url.Values, structuredName string) (permissions, permissions) {
+	var add, remove permissions
+
+	for op, target := range map[string]*permissions{"Add": &add, "Remove": &remove} {
+		for _, prefix := range indexedPrefixes(form, structuredName+"."+op) {
+			*target = append(*target, permission{Group: form.Get(prefix + ".Group"), UserID: form.Get(prefix + ".UserId")})
+		}
+	}
+
+	flat := &add
+	if strings.EqualFold(form.Get("OperationType"), "remove") {
+		flat = &remove
+	}
+	for _, userID := range indexed(form, "UserId") {
+		*flat = append(*flat, permission{UserID: userID})
+	}
+	for _, group := range indexed(form, "UserGroup") {
+		*flat = append(*flat, permission{Group: group})
+	}
+
+	return add, remove
+}
+
+func (s *Server) sortedImages(region string) []*image {
+	var images []*image
+	for _, img := range s.region(region).images {
+		images = append(images, img)
+	}
+	sortByID(images, func(img *image) string { return img.id })
+	return images
+}
+
+// Snapshots
+
+type xmlSnapshot struct {
+	SnapshotID  string `xml:"snapshotId"`
+	VolumeID    string `xml:"volumeId,omitempty"`
+	Status      string `xml:"status"`
+	StartTime   string `xml:"startTime"`
+	Progress    string `xml:"progress"`
+	OwnerID     string `xml:"ownerId"`
+	VolumeSize  int64  `xml:"volumeSize"`
+	Description string `xml:"description,omitempty"`
+	Encrypted   bool   `xml:"encrypted"`
+	KmsKeyID    string `xml:"kmsKeyId,omitempty"`
+	Tags        []tag  `xml:"tagSet>item"`
+}
+
+func (snap *snapshot) toXML() xmlSnapshot {
+	return xmlSnapshot{
+		SnapshotID:  snap.id,
+		VolumeID:    snap.volumeID,
+		Status:      snap.state,
+		StartTime:   snap.startTime.UTC().Format(time.RFC3339),
+		Progress:    "100%",
+		OwnerID:     AccountID,
+		VolumeSize:  snap.volumeSize,
+		Description: snap.description,
+		Encrypted:   snap.encrypted,
+		KmsKeyID:    snap.kmsKeyID,
+		Tags:        snap.tags,
+	}
+}
+
+func (s *Server) createSnapshot(region, volumeID string, sizeGB int64, encrypted bool, kmsKeyID string) *snapshot {
+	snap := &snapshot{
+		id:         s.newID("snap"),
+		volumeID:   volumeID,
+		state:      "completed",
+		encrypted:  encrypted,
+		kmsKeyID:   kmsKeyID,
+		volumeSize: sizeGB,
+		startTime:  time.Now(),
+	}
+	s.region(region).snapshots[snap.id] = snap
+	return snap
+}
+
+func (s *Server) findSnapshot(region, id string) (*snapshot, error) {
+	snap, ok := s.region(region).snapshots[id]
+	if !ok {
+		return nil, newEC2Error("InvalidSnapshot.NotFound", "The snapshot '%s' does not exist.", id)
+	}
+	return snap, nil
+}
+
+func (s *Server) createSnapshotAction(region string, form url.Values) (interface{}, error) {
+	vol, err := s.findVolume(region, form.Get("VolumeId"))
+	if err != nil {
+		return nil, err
+	}
+
+	snap := s.createSnapshot(region, vol.id, vol.size, false, "")
+	snap.description = form.Get("Description")
+	snap.tags = tagSpecifications(form, "snapshot")
+
+	return snap.toXML(), nil
+}
+
+func (s *Server) describeSnapshots(region string, form url.Values) (interface{}, error) {
+	ids := indexed(form, "SnapshotId")
+	f := filters(form, "Filter")
+
+	for _, id := range ids {
+		if _, err := s.findSnapshot(region, id); err != nil {
+			return nil, err
+		}
+	}
+
+	var snapshots []*snapshot
+	for _, snap := range s.region(region).snapshots {
+		snapshots = append(snapshots, snap)
+	}
+	sortByID(snapshots, func(snap *snapshot) string { return snap.id })
+
+	result := struct {
+		Snapshots []xmlSnapshot `xml:"snapshotSet>item"`
+	}{}
+	for _, snap := range snapshots {
+		if len(ids) > 0 && !matchesAny(snap.id, ids) {
+			continue
+		}
+		known := map[string]string{
+			"snapshot-id": snap.id,
+			"volume-id":   snap.volumeID,
+			"status":      snap.state,
+			"description": snap.description,
+		}
+		if !matchesFilters(f, known, snap.tags) {
+			continue
+		}
+		result.Snapshots = append(result.Snapshots, snap.toXML())
+	}
+
+	return result, nil
+}
+
+func (s *Server) deleteSnapshot(region string, form url.Values) (interface{}, error) {
+	snap, err := s.findSnapshot(region, form.Get("SnapshotId"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, img := range s.region(region).images {
+		for _, device := range img.blockDevices {
+			if device.snapshotID == snap.id {
+				return nil, newEC2Error("InvalidSnapshot.InUse", "The snapshot %s is currently in use by %s", snap.id, img.id)
+			}
+		}
+	}
+
+	delete(s.region(region).snapshots, snap.id)
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (s *Server) describeSnapshotAttribute(region string, form url.Values) (interface{}, error) {
+	snap, err := s.findSnapshot(region, form.Get("SnapshotId"))
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		SnapshotID              string       `xml:"snapshotId"`
+		CreateVolumePermissions []permission `xml:"createVolumePermission>item"`
+	}{snap.id, snap.permissions}, nil
+}
+
+func (s *Server) modifySnapshotAttribute(region string, form url.Values) (interface{}, error) {
+	snap, err := s.findSnapshot(region, form.Get("SnapshotId"))
+	if err != nil {
+		return nil, err
+	}
+
+	add, remove := permissionChanges(form, "CreateVolumePermission")
+
+	for _, perm := range add {
+		if perm.Group == "all" && snap.encrypted {
+			return nil, newEC2Error("InvalidParameter", "Encrypted snapshots with EBS default key cannot be shared")
+		}
+		snap.permissions = snap.permissions.add(perm)
+	}
+	for _, perm := range remove {
+		snap.permissions = snap.permissions.remove(perm)
+	}
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+// Import tasks
+
+type xmlSnapshotTaskDetail struct {
+	Status        string `xml:"status"`
+	StatusMessage string `xml:"statusMessage,omitempty"`
+	SnapshotID    string `xml:"snapshotId,omitempty"`
+	URL           string `xml:"url,omitempty"`
+	Format        string `xml:"format,omitempty"`
+	Encrypted     bool   `xml:"encrypted"`
+	KmsKeyID      string `xml:"kmsKeyId,omitempty"`
+}
+
+type xmlImportSnapshotTask struct {
+	ImportTaskID       string                `xml:"importTaskId"`
+	SnapshotTaskDetail xmlSnapshotTaskDetail `xml:"snapshotTaskDetail"`
+}
+
+func (task *importSnapshotTask) toXML() xmlImportSnapshotTask {
+	return xmlImportSnapshotTask{
+		ImportTaskID: task.id,
+		SnapshotTaskDetail: xmlSnapshotTaskDetail{
+			Status:        task.status,
+			StatusMessage: task.statusMessage,
+			SnapshotID:    task.snapshotID,
+			URL:           task.url,
+			Format:        task.format,
+			Encrypted:     task.encrypted,
+			KmsKeyID:      task.kmsKeyID,
+		},
+	}
+}
+
+// importSnapshot completes immediately: the snapshot exists as soon as the
+// task is created, unless the referenced image cannot be found in the fake S3.
+func (s *Server) importSnapshot(region string, form url.Values) (interface{}, error) {
+	task := &importSnapshotTask{
+		id:        s.newID("import-snap"),
+		url:       form.Get("DiskContainer.Url"),
+		format:    form.Get("DiskContainer.Format"),
+		encrypted: boolValue(form, "Encrypted"),
+		kmsKeyID:  form.Get("KmsKeyId"),
+	}
+	if bucketName := form.Get("DiskContainer.UserBucket.S3Bucket"); bucketName != "" {
+		task.url = fmt.Sprintf("s3://%s/%s", bucketName, form.Get("DiskContainer.UserBucket.S3Key"))
+	}
+
+	obj, ok := s.objectFromURL(task.url)
+	if ok {
+		snap := s.createSnapshot(region, "", sizeInGB(int64(len(obj.body))), task.encrypted, task.kmsKeyID)
+		snap.description = "Created by AWS-VMImport service for " + task.id
+		task.snapshotID = snap.id
+		task.status = "completed"
+	} else {
+		task.status = "deleted"
+		task.statusMessage = fmt.Sprintf("ClientError: Disk validation failed [We do not have access to the given resource. Reason 404 Not Found: %s]", task.url)
+	}
+	s.region(region).importTasks[task.id] = task
+
+	response := task.toXML()
+	response.SnapshotTaskDetail.Status = "active"
+	response.SnapshotTaskDetail.SnapshotID = ""
+	return response, nil
+}
+
+func (s *Server) describeImportSnapshotTasks(region string, form url.Values) (interface{}, error) {
+	result := struct {
+		Tasks []xmlImportSnapshotTask `xml:"importSnapshotTaskSet>item"`
+	}{}
+
+	for _, id := range indexed(form, "ImportTaskId") {
+		task, ok := s.region(region).importTasks[id]
+		if !ok {
+			return nil, newEC2Error("InvalidConversionTaskId.Malformed", "The import task id '%s' does not exist", id)
+		}
+		result.Tasks = append(result.Tasks, task.toXML())
+	}
+
+	return result, nil
+}
+
+type xmlConversionTask struct {
+	ConversionTaskID string `xml:"conversionTaskId"`
+	State            string `xml:"state"`
+	StatusMessage    string `xml:"statusMessage,omitempty"`
+	ImportVolume     struct {
+		AvailabilityZone string `xml:"availabilityZone"`
+		Volume           struct {
+			ID   string `xml:"id,omitempty"`
+			Size int64  `xml:"size"`
+		} `xml:"volume"`
+	} `xml:"importVolume"`
+}
+
+func (task *conversionTask) toXML() xmlConversionTask {
+	x := xmlConversionTask{
+		ConversionTaskID: task.id,
+		State:            task.state,
+		StatusMessage:    task.statusMessage,
+	}
+	x.ImportVolume.AvailabilityZone = task.availabilityZone
+	x.ImportVolume.Volume.ID = task.volumeID
+	x.ImportVolume.Volume.Size = task.size
+	return x
+}
+
+// importVolume completes immediately when the import manifest can be found in the fake S3.
+func (s *Server) importVolume(region string, form url.Values) (interface{}, error) {
+	task := &conversionTask{
+		id:               s.newID("import-vol"),
+		availabilityZone: form.Get("AvailabilityZone"),
+		size:             int64Value(form, "Volume.Size"),
+	}
+
+	manifestURL := form.Get("Image.ImportManifestUrl")
+	if _, ok := s.objectFromURL(manifestURL); ok {
+		task.volumeID = s.createVolume(region, task.availabilityZone, task.size).id
+		task.state = "completed"
+	} else {
+		task.state = "cancelled"
+		task.statusMessage = fmt.Sprintf("import manifest %s could not be retrieved", manifestURL)
+	}
+	s.region(region).conversionTasks[task.id] = task
+
+	return struct {
+		ConversionTask xmlConversionTask `xml:"conversionTask"`
+	}{task.toXML()}, nil
+}
+
+func (s *Server) describeConversionTasks(region string, form url.Values) (interface{}, error) {
+	result := struct {
+		Tasks []xmlConversionTask `xml:"conversionTasks>item"`
+	}{}
+
+	for _, id := range indexed(form, "ConversionTaskId") {
+		task, ok := s.region(region).conversionTasks[id]
+		if !ok {
+			return nil, newEC2Error("InvalidConversionTaskId", "The conversion task id '%s' does not exist", id)
+		}
+		result.Tasks = append(result.Tasks, task.toXML())
+	}
+
+	return result, nil
+}
+
+// Volumes
+
+type xmlVolume struct {
+	VolumeID         string `xml:"volumeId"`
+	Size             int64  `xml:"size"`
+	AvailabilityZone string `xml:"availabilityZone"`
+	Status           string `xml:"status"`
+	CreateTime       string `xml:"createTime"`
+	Tags             []tag  `xml:"tagSet>item"`
+}
+
+func (s *Server) createVolume(region, availabilityZone string, sizeGB int64) *volume {
+	vol := &volume{
+		id:               s.newID("vol"),
+		availabilityZone: availabilityZone,
+		state:            "available",
+		size:             sizeGB,
+		createTime:       time.Now(),
+	}
+	s.region(region).volumes[vol.id] = vol
+	return vol
+}
+
+func (s *Server) findVolume(region, id string) (*volume, error) {
+	vol, ok := s.region(region).volumes[id]
+	if !ok {
+		return nil, newEC2Error("InvalidVolume.NotFound", "The volume '%s' does not exist.", id)
+	}
+	return vol, nil
+}
+
+func (s *Server) describeVolumes(region string, form url.Values) (interface{}, error) {
+	ids := indexed(form, "VolumeId")
+	f := filters(form, "Filter")
+
+	for _, id := range ids {
+		if _, err := s.findVolume(region, id); err != nil {
+			return nil, err
+		}
+	}
+
+	var volumes []*volume
+	for _, vol := range s.region(region).volumes {
+		volumes = append(volumes, vol)
+	}
+	sortByID(volumes, func(vol *volume) string { return vol.id })
+
+	result := struct {
+		Volumes []xmlVolume `xml:"volumeSet>item"`
+	}{}
+	for _, vol := range volumes {
+		if len(ids) > 0 && !matchesAny(vol.id, ids) {
+			continue
+		}
+		known := map[string]string{
+			"volume-id": vol.id,
+			"status":    vol.state,
+		}
+		if !matchesFilters(f, known, vol.tags) {
+			continue
+		}
+		result.Volumes = append(result.Volumes, xmlVolume{
+			VolumeID:         vol.id,
+			Size:             vol.size,
+			AvailabilityZone: vol.availabilityZone,
+			Status:           vol.state,
+			CreateTime:       vol.createTime.UTC().Format("2006-01-02T15:04:05.000Z"),
+			Tags:             vol.tags,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Server) deleteVolume(region string, form url.Values) (interface{}, error) {
+	vol, err := s.findVolume(region, form.Get("VolumeId"))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.region(region).volumes, vol.id)
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (s *Server) describeAvailabilityZones(region string, _ url.Values) (interface{}, error) {
+	type zone struct {
+		ZoneName   string `xml:"zoneName"`
+		ZoneState  string `xml:"zoneState"`
+		RegionName string `xml:"regionName"`
+	}
+
+	return struct {
+		Zones []zone `xml:"availabilityZoneInfo>item"`
+	}{
+		Zones: []zone{
+			{ZoneName: region + "a", ZoneState: "available", RegionName: region},
+			{ZoneName: region + "b", ZoneState: "available", RegionName: region},
+		},
+	}, nil
+}
+
+// describeRegions lists every region that the fake has seen a request or fixture for.
+func (s *Server) describeRegions(region string, _ url.Values) (interface{}, error) {
+	type regionInfo struct {
+		RegionName  string `xml:"regionName"`
+		Endpoint    string `xml:"regionEndpoint"`
+		OptInStatus string `xml:"optInStatus"`
+	}
+
+	s.region(region)
+
+	var names []string
+	for name := range s.regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := struct {
+		Regions []regionInfo `xml:"regionInfo>item"`
+	}{}
+	for _, name := range names {
+		result.Regions = append(result.Regions, regionInfo{
+			RegionName:  name,
+			Endpoint:    "ec2." + name + ".amazonaws.com",
+			OptInStatus: "opt-in-not-required",
+		})
+	}
+
+	return result, nil
+}
+
+// Instances
+
+type xmlInstanceState struct {
+	Code int    `xml:"code"`
+	Name string `xml:"name"`
+}
+
+var instanceStateCodes = map[string]int{
+	"pending":    0,
+	"running":    16,
+	"terminated": 48,
+}
+
+func instanceState(name string) xmlInstanceState {
+	return xmlInstanceState{Code: instanceStateCodes[name], Name: name}
+}
+
+type xmlInstance struct {
+	InstanceID    string           `xml:"instanceId"`
+	ImageID       string           `xml:"imageId"`
+	InstanceType  string           `xml:"instanceType"`
+	InstanceState xmlInstanceState `xml:"instanceState"`
+	Tags          []tag            `xml:"tagSet>item"`
+}
+
+func (inst *instance) toXML() xmlInstance {
+	return xmlInstance{
+		InstanceID:    inst.id,
+		ImageID:       inst.imageID,
+		InstanceType:  inst.instanceType,
+		InstanceState: instanceState(inst.state),
+		Tags:          inst.tags,
+	}
+}
+
+func (s *Server) findInstance(region, id string) (*instance, error) {
+	inst, ok := s.region(region).instances[id]
+	if !ok {
+		return nil, newEC2Error("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+	}
+	return inst, nil
+}
+
+func (s *Server) runInstances(region string, form url.Values) (interface{}, error) {
+	img, err := s.findImage(region, form.Get("ImageId"))
+	if err != nil {
+		return nil, err
+	}
+
+	count := int64Value(form, "MinCount")
+	if count < 1 {
+		count = 1
+	}
+
+	result := struct {
+		ReservationID string        `xml:"reservationId"`
+		OwnerID       string        `xml:"ownerId"`
+		Instances     []xmlInstance `xml:"instancesSet>item"`
+	}{
+		ReservationID: s.newID("r"),
+		OwnerID:       AccountID,
+	}
+	for i := int64(0); i < count; i++ {
+		inst := &instance{
+			id:           s.newID("i"),
+			imageID:      img.id,
+			instanceType: form.Get("InstanceType"),
+			state:        "running",
+		}
+		s.region(region).instances[inst.id] = inst
+		result.Instances = append(result.Instances, inst.toXML())
+	}
+
+	return result, nil
+}
+
+func (s *Server) describeInstances(region string, form url.Values) (interface{}, error) {
+	type reservation struct {
+		ReservationID string        `xml:"reservationId"`
+		OwnerID       string        `xml:"ownerId"`
+		Instances     []xmlInstance `xml:"instancesSet>item"`
+	}
+
+	result := struct {
+		Reservations []reservation `xml:"reservationSet>item"`
+	}{}
+	for _, id := range indexed(form, "InstanceId") {
+		inst, err := s.findInstance(region, id)
+		if err != nil {
+			return nil, err
+		}
+		result.Reservations = append(result.Reservations, reservation{
+			ReservationID: "r-" + strings.TrimPrefix(inst.id, "i-"),
+			OwnerID:       AccountID,
+			Instances:     []xmlInstance{inst.toXML()},
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Server) describeInstanceStatus(region string, form url.Values) (interface{}, error) {
+	type summary struct {
+		Status string `xml:"status"`
+	}
+	type status struct {
+		InstanceID       string           `xml:"instanceId"`
+		AvailabilityZone string           `xml:"availabilityZone"`
+		InstanceState    xmlInstanceState `xml:"instanceState"`
+		InstanceStatus   summary          `xml:"instanceStatus"`
+		SystemStatus     summary          `xml:"systemStatus"`
+	}
+
+	result := struct {
+		Statuses []status `xml:"instanceStatusSet>item"`
+	}{}
+	for _, id := range indexed(form, "InstanceId") {
+		inst, err := s.findInstance(region, id)
+		if err != nil {
+			return nil, err
+		}
+		if inst.state != "running" && !boolValue(form, "IncludeAllInstances") {
+			continue
+		}
+		result.Statuses = append(result.Statuses, status{
+			InstanceID:       inst.id,
+			AvailabilityZone: region + "a",
+			InstanceState:    instanceState(inst.state),
+			InstanceStatus:   summary{Status: "ok"},
+			SystemStatus:     summary{Status: "ok"},
+		})
+	}
+
+	return result, nil
+}
+
+func (s *Server) terminateInstances(region string, form url.Values) (interface{}, error) {
+	type stateChange struct {
+		InstanceID    string           `xml:"instanceId"`
+		CurrentState  xmlInstanceState `xml:"currentState"`
+		PreviousState xmlInstanceState `xml:"previousState"`
+	}
+
+	result := struct {
+		Instances []stateChange `xml:"instancesSet>item"`
+	}{}
+	for _, id := range indexed(form, "InstanceId") {
+		inst, err := s.findInstance(region, id)
+		if err != nil {
+			return nil, err
+		}
+		previous := inst.state
+		inst.state = "terminated"
+		result.Instances = append(result.Instances, stateChange{
+			InstanceID:    inst.id,
+			CurrentState:  instanceState(inst.state),
+			PreviousState: instanceState(previous),
+		})
+	}
+
+	return result, nil
+}
+
+// Tags
+
+func (s *Server) createTags(region string, form url.Values) (interface{}, error) {
+	newTags := formTags(form, "Tag")
+
+	for _, id := range indexed(form, "ResourceId") {
+		target, err := s.taggable(region, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range newTags {
+			*target = target.set(t.Key, t.Value)
+		}
+	}
+
+	return struct {
+		Return bool `xml:"return"`
+	}{true}, nil
+}
+
+func (s *Server) taggable(region, id string) (*tags, error) {
+	rs := s.region(region)
+	switch {
+	case strings.HasPrefix(id, "ami-"):
+		img, err := s.findImage(region, id)
+		if err != nil {
+			return nil, err
+		}
+		return &img.tags, nil
+	case strings.HasPrefix(id, "snap-"):
+		snap, err := s.findSnapshot(region, id)
+		if err != nil {
+			return nil, err
+		}
+		return &snap.tags, nil
+	case strings.HasPrefix(id, "vol-"):
+		vol, err := s.findVolume(region, id)
+		if err != nil {
+			return nil, err
+		}
+		return &vol.tags, nil
+	case strings.HasPrefix(id, "i-"):
+		if inst, ok := rs.instances[id]; ok {
+			return &inst.tags, nil
+		}
+	}
+	return nil, newEC2Error("InvalidID", "The ID '%s' is not valid", id)
+}
@@ -0,0 +1,124 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const iamNamespace = "https://iam.amazonaws.com/doc/2010-05-08/"
+
+type role struct {
+	name         string
+	trustPolicy  string
+	creationDate time.Time
+}
+
+func (r *role) arn() string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", AccountID, r.name)
+}
+
+var iamActions = map[string]queryHandler{
+	"GetRole":                 (*Server).getRole,
+	"SimulatePrincipalPolicy": (*Server).simulatePrincipalPolicy,
+}
+
+// CreateRole creates an IAM role that trustedService may assume and returns its ARN.
+func (s *Server) CreateRole(name, trustedService string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &role{
+		name:         name,
+		trustPolicy:  fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"%s"},"Action":"sts:AssumeRole"}]}`, trustedService),
+		creationDate: time.Now(),
+	}
+	s.roles[name] = r
+	return r.arn()
+}
+
+// DenyAction makes SimulatePrincipalPolicy report that no principal is allowed action.
+// Every other action is allowed.
+func (s *Server) DenyAction(action string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deniedActions[action] = true
+}
+
+func (s *Server) serveIAM(w http.ResponseWriter, r *http.Request) {
+	s.serveQuery(w, r, iamActions, iamNamespace)
+}
+
+func (s *Server) getRole(_ string, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	r, ok := s.roles[name]
+	if !ok {
+		return nil, newEC2Error("NoSuchEntity", "The role with name %s cannot be found.", name)
+	}
+
+	type roleResult struct {
+		Path                     string `xml:"Path"`
+		RoleName                 string `xml:"RoleName"`
+		RoleID                   string `xml:"RoleId"`
+		Arn                      string `xml:"Arn"`
+		CreateDate               string `xml:"CreateDate"`
+		AssumeRolePolicyDocument string `xml:"AssumeRolePolicyDocument"`
+	}
+	return struct {
+		XMLName xml.Name   `xml:"GetRoleResult"`
+		Role    roleResult `xml:"Role"`
+	}{
+		Role: roleResult{
+			Path:                     "/",
+			RoleName:                 r.name,
+			RoleID:                   "AROAFAKE" + strings.ToUpper(r.name),
+			Arn:                      r.arn(),
+			CreateDate:               r.creationDate.UTC().Format(time.RFC3339),
+			AssumeRolePolicyDocument: url.QueryEscape(r.trustPolicy),
+		},
+	}, nil
+}
+
+// simulatePrincipalPolicy allows every action of ActionNames on every resource of ResourceArns, except for
+// the actions passed to DenyAction.
+func (s *Server) simulatePrincipalPolicy(_ string, form url.Values) (interface{}, error) {
+	if form.Get("PolicySourceArn") == "" {
+		return nil, newEC2Error("ValidationError", "PolicySourceArn is required")
+	}
+
+	actions := indexed(form, "ActionNames.member")
+	resources := indexed(form, "ResourceArns.member")
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	type evaluationResult struct {
+		EvalActionName   string `xml:"EvalActionName"`
+		EvalResourceName string `xml:"EvalResourceName"`
+		EvalDecision     string `xml:"EvalDecision"`
+	}
+	result := struct {
+		XMLName           xml.Name           `xml:"SimulatePrincipalPolicyResult"`
+		EvaluationResults []evaluationResult `xml:"EvaluationResults>member"`
+		IsTruncated       bool               `xml:"IsTruncated"`
+	}{}
+	for _, action := range actions {
+		for _, resource := range resources {
+			decision := "allowed"
+			if s.deniedActions[action] {
+				decision = "implicitDeny"
+			}
+			result.EvaluationResults = append(result.EvaluationResults, evaluationResult{
+				EvalActionName:   action,
+				EvalResourceName: resource,
+				EvalDecision:     decision,
+			})
+		}
+	}
+
+	return result, nil
+}
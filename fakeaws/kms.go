@@ -0,0 +1,362 @@
+package fakeaws
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/config"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type kmsKey struct {
+	id          string
+	multiRegion bool
+	state       string
+	// primaryRegion is the region of the primary key of a multi-region key
+	primaryRegion string
+}
+
+func (k *kmsKey) arn(region string) string {
+	return config.PartitionForRegion(region).Arn("kms", region, AccountID, "key/"+k.id)
+}
+
+type kmsAlias struct {
+	name         string
+	targetKeyID  string
+	creationDate time.Time
+}
+
+func (a *kmsAlias) arn(region string) string {
+	return config.PartitionForRegion(region).Arn("kms", region, AccountID, a.name)
+}
+
+type kmsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *kmsError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+func newKMSError(errorType, format string, args ...interface{}) *kmsError {
+	return &kmsError{Type: errorType, Message: fmt.Sprintf(format, args...)}
+}
+
+type kmsHandler func(s *Server, region string, body []byte) (interface{}, error)
+
+var kmsActions = map[string]kmsHandler{
+	"CreateAlias":         (*Server).createAlias,
+	"DeleteAlias":         (*Server).deleteAlias,
+	"DescribeKey":         (*Server).describeKey,
+	"ListAliases":         (*Server).listAliases,
+	"ListKeys":            (*Server).listKeys,
+	"ReplicateKey":        (*Server).replicateKey,
+	"ScheduleKeyDeletion": (*Server).scheduleKeyDeletion,
+}
+
+func (s *Server) serveKMS(w http.ResponseWriter, r *http.Request, region string) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "TrentService.")
+	handler, ok := kmsActions[action]
+	if !ok {
+		writeKMS(w, http.StatusBadRequest, newKMSError("UnknownOperationException", "%s is not supported by fakeaws", action))
+		return
+	}
+
+	body, _, err := readS3Body(r)
+	if err != nil {
+		writeKMS(w, http.StatusBadRequest, newKMSError("SerializationException", "%s", err))
+		return
+	}
+
+	s.mu.Lock()
+	response, err := handler(s, region, body)
+	s.mu.Unlock()
+
+	if err != nil {
+		kmsErr, ok := err.(*kmsError)
+		if !ok {
+			kmsErr = newKMSError("KMSInternalException", "%s", err)
+		}
+		writeKMS(w, http.StatusBadRequest, kmsErr)
+		return
+	}
+
+	writeKMS(w, http.StatusOK, response)
+}
+
+func writeKMS(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) //nolint:errcheck
+}
+
+func (s *Server) newKeyID(multiRegion bool) string {
+	if multiRegion {
+		return "mrk-" + hex.EncodeToString(uuid.NewV4().Bytes())
+	}
+	return uuid.NewV4().String()
+}
+
+func (s *Server) createKey(region, id string, multiRegion bool) *kmsKey {
+	key := &kmsKey{id: id, multiRegion: multiRegion, state: "Enabled", primaryRegion: region}
+	s.region(region).keys[id] = key
+	return key
+}
+
+// resolveKey accepts a key ID, key ARN, alias name or alias ARN. ARNs are
+// resolved in the region they name rather than the region of the request.
+func (s *Server) resolveKey(region, ref string) (*kmsKey, string, error) {
+	resource := ref
+	if strings.HasPrefix(ref, "arn:") {
+		parts := strings.SplitN(ref, ":", 6)
+		if len(parts) != 6 {
+			return nil, "", newKMSError("NotFoundException", "Invalid keyId %s", ref)
+		}
+		region, resource = parts[3], parts[5]
+	}
+
+	if strings.HasPrefix(resource, "alias/") {
+		alias, ok := s.region(region).aliases[resource]
+		if !ok {
+			return nil, "", newKMSError("NotFoundException", "Alias %s is not found.", ref)
+		}
+		resource = alias.targetKeyID
+	}
+
+	key, ok := s.region(region).keys[strings.TrimPrefix(resource, "key/")]
+	if !ok {
+		return nil, "", newKMSError("NotFoundException", "Key '%s' does not exist", ref)
+	}
+	return key, region, nil
+}
+
+func (s *Server) createAlias(region string, body []byte) (interface{}, error) {
+	var input struct {
+		AliasName   string
+		TargetKeyId string
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	if !strings.HasPrefix(input.AliasName, "alias/") {
+		return nil, newKMSError("ValidationException", "Alias must start with the prefix \"alias/\"")
+	}
+	if _, ok := s.region(region).aliases[input.AliasName]; ok {
+		return nil, newKMSError("AlreadyExistsException", "An alias with the name %s already exists", input.AliasName)
+	}
+
+	key, _, err := s.resolveKey(region, input.TargetKeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.region(region).aliases[input.AliasName] = &kmsAlias{name: input.AliasName, targetKeyID: key.id, creationDate: time.Now()}
+
+	return struct{}{}, nil
+}
+
+func (s *Server) deleteAlias(region string, body []byte) (interface{}, error) {
+	var input struct {
+		AliasName string
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	if _, ok := s.region(region).aliases[input.AliasName]; !ok {
+		return nil, newKMSError("NotFoundException", "Alias %s is not found.", input.AliasName)
+	}
+	delete(s.region(region).aliases, input.AliasName)
+
+	return struct{}{}, nil
+}
+
+type kmsAliasListEntry struct {
+	AliasName    string
+	AliasArn     string
+	TargetKeyId  string
+	CreationDate float64
+}
+
+func (s *Server) listAliases(region string, body []byte) (interface{}, error) {
+	var input struct {
+		KeyId string
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	targetKeyID := ""
+	if input.KeyId != "" {
+		key, _, err := s.resolveKey(region, input.KeyId)
+		if err != nil {
+			return nil, err
+		}
+		targetKeyID = key.id
+	}
+
+	result := struct {
+		Aliases   []kmsAliasListEntry
+		Truncated bool
+	}{Aliases: []kmsAliasListEntry{}}
+	for _, alias := range s.region(region).aliases {
+		if targetKeyID != "" && alias.targetKeyID != targetKeyID {
+			continue
+		}
+		result.Aliases = append(result.Aliases, kmsAliasListEntry{
+			AliasName:    alias.name,
+			AliasArn:     alias.arn(region),
+			TargetKeyId:  alias.targetKeyID,
+			CreationDate: float64(alias.creationDate.UnixNano()) / float64(time.Second),
+		})
+	}
+	sort.Slice(result.Aliases, func(i, j int) bool { return result.Aliases[i].AliasName < result.Aliases[j].AliasName })
+
+	return result, nil
+}
+
+type kmsKeyMetadata struct {
+	AWSAccountId             string
+	KeyId                    string
+	Arn                      string
+	KeyState                 string
+	Enabled                  bool
+	MultiRegion              bool
+	MultiRegionConfiguration *kmsMultiRegionConfiguration `json:",omitempty"`
+}
+
+type kmsMultiRegionConfiguration struct {
+	MultiRegionKeyType string
+	PrimaryKey         struct {
+		Arn    string
+		Region string
+	}
+}
+
+func (k *kmsKey) metadata(region string) kmsKeyMetadata {
+	metadata := kmsKeyMetadata{
+		AWSAccountId: AccountID,
+		KeyId:        k.id,
+		Arn:          k.arn(region),
+		KeyState:     k.state,
+		Enabled:      k.state == "Enabled",
+		MultiRegion:  k.multiRegion,
+	}
+	if k.multiRegion {
+		metadata.MultiRegionConfiguration = &kmsMultiRegionConfiguration{MultiRegionKeyType: "PRIMARY"}
+		if region != k.primaryRegion {
+			metadata.MultiRegionConfiguration.MultiRegionKeyType = "REPLICA"
+		}
+		metadata.MultiRegionConfiguration.PrimaryKey.Arn = k.arn(k.primaryRegion)
+		metadata.MultiRegionConfiguration.PrimaryKey.Region = k.primaryRegion
+	}
+	return metadata
+}
+
+func (s *Server) describeKey(region string, body []byte) (interface{}, error) {
+	var input struct {
+		KeyId string
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	key, keyRegion, err := s.resolveKey(region, input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		KeyMetadata kmsKeyMetadata
+	}{key.metadata(keyRegion)}, nil
+}
+
+func (s *Server) listKeys(region string, _ []byte) (interface{}, error) {
+	type entry struct {
+		KeyId  string
+		KeyArn string
+	}
+
+	result := struct {
+		Keys      []entry
+		Truncated bool
+	}{Keys: []entry{}}
+	for _, key := range s.region(region).keys {
+		result.Keys = append(result.Keys, entry{KeyId: key.id, KeyArn: key.arn(region)})
+	}
+	sort.Slice(result.Keys, func(i, j int) bool { return result.Keys[i].KeyId < result.Keys[j].KeyId })
+
+	return result, nil
+}
+
+// replicateKey copies a multi-region primary key into ReplicaRegion under the same key ID.
+func (s *Server) replicateKey(region string, body []byte) (interface{}, error) {
+	var input struct {
+		KeyId         string
+		ReplicaRegion string
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	key, _, err := s.resolveKey(region, input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if !key.multiRegion {
+		return nil, newKMSError("UnsupportedOperationException", "%s is not a multi-Region key", input.KeyId)
+	}
+	if _, ok := s.region(input.ReplicaRegion).keys[key.id]; ok {
+		return nil, newKMSError("AlreadyExistsException", "Key %s already exists in %s", key.id, input.ReplicaRegion)
+	}
+
+	replica := s.createKey(input.ReplicaRegion, key.id, true)
+	replica.primaryRegion = key.primaryRegion
+
+	return struct {
+		ReplicaKeyMetadata kmsKeyMetadata
+	}{replica.metadata(input.ReplicaRegion)}, nil
+}
+
+func (s *Server) scheduleKeyDeletion(region string, body []byte) (interface{}, error) {
+	var input struct {
+		KeyId               string
+		PendingWindowInDays int
+	}
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, newKMSError("SerializationException", "%s", err)
+	}
+
+	key, keyRegion, err := s.resolveKey(region, input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if input.PendingWindowInDays == 0 {
+		input.PendingWindowInDays = 30
+	}
+	key.state = "PendingDeletion"
+
+	return struct {
+		KeyId        string
+		KeyState     string
+		DeletionDate float64
+	}{
+		KeyId:        key.arn(keyRegion),
+		KeyState:     key.state,
+		DeletionDate: float64(time.Now().AddDate(0, 0, input.PendingWindowInDays).Unix()),
+	}, nil
+}
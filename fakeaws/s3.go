@@ -0,0 +1,592 @@
+package fakeaws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// maxObjectTags is the number of tags S3 allows on an object
+const maxObjectTags = 10
+
+type bucket struct {
+	region  string
+	objects map[string]*object
+}
+
+type object struct {
+	body                 []byte
+	etag                 string
+	serverSideEncryption string
+	lastModified         time.Time
+	// checksumSHA256 is the SHA-256 checksum the object was uploaded with. For a multipart
+	// upload it is the checksum of the checksums of its parts.
+	checksumSHA256 string
+	partsCount     int
+	// metadata is the user metadata of the object, keyed by its X-Amz-Meta- header
+	metadata http.Header
+	// tagging holds the tags of the object, as given by its X-Amz-Tagging header
+	tagging url.Values
+}
+
+func newObject(body []byte, serverSideEncryption string) *object {
+	sum := md5.Sum(body)
+	return &object{
+		body:                 body,
+		etag:                 fmt.Sprintf("%q", hex.EncodeToString(sum[:])),
+		serverSideEncryption: serverSideEncryption,
+		lastModified:         time.Now(),
+	}
+}
+
+type multipartUpload struct {
+	bucket               string
+	key                  string
+	serverSideEncryption string
+	checksumAlgorithm    string
+	metadata             http.Header
+	tagging              url.Values
+	parts                map[int][]byte
+}
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+
+	status int
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func noSuchKey(key string) *s3Error {
+	return &s3Error{Code: "NoSuchKey", Message: "The specified key does not exist.", Resource: key, status: http.StatusNotFound}
+}
+
+func noSuchBucket(name string) *s3Error {
+	return &s3Error{Code: "NoSuchBucket", Message: "The specified bucket does not exist", Resource: name, status: http.StatusNotFound}
+}
+
+func noSuchUpload(id string) *s3Error {
+	return &s3Error{Code: "NoSuchUpload", Message: "The specified upload does not exist.", Resource: id, status: http.StatusNotFound}
+}
+
+// serveS3 implements path-style object operations: /<bucket>/<key>.
+func (s *Server) serveS3(w http.ResponseWriter, r *http.Request, _ string) {
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	body, trailers, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, r, &s3Error{Code: "IncompleteBody", Message: err.Error(), status: http.StatusBadRequest})
+		return
+	}
+
+	checksum, err := verifyChecksum(r, trailers, body)
+	if err != nil {
+		writeS3Error(w, r, err.(*s3Error))
+		return
+	}
+
+	if r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2" {
+		s.listObjectsV2(w, r, bucketName, query.Get("prefix"))
+		return
+	}
+
+	if r.Method == http.MethodGet && key == "" && query.Has("location") {
+		s.getBucketLocation(w, r, bucketName)
+		return
+	}
+
+	if r.Method == http.MethodGet && query.Has("attributes") {
+		s.getObjectAttributes(w, r, bucketName, key)
+		return
+	}
+
+	if r.Method == http.MethodGet && query.Has("tagging") {
+		s.getObjectTagging(w, r, bucketName, key)
+		return
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		s.getObject(w, r, bucketName, key)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, r, bucketName, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"), body)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeMultipartUpload(w, r, b, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		obj := newObject(body, r.Header.Get("X-Amz-Server-Side-Encryption"))
+		obj.checksumSHA256 = checksum
+		obj.metadata = userMetadata(r)
+		obj.tagging, err = objectTagging(r)
+		if err != nil {
+			writeS3Error(w, r, err.(*s3Error))
+			return
+		}
+		b.objects[key] = obj
+		writeObjectHeaders(w, obj)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, &s3Error{Code: "NotImplemented", Message: fmt.Sprintf("%s %s is not supported by fakeaws", r.Method, r.URL), status: http.StatusNotImplemented})
+	}
+}
+
+// getObject writes the object without holding the server lock, so a client
+// that never drains the body cannot block other requests.
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	s.mu.Lock()
+	b, ok := s.buckets[bucketName]
+	var obj *object
+	if ok {
+		obj = b.objects[key]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+	if obj == nil {
+		writeS3Error(w, r, noSuchKey(key))
+		return
+	}
+
+	writeObjectHeaders(w, obj)
+	if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" && obj.checksumSHA256 != "" {
+		checksum := obj.checksumSHA256
+		if obj.partsCount > 0 {
+			checksum = fmt.Sprintf("%s-%d", checksum, obj.partsCount)
+		}
+		w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(obj.body) //nolint:errcheck
+	}
+}
+
+// getObjectAttributes returns the checksum, parts count and size of an object, as far as they were requested
+func (s *Server) getObjectAttributes(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	type checksum struct {
+		ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
+		ChecksumType   string `xml:"ChecksumType,omitempty"`
+	}
+	type objectParts struct {
+		PartsCount int `xml:"PartsCount"`
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		writeS3Error(w, r, noSuchKey(key))
+		return
+	}
+
+	result := struct {
+		XMLName     xml.Name     `xml:"GetObjectAttributesResponse"`
+		Xmlns       string       `xml:"xmlns,attr"`
+		ETag        string       `xml:"ETag,omitempty"`
+		Checksum    *checksum    `xml:"Checksum"`
+		ObjectParts *objectParts `xml:"ObjectParts"`
+		ObjectSize  *int         `xml:"ObjectSize"`
+	}{Xmlns: s3Namespace}
+
+	for _, attribute := range strings.Split(strings.Join(r.Header.Values("X-Amz-Object-Attributes"), ","), ",") {
+		switch strings.TrimSpace(attribute) {
+		case "ETag":
+			result.ETag = strings.Trim(obj.etag, `"`)
+		case "Checksum":
+			if obj.checksumSHA256 != "" {
+				result.Checksum = &checksum{ChecksumSHA256: obj.checksumSHA256, ChecksumType: "FULL_OBJECT"}
+				if obj.partsCount > 0 {
+					result.Checksum.ChecksumType = "COMPOSITE"
+				}
+			}
+		case "ObjectParts":
+			if obj.partsCount > 0 {
+				result.ObjectParts = &objectParts{PartsCount: obj.partsCount}
+			}
+		case "ObjectSize":
+			size := len(obj.body)
+			result.ObjectSize = &size
+		}
+	}
+
+	w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+	writeS3XML(w, result)
+}
+
+func (s *Server) getObjectTagging(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	type tag struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		writeS3Error(w, r, noSuchKey(key))
+		return
+	}
+
+	result := struct {
+		XMLName xml.Name `xml:"Tagging"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Tags    []tag    `xml:"TagSet>Tag"`
+	}{Xmlns: s3Namespace}
+
+	keys := make([]string, 0, len(obj.tagging))
+	for k := range obj.tagging {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		result.Tags = append(result.Tags, tag{Key: k, Value: obj.tagging.Get(k)})
+	}
+
+	writeS3XML(w, result)
+}
+
+// listObjectsV2 lists every object whose key starts with prefix in a single page.
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, bucketName, prefix string) {
+	type contents struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int    `xml:"Size"`
+		StorageClass string `xml:"StorageClass"`
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := struct {
+		XMLName     xml.Name   `xml:"ListBucketResult"`
+		Xmlns       string     `xml:"xmlns,attr"`
+		Name        string     `xml:"Name"`
+		Prefix      string     `xml:"Prefix"`
+		KeyCount    int        `xml:"KeyCount"`
+		MaxKeys     int        `xml:"MaxKeys"`
+		IsTruncated bool       `xml:"IsTruncated"`
+		Contents    []contents `xml:"Contents"`
+	}{Xmlns: s3Namespace, Name: bucketName, Prefix: prefix, KeyCount: len(keys), MaxKeys: 1000}
+	for _, key := range keys {
+		obj := b.objects[key]
+		result.Contents = append(result.Contents, contents{
+			Key:          key,
+			LastModified: obj.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.etag,
+			Size:         len(obj.body),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	writeS3XML(w, result)
+}
+
+// getBucketLocation reports the location constraint of the bucket, which is empty for us-east-1.
+func (s *Server) getBucketLocation(w http.ResponseWriter, r *http.Request, bucketName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, r, noSuchBucket(bucketName))
+		return
+	}
+
+	location := b.region
+	if location == "us-east-1" {
+		location = ""
+	}
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"LocationConstraint"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string   `xml:",chardata"`
+	}{Xmlns: s3Namespace, Location: location})
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	tagging, err := objectTagging(r)
+	if err != nil {
+		writeS3Error(w, r, err.(*s3Error))
+		return
+	}
+
+	uploadID := s.newID("upload")
+	s.uploads[uploadID] = &multipartUpload{
+		bucket:               bucketName,
+		key:                  key,
+		serverSideEncryption: r.Header.Get("X-Amz-Server-Side-Encryption"),
+		checksumAlgorithm:    r.Header.Get("X-Amz-Checksum-Algorithm"),
+		metadata:             userMetadata(r),
+		tagging:              tagging,
+		parts:                map[int][]byte{},
+	}
+
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Xmlns: s3Namespace, Bucket: bucketName, Key: key, UploadID: uploadID})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID, partNumber string, body []byte) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, r, noSuchUpload(uploadID))
+		return
+	}
+
+	n, err := strconv.Atoi(partNumber)
+	if err != nil {
+		writeS3Error(w, r, &s3Error{Code: "InvalidArgument", Message: "Part number must be an integer", status: http.StatusBadRequest})
+		return
+	}
+	upload.parts[n] = body
+
+	w.Header().Set("ETag", newObject(body, "").etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, b *bucket, uploadID string, body []byte) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, r, noSuchUpload(uploadID))
+		return
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	err := xml.Unmarshal(body, &request)
+	if err != nil {
+		writeS3Error(w, r, &s3Error{Code: "MalformedXML", Message: err.Error(), status: http.StatusBadRequest})
+		return
+	}
+
+	var numbers []int
+	for _, part := range request.Parts {
+		numbers = append(numbers, part.PartNumber)
+	}
+	sort.Ints(numbers)
+
+	var content bytes.Buffer
+	partChecksums := sha256.New()
+	for _, n := range numbers {
+		part, ok := upload.parts[n]
+		if !ok {
+			writeS3Error(w, r, &s3Error{Code: "InvalidPart", Message: fmt.Sprintf("part %d was not uploaded", n), status: http.StatusBadRequest})
+			return
+		}
+		content.Write(part)
+		partChecksum := sha256.Sum256(part)
+		partChecksums.Write(partChecksum[:])
+	}
+
+	obj := newObject(content.Bytes(), upload.serverSideEncryption)
+	obj.partsCount = len(numbers)
+	obj.metadata = upload.metadata
+	obj.tagging = upload.tagging
+	if strings.EqualFold(upload.checksumAlgorithm, "SHA256") {
+		obj.checksumSHA256 = base64.StdEncoding.EncodeToString(partChecksums.Sum(nil))
+	}
+	b.objects[upload.key] = obj
+	delete(s.uploads, uploadID)
+
+	writeObjectHeaders(w, obj)
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Xmlns: s3Namespace, Bucket: upload.bucket, Key: upload.key, ETag: obj.etag})
+}
+
+func writeObjectHeaders(w http.ResponseWriter, obj *object) {
+	w.Header().Set("ETag", obj.etag)
+	w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+	if obj.serverSideEncryption != "" {
+		w.Header().Set("X-Amz-Server-Side-Encryption", obj.serverSideEncryption)
+	}
+	for name, values := range obj.metadata {
+		w.Header()[name] = values
+	}
+}
+
+// objectTagging returns the tags of the X-Amz-Tagging header of a request that stores an object
+func objectTagging(r *http.Request) (url.Values, error) {
+	tagging, err := url.ParseQuery(r.Header.Get("X-Amz-Tagging"))
+	if err != nil {
+		return nil, &s3Error{Code: "InvalidArgument", Message: fmt.Sprintf("The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates: %s", err), status: http.StatusBadRequest}
+	}
+	if len(tagging) > maxObjectTags {
+		return nil, &s3Error{Code: "BadRequest", Message: fmt.Sprintf("Object tags cannot be greater than %d", maxObjectTags), status: http.StatusBadRequest}
+	}
+	return tagging, nil
+}
+
+// userMetadata returns the X-Amz-Meta- headers of a request that stores an object
+func userMetadata(r *http.Request) http.Header {
+	metadata := http.Header{}
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			metadata[name] = values
+		}
+	}
+	return metadata
+}
+
+func writeS3XML(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, xml.Header)  //nolint:errcheck
+	xml.NewEncoder(w).Encode(body) //nolint:errcheck
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, err *s3Error) {
+	err.RequestID = "fakeaws"
+	w.WriteHeader(err.status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	xml.NewEncoder(w).Encode(err) //nolint:errcheck
+}
+
+// readS3Body reads a request body, decoding the aws-chunked content encoding
+// the SDK uses when it streams checksums or signatures alongside the payload.
+// It returns the trailing headers of an aws-chunked body.
+func readS3Body(r *http.Request) ([]byte, http.Header, error) {
+	trailers := http.Header{}
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") &&
+		!strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body, err := io.ReadAll(r.Body)
+		return body, trailers, err
+	}
+
+	var body bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading aws-chunked header: %s", err)
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing aws-chunked size %q: %s", sizeHex, err)
+		}
+		if size == 0 {
+			break
+		}
+		_, err = io.CopyN(&body, reader, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading aws-chunked chunk: %s", err)
+		}
+		_, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading aws-chunked chunk terminator: %s", err)
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if name, value, ok := strings.Cut(strings.TrimSpace(line), ":"); ok {
+			trailers.Set(name, value)
+		}
+		if err != nil || strings.TrimSpace(line) == "" {
+			return body.Bytes(), trailers, nil
+		}
+	}
+}
+
+// verifyChecksum compares the SHA-256 checksum of a request, in its headers or
+// trailers, with body. It returns the checksum, which is empty when none was sent.
+func verifyChecksum(r *http.Request, trailers http.Header, body []byte) (string, error) {
+	checksum := r.Header.Get("X-Amz-Checksum-Sha256")
+	if checksum == "" {
+		checksum = trailers.Get("X-Amz-Checksum-Sha256")
+	}
+	if checksum == "" {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(body)
+	if actual := base64.StdEncoding.EncodeToString(sum[:]); checksum != actual {
+		return "", &s3Error{Code: "BadDigest", Message: fmt.Sprintf("The SHA256 you specified %s did not match the calculated checksum %s.", checksum, actual), status: http.StatusBadRequest}
+	}
+	return checksum, nil
+}
@@ -0,0 +1,286 @@
+// Package fakeaws provides an in-memory stand-in for the parts of the EC2, S3,
+// KMS, STS, IAM and EBS direct APIs that the drivers use. It lets the driver and integration suites
+// run without network access or AWS fixtures.
+package fakeaws
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccountID is the AWS account that owns every resource created by the fake.
+const AccountID = "123456789012"
+
+// DefaultRegion is assumed for requests that do not carry a SigV4 credential scope.
+const DefaultRegion = "us-east-1"
+
+const gbInBytes = 1 << 30
+
+// Server is an HTTP server that speaks the EC2 Query, S3 REST, KMS JSON, STS and IAM
+// Query and EBS direct protocols. Point config.Credentials.Endpoint at Server.URL to use it.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	nextID  uint64
+	regions map[string]*regionState
+	buckets map[string]*bucket
+	uploads map[string]*multipartUpload
+
+	// accounts maps access key IDs to the account they belong to, and caller
+	// is the account of the EC2 request being handled
+	accounts map[string]string
+	caller   string
+
+	// roles are the IAM roles of the fake, and deniedActions the actions that their
+	// policies and the policies of every user do not allow
+	roles         map[string]*role
+	deniedActions map[string]bool
+
+	// failingBlockTags are the tag keys of the snapshots that PutSnapshotBlock fails for
+	failingBlockTags map[string]bool
+}
+
+type regionState struct {
+	images          map[string]*image
+	snapshots       map[string]*snapshot
+	volumes         map[string]*volume
+	instances       map[string]*instance
+	importTasks     map[string]*importSnapshotTask
+	conversionTasks map[string]*conversionTask
+	keys            map[string]*kmsKey
+	aliases         map[string]*kmsAlias
+}
+
+// NewServer starts a fake AWS server listening on a random local port.
+func NewServer() *Server {
+	s := &Server{
+		regions: map[string]*regionState{},
+		buckets: map[string]*bucket{},
+		uploads: map[string]*multipartUpload{},
+
+		accounts: map[string]string{},
+
+		roles:         map[string]*role{},
+		deniedActions: map[string]bool{},
+
+		failingBlockTags: map[string]bool{},
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// ServeHTTP dispatches a request to the API named in its SigV4 credential scope.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	region, service := credentialScope(r)
+
+	switch service {
+	case "ec2":
+		s.serveEC2(w, r, region)
+	case "kms":
+		s.serveKMS(w, r, region)
+	case "s3":
+		s.serveS3(w, r, region)
+	case "ebs":
+		s.serveEBS(w, r, region)
+	case "sts":
+		s.serveSTS(w, r)
+	case "iam":
+		s.serveIAM(w, r)
+	default:
+		http.Error(w, fmt.Sprintf("service %q is not supported by fakeaws", service), http.StatusBadRequest)
+	}
+}
+
+// Close shuts the server down. Client connections are closed first, so a
+// response body that a client never drained cannot block the shutdown.
+func (s *Server) Close() {
+	s.Server.CloseClientConnections()
+	s.Server.Close()
+}
+
+// CreateBucket creates an empty bucket located in region.
+func (s *Server) CreateBucket(region, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets[name] = &bucket{region: region, objects: map[string]*object{}}
+}
+
+// PutObject stores body under key in an existing bucket.
+func (s *Server) PutObject(bucketName, key string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	b.objects[key] = newObject(body, "")
+	return nil
+}
+
+// CreateVolume creates an available EBS volume in region and returns its ID.
+func (s *Server) CreateVolume(region string, sizeGB int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createVolume(region, region+"a", sizeGB).id
+}
+
+// CreateSnapshot creates a completed, unencrypted EBS snapshot in region and returns its ID.
+func (s *Server) CreateSnapshot(region string, sizeGB int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createSnapshot(region, "", sizeGB, false, "").id
+}
+
+// ImageFixture describes an AMI created with CreateImage.
+type ImageFixture struct {
+	Name      string
+	Encrypted bool
+	KmsKeyID  string
+	Public    bool
+	Tags      map[string]string
+
+	// CreationDate defaults to the time the image is created
+	CreationDate time.Time
+}
+
+// CreateImage registers an available x86_64 HVM AMI, backed by a new snapshot, and returns its ID.
+func (s *Server) CreateImage(region string, fixture ImageFixture) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.createSnapshot(region, "", 3, fixture.Encrypted, fixture.KmsKeyID)
+	img := s.registerImage(region, &image{
+		name:               fixture.Name,
+		architecture:       "x86_64",
+		virtualizationType: "hvm",
+		rootDeviceName:     "/dev/xvda",
+		bootMode:           "legacy-bios",
+		sriovNetSupport:    "simple",
+		enaSupport:         true,
+		blockDevices: []blockDevice{
+			{deviceName: "/dev/xvda", snapshotID: snap.id, encrypted: snap.encrypted, volumeSize: snap.volumeSize},
+		},
+	})
+	img.ownerID = AccountID
+	if fixture.Public {
+		img.launchPermissions = img.launchPermissions.add(permission{Group: "all"})
+	}
+	if !fixture.CreationDate.IsZero() {
+		img.creationDate = fixture.CreationDate
+	}
+	for key, value := range fixture.Tags {
+		img.tags = img.tags.set(key, value)
+	}
+	return img.id
+}
+
+// CreateKey creates a KMS key in region and returns its ARN. Multi-region keys
+// can be replicated to other regions with ReplicateKey.
+func (s *Server) CreateKey(region string, multiRegion bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createKey(region, s.newKeyID(multiRegion), multiRegion).arn(region)
+}
+
+// ReplicateKey creates a replica of a multi-region key, identified by its ARN, in region.
+func (s *Server) ReplicateKey(keyARN, region string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, _, err := s.resolveKey(region, keyARN)
+	if err != nil {
+		return err
+	}
+	if !key.multiRegion {
+		return fmt.Errorf("%s is not a multi-region key", keyARN)
+	}
+	s.createKey(region, key.id, true).primaryRegion = key.primaryRegion
+	return nil
+}
+
+func (s *Server) region(name string) *regionState {
+	r, ok := s.regions[name]
+	if !ok {
+		r = &regionState{
+			images:          map[string]*image{},
+			snapshots:       map[string]*snapshot{},
+			volumes:         map[string]*volume{},
+			instances:       map[string]*instance{},
+			importTasks:     map[string]*importSnapshotTask{},
+			conversionTasks: map[string]*conversionTask{},
+			keys:            map[string]*kmsKey{},
+			aliases:         map[string]*kmsAlias{},
+		}
+		s.regions[name] = r
+	}
+	return r
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%017x", prefix, s.nextID)
+}
+
+// credentialScope extracts the region and service from the SigV4 credential
+// scope of a signed or presigned request. Unsigned requests are treated as S3
+// requests in the default region.
+func credentialScope(r *http.Request) (string, string) {
+	credential := r.URL.Query().Get("X-Amz-Credential")
+
+	authorization := r.Header.Get("Authorization")
+	if i := strings.Index(authorization, "Credential="); i >= 0 {
+		credential = strings.SplitN(authorization[i+len("Credential="):], ",", 2)[0]
+	}
+
+	// <access-key>/<date>/<region>/<service>/aws4_request
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 {
+		return DefaultRegion, "s3"
+	}
+	return parts[2], parts[3]
+}
+
+// objectFromURL resolves an s3://bucket/key or path-style https URL to a stored object.
+func (s *Server) objectFromURL(rawURL string) (*object, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false
+	}
+
+	bucketName, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" {
+		bucketName, key, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	}
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	o, ok := b.objects[key]
+	return o, ok
+}
+
+func sortByID[T any](items []T, id func(T) string) {
+	sort.Slice(items, func(i, j int) bool { return id(items[i]) < id(items[j]) })
+}
+
+func sizeInGB(sizeBytes int64) int64 {
+	size := int64(math.Ceil(float64(sizeBytes) / gbInBytes))
+	if size < 1 {
+		return 1
+	}
+	return size
+}
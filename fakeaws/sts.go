@@ -0,0 +1,139 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const stsNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+// queryHandler handles an action of an API that speaks the AWS Query protocol, like STS and IAM
+type queryHandler func(s *Server, accessKeyID string, form url.Values) (interface{}, error)
+
+var stsActions = map[string]queryHandler{
+	"AssumeRole":        (*Server).assumeRole,
+	"GetCallerIdentity": (*Server).getCallerIdentity,
+}
+
+// SetAccount makes requests signed with accessKeyID belong to accountID in
+// GetCallerIdentity. Other access keys belong to AccountID.
+func (s *Server) SetAccount(accessKeyID, accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[accessKeyID] = accountID
+}
+
+func (s *Server) account(accessKeyID string) string {
+	if accountID, ok := s.accounts[accessKeyID]; ok {
+		return accountID
+	}
+	return AccountID
+}
+
+func (s *Server) serveSTS(w http.ResponseWriter, r *http.Request) {
+	s.serveQuery(w, r, stsActions, stsNamespace)
+}
+
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request, actions map[string]queryHandler, namespace string) {
+	err := r.ParseForm()
+	if err != nil {
+		writeEC2Error(w, http.StatusBadRequest, newEC2Error("MalformedQueryString", "%s", err))
+		return
+	}
+
+	action := r.Form.Get("Action")
+	handler, ok := actions[action]
+	if !ok {
+		writeEC2Error(w, http.StatusBadRequest, newEC2Error("InvalidAction", "The action %s is not valid for this web service.", action))
+		return
+	}
+
+	s.mu.Lock()
+	result, err := handler(s, accessKey(r), r.Form)
+	s.mu.Unlock()
+
+	if err != nil {
+		ec2Err, ok := err.(*ec2Error)
+		if !ok {
+			ec2Err = newEC2Error("InternalFailure", "%s", err)
+		}
+		writeEC2Error(w, http.StatusBadRequest, ec2Err)
+		return
+	}
+
+	response := struct {
+		XMLName  xml.Name
+		Xmlns    string      `xml:"xmlns,attr"`
+		Result   interface{} `xml:"Result"`
+		Metadata struct {
+			RequestID string `xml:"RequestId"`
+		} `xml:"ResponseMetadata"`
+	}{
+		XMLName: xml.Name{Local: action + "Response"},
+		Xmlns:   namespace,
+		Result:  result,
+	}
+	response.Metadata.RequestID = "fakeaws"
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response) //nolint:errcheck
+}
+
+// accessKey returns the access key ID that signed the request
+func accessKey(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if i := strings.Index(authorization, "Credential="); i >= 0 {
+		return strings.SplitN(authorization[i+len("Credential="):], "/", 2)[0]
+	}
+	return ""
+}
+
+func (s *Server) getCallerIdentity(accessKeyID string, _ url.Values) (interface{}, error) {
+	accountID := s.account(accessKeyID)
+	return struct {
+		XMLName xml.Name `xml:"GetCallerIdentityResult"`
+		Arn     string   `xml:"Arn"`
+		UserID  string   `xml:"UserId"`
+		Account string   `xml:"Account"`
+	}{
+		Arn:     fmt.Sprintf("arn:aws:iam::%s:user/fakeaws", accountID),
+		UserID:  accessKeyID,
+		Account: accountID,
+	}, nil
+}
+
+// assumeRole returns credentials that belong to the account of the role
+func (s *Server) assumeRole(_ string, form url.Values) (interface{}, error) {
+	roleArn := form.Get("RoleArn")
+	arnParts := strings.Split(roleArn, ":")
+	if len(arnParts) != 6 || arnParts[4] == "" {
+		return nil, newEC2Error("ValidationError", "%s is not a valid role ARN", roleArn)
+	}
+
+	s.nextID++
+	accessKeyID := fmt.Sprintf("ASIAFAKE%012d", s.nextID)
+	s.accounts[accessKeyID] = arnParts[4]
+
+	type credentials struct {
+		AccessKeyID     string `xml:"AccessKeyId"`
+		SecretAccessKey string `xml:"SecretAccessKey"`
+		SessionToken    string `xml:"SessionToken"`
+		Expiration      string `xml:"Expiration"`
+	}
+	return struct {
+		XMLName     xml.Name    `xml:"AssumeRoleResult"`
+		Credentials credentials `xml:"Credentials"`
+	}{
+		Credentials: credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: "fakeaws",
+			SessionToken:    "fakeaws",
+			Expiration:      "2100-01-01T00:00:00Z",
+		},
+	}, nil
+}
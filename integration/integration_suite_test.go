@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/fakeaws"
 	"light-stemcell-builder/resources"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -19,6 +20,9 @@ var machineImageSize string
 
 var expectedRegions []string
 
+// fakeAWS is only set when the suite runs without AWS credentials.
+var fakeAWS *fakeaws.Server
+
 func TestIntegration(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Integration Suite")
@@ -26,6 +30,10 @@ func TestIntegration(t *testing.T) {
 
 var _ = SynchronizedBeforeSuite(
 	func() []byte {
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+			startFakeAWS()
+		}
+
 		cfg = config.Config{
 			AmiConfiguration: config.AmiConfiguration{
 				Description:        "Integration Test AMI",
@@ -43,7 +51,7 @@ var _ = SynchronizedBeforeSuite(
 
 		for _, amiRegion := range cfg.AmiRegions {
 			expectedRegions = append(expectedRegions, amiRegion.RegionName)
-			expectedRegions = append(expectedRegions, amiRegion.Destinations...)
+			expectedRegions = append(expectedRegions, amiRegion.DestinationNames()...)
 		}
 
 		machineImagePath = os.Getenv("MACHINE_IMAGE_PATH")
@@ -62,6 +70,46 @@ var _ = SynchronizedBeforeSuite(
 	func(data []byte) {},
 )
 
+var _ = SynchronizedAfterSuite(
+	func() {},
+	func() {
+		if fakeAWS != nil {
+			fakeAWS.Close()
+			os.Remove(machineImagePath) //nolint:errcheck
+		}
+	},
+)
+
+// startFakeAWS starts a local fake AWS server and exports the environment that
+// points the suite, and the binary under test, at it.
+func startFakeAWS() {
+	const bucket = "light-stemcell-builder-fake"
+
+	fakeAWS = fakeaws.NewServer()
+	fakeAWS.CreateBucket("us-east-1", bucket)
+
+	machineImageFile, err := os.CreateTemp("", "fake-machine-image")
+	Expect(err).ToNot(HaveOccurred())
+	defer machineImageFile.Close() //nolint:errcheck
+
+	_, err = machineImageFile.Write(make([]byte, 1024*1024))
+	Expect(err).ToNot(HaveOccurred())
+
+	env := map[string]string{
+		"AWS_ENDPOINT_URL":       fakeAWS.URL,
+		"AWS_ACCESS_KEY_ID":      "fake-access-key-id",
+		"AWS_SECRET_ACCESS_KEY":  "fake-secret-access-key",
+		"AWS_REGION":             "us-east-1",
+		"AWS_DESTINATION_REGION": "us-west-2",
+		"AWS_BUCKET_NAME":        bucket,
+		"MACHINE_IMAGE_PATH":     machineImageFile.Name(),
+		"MACHINE_IMAGE_FORMAT":   resources.VolumeRawFormat,
+	}
+	for key, value := range env {
+		os.Setenv(key, value) //nolint:errcheck
+	}
+}
+
 func constructUsAmiRegion() config.AmiRegion {
 	usAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
 	Expect(usAccessKey).ToNot(BeEmpty(), "AWS_ACCESS_KEY_ID must be set")
@@ -89,7 +137,8 @@ func constructUsAmiRegion() config.AmiRegion {
 			SessionToken: usSessionToken,
 			RoleArn:      roleArn,
 		},
-		Destinations: []string{usDestination},
+		Destinations: []config.Destination{{RegionName: usDestination}},
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
 	}
 }
 
@@ -134,6 +134,7 @@ cloud_properties:
 					AccessKey: cfg.AmiRegions[0].Credentials.AccessKey,
 					SecretKey: cfg.AmiRegions[0].Credentials.SecretKey,
 					RoleArn:   cfg.AmiRegions[0].Credentials.RoleArn,
+					Endpoint:  cfg.AmiRegions[0].Endpoint,
 					Region:    region,
 				}
 				ec2Client = ec2.NewFromConfig(configCreds.GetAwsConfig())
@@ -143,7 +144,7 @@ cloud_properties:
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(reqOutput.Images).To(HaveLen(1))
-			Expect(reqOutput.Images[0].Tags).To(HaveLen(4))
+			Expect(reqOutput.Images[0].Tags).To(HaveLen(5))
 			for _, tag := range reqOutput.Images[0].Tags {
 				if tag.Key == aws.String("name") {
 					Expect(tag.Value).To(Equal(aws.String("ubuntu-trusty-9999")))
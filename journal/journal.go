@@ -0,0 +1,203 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"light-stemcell-builder/resources"
+)
+
+// Journal records the resources a publish has created in each region so that
+// an interrupted run can be resumed without recreating them. Every update is
+// written to disk before it returns. A nil *Journal records nothing.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+	data state
+}
+
+type state struct {
+	Inputs  Inputs             `json:"inputs"`
+	Regions map[string]*Region `json:"regions"`
+}
+
+// Inputs are the command line arguments of the run that created the journal
+type Inputs struct {
+	ConfigPath       string   `json:"config_path"`
+	MachineImagePath string   `json:"machine_image_path"`
+	ManifestPath     string   `json:"manifest_path"`
+	StemcellPath     string   `json:"stemcell_path,omitempty"`
+	FileFormat       string   `json:"file_format"`
+	VolumeSizeGB     int      `json:"volume_size_gb,omitempty"`
+	OutputTarball    string   `json:"output_tarball,omitempty"`
+	IncludeFiles     []string `json:"include_files,omitempty"`
+	Sidecar          string   `json:"sidecar,omitempty"`
+	ReportPath       string   `json:"report_path,omitempty"`
+	MetricsPath      string   `json:"metrics_path,omitempty"`
+}
+
+// Region records the progress of a publish to a single region
+type Region struct {
+	MachineImage     *resources.MachineImage  `json:"machine_image,omitempty"`
+	ConversionTaskID string                   `json:"conversion_task_id,omitempty"`
+	VolumeID         string                   `json:"volume_id,omitempty"`
+	ImportTaskID     string                   `json:"import_task_id,omitempty"`
+	SnapshotID       string                   `json:"snapshot_id,omitempty"`
+	SourceAmi        *resources.Ami           `json:"source_ami,omitempty"`
+	CopiedAmis       map[string]resources.Ami `json:"copied_amis,omitempty"`
+}
+
+// RemoveAmi forgets an AMI that has been deregistered. Removing the source AMI
+// also forgets the snapshot it was registered from, which is deleted with it.
+func (r *Region) RemoveAmi(id string) {
+	if r.SourceAmi != nil && r.SourceAmi.ID == id {
+		r.SourceAmi = nil
+		r.SnapshotID = ""
+		r.ImportTaskID = ""
+	}
+
+	for destination, ami := range r.CopiedAmis {
+		if ami.ID == id {
+			delete(r.CopiedAmis, destination)
+		}
+	}
+}
+
+// Create starts a new journal at path. It fails if a journal already exists there.
+func Create(path string, inputs Inputs) (*Journal, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return nil, fmt.Errorf("journal %s already exists, use the resume command to continue that run", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("checking for existing journal %s: %s", path, err)
+	}
+
+	j := &Journal{
+		path: path,
+		data: state{
+			Inputs:  inputs,
+			Regions: map[string]*Region{},
+		},
+	}
+
+	err = j.write()
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Load reads an existing journal from path
+func Load(path string) (*Journal, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %s", err)
+	}
+
+	j := &Journal{path: path}
+	err = json.Unmarshal(contents, &j.data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing journal %s: %s", path, err)
+	}
+
+	if j.data.Regions == nil {
+		j.data.Regions = map[string]*Region{}
+	}
+
+	return j, nil
+}
+
+// Inputs returns the command line arguments of the run that created the journal
+func (j *Journal) Inputs() Inputs {
+	return j.data.Inputs
+}
+
+// Region returns a copy of the progress recorded for a region
+func (j *Journal) Region(name string) Region {
+	if j == nil {
+		return Region{}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r, ok := j.data.Regions[name]
+	if !ok {
+		return Region{}
+	}
+
+	regionCopy := *r
+	regionCopy.CopiedAmis = make(map[string]resources.Ami, len(r.CopiedAmis))
+	for destination, ami := range r.CopiedAmis {
+		regionCopy.CopiedAmis[destination] = ami
+	}
+
+	return regionCopy
+}
+
+// Update applies record to the progress of a region and writes the journal to disk
+func (j *Journal) Update(name string, record func(*Region)) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r, ok := j.data.Regions[name]
+	if !ok {
+		r = &Region{}
+		j.data.Regions[name] = r
+	}
+	if r.CopiedAmis == nil {
+		r.CopiedAmis = map[string]resources.Ami{}
+	}
+
+	record(r)
+
+	return j.write()
+}
+
+// write replaces the journal file atomically so a crash never leaves it truncated
+func (j *Journal) write() error {
+	contents, err := json.MarshalIndent(j.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling journal: %s", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary journal file: %s", err)
+	}
+	defer os.Remove(tmpFile.Name()) //nolint:errcheck
+
+	_, err = tmpFile.Write(contents)
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return fmt.Errorf("writing journal: %s", err)
+	}
+
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return fmt.Errorf("syncing journal: %s", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("closing journal: %s", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), j.path)
+	if err != nil {
+		return fmt.Errorf("replacing journal %s: %s", j.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package journal_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"light-stemcell-builder/journal"
+	"light-stemcell-builder/resources"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		journalPath string
+		inputs      journal.Inputs
+	)
+
+	BeforeEach(func() {
+		journalPath = filepath.Join(GinkgoT().TempDir(), "journal.json")
+		inputs = journal.Inputs{
+			ConfigPath:       "/fake/config.json",
+			MachineImagePath: "/fake/root.img",
+			ManifestPath:     "/fake/stemcell.MF",
+			FileFormat:       resources.VolumeRawFormat,
+		}
+	})
+
+	It("writes the inputs of a new journal to disk", func() {
+		_, err := journal.Create(journalPath, inputs)
+		Expect(err).ToNot(HaveOccurred())
+
+		j, err := journal.Load(journalPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(j.Inputs()).To(Equal(inputs))
+	})
+
+	It("refuses to overwrite an existing journal", func() {
+		_, err := journal.Create(journalPath, inputs)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = journal.Create(journalPath, inputs)
+		Expect(err).To(MatchError(ContainSubstring("already exists")))
+	})
+
+	It("persists every update so it can be loaded after a crash", func() {
+		j, err := journal.Create(journalPath, inputs)
+		Expect(err).ToNot(HaveOccurred())
+
+		machineImage := resources.MachineImage{GetURL: "s3://fake-bucket/fake-key", DeleteURLs: []string{"fake-delete-url"}}
+		sourceAmi := resources.Ami{ID: "ami-source", Region: "us-east-1", VirtualizationType: "hvm"}
+		copiedAmi := resources.Ami{ID: "ami-copy", Region: "us-west-2", VirtualizationType: "hvm"}
+
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.MachineImage = &machineImage })).To(Succeed())
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.ImportTaskID = "import-snap-1" })).To(Succeed())
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.SnapshotID = "snap-1" })).To(Succeed())
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.SourceAmi = &sourceAmi })).To(Succeed())
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.CopiedAmis["us-west-2"] = copiedAmi })).To(Succeed())
+
+		loaded, err := journal.Load(journalPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		region := loaded.Region("us-east-1")
+		Expect(region.MachineImage).To(Equal(&machineImage))
+		Expect(region.ImportTaskID).To(Equal("import-snap-1"))
+		Expect(region.SnapshotID).To(Equal("snap-1"))
+		Expect(region.SourceAmi).To(Equal(&sourceAmi))
+		Expect(region.CopiedAmis).To(Equal(map[string]resources.Ami{"us-west-2": copiedAmi}))
+
+		Expect(loaded.Region("cn-north-1")).To(Equal(journal.Region{}))
+	})
+
+	It("returns a copy of the recorded progress", func() {
+		j, err := journal.Create(journalPath, inputs)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.CopiedAmis["us-west-2"] = resources.Ami{ID: "ami-copy"} })).To(Succeed())
+
+		region := j.Region("us-east-1")
+		region.CopiedAmis["eu-west-1"] = resources.Ami{ID: "ami-other"}
+
+		Expect(j.Region("us-east-1").CopiedAmis).To(HaveLen(1))
+	})
+
+	It("forgets removed AMIs and the snapshot of a removed source AMI", func() {
+		region := journal.Region{
+			ImportTaskID: "import-snap-1",
+			SnapshotID:   "snap-1",
+			SourceAmi:    &resources.Ami{ID: "ami-source"},
+			CopiedAmis: map[string]resources.Ami{
+				"us-west-2": {ID: "ami-copy-1"},
+				"eu-west-1": {ID: "ami-copy-2"},
+			},
+		}
+
+		region.RemoveAmi("ami-copy-1")
+		Expect(region.CopiedAmis).To(Equal(map[string]resources.Ami{"eu-west-1": {ID: "ami-copy-2"}}))
+		Expect(region.SourceAmi).ToNot(BeNil())
+
+		region.RemoveAmi("ami-source")
+		Expect(region.SourceAmi).To(BeNil())
+		Expect(region.SnapshotID).To(BeEmpty())
+		Expect(region.ImportTaskID).To(BeEmpty())
+	})
+
+	It("does not leave temporary files behind", func() {
+		j, err := journal.Create(journalPath, inputs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.SnapshotID = "snap-1" })).To(Succeed())
+
+		entries, err := os.ReadDir(filepath.Dir(journalPath))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("records nothing when it is nil", func() {
+		var j *journal.Journal
+
+		Expect(j.Update("us-east-1", func(r *journal.Region) { r.SnapshotID = "snap-1" })).To(Succeed())
+		Expect(j.Region("us-east-1")).To(Equal(journal.Region{}))
+	})
+})
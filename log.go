@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"light-stemcell-builder/logging"
+)
+
+// logOptions are the flags every command configures its log with
+type logOptions struct {
+	format logging.Format
+	level  slog.Level
+}
+
+func addLogFlags(flags *flag.FlagSet) *logOptions {
+	options := &logOptions{}
+	flags.TextVar(&options.format, "log-format", logging.TextFormat, "Format of the log on stderr: text or json")
+	flags.TextVar(&options.level, "log-level", slog.LevelInfo, "Minimum level of the log: debug, info, warn or error. At debug, the AWS SDK logs its requests, responses and retries.")
+	return options
+}
+
+// logger creates the logger that the command and every publisher and driver it creates log to
+func (o *logOptions) logger(w io.Writer) *slog.Logger {
+	return logging.New(w, o.format, o.level)
+}
+
+// fatal logs the message at error level and exits
+func fatal(logger *slog.Logger, format string, v ...interface{}) {
+	logger.Error(fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
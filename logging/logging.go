@@ -0,0 +1,105 @@
+// Package logging creates the structured logger that every command, publisher and driver logs to, and
+// connects the AWS SDK to it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// The keys of the fields that are added to the log records
+const (
+	RegionKey = "region"
+	DriverKey = "driver"
+	StepKey   = "step"
+	AmiIDKey  = "ami_id"
+	TaskIDKey = "task_id"
+)
+
+// Format is the format of the log records
+type Format string
+
+const (
+	TextFormat Format = "text"
+	JSONFormat Format = "json"
+)
+
+// MarshalText implements encoding.TextMarshaler, so a Format can be used with flag.TextVar
+func (f Format) MarshalText() ([]byte, error) {
+	return []byte(f), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler and only accepts the known formats
+func (f *Format) UnmarshalText(text []byte) error {
+	switch format := Format(text); format {
+	case TextFormat, JSONFormat:
+		*f = format
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q, must be one of: ['text', 'json']", text)
+	}
+}
+
+// New creates a logger that writes records of level and above to w in format
+func New(w io.Writer, format Format, level slog.Leveler) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case JSONFormat:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	return slog.New(stepHandler{handler})
+}
+
+// Region is the field of the region a record is about
+func Region(region string) slog.Attr {
+	return slog.String(RegionKey, region)
+}
+
+// Driver is the field of the driver that logs a record
+func Driver(name string) slog.Attr {
+	return slog.String(DriverKey, name)
+}
+
+// AmiID is the field of the AMI a record is about
+func AmiID(id string) slog.Attr {
+	return slog.String(AmiIDKey, id)
+}
+
+// TaskID is the field of the import or copy task a record is about
+func TaskID(id string) slog.Attr {
+	return slog.String(TaskIDKey, id)
+}
+
+type stepKey struct{}
+
+// WithStep returns a context that adds step to the records logged with it, e.g. by the drivers a publisher calls
+func WithStep(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+// stepHandler adds the step of the context of a record to it
+type stepHandler struct {
+	slog.Handler
+}
+
+func (h stepHandler) Handle(ctx context.Context, record slog.Record) error {
+	if step, ok := ctx.Value(stepKey{}).(string); ok {
+		record.AddAttrs(slog.String(StepKey, step))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h stepHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return stepHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h stepHandler) WithGroup(name string) slog.Handler {
+	return stepHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"light-stemcell-builder/redact"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	smithylogging "github.com/aws/smithy-go/logging"
+)
+
+// sdkLogMode are the requests, responses and retries the SDK logs at debug level. The bodies are left out, as the
+// machine image is uploaded in them.
+const sdkLogMode = aws.LogRequest | aws.LogResponse | aws.LogRetries
+
+// ConfigureSDK makes the clients created from cfg log to logger, and log their requests when logger logs at
+// debug level
+func ConfigureSDK(cfg *aws.Config, logger *slog.Logger) {
+	cfg.Logger = sdkLogger{logger: logger, ctx: context.Background()}
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		cfg.ClientLogMode |= sdkLogMode
+	}
+}
+
+// sdkLogger implements the logging.Logger interface of the SDK. The SDK logs requests and responses with their
+// headers, so credentials are redacted.
+type sdkLogger struct {
+	logger *slog.Logger
+	ctx    context.Context
+}
+
+func (l sdkLogger) Logf(classification smithylogging.Classification, format string, v ...interface{}) {
+	level := slog.LevelInfo
+	switch classification {
+	case smithylogging.Warn:
+		level = slog.LevelWarn
+	case smithylogging.Debug:
+		level = slog.LevelDebug
+	}
+
+	l.logger.Log(l.ctx, level, redact.String(fmt.Sprintf(format, v...)))
+}
+
+// WithContext implements the logging.ContextLogger interface, so that the records of the SDK have the step of ctx
+func (l sdkLogger) WithContext(ctx context.Context) smithylogging.Logger {
+	return sdkLogger{logger: l.logger, ctx: ctx}
+}
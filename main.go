@@ -2,23 +2,39 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"light-stemcell-builder/collection"
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/journal"
+	"light-stemcell-builder/logging"
 	"light-stemcell-builder/manifest"
+	"light-stemcell-builder/metrics"
 	"light-stemcell-builder/publisher"
+	"light-stemcell-builder/redact"
+	"light-stemcell-builder/report"
 	"light-stemcell-builder/resources"
+	"light-stemcell-builder/stemcell"
+	"light-stemcell-builder/tracing"
+	"light-stemcell-builder/upload"
 )
 
+// rollbackTimeout bounds the removal of resources after a failed publish
+const rollbackTimeout = 15 * time.Minute
+
 func usage(message string) {
 	fmt.Fprintln(os.Stderr, message)                                   //nolint:errcheck
 	fmt.Fprintln(os.Stderr, "Usage of light-stemcell-builder/main.go") //nolint:errcheck
@@ -31,87 +47,235 @@ func main() {
 		writer: os.Stderr,
 	}
 
-	logger := log.New(sharedWriter, "", log.LstdFlags)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "resume":
+			resume(sharedWriter, os.Args[2:])
+			return
+		case "cleanup":
+			runCleanup(sharedWriter, os.Args[2:])
+			return
+		case "sweep":
+			runSweep(sharedWriter, os.Args[2:])
+			return
+		case "preflight":
+			runPreflight(sharedWriter, os.Args[2:])
+			return
+		}
+	}
 
 	configPath := flag.String("c", "", "Path to the JSON configuration file")
 	machineImagePath := flag.String("image", "", "Path to the input machine image (root.img)")
 	machineImageFormat := flag.String("format", resources.VolumeRawFormat, "Format of the input machine image (RAW or vmdk). Defaults to RAW.")
 	imageVolumeSize := flag.Int("volume-size", 0, "Block device size (in GB) of the input machine image")
 	manifestPath := flag.String("manifest", "", "Path to the input stemcell.MF")
+	stemcellPath := flag.String("stemcell", "", "Path to a heavy stemcell tarball to take the machine image, format and manifest from, instead of --image and --manifest")
+	timeout := flag.Duration("timeout", 0, "Maximum duration of the publish, e.g. 2h. Defaults to no limit.")
+	rollbackOnFailure := flag.Bool("rollback-on-failure", false, "Remove the AMIs, snapshots and KMS aliases created by the run if publishing to any region fails")
+	journalPath := flag.String("journal", "", "Path of a journal to record progress in, so an interrupted publish can be continued with the resume command")
+	outputTarball := flag.String("output-tarball", "", "Path to write the complete light stemcell tarball to, instead of writing the manifest to stdout")
+	var includeFiles stringsFlag
+	flag.Var(&includeFiles, "include", "Path of an extra file to add to the light stemcell tarball, e.g. packages.txt. Can be repeated.")
+	sidecar := flag.String("sidecar", "", "Checksum file to write next to the tarball: sha256 or metalink")
+	reportPath := flag.String("report", "", "Path to write a JSON report of the AMIs, snapshots and steps of each region to, also when publishing fails")
+	metricsPath := flag.String("metrics-file", "", "Path to write Prometheus textfile metrics of the publish to when it ends, also when it fails, e.g. in the directory of the node exporter textfile collector")
+	logOptions := addLogFlags(flag.CommandLine)
+	traceOptions := addTraceFlags(flag.CommandLine)
 
 	flag.Parse()
 
 	if *configPath == "" {
 		usage("-c flag is required")
 	}
-	if *machineImagePath == "" {
-		usage("--image flag is required")
+	if *stemcellPath != "" {
+		formatSet := false
+		flag.Visit(func(f *flag.Flag) {
+			formatSet = formatSet || f.Name == "format"
+		})
+		if *machineImagePath != "" || *manifestPath != "" || formatSet {
+			usage("--stemcell flag cannot be combined with --image, --manifest or --format")
+		}
+	} else {
+		if *machineImagePath == "" {
+			usage("--image flag is required")
+		}
+
+		if *manifestPath == "" {
+			usage("--manifest flag is required")
+		}
+
+		if *imageVolumeSize == 0 && *machineImageFormat != resources.VolumeRawFormat {
+			usage("--volume-size flag is required for formats other than RAW")
+		}
+	}
+
+	if *timeout < 0 {
+		usage("--timeout flag must not be negative")
+	}
+
+	if *outputTarball == "" && (len(includeFiles) > 0 || *sidecar != "") {
+		usage("--include and --sidecar flags require --output-tarball")
+	}
+
+	if *sidecar != "" && *sidecar != stemcell.SHA256Sidecar && *sidecar != stemcell.MetalinkSidecar {
+		usage("--sidecar flag must be one of: ['sha256', 'metalink']")
+	}
+
+	if traceOptions.exporter == tracing.FileExporter && traceOptions.file == "" {
+		usage("--trace-file flag is required with --trace-exporter file")
+	}
+
+	inputs := journal.Inputs{
+		ConfigPath:       *configPath,
+		MachineImagePath: *machineImagePath,
+		ManifestPath:     *manifestPath,
+		StemcellPath:     *stemcellPath,
+		FileFormat:       *machineImageFormat,
+		VolumeSizeGB:     *imageVolumeSize,
+		OutputTarball:    *outputTarball,
+		IncludeFiles:     includeFiles,
+		Sidecar:          *sidecar,
+		ReportPath:       *reportPath,
+		MetricsPath:      *metricsPath,
 	}
 
-	if *manifestPath == "" {
-		usage("--manifest flag is required")
+	logger := logOptions.logger(sharedWriter)
+
+	var j *journal.Journal
+	if *journalPath != "" {
+		absInputs, err := absoluteInputs(inputs)
+		if err != nil {
+			fatal(logger, "Error resolving input paths: %s", err)
+		}
+
+		j, err = journal.Create(*journalPath, absInputs)
+		if err != nil {
+			fatal(logger, "Error creating journal: %s", err)
+		}
+	}
+
+	ctx, cancel := publishContext(*timeout)
+	defer cancel()
+
+	traceOptions.setup(ctx, logger)
+	publish(ctx, logger, sharedWriter, inputs, j, *rollbackOnFailure)
+}
+
+// publishContext returns a context that is cancelled on SIGINT or SIGTERM, or
+// once timeout has passed if it is positive
+func publishContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
 	}
 
-	if *imageVolumeSize == 0 && *machineImageFormat != resources.VolumeRawFormat {
-		usage("--volume-size flag is required for formats other than RAW")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
+}
 
-	configFile, err := os.Open(*configPath)
+// publish uploads the machine image to every configured region and writes the
+// updated stemcell manifest to stdout. Progress is recorded in j when it is not nil.
+func publish(ctx context.Context, logger *slog.Logger, sharedWriter io.Writer, inputs journal.Inputs, j *journal.Journal, rollbackOnFailure bool) {
+	configFile, err := os.Open(inputs.ConfigPath)
 	if err != nil {
-		logger.Fatalf("Error opening config file: %s", err)
+		fatal(logger, "Error opening config file: %s", err)
 	}
 
 	defer func() {
 		closeErr := configFile.Close()
 		if closeErr != nil {
-			logger.Fatalf("Error closing config file: %s", closeErr)
+			fatal(logger, "Error closing config file: %s", closeErr)
 		}
 	}()
 
 	if err != nil {
-		logger.Fatalf("Error opening config file: %s", err)
+		fatal(logger, "Error opening config file: %s", err)
 	}
 
 	c, err := config.NewFromReader(configFile)
 	if err != nil {
-		logger.Fatalf("Error parsing config file: %s. Message: %s", *configPath, err)
+		fatal(logger, "Error parsing config file: %s. Message: %s", inputs.ConfigPath, err)
 	}
+	redactSecrets(sharedWriter, c)
 
-	if _, err := os.Stat(*machineImagePath); os.IsNotExist(err) {
-		logger.Fatalf("machine image not found at: %s", *machineImagePath)
+	for _, includeFile := range inputs.IncludeFiles {
+		if _, err := os.Stat(includeFile); os.IsNotExist(err) {
+			fatal(logger, "file to include not found at: %s", includeFile)
+		}
 	}
 
-	if _, err := os.Stat(*manifestPath); os.IsNotExist(err) {
-		logger.Fatalf("manifest not found at: %s", *manifestPath)
+	ctx, span := tracing.Start(ctx, "publish")
+
+	// fatalf removes the extracted heavy stemcell and exports the spans of the publish before exiting
+	var extractedDir string
+	fatalf := func(format string, v ...interface{}) {
+		if extractedDir != "" {
+			os.RemoveAll(extractedDir) //nolint:errcheck
+		}
+		tracing.End(span, fmt.Errorf(format, v...))
+		shutdownTracing(logger)
+		fatal(logger, format, v...)
 	}
 
-	manifestBytes, err := os.ReadFile(*manifestPath)
+	if inputs.StemcellPath != "" {
+		extractedDir, err = os.MkdirTemp("", "light-stemcell-builder-")
+		if err != nil {
+			fatal(logger, "creating directory to extract stemcell to: %s", err)
+		}
+		defer os.RemoveAll(extractedDir) //nolint:errcheck
+
+		inputs, err = extractStemcell(logger, inputs, extractedDir)
+		if err != nil {
+			fatalf("extracting stemcell: %s", err)
+		}
+	}
+
+	imageInfo, err := os.Stat(inputs.MachineImagePath)
+	if os.IsNotExist(err) {
+		fatalf("machine image not found at: %s", inputs.MachineImagePath)
+	}
+	if err == nil {
+		span.SetAttributes(tracing.ImageSize(imageInfo.Size()))
+	}
+
+	if _, err := os.Stat(inputs.ManifestPath); os.IsNotExist(err) {
+		fatalf("manifest not found at: %s", inputs.ManifestPath)
+	}
+
+	manifestBytes, err := os.ReadFile(inputs.ManifestPath)
 	if err != nil {
-		logger.Fatalf("opening manifest: %s", err)
+		fatalf("opening manifest: %s", err)
 	}
 
 	m, err := manifest.NewFromReader(bytes.NewReader(manifestBytes))
 	if err != nil {
-		logger.Fatalf("reading manifest: %s", err)
+		fatalf("reading manifest: %s", err)
 	}
 
-	if c.AmiConfiguration.Tags == nil {
-		c.AmiConfiguration.Tags = map[string]string{
-			"version": m.Version,
-			"distro":  m.OperatingSystem,
-		}
+	err = setArchitecture(logger, &c.AmiConfiguration, m)
+	if err != nil {
+		fatalf("%s", err)
 	}
 
-	if c.AmiConfiguration.KmsKeyId != "" && c.AmiConfiguration.KmsKeyAliasName == "" {
-		aliasName := "light-stemcell-builder"
-		logger.Printf("Kms key alias not set - using default value: %s", aliasName)
-		c.AmiConfiguration.KmsKeyAliasName = aliasName
+	err = c.RenderTags(config.TagValues{
+		Name:         m.Name,
+		Version:      m.Version,
+		Distro:       m.OperatingSystem,
+		Architecture: c.AmiConfiguration.Architecture,
+	}, map[string]string{
+		"version": m.Version,
+		"distro":  m.OperatingSystem,
+	})
+	if err != nil {
+		fatalf("%s", err)
 	}
 
-	if c.AmiConfiguration.KmsKeyAliasName != "" {
-		if !strings.HasPrefix(c.AmiConfiguration.KmsKeyAliasName, "alias/") {
-			c.AmiConfiguration.KmsKeyAliasName = "alias/" + c.AmiConfiguration.KmsKeyAliasName
-		}
+	var rep *report.Report
+	if inputs.ReportPath != "" {
+		rep = report.New()
 	}
 
 	amiCollection := collection.Ami{}
@@ -120,64 +284,302 @@ func main() {
 	var wg sync.WaitGroup
 	wg.Add(len(c.AmiRegions))
 
+	rollbacks := make([]func(context.Context) []publisher.RollbackResult, len(c.AmiRegions))
+
+	// regions that do not write the snapshot from the local image upload it to S3
+	var uploadRegions []string
+	for _, regionConfig := range c.AmiRegions {
+		if regionConfig.IsolatedRegion || regionConfig.SnapshotMethod != config.EbsDirectSnapshotMethod {
+			uploadRegions = append(uploadRegions, regionConfig.RegionName)
+		}
+	}
+
+	sharedImage := upload.NewSharedFile(inputs.MachineImagePath, uploadRegions, upload.NewLimiter(c.Upload.MaxMBPerSecond*(1<<20)))
+
+	// the checksum names the uploads of every region, so it is computed with one read before they start
+	var imageSHA256 string
+	if len(uploadRegions) > 0 {
+		imageSHA256, err = sharedImage.Digest()
+		if err != nil {
+			fatalf("computing checksum of machine image: %s", err)
+		}
+	}
+
 	imageConfig := publisher.MachineImageConfig{
-		LocalPath:    *machineImagePath,
-		FileFormat:   *machineImageFormat,
-		VolumeSizeGB: int64(*imageVolumeSize),
+		LocalPath:    inputs.MachineImagePath,
+		FileFormat:   inputs.FileFormat,
+		VolumeSizeGB: int64(inputs.VolumeSizeGB),
+		Upload: resources.UploadSettings{
+			PartSize:         c.Upload.PartSizeMB << 20,
+			Concurrency:      c.Upload.Concurrency,
+			ProgressInterval: time.Duration(c.Upload.ProgressIntervalSeconds) * time.Second,
+		},
+		SharedImage:        sharedImage,
+		ImageSHA256:        imageSHA256,
+		VerifySnapshotSize: c.Upload.VerifySnapshotSize,
+		KeepUploadedImage:  c.Upload.KeepUploadedImage,
+	}
+
+	// recordRegion records the result of publishing region in the report, the metrics and the collections
+	recordRegion := func(region string, amis *collection.Ami, err error) {
+		if err != nil {
+			rep.Fail(region, err)
+			metrics.RegionFailed(region)
+			errCollection.Add(fmt.Errorf("publishing AMIs to %s: %s", region, err))
+			return
+		}
+		rep.Succeed(region)
+		metrics.RegionSucceeded(region)
+		amiCollection.Merge(amis)
 	}
 
 	for i := range c.AmiRegions {
-		go func(regionConfig config.AmiRegion) {
+		amiConfig := c.RegionAmiConfiguration(c.AmiRegions[i])
+		setKmsKeyAliasName(logger, &amiConfig)
+
+		go func(i int, regionConfig config.AmiRegion, amiConfig config.AmiConfiguration) {
 			defer wg.Done()
 
+			ctx, span := tracing.Start(ctx, "publish_region", tracing.Region(regionConfig.RegionName))
+
+			var amis *collection.Ami
+			var err error
 			switch {
 			case regionConfig.IsolatedRegion:
-				ds := driverset.NewIsolatedRegionDriverSet(sharedWriter, regionConfig.Credentials)
-				p := publisher.NewIsolatedRegionPublisher(sharedWriter, publisher.Config{
+				ds := driverset.NewIsolatedRegionDriverSet(logger, regionConfig.Credentials)
+				p := publisher.NewIsolatedRegionPublisher(logger, publisher.Config{
 					AmiRegion:        regionConfig,
-					AmiConfiguration: c.AmiConfiguration,
+					AmiConfiguration: amiConfig,
+					Journal:          j,
+					Report:           rep,
 				})
+				rollbacks[i] = func(ctx context.Context) []publisher.RollbackResult {
+					return p.Rollback(ctx, ds)
+				}
 
-				amis, err := p.Publish(ds, imageConfig)
-				if err != nil {
-					errCollection.Add(fmt.Errorf("publishing AMIs to %s: %s", regionConfig.RegionName, err))
+				amis, err = p.Publish(ctx, ds, imageConfig)
+			default:
+				var ds driverset.StandardRegionDriverSet
+				if regionConfig.SnapshotMethod == config.EbsDirectSnapshotMethod {
+					ds = driverset.NewEbsDirectStandardRegionDriverSet(logger, regionConfig.Credentials)
 				} else {
-					amiCollection.Merge(amis)
+					ds = driverset.NewStandardRegionDriverSet(logger, regionConfig.Credentials)
 				}
-			default:
-				ds := driverset.NewStandardRegionDriverSet(sharedWriter, regionConfig.Credentials)
-				p := publisher.NewStandardRegionPublisher(sharedWriter, publisher.Config{
+				p := publisher.NewStandardRegionPublisher(logger, publisher.Config{
 					AmiRegion:        regionConfig,
-					AmiConfiguration: c.AmiConfiguration,
+					AmiConfiguration: amiConfig,
+					Journal:          j,
+					Report:           rep,
 				})
-
-				amis, err := p.Publish(ds, imageConfig)
-				if err != nil {
-					errCollection.Add(fmt.Errorf("publishing AMIs to %s: %s", regionConfig.RegionName, err))
-				} else {
-					amiCollection.Merge(amis)
+				rollbacks[i] = func(ctx context.Context) []publisher.RollbackResult {
+					return p.Rollback(ctx, ds)
 				}
+
+				amis, err = p.Publish(ctx, ds, imageConfig)
 			}
-		}(c.AmiRegions[i])
+			tracing.End(span, err)
+			recordRegion(regionConfig.RegionName, amis, err)
+		}(i, c.AmiRegions[i], amiConfig)
 	}
 
-	logger.Println("Waiting for publishers to finish...")
+	logger.Info("Waiting for publishers to finish...")
 	wg.Wait()
 
 	combinedErr := errCollection.Error()
 	if combinedErr != nil {
-		logger.Fatal(combinedErr)
+		if rollbackOnFailure {
+			rollback(ctx, logger, rollbacks)
+		}
+		err = writeReport(logger, rep, inputs.ReportPath)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+		err = writeMetrics(logger, inputs.MetricsPath)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+		fatalf("%s", combinedErr)
 	}
 
 	m.PublishedAmis = amiCollection.GetAll()
+	if imageSHA256 := imageConfig.SharedImage.SHA256(); imageSHA256 != "" {
+		m.CloudProperties.ImageSHA256 = imageSHA256
+	}
 
-	m.Sha1 = shasum([]byte{})
+	if inputs.OutputTarball != "" {
+		err = writeTarball(logger, m, inputs)
+		if err != nil {
+			fatalf("%s", err)
+		}
+	} else {
+		m.Sha1 = shasum([]byte{})
 
-	err = m.Write(os.Stdout)
+		err = m.Write(os.Stdout)
+		if err != nil {
+			fatalf("writing manifest: %s", err)
+		}
+	}
+
+	err = writeReport(logger, rep, inputs.ReportPath)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	err = writeMetrics(logger, inputs.MetricsPath)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	tracing.End(span, nil)
+	shutdownTracing(logger)
+	logger.Info("Publishing finished successfully")
+}
+
+// extractStemcell extracts the heavy stemcell of inputs to dir and returns inputs
+// that point at the extracted machine image and manifest. The other files of the
+// stemcell are added to the files to include in the light stemcell, unless a file
+// with the same name was given explicitly.
+func extractStemcell(logger *slog.Logger, inputs journal.Inputs, dir string) (journal.Inputs, error) {
+	logger.Info("Extracting stemcell", "path", inputs.StemcellPath)
+
+	heavy, err := stemcell.Extract(inputs.StemcellPath, dir)
+	if err != nil {
+		return journal.Inputs{}, err
+	}
+
+	inputs.MachineImagePath = heavy.ImagePath
+	inputs.ManifestPath = heavy.ManifestPath
+	inputs.FileFormat = heavy.FileFormat
+	if inputs.VolumeSizeGB == 0 {
+		inputs.VolumeSizeGB = heavy.VolumeSizeGB
+	}
+
+	included := map[string]bool{}
+	for _, includeFile := range inputs.IncludeFiles {
+		included[filepath.Base(includeFile)] = true
+	}
+
+	includeFiles := append([]string(nil), inputs.IncludeFiles...)
+	for _, extraFile := range heavy.ExtraFiles {
+		if !included[filepath.Base(extraFile)] {
+			includeFiles = append(includeFiles, extraFile)
+		}
+	}
+	inputs.IncludeFiles = includeFiles
+
+	logger.Info("Extracted image from stemcell", "format", inputs.FileFormat, "volume_size_gb", inputs.VolumeSizeGB)
+	return inputs, nil
+}
+
+// writeTarball writes the light stemcell, and its checksum sidecar if requested
+func writeTarball(logger *slog.Logger, m *manifest.Manifest, inputs journal.Inputs) error {
+	checksums, err := stemcell.WriteTarball(inputs.OutputTarball, m, inputs.IncludeFiles)
+	if err != nil {
+		return fmt.Errorf("writing light stemcell: %s", err)
+	}
+	logger.Info("Wrote light stemcell", "path", inputs.OutputTarball, "sha1", checksums.SHA1, "sha256", checksums.SHA256)
+
+	if inputs.Sidecar != "" {
+		sidecarPath, err := stemcell.WriteSidecar(inputs.OutputTarball, inputs.Sidecar, m.Version, checksums)
+		if err != nil {
+			return fmt.Errorf("writing checksum sidecar: %s", err)
+		}
+		logger.Info("Wrote checksums", "path", sidecarPath)
+	}
+
+	return nil
+}
+
+// writeReport writes the publish report if one was requested
+func writeReport(logger *slog.Logger, rep *report.Report, path string) error {
+	if rep == nil {
+		return nil
+	}
+
+	err := rep.Write(path)
+	if err != nil {
+		return fmt.Errorf("writing publish report: %s", err)
+	}
+	logger.Info("Wrote publish report", "path", path)
+
+	return nil
+}
+
+// writeMetrics writes the metrics of the publish to path, if it is set
+func writeMetrics(logger *slog.Logger, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	err := metrics.WriteTextfile(path)
 	if err != nil {
-		logger.Fatalf("writing manifest: %s", err)
+		return err
+	}
+	logger.Info("Wrote metrics", "path", path)
+
+	return nil
+}
+
+// setArchitecture defaults the architecture to the one in the stemcell manifest,
+// and records the architecture that is published in the manifest
+func setArchitecture(logger *slog.Logger, amiConfig *config.AmiConfiguration, m *manifest.Manifest) error {
+	manifestArchitecture := m.CloudProperties.Architecture
+	if manifestArchitecture == "aarch64" {
+		manifestArchitecture = config.Arm64Architecture
+	}
+
+	if amiConfig.Architecture == "" {
+		switch manifestArchitecture {
+		case "":
+			amiConfig.Architecture = config.X86Architecture
+		case config.X86Architecture, config.Arm64Architecture:
+			amiConfig.Architecture = manifestArchitecture
+		default:
+			return fmt.Errorf("unsupported architecture %q in stemcell manifest, set architecture in ami_configuration", m.CloudProperties.Architecture)
+		}
+	} else if manifestArchitecture != "" && manifestArchitecture != amiConfig.Architecture {
+		logger.Warn(fmt.Sprintf("Publishing %s AMIs for a stemcell built for %s", amiConfig.Architecture, m.CloudProperties.Architecture))
 	}
-	logger.Println("Publishing finished successfully")
+
+	m.CloudProperties.Architecture = amiConfig.Architecture
+	return nil
+}
+
+// setKmsKeyAliasName defaults the alias name when a KMS key is configured and adds the alias/ prefix AWS requires
+func setKmsKeyAliasName(logger *slog.Logger, amiConfig *config.AmiConfiguration) {
+	if amiConfig.KmsKeyId != "" && amiConfig.KmsKeyAliasName == "" {
+		aliasName := "light-stemcell-builder"
+		logger.Info("Kms key alias not set - using default value", "alias", aliasName)
+		amiConfig.KmsKeyAliasName = aliasName
+	}
+
+	if amiConfig.KmsKeyAliasName != "" {
+		if !strings.HasPrefix(amiConfig.KmsKeyAliasName, "alias/") {
+			amiConfig.KmsKeyAliasName = "alias/" + amiConfig.KmsKeyAliasName
+		}
+	}
+}
+
+// rollback removes the resources created by every region of a failed publish.
+// It runs even after the publish context is cancelled.
+func rollback(ctx context.Context, logger *slog.Logger, rollbacks []func(context.Context) []publisher.RollbackResult) {
+	rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	logger.Warn("Publishing failed, rolling back created resources...")
+
+	var removed, failed int
+	for _, rollbackRegion := range rollbacks {
+		for _, result := range rollbackRegion(rollbackCtx) {
+			if result.Err != nil {
+				logger.Error("Rollback: could not remove resource", "resource", result.Resource, logging.Region(result.Region), "error", result.Err)
+				failed++
+			} else {
+				logger.Info("Rollback: removed resource", "resource", result.Resource, logging.Region(result.Region))
+				removed++
+			}
+		}
+	}
+
+	logger.Info("Rollback finished", "removed", removed, "failed", failed)
 }
 
 func shasum(content []byte) string {
@@ -187,14 +589,39 @@ func shasum(content []byte) string {
 	return fmt.Sprintf("%x", bs)
 }
 
+// stringsFlag collects the values of a flag that can be repeated
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// logWriter serializes the log of every driver and redacts the credentials in it
 type logWriter struct {
 	sync.Mutex
-	writer io.Writer
+	writer   io.Writer
+	redactor redact.Redactor
 }
 
 func (l *logWriter) Write(message []byte) (int, error) {
 	l.Lock()
 	defer l.Unlock()
 
-	return l.writer.Write(message)
+	_, err := io.WriteString(l.writer, l.redactor.String(string(message)))
+	if err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
+
+// redactSecrets keeps the credentials of c out of the log written to w
+func redactSecrets(w io.Writer, c config.Config) {
+	if l, ok := w.(*logWriter); ok {
+		l.redactor.AddSecrets(c.Secrets()...)
+	}
 }
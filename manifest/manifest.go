@@ -28,10 +28,13 @@ type Manifest struct {
 // RegionToAmiMapping is a simple map of AWS region to AMI ID in that region
 type RegionToAmiMapping map[string]string
 
-// CloudProperties contains our region to AMI ID mapping and Infrastructure
+// CloudProperties contains our region to AMI ID mapping, Infrastructure and Architecture
 type CloudProperties struct {
 	Infrastructure string             `yaml:"infrastructure"`
+	Architecture   string             `yaml:"architecture,omitempty"`
 	Amis           RegionToAmiMapping `yaml:"ami"`
+	// ImageSHA256 is the SHA-256 checksum of the machine image the AMIs were published from
+	ImageSHA256 string `yaml:"image_sha256,omitempty"`
 }
 
 // NewFromReader creates a new manifest from the YAML stored in the reader
@@ -72,6 +75,14 @@ func (m *Manifest) Write(writer io.Writer) error {
 		m.Name = strings.Replace(m.Name, "xen", "xen-hvm", 1)
 	}
 
+	if m.CloudProperties.Architecture == resources.Arm64AmiArchitecture && !strings.Contains(m.Name, "arm64") {
+		if strings.HasSuffix(m.Name, "-go_agent") {
+			m.Name = strings.TrimSuffix(m.Name, "-go_agent") + "-arm64-go_agent"
+		} else {
+			m.Name += "-arm64"
+		}
+	}
+
 	output, err := yaml.Marshal(m)
 	if err != nil {
 		return fmt.Errorf("marshaling manifest to YAML: %s", err)
@@ -70,6 +70,30 @@ cloud_properties:
 			Expect(resultManifest.CloudProperties.Amis).To(HaveLen(1))
 			Expect(resultManifest.CloudProperties.Amis["fake-region"]).To(Equal("fake-ami-id"))
 			Expect(resultManifest.CloudProperties.Infrastructure).To(Equal("aws"))
+			Expect(resultManifest.CloudProperties.Architecture).To(Equal("x86_64"))
+		})
+
+		It("adds the architecture to the name of arm64 stemcells", func() {
+			m, err := manifest.NewFromReader(bytes.NewReader(manifestBytes))
+			Expect(err).ToNot(HaveOccurred())
+
+			m.CloudProperties.Architecture = resources.Arm64AmiArchitecture
+			m.PublishedAmis = []resources.Ami{{Region: "fake-region", ID: "fake-ami-id", VirtualizationType: resources.HvmAmiVirtualization}}
+
+			writer := &bytes.Buffer{}
+			err = m.Write(writer)
+			Expect(err).ToNot(HaveOccurred())
+
+			resultManifest := &manifest.Manifest{}
+			err = yaml.Unmarshal(writer.Bytes(), resultManifest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resultManifest.Name).To(Equal("bosh-aws-xen-hvm-ubuntu-trusty-arm64-go_agent"))
+			Expect(resultManifest.CloudProperties.Architecture).To(Equal("arm64"))
+
+			err = m.Write(writer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m.Name).To(Equal("bosh-aws-xen-hvm-ubuntu-trusty-arm64-go_agent"))
 		})
 
 		Context("when the name of the stemcell already has 'hvm' in it", func() {
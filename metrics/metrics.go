@@ -0,0 +1,120 @@
+// Package metrics collects the timings of a publish that the drivers log and writes them in the Prometheus
+// textfile format, for the textfile collector of the node exporter.
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "light_stemcell_builder"
+
+// The tasks whose wait is recorded by ObserveImportWait
+const (
+	ImportSnapshotTask = "ImportSnapshot"
+	ImportVolumeTask   = "ImportVolume"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	uploadBytes = newGaugeVec(
+		"upload_bytes",
+		"Bytes of the machine image uploaded to S3.",
+		"region",
+	)
+	uploadDuration = newGaugeVec(
+		"upload_duration_seconds",
+		"Duration of the upload of the machine image to S3.",
+		"region",
+	)
+	importWaitDuration = newGaugeVec(
+		"import_wait_duration_seconds",
+		"Time spent waiting for an ImportSnapshot or ImportVolume task to complete.",
+		"region", "task",
+	)
+	copyDuration = newGaugeVec(
+		"copy_duration_seconds",
+		"Duration of the CopyImage of an AMI until the copy is available in its destination region.",
+		"region", "destination_region",
+	)
+	s3Retries = newCounterVec(
+		"s3_retries_total",
+		"Requests to S3 retried by the S3Retryer.",
+		"region",
+	)
+	regionSuccess = newGaugeVec(
+		"region_success",
+		"Whether publishing to the region succeeded (1) or failed (0).",
+		"region",
+	)
+	lastRun = newGauge(
+		"last_run_timestamp_seconds",
+		"Time the publish ended, as seconds since the Unix epoch.",
+	)
+)
+
+func newGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, labels)
+	registry.MustRegister(gauge)
+	return gauge
+}
+
+func newCounterVec(name string, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labels)
+	registry.MustRegister(counter)
+	return counter
+}
+
+func newGauge(name string, help string) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help})
+	registry.MustRegister(gauge)
+	return gauge
+}
+
+// ObserveUpload records the upload of bytes of the machine image to the bucket of region
+func ObserveUpload(region string, bytes int64, duration time.Duration) {
+	uploadBytes.WithLabelValues(region).Set(float64(bytes))
+	uploadDuration.WithLabelValues(region).Set(duration.Seconds())
+}
+
+// ObserveImportWait records the wait for an import task, ImportSnapshotTask or ImportVolumeTask, in region
+func ObserveImportWait(region string, task string, duration time.Duration) {
+	importWaitDuration.WithLabelValues(region, task).Set(duration.Seconds())
+}
+
+// ObserveCopy records the copy of the AMI of region to destinationRegion
+func ObserveCopy(region string, destinationRegion string, duration time.Duration) {
+	copyDuration.WithLabelValues(region, destinationRegion).Set(duration.Seconds())
+}
+
+// AddS3Retries counts retried requests to S3 in region. Adding 0 writes the count of the region even if
+// no request is retried.
+func AddS3Retries(region string, retries int) {
+	s3Retries.WithLabelValues(region).Add(float64(retries))
+}
+
+// RegionSucceeded records that publishing to region succeeded
+func RegionSucceeded(region string) {
+	regionSuccess.WithLabelValues(region).Set(1)
+}
+
+// RegionFailed records that publishing to region failed
+func RegionFailed(region string) {
+	regionSuccess.WithLabelValues(region).Set(0)
+}
+
+// WriteTextfile writes the metrics to path in the Prometheus textfile format. The file is replaced at once,
+// so the node exporter never reads a partial file.
+func WriteTextfile(path string) error {
+	lastRun.SetToCurrentTime()
+
+	err := prometheus.WriteToTextfile(path, registry)
+	if err != nil {
+		return fmt.Errorf("writing metrics %s: %s", path, err)
+	}
+
+	return nil
+}
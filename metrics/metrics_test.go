@@ -0,0 +1,76 @@
+package metrics_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/metrics"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "light_stemcell_builder.prom")
+	})
+
+	readTextfile := func() string {
+		contents, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	It("writes the metrics of the publish in the textfile format", func() {
+		metrics.ObserveUpload("us-east-1", 4096, 90*time.Second)
+		metrics.ObserveImportWait("us-east-1", metrics.ImportSnapshotTask, 10*time.Minute)
+		metrics.ObserveImportWait("cn-north-1", metrics.ImportVolumeTask, 5*time.Minute)
+		metrics.ObserveCopy("us-east-1", "us-west-2", 2*time.Minute)
+		metrics.AddS3Retries("us-east-1", 2)
+		metrics.AddS3Retries("cn-north-1", 0)
+		metrics.RegionSucceeded("us-east-1")
+		metrics.RegionFailed("cn-north-1")
+
+		Expect(metrics.WriteTextfile(path)).To(Succeed())
+
+		textfile := readTextfile()
+		Expect(strings.Split(textfile, "\n")).To(ContainElements(
+			`light_stemcell_builder_upload_bytes{region="us-east-1"} 4096`,
+			`light_stemcell_builder_upload_duration_seconds{region="us-east-1"} 90`,
+			`light_stemcell_builder_import_wait_duration_seconds{region="us-east-1",task="ImportSnapshot"} 600`,
+			`light_stemcell_builder_import_wait_duration_seconds{region="cn-north-1",task="ImportVolume"} 300`,
+			`light_stemcell_builder_copy_duration_seconds{destination_region="us-west-2",region="us-east-1"} 120`,
+			`light_stemcell_builder_s3_retries_total{region="us-east-1"} 2`,
+			`light_stemcell_builder_s3_retries_total{region="cn-north-1"} 0`,
+			`light_stemcell_builder_region_success{region="us-east-1"} 1`,
+			`light_stemcell_builder_region_success{region="cn-north-1"} 0`,
+			"# TYPE light_stemcell_builder_s3_retries_total counter",
+		))
+
+		lastRun := regexp.MustCompile(`(?m)^light_stemcell_builder_last_run_timestamp_seconds (\S+)$`).FindStringSubmatch(textfile)
+		Expect(lastRun).To(HaveLen(2))
+		lastRunSeconds, err := strconv.ParseFloat(lastRun[1], 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastRunSeconds).To(BeNumerically("~", time.Now().Unix(), 60))
+	})
+
+	It("replaces the metrics of an earlier run", func() {
+		Expect(os.WriteFile(path, []byte("stale"), 0644)).To(Succeed())
+
+		Expect(metrics.WriteTextfile(path)).To(Succeed())
+
+		Expect(readTextfile()).NotTo(ContainSubstring("stale"))
+		Expect(readTextfile()).To(ContainSubstring("light_stemcell_builder_last_run_timestamp_seconds "))
+	})
+
+	It("returns an error when the file cannot be written", func() {
+		err := metrics.WriteTextfile(filepath.Join(path, "missing", "metrics.prom"))
+		Expect(err).To(MatchError(ContainSubstring("writing metrics")))
+	})
+})
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/driver"
+	"light-stemcell-builder/preflight"
+	"light-stemcell-builder/resources"
+)
+
+// runPreflight checks the buckets, vmimport roles, KMS keys, AMI names and IAM permissions that a publish with
+// the configuration needs, prints whether each check passed and fails if one did not
+func runPreflight(sharedWriter io.Writer, args []string) {
+	flags := flag.NewFlagSet("preflight", flag.ExitOnError)
+	configPath := flags.String("c", "", "Path to the JSON configuration file of the publish")
+	timeout := flags.Duration("timeout", 0, "Maximum duration of the checks, e.g. 5m. Defaults to no limit.")
+	logOptions := addLogFlags(flags)
+
+	flags.Parse(args) //nolint:errcheck
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "-c flag is required")                               //nolint:errcheck
+		fmt.Fprintln(os.Stderr, "Usage of light-stemcell-builder/main.go preflight") //nolint:errcheck
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	logger := logOptions.logger(sharedWriter)
+
+	configFile, err := os.Open(*configPath)
+	if err != nil {
+		fatal(logger, "Error opening config file: %s", err)
+	}
+	c, err := config.NewFromReader(configFile)
+	configFile.Close() //nolint:errcheck
+	if err != nil {
+		fatal(logger, "Error parsing config file: %s. Message: %s", *configPath, err)
+	}
+	redactSecrets(sharedWriter, c)
+
+	ctx, cancel := publishContext(*timeout)
+	defer cancel()
+
+	p := preflight.New(logger, c, func(creds config.Credentials) resources.PreflightDriver {
+		return driver.NewPreflightDriver(logger, creds)
+	})
+	results := p.Run(ctx)
+
+	err = preflight.Print(os.Stdout, results)
+	if err != nil {
+		fatal(logger, "Error printing preflight results: %s", err)
+	}
+
+	if failed := preflight.Failed(results); failed > 0 {
+		fatal(logger, "Preflight failed: %d of %d checks did not pass", failed, len(results))
+	}
+	logger.Info("Preflight passed", "checks", len(results))
+}
@@ -0,0 +1,286 @@
+// Package preflight checks the prerequisites of a publish in AWS before anything is uploaded.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+)
+
+// The actions the drivers call, by the step of the publish that calls them
+var (
+	uploadActions = []string{
+		"s3:PutObject",
+		"s3:GetObject",
+		"s3:GetObjectAttributes",
+		"s3:DeleteObject",
+		"s3:AbortMultipartUpload",
+	}
+	importSnapshotActions = []string{
+		"ec2:ImportSnapshot",
+		"ec2:DescribeImportSnapshotTasks",
+	}
+	importVolumeActions = []string{
+		"ec2:ImportVolume",
+		"ec2:DescribeConversionTasks",
+		"ec2:DescribeAvailabilityZones",
+		"ec2:CreateSnapshot",
+		"ec2:DeleteVolume",
+	}
+	ebsDirectActions = []string{
+		"ebs:StartSnapshot",
+		"ebs:PutSnapshotBlock",
+		"ebs:CompleteSnapshot",
+	}
+	createAmiActions = []string{
+		"ec2:DescribeSnapshots",
+		"ec2:RegisterImage",
+		"ec2:DescribeImages",
+		"ec2:CreateTags",
+		"ec2:ModifyImageAttribute",
+		"ec2:ModifySnapshotAttribute",
+	}
+	copyAmiActions = []string{
+		"ec2:CopyImage",
+		"ec2:DescribeImages",
+		"ec2:CreateTags",
+		"ec2:ModifyImageAttribute",
+		"ec2:ModifySnapshotAttribute",
+	}
+	// shareSourceAmiActions share the source AMI and its snapshots with the account of a destination that is
+	// copied to with its own credentials, and revoke the shares afterwards
+	shareSourceAmiActions = []string{
+		"ec2:DescribeImages",
+		"ec2:DescribeImageAttribute",
+		"ec2:ModifyImageAttribute",
+		"ec2:DescribeSnapshotAttribute",
+		"ec2:ModifySnapshotAttribute",
+	}
+	// rollbackActions remove the AMIs and snapshots of a failed publish, and are also called by cleanup and sweep
+	rollbackActions = []string{
+		"ec2:DeregisterImage",
+		"ec2:DeleteSnapshot",
+		"ec2:ResetImageAttribute",
+		"ec2:ModifyImageAttribute",
+	}
+	kmsAliasActions = []string{
+		"kms:CreateAlias",
+		"kms:ListAliases",
+		"kms:DeleteAlias",
+	}
+	replicateKeyActions = []string{
+		"kms:ReplicateKey",
+		"kms:DescribeKey",
+	}
+)
+
+// check is a prerequisite of a publish in a region
+type check struct {
+	name   string
+	region string
+	run    func(context.Context) (string, error)
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Check  string
+	Region string
+	Detail string
+	Err    error
+}
+
+// Preflight runs the checks of a configuration
+type Preflight struct {
+	checks []check
+	logger *slog.Logger
+}
+
+// New creates a Preflight with the checks of every ami_regions entry of c and its destinations. newDriver
+// creates the driver for the credentials of an entry.
+func New(logger *slog.Logger, c config.Config, newDriver func(config.Credentials) resources.PreflightDriver) *Preflight {
+	p := &Preflight{logger: logger}
+
+	for _, regionConfig := range c.AmiRegions {
+		amiConfig := c.RegionAmiConfiguration(regionConfig)
+		d := newDriver(regionConfig.Credentials)
+		region := regionConfig.RegionName
+
+		// regions that do not write the snapshot from the local image upload it to S3
+		uploads := regionConfig.IsolatedRegion || regionConfig.SnapshotMethod != config.EbsDirectSnapshotMethod
+
+		// the key of the region is replicated to the destinations that do not configure their own
+		replicate := false
+		for _, destination := range regionConfig.Destinations {
+			if destination.AmiConfiguration.Apply(amiConfig).KmsKeyId == amiConfig.KmsKeyId {
+				replicate = true
+			}
+		}
+
+		actions := concat(createAmiActions, rollbackActions)
+		switch {
+		case regionConfig.IsolatedRegion:
+			actions = concat(uploadActions, importVolumeActions, actions)
+		case regionConfig.SnapshotMethod == config.EbsDirectSnapshotMethod:
+			actions = concat(ebsDirectActions, actions)
+		default:
+			actions = concat(uploadActions, importSnapshotActions, actions)
+		}
+		if uploads && len(amiConfig.Tags) > 0 {
+			actions = append(actions, "s3:PutObjectTagging")
+		}
+		if !regionConfig.IsolatedRegion && amiConfig.KmsKeyId != "" {
+			actions = concat(actions, kmsAliasActions)
+			if replicate {
+				actions = concat(actions, replicateKeyActions)
+			}
+		}
+		copies, shares := false, false
+		for _, destination := range regionConfig.Destinations {
+			if regionConfig.Credentials.HasDestinationCredentials(destination.RegionName) {
+				shares = true
+			} else {
+				copies = true
+			}
+		}
+		if copies {
+			actions = concat(actions, copyAmiActions)
+		}
+		if shares {
+			actions = concat(actions, shareSourceAmiActions)
+		}
+
+		if uploads {
+			p.add(resources.PreflightBucket, region, func(ctx context.Context) (string, error) {
+				return d.CheckBucket(ctx, region, regionConfig.BucketName)
+			})
+			p.add(resources.PreflightVmimportRole, region, func(ctx context.Context) (string, error) {
+				return d.CheckVmimportRole(ctx, region)
+			})
+		}
+		if amiConfig.KmsKeyId != "" {
+			kmsKeyCheck := resources.KmsKeyCheck{Region: region, KmsKeyId: amiConfig.KmsKeyId, Replicate: replicate}
+			p.add(resources.PreflightKmsKey, region, func(ctx context.Context) (string, error) {
+				return d.CheckKmsKey(ctx, kmsKeyCheck)
+			})
+		}
+		properties := amiProperties(amiConfig, regionConfig.IsolatedRegion)
+		p.add(resources.PreflightAmiName, region, func(ctx context.Context) (string, error) {
+			return d.CheckAmiName(ctx, region, properties)
+		})
+		permissionsCheck := resources.PermissionsCheck{Region: region, BucketName: regionConfig.BucketName, Actions: unique(actions)}
+		p.add(resources.PreflightPermissions, region, func(ctx context.Context) (string, error) {
+			return d.CheckPermissions(ctx, permissionsCheck)
+		})
+
+		for _, destination := range regionConfig.Destinations {
+			destinationConfig := destination.AmiConfiguration.Apply(amiConfig)
+			destinationRegion := destination.RegionName
+
+			if destinationConfig.KmsKeyId != "" && destinationConfig.KmsKeyId != amiConfig.KmsKeyId {
+				kmsKeyCheck := resources.KmsKeyCheck{Region: destinationRegion, KmsKeyId: destinationConfig.KmsKeyId}
+				p.add(resources.PreflightKmsKey, destinationRegion, func(ctx context.Context) (string, error) {
+					return d.CheckKmsKey(ctx, kmsKeyCheck)
+				})
+			}
+			destinationProperties := amiProperties(destinationConfig, false)
+			p.add(resources.PreflightAmiName, destinationRegion, func(ctx context.Context) (string, error) {
+				return d.CheckAmiName(ctx, destinationRegion, destinationProperties)
+			})
+			// the copy is made with the credentials of the destination account when it has its own
+			if regionConfig.Credentials.HasDestinationCredentials(destinationRegion) {
+				permissionsCheck := resources.PermissionsCheck{Region: destinationRegion, Actions: unique(concat(copyAmiActions, rollbackActions))}
+				p.add(resources.PreflightPermissions, destinationRegion, func(ctx context.Context) (string, error) {
+					return d.CheckPermissions(ctx, permissionsCheck)
+				})
+			}
+		}
+	}
+
+	return p
+}
+
+// amiProperties returns the properties of the AMIs a publish with c registers or copies, which an existing AMI
+// needs to be adopted. The distro and version tags come from the stemcell, so they are only checked by the publish.
+func amiProperties(c config.AmiConfiguration, isolated bool) resources.AmiProperties {
+	properties := resources.AmiProperties{
+		Name:               c.AmiName,
+		VirtualizationType: c.VirtualizationType,
+		Architecture:       c.Architecture,
+		Efi:                c.Efi,
+	}
+	// AMIs of isolated regions are registered from an imported volume without encryption
+	if !isolated {
+		properties.Encrypted = c.Encrypted
+		properties.KmsKeyId = c.KmsKeyId
+	}
+	return properties
+}
+
+func (p *Preflight) add(name string, region string, run func(context.Context) (string, error)) {
+	p.checks = append(p.checks, check{name: name, region: region, run: run})
+}
+
+// Run runs every check, also after one failed, and returns their results
+func (p *Preflight) Run(ctx context.Context) []Result {
+	var results []Result
+	for _, c := range p.checks {
+		detail, err := c.run(ctx)
+		if err != nil {
+			p.logger.ErrorContext(ctx, "preflight check failed", "check", c.name, logging.Region(c.region), "error", err)
+		}
+		results = append(results, Result{Check: c.name, Region: c.region, Detail: detail, Err: err})
+	}
+	return results
+}
+
+// Failed returns the number of results whose check failed
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Print writes results to w as a table
+func Print(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tCHECK\tRESULT\tDETAIL") //nolint:errcheck
+	for _, result := range results {
+		status, detail := "PASS", result.Detail
+		if result.Err != nil {
+			status, detail = "FAIL", result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Region, result.Check, status, detail) //nolint:errcheck
+	}
+	return tw.Flush()
+}
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// unique removes the repeated actions of the lists that share some
+func unique(actions []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, action := range actions {
+		if !seen[action] {
+			seen[action] = true
+			result = append(result, action)
+		}
+	}
+	return result
+}
@@ -0,0 +1,261 @@
+package preflight_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/preflight"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/resources/resourcesfakes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Preflight", func() {
+	const (
+		sourceKey      = "arn:aws:kms:us-east-1:123456789012:key/mrk-source"
+		destinationKey = "arn:aws:kms:eu-west-1:123456789012:key/destination"
+	)
+
+	var (
+		fakeDriver *resourcesfakes.FakePreflightDriver
+		driverFor  []config.Credentials
+	)
+
+	newPreflight := func(configJSON string) *preflight.Preflight {
+		c, err := config.NewFromReader(strings.NewReader(configJSON))
+		Expect(err).ToNot(HaveOccurred())
+
+		return preflight.New(logger, c, func(creds config.Credentials) resources.PreflightDriver {
+			driverFor = append(driverFor, creds)
+			return fakeDriver
+		})
+	}
+
+	checksOf := func(results []preflight.Result) []string {
+		var checks []string
+		for _, result := range results {
+			checks = append(checks, result.Region+" "+result.Check)
+		}
+		return checks
+	}
+
+	BeforeEach(func() {
+		fakeDriver = &resourcesfakes.FakePreflightDriver{}
+		driverFor = nil
+	})
+
+	It("checks the bucket, vmimport role, KMS key, AMI name and permissions of a region and the AMI names of its destinations", func() {
+		p := newPreflight(`{
+			"ami_configuration": {"description": "light stemcell", "name": "BOSH-light", "encrypted": true, "kms_key_id": "` + sourceKey + `"},
+			"ami_regions": [{
+				"name": "us-east-1",
+				"bucket_name": "bucket",
+				"credentials": {"access_key": "access", "secret_key": "secret"},
+				"destinations": ["us-west-2"]
+			}]
+		}`)
+
+		results := p.Run(context.Background())
+		Expect(checksOf(results)).To(Equal([]string{
+			"us-east-1 bucket",
+			"us-east-1 vmimport-role",
+			"us-east-1 kms-key",
+			"us-east-1 ami-name",
+			"us-east-1 iam-permissions",
+			"us-west-2 ami-name",
+		}))
+		Expect(preflight.Failed(results)).To(Equal(0))
+
+		Expect(driverFor).To(HaveLen(1))
+		Expect(driverFor[0].Region).To(Equal("us-east-1"))
+
+		_, region, bucketName := fakeDriver.CheckBucketArgsForCall(0)
+		Expect(region).To(Equal("us-east-1"))
+		Expect(bucketName).To(Equal("bucket"))
+
+		_, kmsKeyCheck := fakeDriver.CheckKmsKeyArgsForCall(0)
+		Expect(kmsKeyCheck).To(Equal(resources.KmsKeyCheck{Region: "us-east-1", KmsKeyId: sourceKey, Replicate: true}))
+
+		Expect(fakeDriver.CheckAmiNameCallCount()).To(Equal(2))
+		_, region, properties := fakeDriver.CheckAmiNameArgsForCall(0)
+		Expect(region).To(Equal("us-east-1"))
+		Expect(properties.Name).To(Equal("BOSH-light"))
+		Expect(properties.Encrypted).To(BeTrue())
+		Expect(properties.KmsKeyId).To(Equal(sourceKey))
+		_, region, properties = fakeDriver.CheckAmiNameArgsForCall(1)
+		Expect(region).To(Equal("us-west-2"))
+		Expect(properties.Name).To(Equal("BOSH-light"))
+
+		_, permissionsCheck := fakeDriver.CheckPermissionsArgsForCall(0)
+		Expect(permissionsCheck.Region).To(Equal("us-east-1"))
+		Expect(permissionsCheck.BucketName).To(Equal("bucket"))
+		Expect(permissionsCheck.Actions).To(ContainElements("s3:PutObject", "ec2:ImportSnapshot", "ec2:RegisterImage", "kms:CreateAlias", "kms:ReplicateKey", "ec2:CopyImage"))
+		Expect(permissionsCheck.Actions).To(ContainElements("ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:ResetImageAttribute", "kms:DeleteAlias"), "Expected the actions of a rollback")
+		Expect(permissionsCheck.Actions).ToNot(ContainElements("ebs:StartSnapshot", "ec2:DescribeImageAttribute"))
+		Expect(permissionsCheck.Actions).To(HaveLen(len(uniqueStrings(permissionsCheck.Actions))))
+	})
+
+	It("does not check the bucket and vmimport role of a region that writes the snapshot with the EBS direct APIs", func() {
+		p := newPreflight(`{
+			"ami_configuration": {"description": "light stemcell", "name": "BOSH-light"},
+			"ami_regions": [{
+				"name": "us-east-1",
+				"snapshot_method": "ebs-direct",
+				"credentials": {"access_key": "access", "secret_key": "secret"}
+			}]
+		}`)
+
+		results := p.Run(context.Background())
+		Expect(checksOf(results)).To(Equal([]string{
+			"us-east-1 ami-name",
+			"us-east-1 iam-permissions",
+		}))
+
+		_, permissionsCheck := fakeDriver.CheckPermissionsArgsForCall(0)
+		Expect(permissionsCheck.Actions).To(ContainElements("ebs:StartSnapshot", "ebs:PutSnapshotBlock", "ebs:CompleteSnapshot"))
+		Expect(permissionsCheck.Actions).ToNot(ContainElements("s3:PutObject", "ec2:ImportSnapshot", "ec2:CopyImage"))
+	})
+
+	It("checks the own KMS key and the permissions of a destination published with its own credentials", func() {
+		p := newPreflight(`{
+			"ami_configuration": {"description": "light stemcell", "name": "BOSH-light", "encrypted": true, "kms_key_id": "` + sourceKey + `"},
+			"ami_regions": [{
+				"name": "us-east-1",
+				"bucket_name": "bucket",
+				"credentials": {"access_key": "access", "secret_key": "secret"},
+				"destinations": [{
+					"name": "eu-west-1",
+					"credentials": {"access_key": "other-access", "secret_key": "other-secret"},
+					"ami_configuration": {"name": "BOSH-light-copy", "kms_key_id": "` + destinationKey + `"}
+				}]
+			}]
+		}`)
+
+		results := p.Run(context.Background())
+		Expect(checksOf(results)).To(Equal([]string{
+			"us-east-1 bucket",
+			"us-east-1 vmimport-role",
+			"us-east-1 kms-key",
+			"us-east-1 ami-name",
+			"us-east-1 iam-permissions",
+			"eu-west-1 kms-key",
+			"eu-west-1 ami-name",
+			"eu-west-1 iam-permissions",
+		}))
+
+		_, kmsKeyCheck := fakeDriver.CheckKmsKeyArgsForCall(0)
+		Expect(kmsKeyCheck.Replicate).To(BeFalse())
+		_, kmsKeyCheck = fakeDriver.CheckKmsKeyArgsForCall(1)
+		Expect(kmsKeyCheck).To(Equal(resources.KmsKeyCheck{Region: "eu-west-1", KmsKeyId: destinationKey}))
+
+		_, _, properties := fakeDriver.CheckAmiNameArgsForCall(1)
+		Expect(properties.Name).To(Equal("BOSH-light-copy"))
+		Expect(properties.KmsKeyId).To(Equal(destinationKey))
+
+		_, permissionsCheck := fakeDriver.CheckPermissionsArgsForCall(0)
+		Expect(permissionsCheck.Actions).ToNot(ContainElements("kms:ReplicateKey", "ec2:CopyImage"))
+		Expect(permissionsCheck.Actions).To(ContainElements("ec2:DescribeImageAttribute", "ec2:DescribeSnapshotAttribute"), "Expected the actions of sharing the source AMI with the destination account")
+		Expect(permissionsCheck.Actions).To(ContainElements("ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:ResetImageAttribute", "kms:DeleteAlias"), "Expected the actions of a rollback")
+		_, permissionsCheck = fakeDriver.CheckPermissionsArgsForCall(1)
+		Expect(permissionsCheck.Region).To(Equal("eu-west-1"))
+		Expect(permissionsCheck.Actions).To(ContainElements("ec2:CopyImage", "ec2:DeregisterImage", "ec2:DeleteSnapshot"))
+	})
+
+	It("only simulates actions that builder-policy.json allows", func() {
+		p := newPreflight(`{
+			"ami_configuration": {
+				"description": "light stemcell",
+				"name": "BOSH-light",
+				"encrypted": true,
+				"kms_key_id": "` + sourceKey + `",
+				"tags": {"team": "bosh"}
+			},
+			"ami_regions": [{
+				"name": "us-east-1",
+				"bucket_name": "bucket",
+				"credentials": {"access_key": "access", "secret_key": "secret"},
+				"destinations": ["us-west-2", {
+					"name": "eu-west-1",
+					"credentials": {"access_key": "other-access", "secret_key": "other-secret"}
+				}]
+			}, {
+				"name": "us-east-2",
+				"snapshot_method": "ebs-direct",
+				"credentials": {"access_key": "access", "secret_key": "secret"}
+			}, {
+				"name": "us-west-1",
+				"bucket_name": "bucket",
+				"isolated": true,
+				"credentials": {"access_key": "access", "secret_key": "secret"}
+			}]
+		}`)
+		p.Run(context.Background())
+		Expect(fakeDriver.CheckPermissionsCallCount()).To(Equal(4))
+
+		policyJSON, err := os.ReadFile(filepath.Join("..", "builder-policy.json"))
+		Expect(err).ToNot(HaveOccurred())
+		var policy struct {
+			Statement []struct {
+				Action []string
+			}
+		}
+		Expect(json.Unmarshal(policyJSON, &policy)).To(Succeed())
+		var allowed []string
+		for _, statement := range policy.Statement {
+			allowed = append(allowed, statement.Action...)
+		}
+
+		for i := 0; i < fakeDriver.CheckPermissionsCallCount(); i++ {
+			_, permissionsCheck := fakeDriver.CheckPermissionsArgsForCall(i)
+			for _, action := range permissionsCheck.Actions {
+				Expect(allowed).To(ContainElement(action), "Expected builder-policy.json to allow %s", action)
+			}
+		}
+	})
+
+	It("runs every check after one fails and prints whether each passed", func() {
+		fakeDriver.CheckBucketReturns("", errors.New("bucket bucket is located in eu-west-1 instead of us-east-1"))
+		fakeDriver.CheckVmimportRoleReturns("arn:aws:iam::123456789012:role/vmimport", nil)
+		fakeDriver.CheckAmiNameReturns("", errors.New("AMI ami-1 named BOSH-light already exists, but has architecture arm64 instead of x86_64"))
+		fakeDriver.CheckPermissionsReturns("arn:aws:iam::123456789012:user/builder is allowed all 20 actions", nil)
+
+		p := newPreflight(`{
+			"ami_configuration": {"description": "light stemcell", "name": "BOSH-light"},
+			"ami_regions": [{
+				"name": "us-east-1",
+				"bucket_name": "bucket",
+				"credentials": {"access_key": "access", "secret_key": "secret"}
+			}]
+		}`)
+
+		results := p.Run(context.Background())
+		Expect(results).To(HaveLen(4))
+		Expect(preflight.Failed(results)).To(Equal(2))
+
+		out := &bytes.Buffer{}
+		err := preflight.Print(out, results)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal(`REGION     CHECK            RESULT  DETAIL
+us-east-1  bucket           FAIL    bucket bucket is located in eu-west-1 instead of us-east-1
+us-east-1  vmimport-role    PASS    arn:aws:iam::123456789012:role/vmimport
+us-east-1  ami-name         FAIL    AMI ami-1 named BOSH-light already exists, but has architecture arm64 instead of x86_64
+us-east-1  iam-permissions  PASS    arn:aws:iam::123456789012:user/builder is allowed all 20 actions
+`))
+	})
+})
+
+func uniqueStrings(values []string) map[string]bool {
+	unique := map[string]bool{}
+	for _, value := range values {
+		unique[value] = true
+	}
+	return unique
+}
@@ -1,14 +1,18 @@
 package publisher
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	"light-stemcell-builder/collection"
 	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/journal"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/report"
 	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
 )
 
 type IsolatedRegionPublisher struct {
@@ -16,10 +20,13 @@ type IsolatedRegionPublisher struct {
 	BucketName           string
 	ServerSideEncryption string
 	AmiProperties        resources.AmiProperties
-	logger               *log.Logger
+	journal              *journal.Journal
+	report               *report.Report
+	created              createdResources
+	logger               *slog.Logger
 }
 
-func NewIsolatedRegionPublisher(logDest io.Writer, c Config) *IsolatedRegionPublisher {
+func NewIsolatedRegionPublisher(logger *slog.Logger, c Config) *IsolatedRegionPublisher {
 	return &IsolatedRegionPublisher{
 		Region:               c.RegionName,
 		BucketName:           c.BucketName,
@@ -29,77 +36,238 @@ func NewIsolatedRegionPublisher(logDest io.Writer, c Config) *IsolatedRegionPubl
 			Description:        c.Description,
 			Accessibility:      c.Visibility,
 			VirtualizationType: c.VirtualizationType,
+			Architecture:       c.Architecture,
 			Efi:                c.Efi,
 			Tags:               c.Tags,
 		},
-		logger: log.New(logDest, "IsolatedRegionPublisher ", log.LstdFlags),
+		journal: c.Journal,
+		report:  c.Report,
+		logger:  logger.With(logging.Region(c.RegionName)),
 	}
 }
 
-func (p *IsolatedRegionPublisher) Publish(ds driverset.IsolatedRegionDriverSet, machineImageConfig MachineImageConfig) (*collection.Ami, error) {
+func (p *IsolatedRegionPublisher) Publish(ctx context.Context, ds driverset.IsolatedRegionDriverSet, machineImageConfig MachineImageConfig) (*collection.Ami, error) {
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		p.logger.Printf("completed Publish() in %f minutes\n", time.Since(startTime).Minutes())
+		p.logger.InfoContext(ctx, "completed Publish()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	machineImageDriverConfig := resources.MachineImageDriverConfig{
-		MachineImagePath:     machineImageConfig.LocalPath,
-		BucketName:           p.BucketName,
-		ServerSideEncryption: p.ServerSideEncryption,
-		FileFormat:           machineImageConfig.FileFormat,
-		VolumeSizeGB:         machineImageConfig.VolumeSizeGB,
+	// the machine image is read once every region opened it for its upload or released it
+	defer machineImageConfig.SharedImage.Release(p.Region)
+
+	progress := p.journal.Region(p.Region)
+
+	p.report.Update(p.Region, func(r *report.Region) { r.Visibility = p.AmiProperties.Accessibility })
+
+	// an AMI that an earlier run published is adopted without uploading and importing the machine image again
+	var existingAmi resources.Ami
+	if progress.MachineImage == nil && progress.VolumeID == "" && progress.SnapshotID == "" && progress.SourceAmi == nil {
+		ami, found, err := findExistingAmi(ctx, ds.ExistingAmiDriver(), p.Region, p.AmiProperties)
+		if err != nil {
+			return nil, fmt.Errorf("looking up existing ami: %s", err)
+		}
+		if found {
+			p.logger.InfoContext(ctx, "skipping machine image, volume and snapshot of existing AMI", logging.AmiID(ami.ID))
+			existingAmi = ami
+		}
 	}
 
 	machineImageDriver := ds.MachineImageDriver()
-	machineImage, err := machineImageDriver.Create(machineImageDriverConfig)
-	if err != nil {
-		return nil, fmt.Errorf("creating machine image: %s", err)
-	}
+	machineImage := progress.MachineImage
+	if machineImage != nil {
+		p.logger.InfoContext(ctx, "reusing machine image from journal", "url", machineImage.GetURL)
+	} else if existingAmi.ID == "" && progress.VolumeID == "" && progress.SnapshotID == "" {
+		machineImageDriverConfig := resources.MachineImageDriverConfig{
+			MachineImagePath:     machineImageConfig.LocalPath,
+			BucketName:           p.BucketName,
+			ServerSideEncryption: p.ServerSideEncryption,
+			FileFormat:           machineImageConfig.FileFormat,
+			VolumeSizeGB:         machineImageConfig.VolumeSizeGB,
+			Tags:                 p.AmiProperties.Tags,
+		}
+
+		machineImageDriverConfig = machineImageConfig.uploadConfig(machineImageDriverConfig, p.Region, p.report)
 
-	defer func() {
-		err := machineImageDriver.Delete(machineImage)
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "upload_machine_image", tracing.Region(p.Region), tracing.S3Bucket(p.BucketName))
+		createdMachineImage, err := machineImageDriver.Create(stepCtx, machineImageDriverConfig)
+		endStep(span, err, tracing.S3Key(createdMachineImage.Key))
+		p.report.Step(p.Region, "upload_machine_image", stepStart, err)
 		if err != nil {
-			p.logger.Printf("Failed to delete machine image %s: %s", machineImage.GetURL, err)
+			return nil, fmt.Errorf("creating machine image: %s", err)
 		}
-	}()
+		machineImage = &createdMachineImage
+	}
+	machineImageConfig.SharedImage.Release(p.Region)
+
+	if machineImage != nil {
+		p.report.Update(p.Region, func(r *report.Region) {
+			r.S3Bucket = p.BucketName
+			r.S3Key = machineImage.Key
+			r.ImageReused = machineImage.Reused
+		})
+
+		defer func() {
+			if p.journal != nil && ctx.Err() != nil {
+				p.logger.InfoContext(ctx, "keeping machine image for resume", "url", machineImage.GetURL)
+				return
+			}
 
-	volumeDriverConfig := resources.VolumeDriverConfig{
-		MachineImageManifestURL: machineImage.GetURL,
+			cleanupCtx, cancel := cleanupContext(ctx)
+			defer cancel()
+
+			stepCtx, span := startStep(cleanupCtx, "delete_machine_image", tracing.Region(p.Region), tracing.S3Bucket(p.BucketName), tracing.S3Key(machineImage.Key))
+			err := machineImageDriver.Delete(stepCtx, *machineImage)
+			tracing.End(span, err)
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to delete machine image", "url", machineImage.GetURL, "error", err)
+				return
+			}
+
+			err = p.journal.Update(p.Region, func(r *journal.Region) { r.MachineImage = nil })
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to record deletion of machine image", "url", machineImage.GetURL, "error", err)
+			}
+		}()
+
+		err := machineImageConfig.recordSHA256(*machineImage, p.Region, p.report)
+		if err != nil {
+			return nil, fmt.Errorf("verifying machine image: %s", err)
+		}
 	}
 
-	volumeDriver := ds.VolumeDriver()
-	volume, err := volumeDriver.Create(volumeDriverConfig)
+	err := p.journal.Update(p.Region, func(r *journal.Region) { r.MachineImage = machineImage })
 	if err != nil {
-		return nil, fmt.Errorf("creating volume: %s", err)
+		return nil, fmt.Errorf("recording machine image: %s", err)
 	}
 
-	defer func() {
-		err := volumeDriver.Delete(volume)
-		if err != nil {
-			p.logger.Printf("Failed to delete volume %s: %s", volume.ID, err)
+	volumeDriver := ds.VolumeDriver()
+	var volume *resources.Volume
+	if progress.VolumeID != "" {
+		volume = &resources.Volume{ID: progress.VolumeID}
+		p.logger.InfoContext(ctx, "reusing volume from journal", "volume_id", volume.ID)
+	} else if existingAmi.ID == "" && progress.SnapshotID == "" {
+		volumeDriverConfig := resources.VolumeDriverConfig{
+			MachineImageManifestURL: machineImage.GetURL,
+			ConversionTaskID:        progress.ConversionTaskID,
+			Tags:                    p.AmiProperties.Tags,
+		}
+		if p.journal != nil {
+			volumeDriverConfig.ConversionTaskStarted = func(conversionTaskID string) error {
+				return p.journal.Update(p.Region, func(r *journal.Region) { r.ConversionTaskID = conversionTaskID })
+			}
 		}
-	}()
 
-	snapshotDriverConfig := resources.SnapshotDriverConfig{
-		VolumeID: volume.ID,
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "create_volume", tracing.Region(p.Region))
+		createdVolume, err := volumeDriver.Create(stepCtx, volumeDriverConfig)
+		endStep(span, err, tracing.VolumeID(createdVolume.ID))
+		p.report.Step(p.Region, "create_volume", stepStart, err)
+		if err != nil {
+			if ctx.Err() == nil {
+				// the import task did not complete, so a resume has to start a new one
+				recordErr := p.journal.Update(p.Region, func(r *journal.Region) { r.ConversionTaskID = "" })
+				if recordErr != nil {
+					p.logger.ErrorContext(ctx, "failed to record failed import volume task", "error", recordErr)
+				}
+			}
+			return nil, fmt.Errorf("creating volume: %s", err)
+		}
+		volume = &createdVolume
 	}
 
-	snapshotDriver := ds.CreateSnapshotDriver()
-	snapshot, err := snapshotDriver.Create(snapshotDriverConfig)
-	if err != nil {
-		return nil, fmt.Errorf("creating snapshot: %s", err)
+	if volume != nil {
+		defer func() {
+			if p.journal != nil && ctx.Err() != nil {
+				p.logger.InfoContext(ctx, "keeping volume for resume", "volume_id", volume.ID)
+				return
+			}
+
+			cleanupCtx, cancel := cleanupContext(ctx)
+			defer cancel()
+
+			stepCtx, span := startStep(cleanupCtx, "delete_volume", tracing.Region(p.Region), tracing.VolumeID(volume.ID))
+			err := volumeDriver.Delete(stepCtx, *volume)
+			tracing.End(span, err)
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to delete volume", "volume_id", volume.ID, "error", err)
+				return
+			}
+
+			err = p.journal.Update(p.Region, func(r *journal.Region) { r.VolumeID = "" })
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to record deletion of volume", "volume_id", volume.ID, "error", err)
+			}
+		}()
+
+		err = p.journal.Update(p.Region, func(r *journal.Region) { r.VolumeID = volume.ID })
+		if err != nil {
+			return nil, fmt.Errorf("recording volume %s: %s", volume.ID, err)
+		}
 	}
 
-	createAmiDriver := ds.CreateAmiDriver()
-	createAmiDriverConfig := resources.AmiDriverConfig{
-		SnapshotID:    snapshot.ID,
-		AmiProperties: p.AmiProperties,
+	snapshot := resources.Snapshot{ID: progress.SnapshotID}
+	if snapshot.ID != "" {
+		p.logger.InfoContext(ctx, "reusing snapshot from journal", "snapshot_id", snapshot.ID)
+	} else if existingAmi.ID == "" {
+		snapshotDriverConfig := resources.SnapshotDriverConfig{
+			VolumeID:      volume.ID,
+			AmiProperties: p.AmiProperties,
+		}
+
+		snapshotDriver := ds.CreateSnapshotDriver()
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "create_snapshot", tracing.Region(p.Region), tracing.VolumeID(volume.ID))
+		snapshot, err = snapshotDriver.Create(stepCtx, snapshotDriverConfig)
+		endStep(span, err, tracing.SnapshotID(snapshot.ID))
+		p.report.Step(p.Region, "create_snapshot", stepStart, err)
+		if err != nil {
+			return nil, fmt.Errorf("creating snapshot: %s", err)
+		}
+
+		err = machineImageConfig.verifySnapshotSize(snapshot, machineImageConfig.VolumeSizeGB)
+		if err != nil {
+			return nil, fmt.Errorf("verifying snapshot: %s", err)
+		}
+
+		err = p.journal.Update(p.Region, func(r *journal.Region) { r.SnapshotID = snapshot.ID })
+		if err != nil {
+			return nil, fmt.Errorf("recording snapshot: %s", err)
+		}
 	}
+	p.report.Update(p.Region, func(r *report.Region) { r.SnapshotID = snapshot.ID })
 
-	sourceAmi, err := createAmiDriver.Create(createAmiDriverConfig)
-	if err != nil {
-		return nil, fmt.Errorf("creating ami: %s", err)
+	var sourceAmi resources.Ami
+	if progress.SourceAmi != nil {
+		sourceAmi = *progress.SourceAmi
+		p.logger.InfoContext(ctx, "reusing AMI from journal", logging.AmiID(sourceAmi.ID))
+		p.created.addAmi(sourceAmi)
+	} else {
+		createAmiDriver := ds.CreateAmiDriver()
+		createAmiDriverConfig := resources.AmiDriverConfig{
+			SnapshotID:    snapshot.ID,
+			AmiProperties: p.AmiProperties,
+		}
+
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "create_ami", tracing.Region(p.Region), tracing.SnapshotID(snapshot.ID))
+		sourceAmi, err = createAmiDriver.Create(stepCtx, createAmiDriverConfig)
+		endStep(span, err, tracing.AmiID(sourceAmi.ID))
+		p.report.Step(p.Region, "create_ami", stepStart, err)
+		if err != nil {
+			return nil, fmt.Errorf("creating ami: %s", err)
+		}
+		p.created.addAmi(sourceAmi)
+
+		err = p.journal.Update(p.Region, func(r *journal.Region) { r.SourceAmi = &sourceAmi })
+		if err != nil {
+			return nil, fmt.Errorf("recording ami %s: %s", sourceAmi.ID, err)
+		}
 	}
+	p.report.Update(p.Region, func(r *report.Region) {
+		r.AmiID = sourceAmi.ID
+		r.AmiAdopted = sourceAmi.Adopted
+	})
 
 	amis := collection.Ami{
 		VirtualizationType: p.AmiProperties.VirtualizationType,
@@ -110,3 +278,12 @@ func (p *IsolatedRegionPublisher) Publish(ds driverset.IsolatedRegionDriverSet,
 
 	return &amis, nil
 }
+
+// Rollback removes the AMI and its snapshot created by Publish, including one
+// reused from a journal, and reports the outcome
+func (p *IsolatedRegionPublisher) Rollback(ctx context.Context, ds driverset.IsolatedRegionDriverSet) []RollbackResult {
+	ctx, span := startStep(ctx, "rollback", tracing.Region(p.Region))
+	defer span.End()
+
+	return p.created.rollbackAmis(ctx, ds.DeleteAmiDriver(), p.journal, p.Region)
+}
@@ -1,10 +1,13 @@
 package publisher_test
 
 import (
+	"context"
 	"errors"
+	"path/filepath"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driverset/driversetfakes"
+	"light-stemcell-builder/journal"
 	"light-stemcell-builder/publisher"
 	"light-stemcell-builder/resources"
 	"light-stemcell-builder/resources/resourcesfakes"
@@ -30,12 +33,16 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		Description:        "fake ami description",
 		AmiName:            "fake ami name",
 		VirtualizationType: "fake virtualization type",
+		Architecture:       "arm64",
+		Tags:               map[string]string{"distro": "fake-distro", "version": "fake-version"},
 	}
 	var fakeAmiProperties = resources.AmiProperties{
 		Name:               fakeAmiConfig.AmiName,
 		Description:        fakeAmiConfig.Description,
 		Accessibility:      fakeAmiConfig.Visibility,
 		VirtualizationType: fakeAmiConfig.VirtualizationType,
+		Architecture:       fakeAmiConfig.Architecture,
+		Tags:               fakeAmiConfig.Tags,
 	}
 
 	It("uses the provided driver set to orchestrate the creation of an AMI", func() {
@@ -53,6 +60,7 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		}
 
 		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -88,69 +96,168 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		fakeCreateAmiDriver.CreateReturns(fakeAmi, nil)
 		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
 
-		p := publisher.NewIsolatedRegionPublisher(GinkgoWriter, publisherConfig)
-		amiCollection, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		amiCollection, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		Expect(fakeDs.MachineImageDriverCallCount()).To(Equal(1), "Expected Driverset.MachineImageDriver to be called once")
 		Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(1), "Expected MachineImageDriver.Create to be called once")
-		Expect(fakeMachineImageDriver.CreateArgsForCall(0)).To(Equal(resources.MachineImageDriverConfig{
+		_, machineImageDriverConfig := fakeMachineImageDriver.CreateArgsForCall(0)
+		Expect(machineImageDriverConfig).To(Equal(resources.MachineImageDriverConfig{
 			MachineImagePath: fakeMachineImagePath,
 			BucketName:       fakeBucketName,
 			FileFormat:       machineImageConfig.FileFormat,
 			VolumeSizeGB:     fakeVolumeSizeGB,
+			Tags:             fakeAmiConfig.Tags,
 		}))
 
 		Expect(fakeDs.VolumeDriverCallCount()).To(Equal(1), "Expected Driverset.VolumeDriver to be called once")
 		Expect(fakeVolumeDriver.CreateCallCount()).To(Equal(1), "Expected VolumeDriver.Create to be called once")
-		Expect(fakeVolumeDriver.CreateArgsForCall(0)).To(Equal(resources.VolumeDriverConfig{
+		_, volumeDriverConfig := fakeVolumeDriver.CreateArgsForCall(0)
+		Expect(volumeDriverConfig).To(Equal(resources.VolumeDriverConfig{
 			MachineImageManifestURL: fakeMachineImageURL,
+			Tags:                    fakeAmiConfig.Tags,
 		}))
 
 		Expect(fakeDs.CreateSnapshotDriverCallCount()).To(Equal(1), "Expected Driverset.CreateSnapshotDriver to be called once")
 		Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(1), "Expected CreateSnapshotDriver.Create to be called once")
-		Expect(fakeSnapshotDriver.CreateArgsForCall(0)).To(Equal(resources.SnapshotDriverConfig{
-			VolumeID: fakeVolumeID,
+		_, snapshotDriverConfig := fakeSnapshotDriver.CreateArgsForCall(0)
+		Expect(snapshotDriverConfig).To(Equal(resources.SnapshotDriverConfig{
+			VolumeID:      fakeVolumeID,
+			AmiProperties: fakeAmiProperties,
 		}))
 
 		Expect(fakeDs.CreateAmiDriverCallCount()).To(Equal(1), "Expected Driverset.CreateAmiDriver to be called once")
 		Expect(fakeCreateAmiDriver.CreateCallCount()).To(Equal(1), "Expected CreateAmiDriver.Create to be called once")
-		Expect(fakeCreateAmiDriver.CreateArgsForCall(0)).To(Equal(resources.AmiDriverConfig{
+		_, createAmiDriverConfig := fakeCreateAmiDriver.CreateArgsForCall(0)
+		Expect(createAmiDriverConfig).To(Equal(resources.AmiDriverConfig{
 			SnapshotID:    fakeSnapshotID,
 			AmiProperties: fakeAmiProperties,
 		}))
 
 		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1), "Expected MachineImageDriver.Delete to be called once")
-		Expect(fakeMachineImageDriver.DeleteArgsForCall(0)).To(Equal(fakeMachineImage))
+		_, deletedMachineImage := fakeMachineImageDriver.DeleteArgsForCall(0)
+		Expect(deletedMachineImage).To(Equal(fakeMachineImage))
 
 		Expect(fakeVolumeDriver.DeleteCallCount()).To(Equal(1), "Expected VolumeDriver.Delete to be called once")
-		Expect(fakeVolumeDriver.DeleteArgsForCall(0)).To(Equal(fakeVolume))
+		_, deletedVolume := fakeVolumeDriver.DeleteArgsForCall(0)
+		Expect(deletedVolume).To(Equal(fakeVolume))
 
 		Expect(amiCollection.GetAll()).To(ConsistOf(fakeAmi))
 		Expect(amiCollection.VirtualizationType).To(Equal(fakeAmiConfig.VirtualizationType))
 	})
 
+	It("adopts an AMI published by an earlier run without uploading the machine image or creating a volume and snapshot", func() {
+		publisherConfig := publisher.Config{
+			AmiRegion: config.AmiRegion{
+				RegionName: fakeRegion,
+				BucketName: fakeBucketName,
+			},
+			AmiConfiguration: fakeAmiConfig,
+		}
+
+		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+
+		existingAmi := resources.Ami{ID: fakeAmiID, Region: fakeRegion, Adopted: true}
+		fakeExistingAmiDriver := &resourcesfakes.FakeExistingAmiDriver{}
+		fakeExistingAmiDriver.FindExistingReturns(existingAmi, true, nil)
+		fakeDs.ExistingAmiDriverReturns(fakeExistingAmiDriver)
+
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeVolumeDriver := &resourcesfakes.FakeVolumeDriver{}
+		fakeDs.VolumeDriverReturns(fakeVolumeDriver)
+
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCreateAmiDriver.CreateReturns(existingAmi, nil)
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		amiCollection, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, properties := fakeExistingAmiDriver.FindExistingArgsForCall(0)
+		Expect(properties).To(Equal(fakeAmiProperties))
+
+		Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected MachineImageDriver.Create not to be called")
+		Expect(fakeVolumeDriver.CreateCallCount()).To(Equal(0), "Expected VolumeDriver.Create not to be called")
+		Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(0), "Expected CreateSnapshotDriver.Create not to be called")
+
+		_, createAmiDriverConfig := fakeCreateAmiDriver.CreateArgsForCall(0)
+		Expect(createAmiDriverConfig.SnapshotID).To(BeEmpty())
+
+		Expect(amiCollection.GetAll()).To(ConsistOf(existingAmi))
+	})
+
 	It("returns a machine image driver error if one was returned", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		driverErr := errors.New("error in machine image driver")
 
 		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
 		fakeMachineImageDriver.CreateReturns(resources.MachineImage{}, driverErr)
 		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
 
-		p := publisher.NewIsolatedRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
 	})
 
+	It("deletes intermediate resources with a live context when the publish context is cancelled", func() {
+		publisherConfig := publisher.Config{}
+		machineImageConfig := publisher.MachineImageConfig{}
+		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+		fakeVolume := resources.Volume{ID: fakeVolumeID}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var deleteCtxErrs []error
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeMachineImageDriver.CreateReturns(resources.MachineImage{GetURL: fakeMachineImageURL}, nil)
+		fakeMachineImageDriver.DeleteStub = func(ctx context.Context, _ resources.MachineImage) error {
+			deleteCtxErrs = append(deleteCtxErrs, ctx.Err())
+			return nil
+		}
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeVolumeDriver := &resourcesfakes.FakeVolumeDriver{}
+		fakeVolumeDriver.CreateReturns(fakeVolume, nil)
+		fakeVolumeDriver.DeleteStub = func(ctx context.Context, _ resources.Volume) error {
+			deleteCtxErrs = append(deleteCtxErrs, ctx.Err())
+			return nil
+		}
+		fakeDs.VolumeDriverReturns(fakeVolumeDriver)
+
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeSnapshotDriver.CreateStub = func(ctx context.Context, _ resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+			cancel()
+			return resources.Snapshot{}, ctx.Err()
+		}
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(ctx, fakeDs, machineImageConfig)
+
+		Expect(err).To(MatchError(ContainSubstring(context.Canceled.Error())))
+		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1), "Expected MachineImageDriver.Delete to be called once")
+		Expect(fakeVolumeDriver.DeleteCallCount()).To(Equal(1), "Expected VolumeDriver.Delete to be called once")
+		Expect(deleteCtxErrs).To(ConsistOf(BeNil(), BeNil()), "Expected deletes to run with contexts that were not cancelled")
+	})
+
 	It("returns a volume driver error if one was returned", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		driverErr := errors.New("error in volume driver")
 
 		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
@@ -161,8 +268,8 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		fakeVolumeDriver.CreateReturns(resources.Volume{}, driverErr)
 		fakeDs.VolumeDriverReturns(fakeVolumeDriver)
 
-		p := publisher.NewIsolatedRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
@@ -172,6 +279,7 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		driverErr := errors.New("error in ami driver")
 
 		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
@@ -186,8 +294,8 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		fakeSnapshotDriver.CreateReturns(resources.Snapshot{}, driverErr)
 		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
 
-		p := publisher.NewIsolatedRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
@@ -197,6 +305,7 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 		fakeDs := &driversetfakes.FakeIsolatedRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		driverErr := errors.New("error in create ami driver")
 
 		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
@@ -215,10 +324,120 @@ var _ = Describe("IsolatedRegionPublisher", func() {
 		fakeAmiDriver.CreateReturns(resources.Ami{}, driverErr)
 		fakeDs.CreateAmiDriverReturns(fakeAmiDriver)
 
-		p := publisher.NewIsolatedRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
 	})
+
+	Context("with a journal", func() {
+		var (
+			publisherConfig        publisher.Config
+			j                      *journal.Journal
+			fakeDs                 *driversetfakes.FakeIsolatedRegionDriverSet
+			fakeMachineImageDriver *resourcesfakes.FakeMachineImageDriver
+			fakeVolumeDriver       *resourcesfakes.FakeVolumeDriver
+			fakeSnapshotDriver     *resourcesfakes.FakeSnapshotDriver
+			fakeMachineImage       resources.MachineImage
+		)
+
+		BeforeEach(func() {
+			var err error
+			j, err = journal.Create(filepath.Join(GinkgoT().TempDir(), "journal.json"), journal.Inputs{})
+			Expect(err).ToNot(HaveOccurred())
+
+			publisherConfig = publisher.Config{
+				AmiRegion: config.AmiRegion{
+					RegionName: fakeRegion,
+					BucketName: fakeBucketName,
+				},
+				AmiConfiguration: fakeAmiConfig,
+				Journal:          j,
+			}
+
+			fakeMachineImage = resources.MachineImage{GetURL: fakeMachineImageURL}
+
+			fakeDs = &driversetfakes.FakeIsolatedRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+
+			fakeMachineImageDriver = &resourcesfakes.FakeMachineImageDriver{}
+			fakeMachineImageDriver.CreateReturns(fakeMachineImage, nil)
+			fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+			fakeVolumeDriver = &resourcesfakes.FakeVolumeDriver{}
+			fakeVolumeDriver.CreateReturns(resources.Volume{ID: fakeVolumeID}, nil)
+			fakeDs.VolumeDriverReturns(fakeVolumeDriver)
+
+			fakeSnapshotDriver = &resourcesfakes.FakeSnapshotDriver{}
+			fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID}, nil)
+			fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+			fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+		})
+
+		It("resumes an import volume task recorded by an earlier run", func() {
+			Expect(j.Update(fakeRegion, func(r *journal.Region) {
+				r.MachineImage = &fakeMachineImage
+				r.ConversionTaskID = "fake conversion task id"
+			})).To(Succeed())
+
+			p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected the recorded machine image to be reused")
+			Expect(fakeVolumeDriver.CreateCallCount()).To(Equal(1), "Expected VolumeDriver.Create to be called once")
+			_, volumeDriverConfig := fakeVolumeDriver.CreateArgsForCall(0)
+			Expect(volumeDriverConfig.MachineImageManifestURL).To(Equal(fakeMachineImageURL))
+			Expect(volumeDriverConfig.ConversionTaskID).To(Equal("fake conversion task id"))
+
+			progress := j.Region(fakeRegion)
+			Expect(progress.MachineImage).To(BeNil(), "Expected the deleted machine image to be removed from the journal")
+			Expect(progress.VolumeID).To(BeEmpty(), "Expected the deleted volume to be removed from the journal")
+			Expect(progress.SnapshotID).To(Equal(fakeSnapshotID))
+			Expect(progress.SourceAmi).To(Equal(&resources.Ami{ID: fakeAmiID, Region: fakeRegion}))
+		})
+
+		It("snapshots a volume recorded by an earlier run without uploading the machine image again", func() {
+			Expect(j.Update(fakeRegion, func(r *journal.Region) { r.VolumeID = fakeVolumeID })).To(Succeed())
+
+			p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected no machine image to be uploaded")
+			Expect(fakeVolumeDriver.CreateCallCount()).To(Equal(0), "Expected no volume to be created")
+
+			_, snapshotDriverConfig := fakeSnapshotDriver.CreateArgsForCall(0)
+			Expect(snapshotDriverConfig.VolumeID).To(Equal(fakeVolumeID))
+
+			Expect(fakeVolumeDriver.DeleteCallCount()).To(Equal(1), "Expected the recorded volume to be deleted")
+			_, deletedVolume := fakeVolumeDriver.DeleteArgsForCall(0)
+			Expect(deletedVolume).To(Equal(resources.Volume{ID: fakeVolumeID}))
+		})
+
+		It("removes the AMI it created when rolled back", func() {
+			fakeDeleteAmiDriver := &resourcesfakes.FakeDeleteAmiDriver{}
+			fakeDs.DeleteAmiDriverReturns(fakeDeleteAmiDriver)
+
+			p := publisher.NewIsolatedRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+			Expect(err).ToNot(HaveOccurred())
+
+			results := p.Rollback(context.Background(), fakeDs)
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Err).ToNot(HaveOccurred())
+
+			Expect(fakeDeleteAmiDriver.DeleteCallCount()).To(Equal(1), "Expected DeleteAmiDriver.Delete to be called once")
+			_, deletedAmi := fakeDeleteAmiDriver.DeleteArgsForCall(0)
+			Expect(deletedAmi).To(Equal(resources.Ami{ID: fakeAmiID, Region: fakeRegion}))
+
+			progress := j.Region(fakeRegion)
+			Expect(progress.SourceAmi).To(BeNil(), "Expected the removed AMI to be removed from the journal")
+			Expect(progress.SnapshotID).To(BeEmpty())
+		})
+	})
 })
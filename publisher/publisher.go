@@ -1,16 +1,254 @@
 package publisher
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
 	"light-stemcell-builder/config"
+	"light-stemcell-builder/journal"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/report"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
+	"light-stemcell-builder/upload"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// cleanupTimeout bounds the deletion of intermediate resources once Publish returns
+const cleanupTimeout = 5 * time.Minute
+
+const gbInBytes = 1 << 30
+
 type Config struct {
 	config.AmiRegion
 	config.AmiConfiguration //nolint:govet
+
+	// Journal records each completed step so an interrupted publish can be resumed. It may be nil.
+	Journal *journal.Journal
+
+	// Report collects the outcome of each step for the publish report. It may be nil.
+	Report *report.Report
 }
 
 type MachineImageConfig struct {
 	LocalPath    string
 	FileFormat   string
 	VolumeSizeGB int64
+
+	Upload resources.UploadSettings
+	// SharedImage lets the uploads of all regions share a single read of the machine image. It may be nil.
+	SharedImage *upload.SharedFile
+	// ImageSHA256 is the SHA-256 checksum of the machine image, computed once for all regions. The image is
+	// uploaded to a key derived from it. It may be empty.
+	ImageSHA256 string
+	// VerifySnapshotSize makes a publish fail when a new snapshot is not the size of the volume of the machine image
+	VerifySnapshotSize bool
+	// KeepUploadedImage leaves the uploaded machine image in the bucket for later runs to reuse
+	KeepUploadedImage bool
+}
+
+// recordSHA256 records the checksum of the machine image uploaded for region
+func (c MachineImageConfig) recordSHA256(machineImage resources.MachineImage, region string, r *report.Report) error {
+	if machineImage.SHA256 == "" {
+		return nil
+	}
+
+	r.Update(region, func(reportRegion *report.Region) { reportRegion.ImageSHA256 = machineImage.SHA256 })
+	return c.SharedImage.RecordSHA256(machineImage.SHA256)
+}
+
+// verifySnapshotSize returns an error when the volume of snapshot is not the size of the volume of the machine
+// image, which is volumeSizeGB if it is set and the size of the image rounded up to whole GB otherwise
+func (c MachineImageConfig) verifySnapshotSize(snapshot resources.Snapshot, volumeSizeGB int64) error {
+	if !c.VerifySnapshotSize {
+		return nil
+	}
+
+	if volumeSizeGB == 0 {
+		info, err := os.Stat(c.LocalPath)
+		if err != nil {
+			return fmt.Errorf("reading size of machine image: %s", err)
+		}
+		volumeSizeGB = max((info.Size()+gbInBytes-1)/gbInBytes, 1)
+	}
+
+	if snapshot.VolumeSizeGB != volumeSizeGB {
+		return fmt.Errorf("snapshot %s has a volume of %d GB, but the machine image %s needs %d GB", snapshot.ID, snapshot.VolumeSizeGB, c.LocalPath, volumeSizeGB)
+	}
+
+	return nil
+}
+
+// uploadConfig sets up the upload of the machine image of region in driverConfig, and records its progress in r.
+// An image with a checksum is uploaded to a key derived from it.
+func (c MachineImageConfig) uploadConfig(driverConfig resources.MachineImageDriverConfig, region string, r *report.Report) resources.MachineImageDriverConfig {
+	driverConfig.Upload = c.Upload
+	driverConfig.KeepUploadedImage = c.KeepUploadedImage
+	driverConfig.ImageSHA256 = c.ImageSHA256
+
+	if c.SharedImage != nil {
+		driverConfig.OpenMachineImage = func() (io.ReadCloser, error) {
+			return c.SharedImage.Open(region)
+		}
+	}
+
+	if r != nil {
+		driverConfig.UploadProgress = func(progress resources.UploadProgress) {
+			r.UploadProgress(region, progress.TotalBytes, report.UploadProgress{
+				Time:        time.Now().UTC(),
+				BytesSent:   progress.BytesSent,
+				MBPerSecond: progress.BytesPerSecond / (1 << 20),
+				ETASeconds:  progress.ETA.Seconds(),
+			})
+		}
+	}
+
+	return driverConfig
+}
+
+// startStep starts the span of step and returns a context that adds step to the records logged with it
+func startStep(ctx context.Context, step string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(logging.WithStep(ctx, step), step, attrs...)
+}
+
+// endStep ends the span of a step. The attributes of the resources the step created are only added when it succeeded.
+func endStep(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	if err == nil {
+		span.SetAttributes(attrs...)
+	}
+	tracing.End(span, err)
+}
+
+// cleanupContext returns a context for deleting intermediate resources. It is
+// not cancelled along with ctx, so cleanup still runs after an interrupt or
+// once the publish deadline has passed.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// RollbackResult is the outcome of removing one resource that a Publish created
+type RollbackResult struct {
+	Resource string
+	Region   string
+	Err      error
+}
+
+func (r RollbackResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("could not remove %s in %s: %s", r.Resource, r.Region, r.Err)
+	}
+	return fmt.Sprintf("removed %s in %s", r.Resource, r.Region)
+}
+
+// createdResources tracks the AMIs and KMS aliases of a Publish so that Rollback can remove them
+type createdResources struct {
+	mu         sync.Mutex
+	amis       []resources.Ami
+	kmsAliases []string
+}
+
+func (c *createdResources) addAmi(ami resources.Ami) {
+	// an adopted AMI existed before the run, so a rollback leaves it alone
+	if ami.Adopted {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.amis = append(c.amis, ami)
+}
+
+func (c *createdResources) addKmsAlias(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kmsAliases = append(c.kmsAliases, name)
+}
+
+// rollbackAmis removes AMIs in the reverse order of their creation, so copies go before their source
+func (c *createdResources) rollbackAmis(ctx context.Context, driver resources.DeleteAmiDriver, j *journal.Journal, region string) []RollbackResult {
+	c.mu.Lock()
+	amis := append([]resources.Ami(nil), c.amis...)
+	c.mu.Unlock()
+
+	var results []RollbackResult
+	for i := len(amis) - 1; i >= 0; i-- {
+		ami := amis[i]
+		deleteCtx, span := tracing.Start(ctx, "delete_ami", tracing.Region(ami.Region), tracing.AmiID(ami.ID))
+		err := driver.Delete(deleteCtx, ami)
+		tracing.End(span, err)
+		if err == nil {
+			c.mu.Lock()
+			c.amis = removeAmi(c.amis, ami.ID)
+			c.mu.Unlock()
+
+			recordErr := j.Update(region, func(r *journal.Region) { r.RemoveAmi(ami.ID) })
+			if recordErr != nil {
+				err = fmt.Errorf("recording removal in journal: %s", recordErr)
+			}
+		}
+
+		results = append(results, RollbackResult{
+			Resource: fmt.Sprintf("AMI %s and its snapshots", ami.ID),
+			Region:   ami.Region,
+			Err:      err,
+		})
+	}
+
+	return results
+}
+
+// rollbackKmsAliases removes the KMS aliases created in region
+func (c *createdResources) rollbackKmsAliases(ctx context.Context, driver resources.KmsDriver, region string) []RollbackResult {
+	c.mu.Lock()
+	aliases := c.kmsAliases
+	c.kmsAliases = nil
+	c.mu.Unlock()
+
+	var results []RollbackResult
+	for _, alias := range aliases {
+		deleteCtx, span := tracing.Start(ctx, "delete_kms_alias", tracing.Region(region), tracing.KmsKeyAlias(alias))
+		err := driver.DeleteAlias(deleteCtx, resources.KmsDeleteAliasDriverConfig{
+			KmsKeyAliasName: alias,
+			Region:          region,
+		})
+		tracing.End(span, err)
+		if err != nil {
+			c.addKmsAlias(alias)
+		}
+
+		results = append(results, RollbackResult{
+			Resource: fmt.Sprintf("KMS alias %s", alias),
+			Region:   region,
+			Err:      err,
+		})
+	}
+
+	return results
+}
+
+func removeAmi(amis []resources.Ami, id string) []resources.Ami {
+	var remaining []resources.Ami
+	for _, ami := range amis {
+		if ami.ID != id {
+			remaining = append(remaining, ami)
+		}
+	}
+	return remaining
+}
+
+// findExistingAmi looks up an AMI that an earlier run published with properties, so that a region is not uploaded
+// and imported again only for its AMI to be adopted
+func findExistingAmi(ctx context.Context, d resources.ExistingAmiDriver, region string, properties resources.AmiProperties) (resources.Ami, bool, error) {
+	stepCtx, span := startStep(ctx, "find_existing_ami", tracing.Region(region))
+	ami, found, err := d.FindExisting(stepCtx, properties)
+	endStep(span, err, tracing.AmiID(ami.ID))
+	return ami, found, err
 }
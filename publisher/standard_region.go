@@ -1,15 +1,20 @@
 package publisher
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"light-stemcell-builder/collection"
+	"light-stemcell-builder/config"
 	"light-stemcell-builder/driverset"
+	"light-stemcell-builder/journal"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/report"
 	"light-stemcell-builder/resources"
+	"light-stemcell-builder/tracing"
 )
 
 type StandardRegionPublisher struct {
@@ -18,93 +23,257 @@ type StandardRegionPublisher struct {
 	ServerSideEncryption string
 	AmiProperties        resources.AmiProperties
 	CopyDestinations     []string
-	logger               *log.Logger
+	// DestinationAmiProperties are the properties of the copy to each destination,
+	// which differ from AmiProperties when the destination overrides them
+	DestinationAmiProperties map[string]resources.AmiProperties
+	SnapshotMethod           string
+	journal                  *journal.Journal
+	report                   *report.Report
+	created                  createdResources
+	logger                   *slog.Logger
 }
 
-func NewStandardRegionPublisher(logDest io.Writer, c Config) *StandardRegionPublisher {
+func NewStandardRegionPublisher(logger *slog.Logger, c Config) *StandardRegionPublisher {
+	destinationAmiProperties := map[string]resources.AmiProperties{}
+	for _, destination := range c.Destinations {
+		destinationAmiProperties[destination.RegionName] = standardAmiProperties(destination.AmiConfiguration.Apply(c.AmiConfiguration))
+	}
+
 	return &StandardRegionPublisher{
-		Region:               c.RegionName,
-		BucketName:           c.BucketName,
-		ServerSideEncryption: c.ServerSideEncryption,
-		CopyDestinations:     c.Destinations,
-		AmiProperties: resources.AmiProperties{
-			Name:               c.AmiName,
-			Description:        c.Description,
-			Accessibility:      c.Visibility,
-			VirtualizationType: c.VirtualizationType,
-			Efi:                c.Efi,
-			Encrypted:          c.Encrypted,
-			KmsKeyId:           c.KmsKeyId,
-			KmsKeyAliasName:    c.KmsKeyAliasName,
-			Tags:               c.Tags,
-			SharedWithAccounts: c.SharedWithAccounts,
-		},
-		logger: log.New(logDest, "StandardRegionPublisher ", log.LstdFlags),
+		Region:                   c.RegionName,
+		BucketName:               c.BucketName,
+		ServerSideEncryption:     c.ServerSideEncryption,
+		CopyDestinations:         c.DestinationNames(),
+		DestinationAmiProperties: destinationAmiProperties,
+		SnapshotMethod:           c.SnapshotMethod,
+		AmiProperties:            standardAmiProperties(c.AmiConfiguration),
+		journal:                  c.Journal,
+		report:                   c.Report,
+		logger:                   logger.With(logging.Region(c.RegionName)),
+	}
+}
+
+func standardAmiProperties(c config.AmiConfiguration) resources.AmiProperties {
+	return resources.AmiProperties{
+		Name:               c.AmiName,
+		Description:        c.Description,
+		Accessibility:      c.Visibility,
+		VirtualizationType: c.VirtualizationType,
+		Architecture:       c.Architecture,
+		Efi:                c.Efi,
+		Encrypted:          c.Encrypted,
+		KmsKeyId:           c.KmsKeyId,
+		KmsKeyAliasName:    c.KmsKeyAliasName,
+		Tags:               c.Tags,
+		SharedWithAccounts: c.SharedWithAccounts,
 	}
 }
 
-func (p *StandardRegionPublisher) Publish(ds driverset.StandardRegionDriverSet, machineImageConfig MachineImageConfig) (*collection.Ami, error) {
+func (p *StandardRegionPublisher) Publish(ctx context.Context, ds driverset.StandardRegionDriverSet, machineImageConfig MachineImageConfig) (*collection.Ami, error) {
 
 	createStartTime := time.Now()
 	defer func(startTime time.Time) {
-		p.logger.Printf("completed Publish() in %f minutes\n", time.Since(startTime).Minutes())
+		p.logger.InfoContext(ctx, "completed Publish()", "duration", time.Since(startTime))
 	}(createStartTime)
 
-	machineImageDriverConfig := resources.MachineImageDriverConfig{
-		MachineImagePath:     machineImageConfig.LocalPath,
-		FileFormat:           machineImageConfig.FileFormat,
-		BucketName:           p.BucketName,
-		ServerSideEncryption: p.ServerSideEncryption,
+	// the machine image is read once every region opened it for its upload or released it
+	defer machineImageConfig.SharedImage.Release(p.Region)
+
+	progress := p.journal.Region(p.Region)
+
+	p.report.Update(p.Region, func(r *report.Region) {
+		r.Visibility = p.AmiProperties.Accessibility
+		r.Encrypted = p.AmiProperties.Encrypted
+		r.KmsKeyArn = p.AmiProperties.KmsKeyId
+		r.SharedWithAccounts = p.AmiProperties.SharedWithAccounts
+	})
+
+	// an AMI that an earlier run published is adopted without uploading and importing the machine image again
+	var existingAmi resources.Ami
+	if progress.MachineImage == nil && progress.SnapshotID == "" && progress.SourceAmi == nil {
+		ami, found, err := findExistingAmi(ctx, ds.ExistingAmiDriver(), p.Region, p.AmiProperties)
+		if err != nil {
+			return nil, fmt.Errorf("looking up existing ami: %s", err)
+		}
+		if found {
+			p.logger.InfoContext(ctx, "skipping machine image and snapshot of existing AMI", logging.AmiID(ami.ID))
+			existingAmi = ami
+		}
 	}
 
 	machineImageDriver := ds.MachineImageDriver()
-	machineImage, err := machineImageDriver.Create(machineImageDriverConfig)
-	if err != nil {
-		return nil, fmt.Errorf("creating machine image: %s", err)
-	}
-	defer func() {
-		err := machineImageDriver.Delete(machineImage)
+	machineImage := progress.MachineImage
+	if machineImage != nil {
+		p.logger.InfoContext(ctx, "reusing machine image from journal", "url", machineImage.GetURL)
+	} else if existingAmi.ID == "" && progress.SnapshotID == "" && p.SnapshotMethod != config.EbsDirectSnapshotMethod {
+		machineImageDriverConfig := resources.MachineImageDriverConfig{
+			MachineImagePath:     machineImageConfig.LocalPath,
+			FileFormat:           machineImageConfig.FileFormat,
+			BucketName:           p.BucketName,
+			ServerSideEncryption: p.ServerSideEncryption,
+			Tags:                 p.AmiProperties.Tags,
+		}
+
+		machineImageDriverConfig = machineImageConfig.uploadConfig(machineImageDriverConfig, p.Region, p.report)
+
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "upload_machine_image", tracing.Region(p.Region), tracing.S3Bucket(p.BucketName))
+		createdMachineImage, err := machineImageDriver.Create(stepCtx, machineImageDriverConfig)
+		endStep(span, err, tracing.S3Key(createdMachineImage.Key))
+		p.report.Step(p.Region, "upload_machine_image", stepStart, err)
 		if err != nil {
-			p.logger.Printf("Failed to delete machine image %s: %s", machineImage.GetURL, err)
-		}
-	}()
-
-	//As of 7.11.2023 AWS is not supporting a snapshot creation with a multi region kms key ARN - even though it is documented.
-	//As workaround one has to create an alias for the provides kms key and use the alias ARN during the snapshot creation later on.
-	kmsAlias, err := ds.KmsDriver().CreateAlias(
-		resources.KmsCreateAliasDriverConfig{
-			KmsKeyAliasName: p.AmiProperties.KmsKeyAliasName,
-			KmsKeyId:        p.AmiProperties.KmsKeyId,
-			Region:          p.Region,
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("creating KMS alias: %s", err)
+			return nil, fmt.Errorf("creating machine image: %s", err)
+		}
+		machineImage = &createdMachineImage
 	}
+	machineImageConfig.SharedImage.Release(p.Region)
+
+	if machineImage != nil {
+		p.report.Update(p.Region, func(r *report.Region) {
+			r.S3Bucket = p.BucketName
+			r.S3Key = machineImage.Key
+			r.ImageReused = machineImage.Reused
+		})
 
-	snapshotDriverConfig := resources.SnapshotDriverConfig{
-		MachineImageURL: machineImage.GetURL,
-		FileFormat:      machineImageConfig.FileFormat,
-		AmiProperties:   p.AmiProperties,
-		KmsAlias:        kmsAlias,
+		defer func() {
+			if p.journal != nil && ctx.Err() != nil {
+				p.logger.InfoContext(ctx, "keeping machine image for resume", "url", machineImage.GetURL)
+				return
+			}
+
+			cleanupCtx, cancel := cleanupContext(ctx)
+			defer cancel()
+
+			stepCtx, span := startStep(cleanupCtx, "delete_machine_image", tracing.Region(p.Region), tracing.S3Bucket(p.BucketName), tracing.S3Key(machineImage.Key))
+			err := machineImageDriver.Delete(stepCtx, *machineImage)
+			tracing.End(span, err)
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to delete machine image", "url", machineImage.GetURL, "error", err)
+				return
+			}
+
+			err = p.journal.Update(p.Region, func(r *journal.Region) { r.MachineImage = nil })
+			if err != nil {
+				p.logger.ErrorContext(ctx, "failed to record deletion of machine image", "url", machineImage.GetURL, "error", err)
+			}
+		}()
+
+		err := machineImageConfig.recordSHA256(*machineImage, p.Region, p.report)
+		if err != nil {
+			return nil, fmt.Errorf("verifying machine image: %s", err)
+		}
 	}
 
-	snapshotDriver := ds.CreateSnapshotDriver()
-	snapshot, err := snapshotDriver.Create(snapshotDriverConfig)
+	err := p.journal.Update(p.Region, func(r *journal.Region) { r.MachineImage = machineImage })
 	if err != nil {
-		return nil, fmt.Errorf("creating snapshot: %s", err)
+		return nil, fmt.Errorf("recording machine image: %s", err)
 	}
 
-	createAmiDriver := ds.CreateAmiDriver()
-	createAmiDriverConfig := resources.AmiDriverConfig{
-		SnapshotID:    snapshot.ID,
-		AmiProperties: p.AmiProperties,
+	snapshot := resources.Snapshot{ID: progress.SnapshotID}
+	if snapshot.ID != "" {
+		p.logger.InfoContext(ctx, "reusing snapshot from journal", "snapshot_id", snapshot.ID)
+	} else if existingAmi.ID == "" {
+		//As of 7.11.2023 AWS is not supporting a snapshot creation with a multi region kms key ARN - even though it is documented.
+		//As workaround one has to create an alias for the provides kms key and use the alias ARN during the snapshot creation later on.
+		stepCtx, span := startStep(ctx, "create_kms_alias", tracing.Region(p.Region), tracing.KmsKeyAlias(p.AmiProperties.KmsKeyAliasName))
+		kmsAlias, err := ds.KmsDriver().CreateAlias(
+			stepCtx,
+			resources.KmsCreateAliasDriverConfig{
+				KmsKeyAliasName: p.AmiProperties.KmsKeyAliasName,
+				KmsKeyId:        p.AmiProperties.KmsKeyId,
+				Region:          p.Region,
+			},
+		)
+		tracing.End(span, err)
+		if err != nil {
+			return nil, fmt.Errorf("creating KMS alias: %s", err)
+		}
+		if kmsAlias.Created {
+			p.created.addKmsAlias(p.AmiProperties.KmsKeyAliasName)
+		}
+		p.report.Update(p.Region, func(r *report.Region) { r.KmsKeyAliasArn = kmsAlias.ARN })
+
+		snapshotDriverConfig := resources.SnapshotDriverConfig{
+			MachineImagePath: machineImageConfig.LocalPath,
+			FileFormat:       machineImageConfig.FileFormat,
+			AmiProperties:    p.AmiProperties,
+			KmsAlias:         kmsAlias,
+			ImportTaskID:     progress.ImportTaskID,
+		}
+		if machineImage != nil {
+			snapshotDriverConfig.MachineImageURL = machineImage.GetURL
+		}
+		if p.journal != nil {
+			snapshotDriverConfig.ImportTaskStarted = func(importTaskID string) error {
+				return p.journal.Update(p.Region, func(r *journal.Region) { r.ImportTaskID = importTaskID })
+			}
+		}
+
+		snapshotDriver := ds.CreateSnapshotDriver()
+		stepStart := time.Now()
+		stepCtx, span = startStep(ctx, "create_snapshot", tracing.Region(p.Region))
+		snapshot, err = snapshotDriver.Create(stepCtx, snapshotDriverConfig)
+		endStep(span, err, tracing.SnapshotID(snapshot.ID))
+		p.report.Step(p.Region, "create_snapshot", stepStart, err)
+		if err != nil {
+			if ctx.Err() == nil {
+				// the import task did not complete, so a resume has to start a new one
+				recordErr := p.journal.Update(p.Region, func(r *journal.Region) { r.ImportTaskID = "" })
+				if recordErr != nil {
+					p.logger.ErrorContext(ctx, "failed to record failed import snapshot task", "error", recordErr)
+				}
+			}
+			return nil, fmt.Errorf("creating snapshot: %s", err)
+		}
+
+		// the import of other formats than RAW is as large as their volume size
+		var volumeSizeGB int64
+		if machineImageConfig.FileFormat != resources.VolumeRawFormat {
+			volumeSizeGB = machineImageConfig.VolumeSizeGB
+		}
+		err = machineImageConfig.verifySnapshotSize(snapshot, volumeSizeGB)
+		if err != nil {
+			return nil, fmt.Errorf("verifying snapshot: %s", err)
+		}
+
+		err = p.journal.Update(p.Region, func(r *journal.Region) { r.SnapshotID = snapshot.ID })
+		if err != nil {
+			return nil, fmt.Errorf("recording snapshot: %s", err)
+		}
 	}
+	p.report.Update(p.Region, func(r *report.Region) { r.SnapshotID = snapshot.ID })
 
-	sourceAmi, err := createAmiDriver.Create(createAmiDriverConfig)
-	if err != nil {
-		return nil, fmt.Errorf("creating ami: %s", err)
+	var sourceAmi resources.Ami
+	if progress.SourceAmi != nil {
+		sourceAmi = *progress.SourceAmi
+		p.logger.InfoContext(ctx, "reusing AMI from journal", logging.AmiID(sourceAmi.ID))
+		p.created.addAmi(sourceAmi)
+	} else {
+		createAmiDriver := ds.CreateAmiDriver()
+		createAmiDriverConfig := resources.AmiDriverConfig{
+			SnapshotID:    snapshot.ID,
+			AmiProperties: p.AmiProperties,
+		}
+
+		stepStart := time.Now()
+		stepCtx, span := startStep(ctx, "create_ami", tracing.Region(p.Region), tracing.SnapshotID(snapshot.ID))
+		sourceAmi, err = createAmiDriver.Create(stepCtx, createAmiDriverConfig)
+		endStep(span, err, tracing.AmiID(sourceAmi.ID))
+		p.report.Step(p.Region, "create_ami", stepStart, err)
+		if err != nil {
+			return nil, fmt.Errorf("creating ami: %s", err)
+		}
+		p.created.addAmi(sourceAmi)
+
+		err = p.journal.Update(p.Region, func(r *journal.Region) { r.SourceAmi = &sourceAmi })
+		if err != nil {
+			return nil, fmt.Errorf("recording ami %s: %s", sourceAmi.ID, err)
+		}
 	}
+	p.report.Update(p.Region, func(r *report.Region) {
+		r.AmiID = sourceAmi.ID
+		r.AmiAdopted = sourceAmi.Adopted
+	})
 
 	amis := collection.Ami{
 		VirtualizationType: p.AmiProperties.VirtualizationType,
@@ -122,32 +291,81 @@ func (p *StandardRegionPublisher) Publish(ds driverset.StandardRegionDriverSet,
 		go func(dstRegion string) {
 			defer procGroup.Done()
 
-			kmsKey, err := ds.KmsDriver().ReplicateKey(
-				resources.KmsReplicateKeyDriverConfig{
-					KmsKeyId:     p.AmiProperties.KmsKeyId,
-					SourceRegion: p.Region,
-					TargetRegion: dstRegion,
-				},
-			)
-			if err != nil {
-				errCol.Add(fmt.Errorf("failed to replicate KMS key: %s", err))
+			if copiedAmi, ok := progress.CopiedAmis[dstRegion]; ok {
+				p.logger.InfoContext(ctx, "reusing copied AMI from journal", logging.AmiID(copiedAmi.ID), "destination_region", dstRegion)
+				p.created.addAmi(copiedAmi)
+				amis.Add(copiedAmi)
+				p.report.Update(p.Region, func(r *report.Region) {
+					r.Copies = append(r.Copies, report.Copy{Region: dstRegion, AmiID: copiedAmi.ID, Adopted: copiedAmi.Adopted})
+				})
 				return
 			}
 
+			copyStart := time.Now()
+			reportCopyErr := func(err error) {
+				p.report.Update(p.Region, func(r *report.Region) {
+					r.Copies = append(r.Copies, report.Copy{Region: dstRegion, DurationSeconds: time.Since(copyStart).Seconds(), Error: err.Error()})
+				})
+				errCol.Add(err)
+			}
+
+			amiProperties, ok := p.DestinationAmiProperties[dstRegion]
+			if !ok {
+				amiProperties = p.AmiProperties
+			}
+
+			stepCtx, span := startStep(ctx, "copy_ami", tracing.Region(p.Region), tracing.DestinationRegion(dstRegion), tracing.AmiID(sourceAmi.ID))
+
+			// a destination with its own KMS key uses it as is, otherwise the key of the source region is replicated
+			kmsKey := resources.KmsKey{ARN: amiProperties.KmsKeyId}
+			if amiProperties.KmsKeyId == p.AmiProperties.KmsKeyId {
+				var err error
+				kmsKey, err = ds.KmsDriver().ReplicateKey(
+					stepCtx,
+					resources.KmsReplicateKeyDriverConfig{
+						KmsKeyId:     p.AmiProperties.KmsKeyId,
+						SourceRegion: p.Region,
+						TargetRegion: dstRegion,
+					},
+				)
+				if err != nil {
+					tracing.End(span, err)
+					reportCopyErr(fmt.Errorf("failed to replicate KMS key: %s", err))
+					return
+				}
+			}
+
 			copiedAmi, copyErr := copyAmiDriver.Create(
+				stepCtx,
 				resources.AmiDriverConfig{
 					ExistingAmiID:     sourceAmi.ID,
 					DestinationRegion: dstRegion,
-					AmiProperties:     p.AmiProperties,
+					AmiProperties:     amiProperties,
 					KmsKey:            kmsKey,
 				},
 			)
+			endStep(span, copyErr, tracing.DestinationAmiID(copiedAmi.ID))
 			if copyErr != nil {
-				errCol.Add(fmt.Errorf("copying source ami: %s to destination region: %s: %s", sourceAmi.ID, dstRegion, copyErr))
+				reportCopyErr(fmt.Errorf("copying source ami: %s to destination region: %s: %s", sourceAmi.ID, dstRegion, copyErr))
 				return
 			}
 
+			p.created.addAmi(copiedAmi)
 			amis.Add(copiedAmi)
+			p.report.Update(p.Region, func(r *report.Region) {
+				r.Copies = append(r.Copies, report.Copy{
+					Region:          dstRegion,
+					AmiID:           copiedAmi.ID,
+					Adopted:         copiedAmi.Adopted,
+					KmsKeyArn:       kmsKey.ARN,
+					DurationSeconds: time.Since(copyStart).Seconds(),
+				})
+			})
+
+			err := p.journal.Update(p.Region, func(r *journal.Region) { r.CopiedAmis[dstRegion] = copiedAmi })
+			if err != nil {
+				errCol.Add(fmt.Errorf("recording copied ami %s: %s", copiedAmi.ID, err))
+			}
 		}(p.CopyDestinations[i])
 	}
 
@@ -155,3 +373,13 @@ func (p *StandardRegionPublisher) Publish(ds driverset.StandardRegionDriverSet,
 
 	return &amis, errCol.Error()
 }
+
+// Rollback removes the AMIs, their snapshots and the KMS aliases created by
+// Publish, including those reused from a journal, and reports the outcome for each
+func (p *StandardRegionPublisher) Rollback(ctx context.Context, ds driverset.StandardRegionDriverSet) []RollbackResult {
+	ctx, span := startStep(ctx, "rollback", tracing.Region(p.Region))
+	defer span.End()
+
+	results := p.created.rollbackAmis(ctx, ds.DeleteAmiDriver(), p.journal, p.Region)
+	return append(results, p.created.rollbackKmsAliases(ctx, ds.KmsDriver(), p.Region)...)
+}
@@ -1,16 +1,32 @@
 package publisher_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
 
 	"light-stemcell-builder/config"
 	"light-stemcell-builder/driverset/driversetfakes"
+	"light-stemcell-builder/journal"
 	"light-stemcell-builder/publisher"
+	"light-stemcell-builder/report"
 	"light-stemcell-builder/resources"
 	"light-stemcell-builder/resources/resourcesfakes"
+	"light-stemcell-builder/upload"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var _ = Describe("StandardRegionPublisher", func() {
@@ -33,6 +49,7 @@ var _ = Describe("StandardRegionPublisher", func() {
 		Description:        "fake ami description",
 		AmiName:            "fake ami name",
 		VirtualizationType: "fake virtualization type",
+		Architecture:       "arm64",
 	}
 
 	var fakeAmiProperties = resources.AmiProperties{
@@ -40,6 +57,7 @@ var _ = Describe("StandardRegionPublisher", func() {
 		Description:        fakeAmiConfig.Description,
 		Accessibility:      fakeAmiConfig.Visibility,
 		VirtualizationType: fakeAmiConfig.VirtualizationType,
+		Architecture:       fakeAmiConfig.Architecture,
 	}
 
 	var fakeKmsAlias = resources.KmsAlias{
@@ -55,7 +73,7 @@ var _ = Describe("StandardRegionPublisher", func() {
 			AmiRegion: config.AmiRegion{
 				RegionName:   fakeRegion,
 				BucketName:   fakeBucketName,
-				Destinations: []string{fakeCopyDestination},
+				Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
 			},
 			AmiConfiguration: fakeAmiConfig,
 		}
@@ -65,6 +83,7 @@ var _ = Describe("StandardRegionPublisher", func() {
 		}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -103,13 +122,14 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeCopyAmiDriver.CreateReturns(fakeCopiedAmi, nil)
 		fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		amiCollection, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		amiCollection, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 		Expect(err).ToNot(HaveOccurred())
 
 		Expect(fakeDs.MachineImageDriverCallCount()).To(Equal(1), "Expected Driverset.MachineImageDriver to be called once")
 		Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(1), "Expected MachineImageDriver.Create to be called once")
-		Expect(fakeMachineImageDriver.CreateArgsForCall(0)).To(Equal(resources.MachineImageDriverConfig{
+		_, machineImageDriverConfig := fakeMachineImageDriver.CreateArgsForCall(0)
+		Expect(machineImageDriverConfig).To(Equal(resources.MachineImageDriverConfig{
 			MachineImagePath: fakeMachineImagePath,
 			FileFormat:       resources.VolumeRawFormat,
 			BucketName:       fakeBucketName,
@@ -117,16 +137,19 @@ var _ = Describe("StandardRegionPublisher", func() {
 
 		Expect(fakeDs.CreateSnapshotDriverCallCount()).To(Equal(1), "Expected Driverset.CreateSnapshotDriver to be called once")
 		Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(1), "Expected CreateSnapshotDriver.Create to be called once")
-		Expect(fakeSnapshotDriver.CreateArgsForCall(0)).To(Equal(resources.SnapshotDriverConfig{
-			MachineImageURL: fakeMachineImageURL,
-			FileFormat:      resources.VolumeRawFormat,
-			AmiProperties:   fakeAmiProperties,
-			KmsAlias:        fakeKmsAlias,
+		_, snapshotDriverConfig := fakeSnapshotDriver.CreateArgsForCall(0)
+		Expect(snapshotDriverConfig).To(Equal(resources.SnapshotDriverConfig{
+			MachineImagePath: fakeMachineImagePath,
+			MachineImageURL:  fakeMachineImageURL,
+			FileFormat:       resources.VolumeRawFormat,
+			AmiProperties:    fakeAmiProperties,
+			KmsAlias:         fakeKmsAlias,
 		}))
 
 		Expect(fakeDs.CreateAmiDriverCallCount()).To(Equal(1), "Expected Driverset.CreateAmiDriver to be called once")
 		Expect(fakeCreateAmiDriver.CreateCallCount()).To(Equal(1), "Expected CreateAmiDriver.Create to be called once")
-		Expect(fakeCreateAmiDriver.CreateArgsForCall(0)).To(Equal(resources.AmiDriverConfig{
+		_, createAmiDriverConfig := fakeCreateAmiDriver.CreateArgsForCall(0)
+		Expect(createAmiDriverConfig).To(Equal(resources.AmiDriverConfig{
 			SnapshotID:    fakeSnapshotID,
 			AmiProperties: fakeAmiProperties,
 		}))
@@ -134,7 +157,8 @@ var _ = Describe("StandardRegionPublisher", func() {
 		Expect(fakeDs.CopyAmiDriverCallCount()).To(Equal(1), "Expected Driverset.CopyAmiDriver to be called once")
 		Expect(fakeCopyAmiDriver.CreateCallCount()).To(Equal(1), "Expected CopyAmiDriver.Create to be called once")
 
-		Expect(fakeCopyAmiDriver.CreateArgsForCall(0)).To(Equal(resources.AmiDriverConfig{
+		_, copyAmiDriverConfig := fakeCopyAmiDriver.CreateArgsForCall(0)
+		Expect(copyAmiDriverConfig).To(Equal(resources.AmiDriverConfig{
 			ExistingAmiID:     fakeAmiID,
 			DestinationRegion: fakeCopyDestination,
 			AmiProperties:     fakeAmiProperties,
@@ -142,17 +166,190 @@ var _ = Describe("StandardRegionPublisher", func() {
 		}))
 
 		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1), "Expected MachineImageDriver.Delete to be called once")
-		Expect(fakeMachineImageDriver.DeleteArgsForCall(0)).To(Equal(fakeMachineImage))
+		_, deletedMachineImage := fakeMachineImageDriver.DeleteArgsForCall(0)
+		Expect(deletedMachineImage).To(Equal(fakeMachineImage))
 
 		Expect(amiCollection.GetAll()).To(ConsistOf(fakeAmi, fakeCopiedAmi))
 		Expect(amiCollection.VirtualizationType).To(Equal(fakeAmiConfig.VirtualizationType))
 	})
 
+	It("writes the snapshot from the local machine image without uploading it when the snapshot method is ebs-direct", func() {
+		publisherConfig := publisher.Config{
+			AmiRegion: config.AmiRegion{
+				RegionName:     "fake-region",
+				SnapshotMethod: config.EbsDirectSnapshotMethod,
+			},
+		}
+		machineImageConfig := publisher.MachineImageConfig{
+			LocalPath:  "fake-machine-image-path",
+			FileFormat: resources.VolumeRawFormat,
+		}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeDs.KmsDriverReturns(&resourcesfakes.FakeKmsDriver{})
+
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: "fake-snapshot-id"}, nil)
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: "fake-ami-id", Region: "fake-region"}, nil)
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected MachineImageDriver.Create not to be called")
+		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(0), "Expected MachineImageDriver.Delete not to be called")
+
+		Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(1), "Expected CreateSnapshotDriver.Create to be called once")
+		_, snapshotDriverConfig := fakeSnapshotDriver.CreateArgsForCall(0)
+		Expect(snapshotDriverConfig.MachineImagePath).To(Equal("fake-machine-image-path"))
+		Expect(snapshotDriverConfig.MachineImageURL).To(BeEmpty())
+	})
+
+	It("adopts an AMI published by an earlier run without uploading the machine image or creating a snapshot", func() {
+		publisherConfig := publisher.Config{
+			AmiRegion: config.AmiRegion{
+				RegionName: fakeRegion,
+				BucketName: fakeBucketName,
+			},
+			AmiConfiguration: fakeAmiConfig,
+		}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+
+		existingAmi := resources.Ami{ID: fakeAmiID, Region: fakeRegion, Adopted: true}
+		fakeExistingAmiDriver := &resourcesfakes.FakeExistingAmiDriver{}
+		fakeExistingAmiDriver.FindExistingReturns(existingAmi, true, nil)
+		fakeDs.ExistingAmiDriverReturns(fakeExistingAmiDriver)
+
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+		fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCreateAmiDriver.CreateReturns(existingAmi, nil)
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		amiCollection, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeExistingAmiDriver.FindExistingCallCount()).To(Equal(1))
+		_, properties := fakeExistingAmiDriver.FindExistingArgsForCall(0)
+		Expect(properties).To(Equal(fakeAmiProperties))
+
+		Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected MachineImageDriver.Create not to be called")
+		Expect(fakeKmsDriver.CreateAliasCallCount()).To(Equal(0), "Expected KmsDriver.CreateAlias not to be called")
+		Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(0), "Expected CreateSnapshotDriver.Create not to be called")
+
+		Expect(fakeCreateAmiDriver.CreateCallCount()).To(Equal(1), "Expected CreateAmiDriver.Create to be called once")
+		_, createAmiDriverConfig := fakeCreateAmiDriver.CreateArgsForCall(0)
+		Expect(createAmiDriverConfig.SnapshotID).To(BeEmpty())
+
+		Expect(amiCollection.GetAll()).To(ConsistOf(existingAmi))
+	})
+
+	It("returns an error when looking up an existing AMI fails", func() {
+		publisherConfig := publisher.Config{
+			AmiRegion:        config.AmiRegion{RegionName: fakeRegion},
+			AmiConfiguration: fakeAmiConfig,
+		}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeExistingAmiDriver := &resourcesfakes.FakeExistingAmiDriver{}
+		fakeExistingAmiDriver.FindExistingReturns(resources.Ami{}, false, errors.New("error in existing ami driver"))
+		fakeDs.ExistingAmiDriverReturns(fakeExistingAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+		Expect(err).To(MatchError("looking up existing ami: error in existing ami driver"))
+		Expect(fakeDs.MachineImageDriverCallCount()).To(Equal(0))
+	})
+
+	It("copies the AMI with the overrides of each destination", func() {
+		const overriddenDestination = "fake overridden destination"
+		destinationKey := "fake destination key ARN"
+		destinationAccounts := []string{"222222222222"}
+
+		amiConfig := fakeAmiConfig
+		amiConfig.Encrypted = true
+		amiConfig.KmsKeyId = "fake source key ARN"
+		publisherConfig := publisher.Config{
+			AmiRegion: config.AmiRegion{
+				RegionName: fakeRegion,
+				BucketName: fakeBucketName,
+				Destinations: []config.Destination{
+					{RegionName: fakeCopyDestination},
+					{RegionName: overriddenDestination, AmiConfiguration: &config.AmiOverrides{
+						KmsKeyId:           &destinationKey,
+						SharedWithAccounts: &destinationAccounts,
+					}},
+				},
+			},
+			AmiConfiguration: amiConfig,
+		}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+		fakeDs.MachineImageDriverReturns(&resourcesfakes.FakeMachineImageDriver{})
+
+		fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+		fakeKmsDriver.ReplicateKeyReturns(fakeReplicatedKey, nil)
+		fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+		fakeDs.CreateSnapshotDriverReturns(&resourcesfakes.FakeSnapshotDriver{})
+
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		fakeCopyAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeKmsDriver.ReplicateKeyCallCount()).To(Equal(1), "Expected only the source key to be replicated")
+		_, replicateConfig := fakeKmsDriver.ReplicateKeyArgsForCall(0)
+		Expect(replicateConfig.TargetRegion).To(Equal(fakeCopyDestination))
+		Expect(replicateConfig.KmsKeyId).To(Equal("fake source key ARN"))
+
+		Expect(fakeCopyAmiDriver.CreateCallCount()).To(Equal(2))
+		copyConfigs := map[string]resources.AmiDriverConfig{}
+		for i := 0; i < fakeCopyAmiDriver.CreateCallCount(); i++ {
+			_, copyConfig := fakeCopyAmiDriver.CreateArgsForCall(i)
+			copyConfigs[copyConfig.DestinationRegion] = copyConfig
+		}
+
+		Expect(copyConfigs[fakeCopyDestination].KmsKey).To(Equal(fakeReplicatedKey))
+		Expect(copyConfigs[fakeCopyDestination].AmiProperties.SharedWithAccounts).To(BeEmpty())
+
+		Expect(copyConfigs[overriddenDestination].KmsKey).To(Equal(resources.KmsKey{ARN: destinationKey}))
+		Expect(copyConfigs[overriddenDestination].AmiProperties.KmsKeyId).To(Equal(destinationKey))
+		Expect(copyConfigs[overriddenDestination].AmiProperties.SharedWithAccounts).To(Equal(destinationAccounts))
+		Expect(copyConfigs[overriddenDestination].AmiProperties.Encrypted).To(BeTrue())
+	})
+
 	It("returns a machine image driver error if one was returned", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 
 		driverErr := errors.New("error in machine image driver")
 
@@ -160,18 +357,58 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeMachineImageDriver.CreateReturns(resources.MachineImage{}, driverErr)
 		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
 	})
 
+	It("deletes the machine image with a live context when the publish context is cancelled", func() {
+		publisherConfig := publisher.Config{}
+		machineImageConfig := publisher.MachineImageConfig{}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+		fakeMachineImage := resources.MachineImage{
+			GetURL: fakeMachineImageURL,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var deleteCtxErr error
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeMachineImageDriver.CreateReturns(fakeMachineImage, nil)
+		fakeMachineImageDriver.DeleteStub = func(ctx context.Context, _ resources.MachineImage) error {
+			deleteCtxErr = ctx.Err()
+			return nil
+		}
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+		fakeKmsDriver.CreateAliasStub = func(ctx context.Context, _ resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error) {
+			cancel()
+			return resources.KmsAlias{}, ctx.Err()
+		}
+		fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(ctx, fakeDs, machineImageConfig)
+
+		Expect(err).To(MatchError(ContainSubstring(context.Canceled.Error())))
+
+		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1), "Expected MachineImageDriver.Delete to be called once")
+		_, deletedMachineImage := fakeMachineImageDriver.DeleteArgsForCall(0)
+		Expect(deletedMachineImage).To(Equal(fakeMachineImage))
+		Expect(deleteCtxErr).ToNot(HaveOccurred(), "Expected MachineImageDriver.Delete to run with a context that was not cancelled")
+	})
+
 	It("returns a KMS driver error if Alias creation fails", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -186,8 +423,8 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeKmsDriver.CreateAliasReturns(resources.KmsAlias{}, driverErr)
 		fakeDs.KmsDriverReturns(fakeKmsDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
@@ -198,6 +435,7 @@ var _ = Describe("StandardRegionPublisher", func() {
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -217,18 +455,54 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeSnapshotDriver.CreateReturns(resources.Snapshot{}, driverErr)
 		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
 	})
 
+	It("returns an error when the snapshot is not the size of the machine image and the size is verified", func() {
+		imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+		Expect(os.WriteFile(imagePath, []byte("image contents"), 0644)).To(Succeed())
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+		fakeDs.MachineImageDriverReturns(&resourcesfakes.FakeMachineImageDriver{})
+		fakeDs.KmsDriverReturns(&resourcesfakes.FakeKmsDriver{})
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID, VolumeSizeGB: 3}, nil)
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisher.Config{})
+		_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{
+			LocalPath:          imagePath,
+			FileFormat:         resources.VolumeRawFormat,
+			VerifySnapshotSize: true,
+		})
+
+		Expect(err).To(MatchError(ContainSubstring("snapshot fake snapshot id has a volume of 3 GB, but the machine image %s needs 1 GB", imagePath)))
+		Expect(fakeCreateAmiDriver.CreateCallCount()).To(Equal(0))
+
+		fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID, VolumeSizeGB: 1}, nil)
+		fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+
+		_, err = p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{
+			LocalPath:          imagePath,
+			FileFormat:         resources.VolumeRawFormat,
+			VerifySnapshotSize: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
 	It("returns a create ami driver error if one was returned", func() {
 		publisherConfig := publisher.Config{}
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -255,8 +529,8 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeAmiDriver.CreateReturns(resources.Ami{}, driverErr)
 		fakeDs.CreateAmiDriverReturns(fakeAmiDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
@@ -265,13 +539,14 @@ var _ = Describe("StandardRegionPublisher", func() {
 	It("returns a KMS driver error if key replication fails", func() {
 		publisherConfig := publisher.Config{
 			AmiRegion: config.AmiRegion{
-				Destinations: []string{fakeCopyDestination},
+				Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
 			},
 			AmiConfiguration: fakeAmiConfig,
 		}
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -303,8 +578,8 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeCreateAmiDriver.CreateReturns(fakeAmi, nil)
 		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
@@ -313,13 +588,14 @@ var _ = Describe("StandardRegionPublisher", func() {
 	It("returns a copy ami driver error if one was returned", func() {
 		publisherConfig := publisher.Config{
 			AmiRegion: config.AmiRegion{
-				Destinations: []string{fakeCopyDestination},
+				Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
 			},
 			AmiConfiguration: fakeAmiConfig,
 		}
 		machineImageConfig := publisher.MachineImageConfig{}
 
 		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
 		fakeMachineImage := resources.MachineImage{
 			GetURL: fakeMachineImageURL,
 		}
@@ -355,10 +631,574 @@ var _ = Describe("StandardRegionPublisher", func() {
 		fakeCopyAmiDriver.CreateReturns(resources.Ami{}, driverErr)
 		fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
 
-		p := publisher.NewStandardRegionPublisher(GinkgoWriter, publisherConfig)
-		_, err := p.Publish(fakeDs, machineImageConfig)
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
 
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(driverErr.Error()))
 	})
+
+	It("records a span for each step and copy with the resources it created", func() {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+		publisherConfig := publisher.Config{
+			AmiRegion: config.AmiRegion{
+				RegionName:   fakeRegion,
+				BucketName:   fakeBucketName,
+				Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
+			},
+			AmiConfiguration: fakeAmiConfig,
+		}
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeMachineImageDriver.CreateReturns(resources.MachineImage{GetURL: fakeMachineImageURL, Key: "fake key"}, nil)
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+		fakeKmsDriver.CreateAliasReturns(fakeKmsAlias, nil)
+		fakeKmsDriver.ReplicateKeyReturns(fakeReplicatedKey, nil)
+		fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+		fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+		fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID}, nil)
+		fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+		fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+		fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+		copyErr := errors.New("error in copy ami driver")
+		fakeCopyAmiDriver := &resourcesfakes.FakeAmiDriver{}
+		fakeCopyAmiDriver.CreateReturns(resources.Ami{}, copyErr)
+		fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
+
+		p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+		_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+		Expect(err).To(HaveOccurred())
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		Expect(spans).To(HaveLen(7))
+
+		Expect(spans["find_existing_ami"].Attributes()).To(ContainElement(attribute.String("region", fakeRegion)))
+		Expect(spans["upload_machine_image"].Attributes()).To(ContainElements(
+			attribute.String("region", fakeRegion),
+			attribute.String("s3.bucket", fakeBucketName),
+			attribute.String("s3.key", "fake key"),
+		))
+		Expect(spans["create_kms_alias"].Status().Code).To(Equal(codes.Unset))
+		Expect(spans["create_snapshot"].Attributes()).To(ContainElement(attribute.String("snapshot_id", fakeSnapshotID)))
+		Expect(spans["create_ami"].Attributes()).To(ContainElements(
+			attribute.String("snapshot_id", fakeSnapshotID),
+			attribute.String("ami_id", fakeAmiID),
+		))
+		Expect(spans["copy_ami"].Attributes()).To(ContainElements(
+			attribute.String("ami_id", fakeAmiID),
+			attribute.String("destination_region", fakeCopyDestination),
+		))
+		Expect(spans["copy_ami"].Status().Code).To(Equal(codes.Error))
+		Expect(spans["copy_ami"].Status().Description).To(Equal(copyErr.Error()))
+		Expect(spans["delete_machine_image"].Attributes()).To(ContainElement(attribute.String("s3.key", "fake key")))
+	})
+
+	It("returns an error when the uploaded machine image does not have the checksum of the shared image", func() {
+		imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+		Expect(os.WriteFile(imagePath, []byte("image contents"), 0644)).To(Succeed())
+
+		fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+		fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+		fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+		fakeMachineImageDriver.CreateReturns(resources.MachineImage{GetURL: fakeMachineImageURL, SHA256: "other checksum"}, nil)
+		fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+		sharedImage := upload.NewSharedFile(imagePath, []string{fakeRegion}, nil)
+		imageSHA256, err := sharedImage.Digest()
+		Expect(err).ToNot(HaveOccurred())
+
+		p := publisher.NewStandardRegionPublisher(logger, publisher.Config{AmiRegion: config.AmiRegion{RegionName: fakeRegion}})
+		_, err = p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{
+			SharedImage: sharedImage,
+			ImageSHA256: imageSHA256,
+		})
+		Expect(err).To(MatchError(ContainSubstring("differs from checksum")))
+		Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1))
+	})
+
+	Context("with a journal", func() {
+		const secondCopyDestination = "fake second copy destination"
+
+		var (
+			publisherConfig        publisher.Config
+			machineImageConfig     publisher.MachineImageConfig
+			j                      *journal.Journal
+			fakeDs                 *driversetfakes.FakeStandardRegionDriverSet
+			fakeMachineImageDriver *resourcesfakes.FakeMachineImageDriver
+			fakeKmsDriver          *resourcesfakes.FakeKmsDriver
+			fakeSnapshotDriver     *resourcesfakes.FakeSnapshotDriver
+			fakeCreateAmiDriver    *resourcesfakes.FakeAmiDriver
+			fakeCopyAmiDriver      *resourcesfakes.FakeAmiDriver
+			fakeMachineImage       resources.MachineImage
+			fakeAmi                resources.Ami
+		)
+
+		BeforeEach(func() {
+			var err error
+			j, err = journal.Create(filepath.Join(GinkgoT().TempDir(), "journal.json"), journal.Inputs{})
+			Expect(err).ToNot(HaveOccurred())
+
+			publisherConfig = publisher.Config{
+				AmiRegion: config.AmiRegion{
+					RegionName:   fakeRegion,
+					BucketName:   fakeBucketName,
+					Destinations: []config.Destination{{RegionName: fakeCopyDestination}, {RegionName: secondCopyDestination}},
+				},
+				AmiConfiguration: fakeAmiConfig,
+				Journal:          j,
+			}
+			machineImageConfig = publisher.MachineImageConfig{
+				LocalPath:  fakeMachineImagePath,
+				FileFormat: resources.VolumeRawFormat,
+			}
+
+			fakeMachineImage = resources.MachineImage{GetURL: fakeMachineImageURL}
+			fakeAmi = resources.Ami{ID: fakeAmiID, Region: fakeRegion}
+
+			fakeDs = &driversetfakes.FakeStandardRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+
+			fakeMachineImageDriver = &resourcesfakes.FakeMachineImageDriver{}
+			fakeMachineImageDriver.CreateReturns(fakeMachineImage, nil)
+			fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+			fakeKmsDriver = &resourcesfakes.FakeKmsDriver{}
+			fakeKmsDriver.CreateAliasReturns(fakeKmsAlias, nil)
+			fakeKmsDriver.ReplicateKeyReturns(fakeReplicatedKey, nil)
+			fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+			fakeSnapshotDriver = &resourcesfakes.FakeSnapshotDriver{}
+			fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID}, nil)
+			fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+			fakeCreateAmiDriver = &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(fakeAmi, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+			fakeCopyAmiDriver = &resourcesfakes.FakeAmiDriver{}
+			fakeCopyAmiDriver.CreateStub = func(_ context.Context, driverConfig resources.AmiDriverConfig) (resources.Ami, error) {
+				return resources.Ami{ID: fakeCopiedAmiID, Region: driverConfig.DestinationRegion}, nil
+			}
+			fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
+		})
+
+		It("records each completed step", func() {
+			fakeSnapshotDriver.CreateStub = func(_ context.Context, driverConfig resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+				Expect(driverConfig.ImportTaskStarted("fake import task id")).To(Succeed())
+				return resources.Snapshot{ID: fakeSnapshotID}, nil
+			}
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			progress := j.Region(fakeRegion)
+			Expect(progress.MachineImage).To(BeNil(), "Expected the deleted machine image to be removed from the journal")
+			Expect(progress.ImportTaskID).To(Equal("fake import task id"))
+			Expect(progress.SnapshotID).To(Equal(fakeSnapshotID))
+			Expect(progress.SourceAmi).To(Equal(&fakeAmi))
+			Expect(progress.CopiedAmis).To(Equal(map[string]resources.Ami{
+				fakeCopyDestination:   {ID: fakeCopiedAmiID, Region: fakeCopyDestination},
+				secondCopyDestination: {ID: fakeCopiedAmiID, Region: secondCopyDestination},
+			}))
+		})
+
+		It("resumes an import task recorded by an earlier run", func() {
+			Expect(j.Update(fakeRegion, func(r *journal.Region) {
+				r.MachineImage = &fakeMachineImage
+				r.ImportTaskID = "fake import task id"
+			})).To(Succeed())
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected the recorded machine image to be reused")
+			Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(1), "Expected CreateSnapshotDriver.Create to be called once")
+			_, snapshotDriverConfig := fakeSnapshotDriver.CreateArgsForCall(0)
+			Expect(snapshotDriverConfig.MachineImageURL).To(Equal(fakeMachineImageURL))
+			Expect(snapshotDriverConfig.ImportTaskID).To(Equal("fake import task id"))
+
+			Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(1), "Expected MachineImageDriver.Delete to be called once")
+			_, deletedMachineImage := fakeMachineImageDriver.DeleteArgsForCall(0)
+			Expect(deletedMachineImage).To(Equal(fakeMachineImage))
+		})
+
+		It("reuses the snapshot, source AMI and copies recorded by an earlier run", func() {
+			recordedCopy := resources.Ami{ID: "fake recorded copy id", Region: fakeCopyDestination}
+			Expect(j.Update(fakeRegion, func(r *journal.Region) {
+				r.SnapshotID = fakeSnapshotID
+				r.SourceAmi = &fakeAmi
+				r.CopiedAmis[fakeCopyDestination] = recordedCopy
+			})).To(Succeed())
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			amiCollection, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(0), "Expected no machine image to be uploaded")
+			Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(0), "Expected no machine image to be deleted")
+			Expect(fakeKmsDriver.CreateAliasCallCount()).To(Equal(0), "Expected no KMS alias to be created")
+			Expect(fakeSnapshotDriver.CreateCallCount()).To(Equal(0), "Expected no snapshot to be created")
+			Expect(fakeCreateAmiDriver.CreateCallCount()).To(Equal(0), "Expected no AMI to be created")
+
+			Expect(fakeCopyAmiDriver.CreateCallCount()).To(Equal(1), "Expected only the missing copy to be made")
+			_, copyAmiDriverConfig := fakeCopyAmiDriver.CreateArgsForCall(0)
+			Expect(copyAmiDriverConfig.ExistingAmiID).To(Equal(fakeAmiID))
+			Expect(copyAmiDriverConfig.DestinationRegion).To(Equal(secondCopyDestination))
+
+			newCopy := resources.Ami{ID: fakeCopiedAmiID, Region: secondCopyDestination}
+			Expect(amiCollection.GetAll()).To(ConsistOf(fakeAmi, recordedCopy, newCopy))
+			Expect(j.Region(fakeRegion).CopiedAmis).To(HaveKeyWithValue(secondCopyDestination, newCopy))
+		})
+
+		It("keeps the machine image for a resume when the publish is interrupted", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			fakeSnapshotDriver.CreateStub = func(ctx context.Context, _ resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+				cancel()
+				return resources.Snapshot{}, ctx.Err()
+			}
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(ctx, fakeDs, machineImageConfig)
+			Expect(err).To(HaveOccurred())
+
+			Expect(fakeMachineImageDriver.DeleteCallCount()).To(Equal(0), "Expected the machine image to be kept")
+			Expect(j.Region(fakeRegion).MachineImage).To(Equal(&fakeMachineImage))
+		})
+
+		Context("when rolling back a failed publish", func() {
+			var fakeDeleteAmiDriver *resourcesfakes.FakeDeleteAmiDriver
+
+			BeforeEach(func() {
+				publisherConfig.Destinations = []config.Destination{{RegionName: fakeCopyDestination}}
+				publisherConfig.KmsKeyAliasName = "alias/fake-alias"
+
+				fakeKmsDriver.CreateAliasReturns(resources.KmsAlias{ARN: fakeKmsAliasARN, Created: true}, nil)
+
+				fakeDeleteAmiDriver = &resourcesfakes.FakeDeleteAmiDriver{}
+				fakeDs.DeleteAmiDriverReturns(fakeDeleteAmiDriver)
+			})
+
+			It("removes the AMIs and KMS alias created by the run, copies first", func() {
+				copiedAmi := resources.Ami{ID: fakeCopiedAmiID, Region: fakeCopyDestination}
+				fakeCopyAmiDriver.CreateStub = nil
+				fakeCopyAmiDriver.CreateReturns(copiedAmi, nil)
+				fakeKmsDriver.ReplicateKeyStub = func(_ context.Context, driverConfig resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error) {
+					if driverConfig.TargetRegion == secondCopyDestination {
+						return resources.KmsKey{}, errors.New("error replicating key")
+					}
+					return fakeReplicatedKey, nil
+				}
+				publisherConfig.Destinations = []config.Destination{{RegionName: fakeCopyDestination}, {RegionName: secondCopyDestination}}
+
+				p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+				_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+				Expect(err).To(HaveOccurred())
+
+				results := p.Rollback(context.Background(), fakeDs)
+				Expect(results).To(HaveLen(3))
+				for _, result := range results {
+					Expect(result.Err).ToNot(HaveOccurred())
+				}
+
+				Expect(fakeDeleteAmiDriver.DeleteCallCount()).To(Equal(2), "Expected DeleteAmiDriver.Delete to be called twice")
+				_, firstDeletedAmi := fakeDeleteAmiDriver.DeleteArgsForCall(0)
+				Expect(firstDeletedAmi).To(Equal(copiedAmi))
+				_, secondDeletedAmi := fakeDeleteAmiDriver.DeleteArgsForCall(1)
+				Expect(secondDeletedAmi).To(Equal(fakeAmi))
+
+				Expect(fakeKmsDriver.DeleteAliasCallCount()).To(Equal(1), "Expected KmsDriver.DeleteAlias to be called once")
+				_, deleteAliasConfig := fakeKmsDriver.DeleteAliasArgsForCall(0)
+				Expect(deleteAliasConfig).To(Equal(resources.KmsDeleteAliasDriverConfig{
+					KmsKeyAliasName: "alias/fake-alias",
+					Region:          fakeRegion,
+				}))
+
+				progress := j.Region(fakeRegion)
+				Expect(progress.SourceAmi).To(BeNil(), "Expected the removed source AMI to be removed from the journal")
+				Expect(progress.SnapshotID).To(BeEmpty())
+				Expect(progress.CopiedAmis).To(BeEmpty())
+			})
+
+			It("does not remove a KMS alias that existed before the run", func() {
+				fakeKmsDriver.CreateAliasReturns(fakeKmsAlias, nil)
+				fakeCreateAmiDriver.CreateReturns(resources.Ami{}, errors.New("error in create ami driver"))
+
+				p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+				_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+				Expect(err).To(HaveOccurred())
+
+				Expect(p.Rollback(context.Background(), fakeDs)).To(BeEmpty())
+				Expect(fakeDeleteAmiDriver.DeleteCallCount()).To(Equal(0))
+				Expect(fakeKmsDriver.DeleteAliasCallCount()).To(Equal(0))
+			})
+
+			It("does not remove AMIs that existed before the run and were adopted", func() {
+				fakeKmsDriver.CreateAliasReturns(fakeKmsAlias, nil)
+				fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion, Adopted: true}, nil)
+				fakeCopyAmiDriver.CreateStub = nil
+				fakeCopyAmiDriver.CreateReturns(resources.Ami{}, errors.New("error in copy ami driver"))
+
+				p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+				_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+				Expect(err).To(HaveOccurred())
+
+				Expect(p.Rollback(context.Background(), fakeDs)).To(BeEmpty())
+				Expect(fakeDeleteAmiDriver.DeleteCallCount()).To(Equal(0))
+			})
+
+			It("reports resources that could not be removed and retries them on the next rollback", func() {
+				fakeCopyAmiDriver.CreateStub = nil
+				fakeCopyAmiDriver.CreateReturns(resources.Ami{}, errors.New("error in copy ami driver"))
+				fakeDeleteAmiDriver.DeleteReturnsOnCall(0, errors.New("error deleting AMI"))
+
+				p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+				_, err := p.Publish(context.Background(), fakeDs, machineImageConfig)
+				Expect(err).To(HaveOccurred())
+
+				results := p.Rollback(context.Background(), fakeDs)
+				Expect(results).To(HaveLen(2))
+				Expect(results[0].Err).To(MatchError("error deleting AMI"))
+				Expect(results[0].String()).To(Equal("could not remove AMI fake AMI id and its snapshots in fake region: error deleting AMI"))
+				Expect(results[1].Err).ToNot(HaveOccurred())
+				Expect(j.Region(fakeRegion).SourceAmi).To(Equal(&fakeAmi), "Expected the AMI to stay in the journal")
+
+				results = p.Rollback(context.Background(), fakeDs)
+				Expect(results).To(HaveLen(1))
+				Expect(results[0].Err).ToNot(HaveOccurred())
+				Expect(results[0].String()).To(Equal("removed AMI fake AMI id and its snapshots in fake region"))
+				Expect(fakeDeleteAmiDriver.DeleteCallCount()).To(Equal(2))
+				Expect(fakeKmsDriver.DeleteAliasCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("with a report", func() {
+		readRegion := func(r *report.Report) report.Region {
+			reportPath := filepath.Join(GinkgoT().TempDir(), "report.json")
+			Expect(r.Write(reportPath)).To(Succeed())
+
+			contents, err := os.ReadFile(reportPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			written := struct {
+				Regions []report.Region `json:"regions"`
+			}{}
+			Expect(json.Unmarshal(contents, &written)).To(Succeed())
+			Expect(written.Regions).To(HaveLen(1))
+			return written.Regions[0]
+		}
+
+		It("records the resources and steps of the publish", func() {
+			r := report.New()
+			amiConfig := fakeAmiConfig
+			amiConfig.Encrypted = true
+			amiConfig.KmsKeyId = "fake key ARN"
+			amiConfig.SharedWithAccounts = []string{"123456789012"}
+			publisherConfig := publisher.Config{
+				AmiRegion: config.AmiRegion{
+					RegionName:   fakeRegion,
+					BucketName:   fakeBucketName,
+					Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
+				},
+				AmiConfiguration: amiConfig,
+				Report:           r,
+			}
+
+			fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+
+			fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+			fakeMachineImageDriver.CreateReturns(resources.MachineImage{GetURL: fakeMachineImageURL, Key: "fake-key"}, nil)
+			fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+
+			fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+			fakeKmsDriver.CreateAliasReturns(fakeKmsAlias, nil)
+			fakeKmsDriver.ReplicateKeyReturns(fakeReplicatedKey, nil)
+			fakeDs.KmsDriverReturns(fakeKmsDriver)
+
+			fakeSnapshotDriver := &resourcesfakes.FakeSnapshotDriver{}
+			fakeSnapshotDriver.CreateReturns(resources.Snapshot{ID: fakeSnapshotID}, nil)
+			fakeDs.CreateSnapshotDriverReturns(fakeSnapshotDriver)
+
+			fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+			fakeCopyAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCopyAmiDriver.CreateReturns(resources.Ami{ID: fakeCopiedAmiID, Region: fakeCopyDestination}, nil)
+			fakeDs.CopyAmiDriverReturns(fakeCopyAmiDriver)
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{LocalPath: fakeMachineImagePath})
+			Expect(err).ToNot(HaveOccurred())
+
+			region := readRegion(r)
+			Expect(region.Region).To(Equal(fakeRegion))
+			Expect(region.AmiID).To(Equal(fakeAmiID))
+			Expect(region.SnapshotID).To(Equal(fakeSnapshotID))
+			Expect(region.Visibility).To(Equal("public"))
+			Expect(region.Encrypted).To(BeTrue())
+			Expect(region.KmsKeyArn).To(Equal("fake key ARN"))
+			Expect(region.KmsKeyAliasArn).To(Equal(fakeKmsAliasARN))
+			Expect(region.SharedWithAccounts).To(Equal([]string{"123456789012"}))
+			Expect(region.S3Bucket).To(Equal(fakeBucketName))
+			Expect(region.S3Key).To(Equal("fake-key"))
+
+			var stepNames []string
+			for _, step := range region.Steps {
+				stepNames = append(stepNames, step.Name)
+			}
+			Expect(stepNames).To(Equal([]string{"upload_machine_image", "create_snapshot", "create_ami"}))
+
+			Expect(region.Copies).To(HaveLen(1))
+			Expect(region.Copies[0].Region).To(Equal(fakeCopyDestination))
+			Expect(region.Copies[0].AmiID).To(Equal(fakeCopiedAmiID))
+			Expect(region.Copies[0].KmsKeyArn).To(Equal(fakeReplicatedKeyARN))
+			Expect(region.Copies[0].Error).To(BeEmpty())
+		})
+
+		It("passes the upload settings and checksum of the shared image to the machine image driver and records the upload progress", func() {
+			r := report.New()
+			publisherConfig := publisher.Config{
+				AmiRegion: config.AmiRegion{
+					RegionName: fakeRegion,
+					BucketName: fakeBucketName,
+				},
+				AmiConfiguration: fakeAmiConfig,
+				Report:           r,
+			}
+
+			imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+			Expect(os.WriteFile(imagePath, []byte("image contents"), 0644)).To(Succeed())
+			uploadSettings := resources.UploadSettings{PartSize: 64 << 20, Concurrency: 8, ProgressInterval: time.Second}
+			imageSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("image contents")))
+
+			fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+			fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+			fakeMachineImageDriver.CreateStub = func(_ context.Context, driverConfig resources.MachineImageDriverConfig) (resources.MachineImage, error) {
+				defer GinkgoRecover()
+
+				Expect(driverConfig.Upload).To(Equal(uploadSettings))
+				Expect(driverConfig.ImageSHA256).To(Equal(imageSHA256))
+				Expect(driverConfig.KeepUploadedImage).To(BeTrue())
+
+				image, err := driverConfig.OpenMachineImage()
+				Expect(err).ToNot(HaveOccurred())
+				defer image.Close() //nolint:errcheck
+				Expect(io.ReadAll(image)).To(Equal([]byte("image contents")))
+
+				driverConfig.UploadProgress(resources.UploadProgress{BytesSent: 14, TotalBytes: 14, BytesPerSecond: 2 << 20})
+				return resources.MachineImage{GetURL: fakeMachineImageURL, Reused: true}, nil
+			}
+			fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+			fakeDs.KmsDriverReturns(&resourcesfakes.FakeKmsDriver{})
+			fakeDs.CreateSnapshotDriverReturns(&resourcesfakes.FakeSnapshotDriver{})
+			fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{
+				LocalPath:         imagePath,
+				Upload:            uploadSettings,
+				SharedImage:       upload.NewSharedFile(imagePath, []string{fakeRegion}, nil),
+				ImageSHA256:       imageSHA256,
+				KeepUploadedImage: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeMachineImageDriver.CreateCallCount()).To(Equal(1))
+
+			region := readRegion(r)
+			Expect(region.Upload).ToNot(BeNil())
+			Expect(region.Upload.TotalBytes).To(Equal(int64(14)))
+			Expect(region.Upload.Progress).To(HaveLen(1))
+			Expect(region.Upload.Progress[0].BytesSent).To(Equal(int64(14)))
+			Expect(region.Upload.Progress[0].MBPerSecond).To(Equal(2.0))
+			Expect(region.ImageReused).To(BeTrue())
+		})
+
+		It("records the checksum of the uploaded machine image", func() {
+			r := report.New()
+			publisherConfig := publisher.Config{
+				AmiRegion:        config.AmiRegion{RegionName: fakeRegion},
+				AmiConfiguration: fakeAmiConfig,
+				Report:           r,
+			}
+
+			fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+			fakeMachineImageDriver := &resourcesfakes.FakeMachineImageDriver{}
+			imagePath := filepath.Join(GinkgoT().TempDir(), "root.img")
+			Expect(os.WriteFile(imagePath, []byte("image contents"), 0644)).To(Succeed())
+			imageSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("image contents")))
+
+			fakeMachineImageDriver.CreateReturns(resources.MachineImage{GetURL: fakeMachineImageURL, SHA256: imageSHA256}, nil)
+			fakeDs.MachineImageDriverReturns(fakeMachineImageDriver)
+			fakeDs.KmsDriverReturns(&resourcesfakes.FakeKmsDriver{})
+			fakeDs.CreateSnapshotDriverReturns(&resourcesfakes.FakeSnapshotDriver{})
+			fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+			sharedImage := upload.NewSharedFile(imagePath, []string{fakeRegion}, nil)
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{SharedImage: sharedImage})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readRegion(r).ImageSHA256).To(Equal(imageSHA256))
+			Expect(sharedImage.SHA256()).To(Equal(imageSHA256))
+
+			Expect(sharedImage.RecordSHA256("other checksum")).ToNot(Succeed())
+		})
+
+		It("records the error of a failed step and copy", func() {
+			r := report.New()
+			publisherConfig := publisher.Config{
+				AmiRegion: config.AmiRegion{
+					RegionName:   fakeRegion,
+					Destinations: []config.Destination{{RegionName: fakeCopyDestination}},
+				},
+				AmiConfiguration: fakeAmiConfig,
+				Report:           r,
+			}
+
+			fakeDs := &driversetfakes.FakeStandardRegionDriverSet{}
+			fakeDs.ExistingAmiDriverReturns(&resourcesfakes.FakeExistingAmiDriver{})
+			fakeDs.MachineImageDriverReturns(&resourcesfakes.FakeMachineImageDriver{})
+			fakeKmsDriver := &resourcesfakes.FakeKmsDriver{}
+			fakeKmsDriver.ReplicateKeyReturns(resources.KmsKey{}, errors.New("some replicate error"))
+			fakeDs.KmsDriverReturns(fakeKmsDriver)
+			fakeDs.CreateSnapshotDriverReturns(&resourcesfakes.FakeSnapshotDriver{})
+			fakeCreateAmiDriver := &resourcesfakes.FakeAmiDriver{}
+			fakeCreateAmiDriver.CreateReturns(resources.Ami{ID: fakeAmiID, Region: fakeRegion}, nil)
+			fakeDs.CreateAmiDriverReturns(fakeCreateAmiDriver)
+
+			p := publisher.NewStandardRegionPublisher(logger, publisherConfig)
+			_, err := p.Publish(context.Background(), fakeDs, publisher.MachineImageConfig{})
+			Expect(err).To(HaveOccurred())
+
+			region := readRegion(r)
+			Expect(region.Copies).To(HaveLen(1))
+			Expect(region.Copies[0].Region).To(Equal(fakeCopyDestination))
+			Expect(region.Copies[0].AmiID).To(BeEmpty())
+			Expect(region.Copies[0].Error).To(ContainSubstring("some replicate error"))
+		})
+	})
 })
@@ -0,0 +1,104 @@
+// Package redact removes credentials from log output: the signatures, credentials and session tokens of
+// presigned URLs and Authorization headers, secrets given as key/value pairs, AWS access key IDs and any
+// secret a Redactor has been told about.
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces every credential that is removed
+const Redacted = "REDACTED"
+
+// minSecretLength keeps short values, e.g. an empty or placeholder external ID, from redacting unrelated output
+const minSecretLength = 8
+
+// sensitiveQueryParameters are the query parameters of presigned URLs that hold credentials, in lower case
+var sensitiveQueryParameters = map[string]bool{
+	"x-amz-signature":      true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"signature":            true,
+	"awsaccesskeyid":       true,
+}
+
+var (
+	urlPattern = regexp.MustCompile(`https?://[^\s"'<>,]+`)
+
+	// authorizationPattern matches the credential and signature of a SigV4 Authorization header
+	authorizationPattern = regexp.MustCompile(`(\b(?:Credential|Signature)=)[^,\s&]+`)
+
+	// keyValuePattern matches secrets in headers, config files, environment variables and JSON
+	keyValuePattern = regexp.MustCompile(`(?i)((?:aws_)?(?:secret_?(?:access_?)?key|session_?token|security[_-]?token)["']?\s*[:=]\s*["']?)[^\s"',&]+`)
+
+	// accessKeyIDPattern matches the IDs of long-term and temporary access keys
+	accessKeyIDPattern = regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`)
+)
+
+// String returns s with the credentials it recognizes replaced by Redacted
+func String(s string) string {
+	s = urlPattern.ReplaceAllStringFunc(s, redactURL)
+	s = authorizationPattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = keyValuePattern.ReplaceAllString(s, "${1}"+Redacted)
+	return accessKeyIDPattern.ReplaceAllString(s, Redacted)
+}
+
+// redactURL replaces the values of the sensitive query parameters of rawURL. The rest of the URL is kept as
+// it is, so that the log still shows which object the URL is for.
+func redactURL(rawURL string) string {
+	base, query, found := strings.Cut(rawURL, "?")
+	if !found {
+		return rawURL
+	}
+
+	parameters := strings.Split(query, "&")
+	for i, parameter := range parameters {
+		name, _, hasValue := strings.Cut(parameter, "=")
+		unescapedName, err := url.QueryUnescape(name)
+		if err != nil {
+			unescapedName = name
+		}
+		if hasValue && sensitiveQueryParameters[strings.ToLower(unescapedName)] {
+			parameters[i] = name + "=" + Redacted
+		}
+	}
+
+	return base + "?" + strings.Join(parameters, "&")
+}
+
+// Redactor redacts the credentials String recognizes and the secrets it has been given
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// AddSecrets makes the Redactor replace every occurrence of secrets, also when they are URL encoded.
+// Secrets shorter than 8 characters are ignored.
+func (r *Redactor) AddSecrets(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		r.secrets = append(r.secrets, secret)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			r.secrets = append(r.secrets, escaped)
+		}
+	}
+}
+
+// String returns s with its credentials and the secrets of the Redactor replaced by Redacted
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return String(s)
+}
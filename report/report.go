@@ -0,0 +1,187 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Region statuses
+const (
+	SucceededStatus = "succeeded"
+	FailedStatus    = "failed"
+)
+
+// Report collects what a publish did in each region in a machine-readable form
+// for auditing and downstream automation. A nil *Report records nothing.
+type Report struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	regions   map[string]*Region
+}
+
+type document struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Succeeded  bool      `json:"succeeded"`
+	Regions    []*Region `json:"regions"`
+}
+
+// Region describes the publish to a single source region and the copies of its AMI
+type Region struct {
+	Region             string   `json:"region"`
+	Status             string   `json:"status"`
+	AmiID              string   `json:"ami_id,omitempty"`
+	AmiAdopted         bool     `json:"ami_adopted,omitempty"`
+	SnapshotID         string   `json:"snapshot_id,omitempty"`
+	Visibility         string   `json:"visibility"`
+	Encrypted          bool     `json:"encrypted"`
+	KmsKeyArn          string   `json:"kms_key_arn,omitempty"`
+	KmsKeyAliasArn     string   `json:"kms_key_alias_arn,omitempty"`
+	SharedWithAccounts []string `json:"shared_with_accounts,omitempty"`
+	S3Bucket           string   `json:"s3_bucket,omitempty"`
+	S3Key              string   `json:"s3_key,omitempty"`
+	ImageSHA256        string   `json:"image_sha256,omitempty"`
+	ImageReused        bool     `json:"image_reused,omitempty"`
+	Upload             *Upload  `json:"upload,omitempty"`
+	Steps              []Step   `json:"steps"`
+	Copies             []Copy   `json:"copies,omitempty"`
+	Errors             []string `json:"errors,omitempty"`
+}
+
+// Upload describes the upload of the machine image to S3
+type Upload struct {
+	TotalBytes int64            `json:"total_bytes"`
+	Progress   []UploadProgress `json:"progress"`
+}
+
+// UploadProgress is the state of the upload at one of its progress reports
+type UploadProgress struct {
+	Time        time.Time `json:"time"`
+	BytesSent   int64     `json:"bytes_sent"`
+	MBPerSecond float64   `json:"mb_per_second"`
+	ETASeconds  float64   `json:"eta_seconds"`
+}
+
+// Step is one step of a publish that was run, rather than reused from a journal
+type Step struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Copy describes the copy of a source AMI to another region
+type Copy struct {
+	Region          string  `json:"region"`
+	AmiID           string  `json:"ami_id,omitempty"`
+	Adopted         bool    `json:"adopted,omitempty"`
+	KmsKeyArn       string  `json:"kms_key_arn,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// New starts an empty report
+func New() *Report {
+	return &Report{
+		startedAt: time.Now().UTC(),
+		regions:   map[string]*Region{},
+	}
+}
+
+// Update applies record to the region named name
+func (r *Report) Update(name string, record func(*Region)) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	region, ok := r.regions[name]
+	if !ok {
+		region = &Region{Region: name, Steps: []Step{}}
+		r.regions[name] = region
+	}
+
+	record(region)
+}
+
+// Step records a step of the region named name that started at start, and its error if err is not nil
+func (r *Report) Step(name string, step string, start time.Time, err error) {
+	s := Step{Name: step, DurationSeconds: time.Since(start).Seconds()}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	r.Update(name, func(region *Region) { region.Steps = append(region.Steps, s) })
+}
+
+// UploadProgress records a progress report of the machine image upload of the region named name
+func (r *Report) UploadProgress(name string, totalBytes int64, progress UploadProgress) {
+	r.Update(name, func(region *Region) {
+		if region.Upload == nil {
+			region.Upload = &Upload{}
+		}
+		region.Upload.TotalBytes = totalBytes
+		region.Upload.Progress = append(region.Upload.Progress, progress)
+	})
+}
+
+// Succeed marks a region as published
+func (r *Report) Succeed(name string) {
+	r.Update(name, func(region *Region) { region.Status = SucceededStatus })
+}
+
+// Fail marks a region as failed with err
+func (r *Report) Fail(name string, err error) {
+	r.Update(name, func(region *Region) {
+		region.Status = FailedStatus
+		region.Errors = append(region.Errors, err.Error())
+	})
+}
+
+// Write writes the report as JSON to path, with the regions and copies sorted by name
+func (r *Report) Write(path string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	doc := document{
+		StartedAt:  r.startedAt,
+		FinishedAt: time.Now().UTC(),
+		Succeeded:  true,
+		Regions:    []*Region{},
+	}
+	for _, region := range r.regions {
+		regionCopy := *region
+		regionCopy.Copies = append([]Copy(nil), region.Copies...)
+		if region.Upload != nil {
+			upload := *region.Upload
+			upload.Progress = append([]UploadProgress(nil), region.Upload.Progress...)
+			regionCopy.Upload = &upload
+		}
+		sort.Slice(regionCopy.Copies, func(i, j int) bool { return regionCopy.Copies[i].Region < regionCopy.Copies[j].Region })
+
+		doc.Succeeded = doc.Succeeded && regionCopy.Status != FailedStatus
+		doc.Regions = append(doc.Regions, &regionCopy)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(doc.Regions, func(i, j int) bool { return doc.Regions[i].Region < doc.Regions[j].Region })
+
+	contents, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling report: %s", err)
+	}
+
+	err = os.WriteFile(path, append(contents, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("writing report %s: %s", path, err)
+	}
+
+	return nil
+}
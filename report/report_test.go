@@ -0,0 +1,130 @@
+package report_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"light-stemcell-builder/report"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type writtenReport struct {
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Succeeded  bool            `json:"succeeded"`
+	Regions    []report.Region `json:"regions"`
+}
+
+var _ = Describe("Report", func() {
+	var reportPath string
+
+	BeforeEach(func() {
+		reportPath = filepath.Join(GinkgoT().TempDir(), "report.json")
+	})
+
+	readReport := func() writtenReport {
+		contents, err := os.ReadFile(reportPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		written := writtenReport{}
+		Expect(json.Unmarshal(contents, &written)).To(Succeed())
+		return written
+	}
+
+	It("writes the regions and their copies sorted by name", func() {
+		r := report.New()
+		r.Update("us-west-1", func(region *report.Region) {
+			region.AmiID = "ami-west"
+			region.Copies = append(region.Copies,
+				report.Copy{Region: "eu-west-1", AmiID: "ami-eu"},
+				report.Copy{Region: "ap-south-1", AmiID: "ami-ap"},
+			)
+		})
+		r.Update("us-east-1", func(region *report.Region) {
+			region.AmiID = "ami-east"
+			region.SnapshotID = "snap-east"
+			region.Encrypted = true
+		})
+		r.Succeed("us-west-1")
+		r.Succeed("us-east-1")
+
+		Expect(r.Write(reportPath)).To(Succeed())
+
+		written := readReport()
+		Expect(written.Succeeded).To(BeTrue())
+		Expect(written.FinishedAt).ToNot(BeTemporally("<", written.StartedAt))
+		Expect(written.Regions).To(HaveLen(2))
+
+		Expect(written.Regions[0].Region).To(Equal("us-east-1"))
+		Expect(written.Regions[0].Status).To(Equal(report.SucceededStatus))
+		Expect(written.Regions[0].AmiID).To(Equal("ami-east"))
+		Expect(written.Regions[0].SnapshotID).To(Equal("snap-east"))
+		Expect(written.Regions[0].Encrypted).To(BeTrue())
+
+		Expect(written.Regions[1].Region).To(Equal("us-west-1"))
+		Expect(written.Regions[1].Copies).To(Equal([]report.Copy{
+			{Region: "ap-south-1", AmiID: "ami-ap"},
+			{Region: "eu-west-1", AmiID: "ami-eu"},
+		}))
+	})
+
+	It("records the duration and error of each step", func() {
+		r := report.New()
+		r.Step("us-east-1", "create_snapshot", time.Now().Add(-2*time.Second), nil)
+		r.Step("us-east-1", "create_ami", time.Now(), errors.New("some error"))
+
+		Expect(r.Write(reportPath)).To(Succeed())
+
+		steps := readReport().Regions[0].Steps
+		Expect(steps).To(HaveLen(2))
+		Expect(steps[0].Name).To(Equal("create_snapshot"))
+		Expect(steps[0].DurationSeconds).To(BeNumerically(">=", 2))
+		Expect(steps[0].Error).To(BeEmpty())
+		Expect(steps[1].Name).To(Equal("create_ami"))
+		Expect(steps[1].Error).To(Equal("some error"))
+	})
+
+	It("records the progress reports of the upload", func() {
+		r := report.New()
+		r.UploadProgress("us-east-1", 100, report.UploadProgress{BytesSent: 40, MBPerSecond: 1.5, ETASeconds: 60})
+		r.UploadProgress("us-east-1", 100, report.UploadProgress{BytesSent: 100, MBPerSecond: 2})
+
+		Expect(r.Write(reportPath)).To(Succeed())
+
+		upload := readReport().Regions[0].Upload
+		Expect(upload).ToNot(BeNil())
+		Expect(upload.TotalBytes).To(Equal(int64(100)))
+		Expect(upload.Progress).To(Equal([]report.UploadProgress{
+			{BytesSent: 40, MBPerSecond: 1.5, ETASeconds: 60},
+			{BytesSent: 100, MBPerSecond: 2},
+		}))
+	})
+
+	It("marks the report as failed when any region failed", func() {
+		r := report.New()
+		r.Succeed("us-east-1")
+		r.Fail("us-west-1", errors.New("creating snapshot: some error"))
+
+		Expect(r.Write(reportPath)).To(Succeed())
+
+		written := readReport()
+		Expect(written.Succeeded).To(BeFalse())
+		Expect(written.Regions[1].Status).To(Equal(report.FailedStatus))
+		Expect(written.Regions[1].Errors).To(ConsistOf("creating snapshot: some error"))
+	})
+
+	It("records nothing when it is nil", func() {
+		var r *report.Report
+		r.Update("us-east-1", func(region *report.Region) { Fail("record should not be called") })
+		r.Step("us-east-1", "create_ami", time.Now(), nil)
+		r.Fail("us-east-1", errors.New("some error"))
+
+		Expect(r.Write(reportPath)).To(Succeed())
+		Expect(reportPath).ToNot(BeAnExistingFile())
+	})
+})
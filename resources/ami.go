@@ -1,5 +1,7 @@
 package resources
 
+import "context"
+
 // You only need **one** of these per package!
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
 
@@ -8,6 +10,7 @@ const (
 	PublicAmiAccessibility  = "public"
 	PrivateAmiAccessibility = "private"
 	AmiArchitecture         = "x86_64"
+	Arm64AmiArchitecture    = "arm64"
 	HvmAmiVirtualization    = "hvm"
 )
 
@@ -15,14 +18,30 @@ const (
 //
 //counterfeiter:generate . AmiDriver
 type AmiDriver interface {
-	Create(AmiDriverConfig) (Ami, error)
+	Create(context.Context, AmiDriverConfig) (Ami, error)
+}
+
+// ExistingAmiDriver abstracts the lookup of an AMI that an earlier run already published
+//
+//counterfeiter:generate . ExistingAmiDriver
+type ExistingAmiDriver interface {
+	FindExisting(context.Context, AmiProperties) (Ami, bool, error)
+}
+
+// DeleteAmiDriver abstracts the API calls required to remove an AMI
+//
+//counterfeiter:generate . DeleteAmiDriver
+type DeleteAmiDriver interface {
+	Delete(context.Context, Ami) error
 }
 
 // Ami represents an AMI resource in EC2
 type Ami struct {
-	ID                 string
-	Region             string
-	VirtualizationType string
+	ID                 string `json:"id"`
+	Region             string `json:"region"`
+	VirtualizationType string `json:"virtualization_type"`
+	// Adopted is set when the AMI existed before it was to be created, e.g. from an earlier run
+	Adopted bool `json:"adopted,omitempty"`
 }
 
 // AmiProperties describes what properties the published AMI should have
@@ -31,6 +50,7 @@ type AmiProperties struct {
 	Description        string
 	Name               string
 	VirtualizationType string
+	Architecture       string
 	Efi                bool
 	Encrypted          bool
 	KmsKeyId           string
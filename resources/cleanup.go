@@ -0,0 +1,35 @@
+package resources
+
+import (
+	"context"
+	"time"
+)
+
+// AmiCleanupDriver abstracts the API calls required to find and remove stale AMIs
+//
+//counterfeiter:generate . AmiCleanupDriver
+type AmiCleanupDriver interface {
+	Regions(context.Context) ([]string, error)
+	FindAmis(context.Context, AmiFilter) ([]AmiImage, error)
+	DeregisterAmi(context.Context, AmiImage) error
+	DeleteSnapshot(ctx context.Context, region string, snapshotID string) error
+}
+
+// AmiFilter selects AMIs owned by the account in a region. Empty fields do not filter.
+type AmiFilter struct {
+	Region      string
+	NamePattern string
+	PublicOnly  bool
+	Tags        map[string]string
+	SnapshotID  string
+}
+
+// AmiImage describes an existing AMI and the snapshots backing it
+type AmiImage struct {
+	ID           string    `json:"id"`
+	Region       string    `json:"region"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version,omitempty"`
+	CreationDate time.Time `json:"creation_date"`
+	SnapshotIDs  []string  `json:"snapshot_ids"`
+}
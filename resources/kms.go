@@ -1,16 +1,21 @@
 package resources
 
+import "context"
+
 // KmsDriver abstracts the creation of a snapshot in AWS
 //
 //counterfeiter:generate . KmsDriver
 type KmsDriver interface {
-	CreateAlias(KmsCreateAliasDriverConfig) (KmsAlias, error)
-	ReplicateKey(KmsReplicateKeyDriverConfig) (KmsKey, error)
+	CreateAlias(context.Context, KmsCreateAliasDriverConfig) (KmsAlias, error)
+	ReplicateKey(context.Context, KmsReplicateKeyDriverConfig) (KmsKey, error)
+	DeleteAlias(context.Context, KmsDeleteAliasDriverConfig) error
 }
 
 type KmsAlias struct {
 	ARN         string
 	TargetKeyId string
+	// Created is true when the alias did not exist before CreateAlias
+	Created bool
 }
 
 type KmsKey struct {
@@ -28,3 +33,8 @@ type KmsReplicateKeyDriverConfig struct {
 	SourceRegion string
 	TargetRegion string
 }
+
+type KmsDeleteAliasDriverConfig struct {
+	KmsKeyAliasName string
+	Region          string
+}
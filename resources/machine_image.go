@@ -1,14 +1,26 @@
 package resources
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 //counterfeiter:generate . MachineImageDriver
 type MachineImageDriver interface {
-	Create(MachineImageDriverConfig) (MachineImage, error)
-	Delete(MachineImage) error
+	Create(context.Context, MachineImageDriverConfig) (MachineImage, error)
+	Delete(context.Context, MachineImage) error
 }
 
 type MachineImage struct {
-	GetURL     string
-	DeleteURLs []string
+	GetURL     string   `json:"get_url"`
+	DeleteURLs []string `json:"delete_urls"`
+	// Key is the S3 key the machine image was uploaded to
+	Key string `json:"key,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the uploaded machine image, as verified by S3
+	SHA256 string `json:"sha256,omitempty"`
+	// Reused is set when the machine image was uploaded by an earlier run and not by Create
+	Reused bool `json:"reused,omitempty"`
 }
 
 type MachineImageDriverConfig struct {
@@ -17,4 +29,34 @@ type MachineImageDriverConfig struct {
 	ServerSideEncryption string
 	FileFormat           string
 	VolumeSizeGB         int64
+
+	// ImageSHA256, when set, is the hex encoded SHA-256 checksum of the machine image. The image is uploaded
+	// to a key derived from it, and an image an earlier run uploaded to that key is reused.
+	ImageSHA256 string
+	// Tags are set on the uploaded objects
+	Tags map[string]string
+	// KeepUploadedImage leaves the uploaded machine image in the bucket when the MachineImage is deleted
+	KeepUploadedImage bool
+
+	// OpenMachineImage, when set, opens the machine image for the upload instead of reading MachineImagePath
+	OpenMachineImage func() (io.ReadCloser, error)
+	Upload           UploadSettings
+	// UploadProgress, when set, is called with the progress of the upload at Upload.ProgressInterval and once it finished
+	UploadProgress func(UploadProgress)
+}
+
+// UploadSettings tune the multipart upload of a machine image. Zero values use the AWS SDK defaults.
+type UploadSettings struct {
+	PartSize         int64
+	Concurrency      int
+	ProgressInterval time.Duration
+}
+
+// UploadProgress is the state of a machine image upload
+type UploadProgress struct {
+	BytesSent      int64
+	TotalBytes     int64
+	BytesPerSecond float64
+	// ETA is the estimated time until the upload finishes, at the average rate so far
+	ETA time.Duration
 }
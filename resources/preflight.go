@@ -0,0 +1,40 @@
+package resources
+
+import "context"
+
+// Checks that preflight runs before a publish
+const (
+	PreflightBucket       = "bucket"
+	PreflightVmimportRole = "vmimport-role"
+	PreflightKmsKey       = "kms-key"
+	PreflightAmiName      = "ami-name"
+	PreflightPermissions  = "iam-permissions"
+)
+
+// PreflightDriver abstracts the API calls that check the prerequisites of a publish before anything is uploaded.
+// Every check returns a detail of what it found, and an error when the prerequisite is not met.
+//
+//counterfeiter:generate . PreflightDriver
+type PreflightDriver interface {
+	CheckBucket(ctx context.Context, region string, bucketName string) (string, error)
+	CheckVmimportRole(ctx context.Context, region string) (string, error)
+	CheckKmsKey(ctx context.Context, check KmsKeyCheck) (string, error)
+	CheckAmiName(ctx context.Context, region string, properties AmiProperties) (string, error)
+	CheckPermissions(ctx context.Context, check PermissionsCheck) (string, error)
+}
+
+// KmsKeyCheck describes the KMS key the AMIs of a region are encrypted with. A key that is replicated
+// to the copy destinations must be the primary key of a multi-Region key.
+type KmsKeyCheck struct {
+	Region    string
+	KmsKeyId  string
+	Replicate bool
+}
+
+// PermissionsCheck lists the actions the principal of the credentials of Region calls. The S3 actions
+// are checked on BucketName and its objects, every other action on all resources.
+type PermissionsCheck struct {
+	Region     string
+	BucketName string
+	Actions    []string
+}
@@ -0,0 +1,343 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package resourcesfakes
+
+import (
+	"context"
+	"light-stemcell-builder/resources"
+	"sync"
+)
+
+type FakeAmiCleanupDriver struct {
+	DeleteSnapshotStub        func(context.Context, string, string) error
+	deleteSnapshotMutex       sync.RWMutex
+	deleteSnapshotArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}
+	deleteSnapshotReturns struct {
+		result1 error
+	}
+	deleteSnapshotReturnsOnCall map[int]struct {
+		result1 error
+	}
+	DeregisterAmiStub        func(context.Context, resources.AmiImage) error
+	deregisterAmiMutex       sync.RWMutex
+	deregisterAmiArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.AmiImage
+	}
+	deregisterAmiReturns struct {
+		result1 error
+	}
+	deregisterAmiReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FindAmisStub        func(context.Context, resources.AmiFilter) ([]resources.AmiImage, error)
+	findAmisMutex       sync.RWMutex
+	findAmisArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.AmiFilter
+	}
+	findAmisReturns struct {
+		result1 []resources.AmiImage
+		result2 error
+	}
+	findAmisReturnsOnCall map[int]struct {
+		result1 []resources.AmiImage
+		result2 error
+	}
+	RegionsStub        func(context.Context) ([]string, error)
+	regionsMutex       sync.RWMutex
+	regionsArgsForCall []struct {
+		arg1 context.Context
+	}
+	regionsReturns struct {
+		result1 []string
+		result2 error
+	}
+	regionsReturnsOnCall map[int]struct {
+		result1 []string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshot(arg1 context.Context, arg2 string, arg3 string) error {
+	fake.deleteSnapshotMutex.Lock()
+	ret, specificReturn := fake.deleteSnapshotReturnsOnCall[len(fake.deleteSnapshotArgsForCall)]
+	fake.deleteSnapshotArgsForCall = append(fake.deleteSnapshotArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.DeleteSnapshotStub
+	fakeReturns := fake.deleteSnapshotReturns
+	fake.recordInvocation("DeleteSnapshot", []interface{}{arg1, arg2, arg3})
+	fake.deleteSnapshotMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshotCallCount() int {
+	fake.deleteSnapshotMutex.RLock()
+	defer fake.deleteSnapshotMutex.RUnlock()
+	return len(fake.deleteSnapshotArgsForCall)
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshotCalls(stub func(context.Context, string, string) error) {
+	fake.deleteSnapshotMutex.Lock()
+	defer fake.deleteSnapshotMutex.Unlock()
+	fake.DeleteSnapshotStub = stub
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshotArgsForCall(i int) (context.Context, string, string) {
+	fake.deleteSnapshotMutex.RLock()
+	defer fake.deleteSnapshotMutex.RUnlock()
+	argsForCall := fake.deleteSnapshotArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshotReturns(result1 error) {
+	fake.deleteSnapshotMutex.Lock()
+	defer fake.deleteSnapshotMutex.Unlock()
+	fake.DeleteSnapshotStub = nil
+	fake.deleteSnapshotReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAmiCleanupDriver) DeleteSnapshotReturnsOnCall(i int, result1 error) {
+	fake.deleteSnapshotMutex.Lock()
+	defer fake.deleteSnapshotMutex.Unlock()
+	fake.DeleteSnapshotStub = nil
+	if fake.deleteSnapshotReturnsOnCall == nil {
+		fake.deleteSnapshotReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deleteSnapshotReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmi(arg1 context.Context, arg2 resources.AmiImage) error {
+	fake.deregisterAmiMutex.Lock()
+	ret, specificReturn := fake.deregisterAmiReturnsOnCall[len(fake.deregisterAmiArgsForCall)]
+	fake.deregisterAmiArgsForCall = append(fake.deregisterAmiArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.AmiImage
+	}{arg1, arg2})
+	stub := fake.DeregisterAmiStub
+	fakeReturns := fake.deregisterAmiReturns
+	fake.recordInvocation("DeregisterAmi", []interface{}{arg1, arg2})
+	fake.deregisterAmiMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmiCallCount() int {
+	fake.deregisterAmiMutex.RLock()
+	defer fake.deregisterAmiMutex.RUnlock()
+	return len(fake.deregisterAmiArgsForCall)
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmiCalls(stub func(context.Context, resources.AmiImage) error) {
+	fake.deregisterAmiMutex.Lock()
+	defer fake.deregisterAmiMutex.Unlock()
+	fake.DeregisterAmiStub = stub
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmiArgsForCall(i int) (context.Context, resources.AmiImage) {
+	fake.deregisterAmiMutex.RLock()
+	defer fake.deregisterAmiMutex.RUnlock()
+	argsForCall := fake.deregisterAmiArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmiReturns(result1 error) {
+	fake.deregisterAmiMutex.Lock()
+	defer fake.deregisterAmiMutex.Unlock()
+	fake.DeregisterAmiStub = nil
+	fake.deregisterAmiReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAmiCleanupDriver) DeregisterAmiReturnsOnCall(i int, result1 error) {
+	fake.deregisterAmiMutex.Lock()
+	defer fake.deregisterAmiMutex.Unlock()
+	fake.DeregisterAmiStub = nil
+	if fake.deregisterAmiReturnsOnCall == nil {
+		fake.deregisterAmiReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deregisterAmiReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmis(arg1 context.Context, arg2 resources.AmiFilter) ([]resources.AmiImage, error) {
+	fake.findAmisMutex.Lock()
+	ret, specificReturn := fake.findAmisReturnsOnCall[len(fake.findAmisArgsForCall)]
+	fake.findAmisArgsForCall = append(fake.findAmisArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.AmiFilter
+	}{arg1, arg2})
+	stub := fake.FindAmisStub
+	fakeReturns := fake.findAmisReturns
+	fake.recordInvocation("FindAmis", []interface{}{arg1, arg2})
+	fake.findAmisMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmisCallCount() int {
+	fake.findAmisMutex.RLock()
+	defer fake.findAmisMutex.RUnlock()
+	return len(fake.findAmisArgsForCall)
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmisCalls(stub func(context.Context, resources.AmiFilter) ([]resources.AmiImage, error)) {
+	fake.findAmisMutex.Lock()
+	defer fake.findAmisMutex.Unlock()
+	fake.FindAmisStub = stub
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmisArgsForCall(i int) (context.Context, resources.AmiFilter) {
+	fake.findAmisMutex.RLock()
+	defer fake.findAmisMutex.RUnlock()
+	argsForCall := fake.findAmisArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmisReturns(result1 []resources.AmiImage, result2 error) {
+	fake.findAmisMutex.Lock()
+	defer fake.findAmisMutex.Unlock()
+	fake.FindAmisStub = nil
+	fake.findAmisReturns = struct {
+		result1 []resources.AmiImage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAmiCleanupDriver) FindAmisReturnsOnCall(i int, result1 []resources.AmiImage, result2 error) {
+	fake.findAmisMutex.Lock()
+	defer fake.findAmisMutex.Unlock()
+	fake.FindAmisStub = nil
+	if fake.findAmisReturnsOnCall == nil {
+		fake.findAmisReturnsOnCall = make(map[int]struct {
+			result1 []resources.AmiImage
+			result2 error
+		})
+	}
+	fake.findAmisReturnsOnCall[i] = struct {
+		result1 []resources.AmiImage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAmiCleanupDriver) Regions(arg1 context.Context) ([]string, error) {
+	fake.regionsMutex.Lock()
+	ret, specificReturn := fake.regionsReturnsOnCall[len(fake.regionsArgsForCall)]
+	fake.regionsArgsForCall = append(fake.regionsArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	stub := fake.RegionsStub
+	fakeReturns := fake.regionsReturns
+	fake.recordInvocation("Regions", []interface{}{arg1})
+	fake.regionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeAmiCleanupDriver) RegionsCallCount() int {
+	fake.regionsMutex.RLock()
+	defer fake.regionsMutex.RUnlock()
+	return len(fake.regionsArgsForCall)
+}
+
+func (fake *FakeAmiCleanupDriver) RegionsCalls(stub func(context.Context) ([]string, error)) {
+	fake.regionsMutex.Lock()
+	defer fake.regionsMutex.Unlock()
+	fake.RegionsStub = stub
+}
+
+func (fake *FakeAmiCleanupDriver) RegionsArgsForCall(i int) context.Context {
+	fake.regionsMutex.RLock()
+	defer fake.regionsMutex.RUnlock()
+	argsForCall := fake.regionsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeAmiCleanupDriver) RegionsReturns(result1 []string, result2 error) {
+	fake.regionsMutex.Lock()
+	defer fake.regionsMutex.Unlock()
+	fake.RegionsStub = nil
+	fake.regionsReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAmiCleanupDriver) RegionsReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.regionsMutex.Lock()
+	defer fake.regionsMutex.Unlock()
+	fake.RegionsStub = nil
+	if fake.regionsReturnsOnCall == nil {
+		fake.regionsReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.regionsReturnsOnCall[i] = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeAmiCleanupDriver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeAmiCleanupDriver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ resources.AmiCleanupDriver = new(FakeAmiCleanupDriver)
@@ -2,15 +2,17 @@
 package resourcesfakes
 
 import (
+	"context"
 	"light-stemcell-builder/resources"
 	"sync"
 )
 
 type FakeAmiDriver struct {
-	CreateStub        func(resources.AmiDriverConfig) (resources.Ami, error)
+	CreateStub        func(context.Context, resources.AmiDriverConfig) (resources.Ami, error)
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
-		arg1 resources.AmiDriverConfig
+		arg1 context.Context
+		arg2 resources.AmiDriverConfig
 	}
 	createReturns struct {
 		result1 resources.Ami
@@ -24,18 +26,19 @@ type FakeAmiDriver struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeAmiDriver) Create(arg1 resources.AmiDriverConfig) (resources.Ami, error) {
+func (fake *FakeAmiDriver) Create(arg1 context.Context, arg2 resources.AmiDriverConfig) (resources.Ami, error) {
 	fake.createMutex.Lock()
 	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
-		arg1 resources.AmiDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.AmiDriverConfig
+	}{arg1, arg2})
 	stub := fake.CreateStub
 	fakeReturns := fake.createReturns
-	fake.recordInvocation("Create", []interface{}{arg1})
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
 	fake.createMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -49,17 +52,17 @@ func (fake *FakeAmiDriver) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeAmiDriver) CreateCalls(stub func(resources.AmiDriverConfig) (resources.Ami, error)) {
+func (fake *FakeAmiDriver) CreateCalls(stub func(context.Context, resources.AmiDriverConfig) (resources.Ami, error)) {
 	fake.createMutex.Lock()
 	defer fake.createMutex.Unlock()
 	fake.CreateStub = stub
 }
 
-func (fake *FakeAmiDriver) CreateArgsForCall(i int) resources.AmiDriverConfig {
+func (fake *FakeAmiDriver) CreateArgsForCall(i int) (context.Context, resources.AmiDriverConfig) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
 	argsForCall := fake.createArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeAmiDriver) CreateReturns(result1 resources.Ami, result2 error) {
@@ -91,8 +94,6 @@ func (fake *FakeAmiDriver) CreateReturnsOnCall(i int, result1 resources.Ami, res
 func (fake *FakeAmiDriver) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.createMutex.RLock()
-	defer fake.createMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
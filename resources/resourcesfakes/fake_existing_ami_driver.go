@@ -0,0 +1,121 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package resourcesfakes
+
+import (
+	"context"
+	"light-stemcell-builder/resources"
+	"sync"
+)
+
+type FakeExistingAmiDriver struct {
+	FindExistingStub        func(context.Context, resources.AmiProperties) (resources.Ami, bool, error)
+	findExistingMutex       sync.RWMutex
+	findExistingArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.AmiProperties
+	}
+	findExistingReturns struct {
+		result1 resources.Ami
+		result2 bool
+		result3 error
+	}
+	findExistingReturnsOnCall map[int]struct {
+		result1 resources.Ami
+		result2 bool
+		result3 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeExistingAmiDriver) FindExisting(arg1 context.Context, arg2 resources.AmiProperties) (resources.Ami, bool, error) {
+	fake.findExistingMutex.Lock()
+	ret, specificReturn := fake.findExistingReturnsOnCall[len(fake.findExistingArgsForCall)]
+	fake.findExistingArgsForCall = append(fake.findExistingArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.AmiProperties
+	}{arg1, arg2})
+	stub := fake.FindExistingStub
+	fakeReturns := fake.findExistingReturns
+	fake.recordInvocation("FindExisting", []interface{}{arg1, arg2})
+	fake.findExistingMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeExistingAmiDriver) FindExistingCallCount() int {
+	fake.findExistingMutex.RLock()
+	defer fake.findExistingMutex.RUnlock()
+	return len(fake.findExistingArgsForCall)
+}
+
+func (fake *FakeExistingAmiDriver) FindExistingCalls(stub func(context.Context, resources.AmiProperties) (resources.Ami, bool, error)) {
+	fake.findExistingMutex.Lock()
+	defer fake.findExistingMutex.Unlock()
+	fake.FindExistingStub = stub
+}
+
+func (fake *FakeExistingAmiDriver) FindExistingArgsForCall(i int) (context.Context, resources.AmiProperties) {
+	fake.findExistingMutex.RLock()
+	defer fake.findExistingMutex.RUnlock()
+	argsForCall := fake.findExistingArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeExistingAmiDriver) FindExistingReturns(result1 resources.Ami, result2 bool, result3 error) {
+	fake.findExistingMutex.Lock()
+	defer fake.findExistingMutex.Unlock()
+	fake.FindExistingStub = nil
+	fake.findExistingReturns = struct {
+		result1 resources.Ami
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeExistingAmiDriver) FindExistingReturnsOnCall(i int, result1 resources.Ami, result2 bool, result3 error) {
+	fake.findExistingMutex.Lock()
+	defer fake.findExistingMutex.Unlock()
+	fake.FindExistingStub = nil
+	if fake.findExistingReturnsOnCall == nil {
+		fake.findExistingReturnsOnCall = make(map[int]struct {
+			result1 resources.Ami
+			result2 bool
+			result3 error
+		})
+	}
+	fake.findExistingReturnsOnCall[i] = struct {
+		result1 resources.Ami
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeExistingAmiDriver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeExistingAmiDriver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ resources.ExistingAmiDriver = new(FakeExistingAmiDriver)
@@ -2,15 +2,17 @@
 package resourcesfakes
 
 import (
+	"context"
 	"light-stemcell-builder/resources"
 	"sync"
 )
 
 type FakeKmsDriver struct {
-	CreateAliasStub        func(resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error)
+	CreateAliasStub        func(context.Context, resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error)
 	createAliasMutex       sync.RWMutex
 	createAliasArgsForCall []struct {
-		arg1 resources.KmsCreateAliasDriverConfig
+		arg1 context.Context
+		arg2 resources.KmsCreateAliasDriverConfig
 	}
 	createAliasReturns struct {
 		result1 resources.KmsAlias
@@ -20,10 +22,23 @@ type FakeKmsDriver struct {
 		result1 resources.KmsAlias
 		result2 error
 	}
-	ReplicateKeyStub        func(resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error)
+	DeleteAliasStub        func(context.Context, resources.KmsDeleteAliasDriverConfig) error
+	deleteAliasMutex       sync.RWMutex
+	deleteAliasArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.KmsDeleteAliasDriverConfig
+	}
+	deleteAliasReturns struct {
+		result1 error
+	}
+	deleteAliasReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ReplicateKeyStub        func(context.Context, resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error)
 	replicateKeyMutex       sync.RWMutex
 	replicateKeyArgsForCall []struct {
-		arg1 resources.KmsReplicateKeyDriverConfig
+		arg1 context.Context
+		arg2 resources.KmsReplicateKeyDriverConfig
 	}
 	replicateKeyReturns struct {
 		result1 resources.KmsKey
@@ -37,18 +52,19 @@ type FakeKmsDriver struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeKmsDriver) CreateAlias(arg1 resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error) {
+func (fake *FakeKmsDriver) CreateAlias(arg1 context.Context, arg2 resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error) {
 	fake.createAliasMutex.Lock()
 	ret, specificReturn := fake.createAliasReturnsOnCall[len(fake.createAliasArgsForCall)]
 	fake.createAliasArgsForCall = append(fake.createAliasArgsForCall, struct {
-		arg1 resources.KmsCreateAliasDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.KmsCreateAliasDriverConfig
+	}{arg1, arg2})
 	stub := fake.CreateAliasStub
 	fakeReturns := fake.createAliasReturns
-	fake.recordInvocation("CreateAlias", []interface{}{arg1})
+	fake.recordInvocation("CreateAlias", []interface{}{arg1, arg2})
 	fake.createAliasMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -62,17 +78,17 @@ func (fake *FakeKmsDriver) CreateAliasCallCount() int {
 	return len(fake.createAliasArgsForCall)
 }
 
-func (fake *FakeKmsDriver) CreateAliasCalls(stub func(resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error)) {
+func (fake *FakeKmsDriver) CreateAliasCalls(stub func(context.Context, resources.KmsCreateAliasDriverConfig) (resources.KmsAlias, error)) {
 	fake.createAliasMutex.Lock()
 	defer fake.createAliasMutex.Unlock()
 	fake.CreateAliasStub = stub
 }
 
-func (fake *FakeKmsDriver) CreateAliasArgsForCall(i int) resources.KmsCreateAliasDriverConfig {
+func (fake *FakeKmsDriver) CreateAliasArgsForCall(i int) (context.Context, resources.KmsCreateAliasDriverConfig) {
 	fake.createAliasMutex.RLock()
 	defer fake.createAliasMutex.RUnlock()
 	argsForCall := fake.createAliasArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeKmsDriver) CreateAliasReturns(result1 resources.KmsAlias, result2 error) {
@@ -101,18 +117,81 @@ func (fake *FakeKmsDriver) CreateAliasReturnsOnCall(i int, result1 resources.Kms
 	}{result1, result2}
 }
 
-func (fake *FakeKmsDriver) ReplicateKey(arg1 resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error) {
+func (fake *FakeKmsDriver) DeleteAlias(arg1 context.Context, arg2 resources.KmsDeleteAliasDriverConfig) error {
+	fake.deleteAliasMutex.Lock()
+	ret, specificReturn := fake.deleteAliasReturnsOnCall[len(fake.deleteAliasArgsForCall)]
+	fake.deleteAliasArgsForCall = append(fake.deleteAliasArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.KmsDeleteAliasDriverConfig
+	}{arg1, arg2})
+	stub := fake.DeleteAliasStub
+	fakeReturns := fake.deleteAliasReturns
+	fake.recordInvocation("DeleteAlias", []interface{}{arg1, arg2})
+	fake.deleteAliasMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeKmsDriver) DeleteAliasCallCount() int {
+	fake.deleteAliasMutex.RLock()
+	defer fake.deleteAliasMutex.RUnlock()
+	return len(fake.deleteAliasArgsForCall)
+}
+
+func (fake *FakeKmsDriver) DeleteAliasCalls(stub func(context.Context, resources.KmsDeleteAliasDriverConfig) error) {
+	fake.deleteAliasMutex.Lock()
+	defer fake.deleteAliasMutex.Unlock()
+	fake.DeleteAliasStub = stub
+}
+
+func (fake *FakeKmsDriver) DeleteAliasArgsForCall(i int) (context.Context, resources.KmsDeleteAliasDriverConfig) {
+	fake.deleteAliasMutex.RLock()
+	defer fake.deleteAliasMutex.RUnlock()
+	argsForCall := fake.deleteAliasArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKmsDriver) DeleteAliasReturns(result1 error) {
+	fake.deleteAliasMutex.Lock()
+	defer fake.deleteAliasMutex.Unlock()
+	fake.DeleteAliasStub = nil
+	fake.deleteAliasReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKmsDriver) DeleteAliasReturnsOnCall(i int, result1 error) {
+	fake.deleteAliasMutex.Lock()
+	defer fake.deleteAliasMutex.Unlock()
+	fake.DeleteAliasStub = nil
+	if fake.deleteAliasReturnsOnCall == nil {
+		fake.deleteAliasReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deleteAliasReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKmsDriver) ReplicateKey(arg1 context.Context, arg2 resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error) {
 	fake.replicateKeyMutex.Lock()
 	ret, specificReturn := fake.replicateKeyReturnsOnCall[len(fake.replicateKeyArgsForCall)]
 	fake.replicateKeyArgsForCall = append(fake.replicateKeyArgsForCall, struct {
-		arg1 resources.KmsReplicateKeyDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.KmsReplicateKeyDriverConfig
+	}{arg1, arg2})
 	stub := fake.ReplicateKeyStub
 	fakeReturns := fake.replicateKeyReturns
-	fake.recordInvocation("ReplicateKey", []interface{}{arg1})
+	fake.recordInvocation("ReplicateKey", []interface{}{arg1, arg2})
 	fake.replicateKeyMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -126,17 +205,17 @@ func (fake *FakeKmsDriver) ReplicateKeyCallCount() int {
 	return len(fake.replicateKeyArgsForCall)
 }
 
-func (fake *FakeKmsDriver) ReplicateKeyCalls(stub func(resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error)) {
+func (fake *FakeKmsDriver) ReplicateKeyCalls(stub func(context.Context, resources.KmsReplicateKeyDriverConfig) (resources.KmsKey, error)) {
 	fake.replicateKeyMutex.Lock()
 	defer fake.replicateKeyMutex.Unlock()
 	fake.ReplicateKeyStub = stub
 }
 
-func (fake *FakeKmsDriver) ReplicateKeyArgsForCall(i int) resources.KmsReplicateKeyDriverConfig {
+func (fake *FakeKmsDriver) ReplicateKeyArgsForCall(i int) (context.Context, resources.KmsReplicateKeyDriverConfig) {
 	fake.replicateKeyMutex.RLock()
 	defer fake.replicateKeyMutex.RUnlock()
 	argsForCall := fake.replicateKeyArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeKmsDriver) ReplicateKeyReturns(result1 resources.KmsKey, result2 error) {
@@ -168,10 +247,6 @@ func (fake *FakeKmsDriver) ReplicateKeyReturnsOnCall(i int, result1 resources.Km
 func (fake *FakeKmsDriver) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.createAliasMutex.RLock()
-	defer fake.createAliasMutex.RUnlock()
-	fake.replicateKeyMutex.RLock()
-	defer fake.replicateKeyMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -2,15 +2,17 @@
 package resourcesfakes
 
 import (
+	"context"
 	"light-stemcell-builder/resources"
 	"sync"
 )
 
 type FakeMachineImageDriver struct {
-	CreateStub        func(resources.MachineImageDriverConfig) (resources.MachineImage, error)
+	CreateStub        func(context.Context, resources.MachineImageDriverConfig) (resources.MachineImage, error)
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
-		arg1 resources.MachineImageDriverConfig
+		arg1 context.Context
+		arg2 resources.MachineImageDriverConfig
 	}
 	createReturns struct {
 		result1 resources.MachineImage
@@ -20,10 +22,11 @@ type FakeMachineImageDriver struct {
 		result1 resources.MachineImage
 		result2 error
 	}
-	DeleteStub        func(resources.MachineImage) error
+	DeleteStub        func(context.Context, resources.MachineImage) error
 	deleteMutex       sync.RWMutex
 	deleteArgsForCall []struct {
-		arg1 resources.MachineImage
+		arg1 context.Context
+		arg2 resources.MachineImage
 	}
 	deleteReturns struct {
 		result1 error
@@ -35,18 +38,19 @@ type FakeMachineImageDriver struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeMachineImageDriver) Create(arg1 resources.MachineImageDriverConfig) (resources.MachineImage, error) {
+func (fake *FakeMachineImageDriver) Create(arg1 context.Context, arg2 resources.MachineImageDriverConfig) (resources.MachineImage, error) {
 	fake.createMutex.Lock()
 	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
-		arg1 resources.MachineImageDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.MachineImageDriverConfig
+	}{arg1, arg2})
 	stub := fake.CreateStub
 	fakeReturns := fake.createReturns
-	fake.recordInvocation("Create", []interface{}{arg1})
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
 	fake.createMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -60,17 +64,17 @@ func (fake *FakeMachineImageDriver) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeMachineImageDriver) CreateCalls(stub func(resources.MachineImageDriverConfig) (resources.MachineImage, error)) {
+func (fake *FakeMachineImageDriver) CreateCalls(stub func(context.Context, resources.MachineImageDriverConfig) (resources.MachineImage, error)) {
 	fake.createMutex.Lock()
 	defer fake.createMutex.Unlock()
 	fake.CreateStub = stub
 }
 
-func (fake *FakeMachineImageDriver) CreateArgsForCall(i int) resources.MachineImageDriverConfig {
+func (fake *FakeMachineImageDriver) CreateArgsForCall(i int) (context.Context, resources.MachineImageDriverConfig) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
 	argsForCall := fake.createArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeMachineImageDriver) CreateReturns(result1 resources.MachineImage, result2 error) {
@@ -99,18 +103,19 @@ func (fake *FakeMachineImageDriver) CreateReturnsOnCall(i int, result1 resources
 	}{result1, result2}
 }
 
-func (fake *FakeMachineImageDriver) Delete(arg1 resources.MachineImage) error {
+func (fake *FakeMachineImageDriver) Delete(arg1 context.Context, arg2 resources.MachineImage) error {
 	fake.deleteMutex.Lock()
 	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
-		arg1 resources.MachineImage
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.MachineImage
+	}{arg1, arg2})
 	stub := fake.DeleteStub
 	fakeReturns := fake.deleteReturns
-	fake.recordInvocation("Delete", []interface{}{arg1})
+	fake.recordInvocation("Delete", []interface{}{arg1, arg2})
 	fake.deleteMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -124,17 +129,17 @@ func (fake *FakeMachineImageDriver) DeleteCallCount() int {
 	return len(fake.deleteArgsForCall)
 }
 
-func (fake *FakeMachineImageDriver) DeleteCalls(stub func(resources.MachineImage) error) {
+func (fake *FakeMachineImageDriver) DeleteCalls(stub func(context.Context, resources.MachineImage) error) {
 	fake.deleteMutex.Lock()
 	defer fake.deleteMutex.Unlock()
 	fake.DeleteStub = stub
 }
 
-func (fake *FakeMachineImageDriver) DeleteArgsForCall(i int) resources.MachineImage {
+func (fake *FakeMachineImageDriver) DeleteArgsForCall(i int) (context.Context, resources.MachineImage) {
 	fake.deleteMutex.RLock()
 	defer fake.deleteMutex.RUnlock()
 	argsForCall := fake.deleteArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeMachineImageDriver) DeleteReturns(result1 error) {
@@ -163,10 +168,6 @@ func (fake *FakeMachineImageDriver) DeleteReturnsOnCall(i int, result1 error) {
 func (fake *FakeMachineImageDriver) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.createMutex.RLock()
-	defer fake.createMutex.RUnlock()
-	fake.deleteMutex.RLock()
-	defer fake.deleteMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,436 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package resourcesfakes
+
+import (
+	"context"
+	"light-stemcell-builder/resources"
+	"sync"
+)
+
+type FakePreflightDriver struct {
+	CheckAmiNameStub        func(context.Context, string, resources.AmiProperties) (string, error)
+	checkAmiNameMutex       sync.RWMutex
+	checkAmiNameArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 resources.AmiProperties
+	}
+	checkAmiNameReturns struct {
+		result1 string
+		result2 error
+	}
+	checkAmiNameReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	CheckBucketStub        func(context.Context, string, string) (string, error)
+	checkBucketMutex       sync.RWMutex
+	checkBucketArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}
+	checkBucketReturns struct {
+		result1 string
+		result2 error
+	}
+	checkBucketReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	CheckKmsKeyStub        func(context.Context, resources.KmsKeyCheck) (string, error)
+	checkKmsKeyMutex       sync.RWMutex
+	checkKmsKeyArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.KmsKeyCheck
+	}
+	checkKmsKeyReturns struct {
+		result1 string
+		result2 error
+	}
+	checkKmsKeyReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	CheckPermissionsStub        func(context.Context, resources.PermissionsCheck) (string, error)
+	checkPermissionsMutex       sync.RWMutex
+	checkPermissionsArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.PermissionsCheck
+	}
+	checkPermissionsReturns struct {
+		result1 string
+		result2 error
+	}
+	checkPermissionsReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	CheckVmimportRoleStub        func(context.Context, string) (string, error)
+	checkVmimportRoleMutex       sync.RWMutex
+	checkVmimportRoleArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+	}
+	checkVmimportRoleReturns struct {
+		result1 string
+		result2 error
+	}
+	checkVmimportRoleReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakePreflightDriver) CheckAmiName(arg1 context.Context, arg2 string, arg3 resources.AmiProperties) (string, error) {
+	fake.checkAmiNameMutex.Lock()
+	ret, specificReturn := fake.checkAmiNameReturnsOnCall[len(fake.checkAmiNameArgsForCall)]
+	fake.checkAmiNameArgsForCall = append(fake.checkAmiNameArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 resources.AmiProperties
+	}{arg1, arg2, arg3})
+	stub := fake.CheckAmiNameStub
+	fakeReturns := fake.checkAmiNameReturns
+	fake.recordInvocation("CheckAmiName", []interface{}{arg1, arg2, arg3})
+	fake.checkAmiNameMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePreflightDriver) CheckAmiNameCallCount() int {
+	fake.checkAmiNameMutex.RLock()
+	defer fake.checkAmiNameMutex.RUnlock()
+	return len(fake.checkAmiNameArgsForCall)
+}
+
+func (fake *FakePreflightDriver) CheckAmiNameCalls(stub func(context.Context, string, resources.AmiProperties) (string, error)) {
+	fake.checkAmiNameMutex.Lock()
+	defer fake.checkAmiNameMutex.Unlock()
+	fake.CheckAmiNameStub = stub
+}
+
+func (fake *FakePreflightDriver) CheckAmiNameArgsForCall(i int) (context.Context, string, resources.AmiProperties) {
+	fake.checkAmiNameMutex.RLock()
+	defer fake.checkAmiNameMutex.RUnlock()
+	argsForCall := fake.checkAmiNameArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakePreflightDriver) CheckAmiNameReturns(result1 string, result2 error) {
+	fake.checkAmiNameMutex.Lock()
+	defer fake.checkAmiNameMutex.Unlock()
+	fake.CheckAmiNameStub = nil
+	fake.checkAmiNameReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckAmiNameReturnsOnCall(i int, result1 string, result2 error) {
+	fake.checkAmiNameMutex.Lock()
+	defer fake.checkAmiNameMutex.Unlock()
+	fake.CheckAmiNameStub = nil
+	if fake.checkAmiNameReturnsOnCall == nil {
+		fake.checkAmiNameReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.checkAmiNameReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckBucket(arg1 context.Context, arg2 string, arg3 string) (string, error) {
+	fake.checkBucketMutex.Lock()
+	ret, specificReturn := fake.checkBucketReturnsOnCall[len(fake.checkBucketArgsForCall)]
+	fake.checkBucketArgsForCall = append(fake.checkBucketArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.CheckBucketStub
+	fakeReturns := fake.checkBucketReturns
+	fake.recordInvocation("CheckBucket", []interface{}{arg1, arg2, arg3})
+	fake.checkBucketMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePreflightDriver) CheckBucketCallCount() int {
+	fake.checkBucketMutex.RLock()
+	defer fake.checkBucketMutex.RUnlock()
+	return len(fake.checkBucketArgsForCall)
+}
+
+func (fake *FakePreflightDriver) CheckBucketCalls(stub func(context.Context, string, string) (string, error)) {
+	fake.checkBucketMutex.Lock()
+	defer fake.checkBucketMutex.Unlock()
+	fake.CheckBucketStub = stub
+}
+
+func (fake *FakePreflightDriver) CheckBucketArgsForCall(i int) (context.Context, string, string) {
+	fake.checkBucketMutex.RLock()
+	defer fake.checkBucketMutex.RUnlock()
+	argsForCall := fake.checkBucketArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakePreflightDriver) CheckBucketReturns(result1 string, result2 error) {
+	fake.checkBucketMutex.Lock()
+	defer fake.checkBucketMutex.Unlock()
+	fake.CheckBucketStub = nil
+	fake.checkBucketReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckBucketReturnsOnCall(i int, result1 string, result2 error) {
+	fake.checkBucketMutex.Lock()
+	defer fake.checkBucketMutex.Unlock()
+	fake.CheckBucketStub = nil
+	if fake.checkBucketReturnsOnCall == nil {
+		fake.checkBucketReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.checkBucketReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckKmsKey(arg1 context.Context, arg2 resources.KmsKeyCheck) (string, error) {
+	fake.checkKmsKeyMutex.Lock()
+	ret, specificReturn := fake.checkKmsKeyReturnsOnCall[len(fake.checkKmsKeyArgsForCall)]
+	fake.checkKmsKeyArgsForCall = append(fake.checkKmsKeyArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.KmsKeyCheck
+	}{arg1, arg2})
+	stub := fake.CheckKmsKeyStub
+	fakeReturns := fake.checkKmsKeyReturns
+	fake.recordInvocation("CheckKmsKey", []interface{}{arg1, arg2})
+	fake.checkKmsKeyMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePreflightDriver) CheckKmsKeyCallCount() int {
+	fake.checkKmsKeyMutex.RLock()
+	defer fake.checkKmsKeyMutex.RUnlock()
+	return len(fake.checkKmsKeyArgsForCall)
+}
+
+func (fake *FakePreflightDriver) CheckKmsKeyCalls(stub func(context.Context, resources.KmsKeyCheck) (string, error)) {
+	fake.checkKmsKeyMutex.Lock()
+	defer fake.checkKmsKeyMutex.Unlock()
+	fake.CheckKmsKeyStub = stub
+}
+
+func (fake *FakePreflightDriver) CheckKmsKeyArgsForCall(i int) (context.Context, resources.KmsKeyCheck) {
+	fake.checkKmsKeyMutex.RLock()
+	defer fake.checkKmsKeyMutex.RUnlock()
+	argsForCall := fake.checkKmsKeyArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakePreflightDriver) CheckKmsKeyReturns(result1 string, result2 error) {
+	fake.checkKmsKeyMutex.Lock()
+	defer fake.checkKmsKeyMutex.Unlock()
+	fake.CheckKmsKeyStub = nil
+	fake.checkKmsKeyReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckKmsKeyReturnsOnCall(i int, result1 string, result2 error) {
+	fake.checkKmsKeyMutex.Lock()
+	defer fake.checkKmsKeyMutex.Unlock()
+	fake.CheckKmsKeyStub = nil
+	if fake.checkKmsKeyReturnsOnCall == nil {
+		fake.checkKmsKeyReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.checkKmsKeyReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckPermissions(arg1 context.Context, arg2 resources.PermissionsCheck) (string, error) {
+	fake.checkPermissionsMutex.Lock()
+	ret, specificReturn := fake.checkPermissionsReturnsOnCall[len(fake.checkPermissionsArgsForCall)]
+	fake.checkPermissionsArgsForCall = append(fake.checkPermissionsArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.PermissionsCheck
+	}{arg1, arg2})
+	stub := fake.CheckPermissionsStub
+	fakeReturns := fake.checkPermissionsReturns
+	fake.recordInvocation("CheckPermissions", []interface{}{arg1, arg2})
+	fake.checkPermissionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePreflightDriver) CheckPermissionsCallCount() int {
+	fake.checkPermissionsMutex.RLock()
+	defer fake.checkPermissionsMutex.RUnlock()
+	return len(fake.checkPermissionsArgsForCall)
+}
+
+func (fake *FakePreflightDriver) CheckPermissionsCalls(stub func(context.Context, resources.PermissionsCheck) (string, error)) {
+	fake.checkPermissionsMutex.Lock()
+	defer fake.checkPermissionsMutex.Unlock()
+	fake.CheckPermissionsStub = stub
+}
+
+func (fake *FakePreflightDriver) CheckPermissionsArgsForCall(i int) (context.Context, resources.PermissionsCheck) {
+	fake.checkPermissionsMutex.RLock()
+	defer fake.checkPermissionsMutex.RUnlock()
+	argsForCall := fake.checkPermissionsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakePreflightDriver) CheckPermissionsReturns(result1 string, result2 error) {
+	fake.checkPermissionsMutex.Lock()
+	defer fake.checkPermissionsMutex.Unlock()
+	fake.CheckPermissionsStub = nil
+	fake.checkPermissionsReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckPermissionsReturnsOnCall(i int, result1 string, result2 error) {
+	fake.checkPermissionsMutex.Lock()
+	defer fake.checkPermissionsMutex.Unlock()
+	fake.CheckPermissionsStub = nil
+	if fake.checkPermissionsReturnsOnCall == nil {
+		fake.checkPermissionsReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.checkPermissionsReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRole(arg1 context.Context, arg2 string) (string, error) {
+	fake.checkVmimportRoleMutex.Lock()
+	ret, specificReturn := fake.checkVmimportRoleReturnsOnCall[len(fake.checkVmimportRoleArgsForCall)]
+	fake.checkVmimportRoleArgsForCall = append(fake.checkVmimportRoleArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.CheckVmimportRoleStub
+	fakeReturns := fake.checkVmimportRoleReturns
+	fake.recordInvocation("CheckVmimportRole", []interface{}{arg1, arg2})
+	fake.checkVmimportRoleMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRoleCallCount() int {
+	fake.checkVmimportRoleMutex.RLock()
+	defer fake.checkVmimportRoleMutex.RUnlock()
+	return len(fake.checkVmimportRoleArgsForCall)
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRoleCalls(stub func(context.Context, string) (string, error)) {
+	fake.checkVmimportRoleMutex.Lock()
+	defer fake.checkVmimportRoleMutex.Unlock()
+	fake.CheckVmimportRoleStub = stub
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRoleArgsForCall(i int) (context.Context, string) {
+	fake.checkVmimportRoleMutex.RLock()
+	defer fake.checkVmimportRoleMutex.RUnlock()
+	argsForCall := fake.checkVmimportRoleArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRoleReturns(result1 string, result2 error) {
+	fake.checkVmimportRoleMutex.Lock()
+	defer fake.checkVmimportRoleMutex.Unlock()
+	fake.CheckVmimportRoleStub = nil
+	fake.checkVmimportRoleReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) CheckVmimportRoleReturnsOnCall(i int, result1 string, result2 error) {
+	fake.checkVmimportRoleMutex.Lock()
+	defer fake.checkVmimportRoleMutex.Unlock()
+	fake.CheckVmimportRoleStub = nil
+	if fake.checkVmimportRoleReturnsOnCall == nil {
+		fake.checkVmimportRoleReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.checkVmimportRoleReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePreflightDriver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakePreflightDriver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ resources.PreflightDriver = new(FakePreflightDriver)
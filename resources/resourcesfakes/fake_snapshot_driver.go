@@ -2,15 +2,17 @@
 package resourcesfakes
 
 import (
+	"context"
 	"light-stemcell-builder/resources"
 	"sync"
 )
 
 type FakeSnapshotDriver struct {
-	CreateStub        func(resources.SnapshotDriverConfig) (resources.Snapshot, error)
+	CreateStub        func(context.Context, resources.SnapshotDriverConfig) (resources.Snapshot, error)
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
-		arg1 resources.SnapshotDriverConfig
+		arg1 context.Context
+		arg2 resources.SnapshotDriverConfig
 	}
 	createReturns struct {
 		result1 resources.Snapshot
@@ -24,18 +26,19 @@ type FakeSnapshotDriver struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeSnapshotDriver) Create(arg1 resources.SnapshotDriverConfig) (resources.Snapshot, error) {
+func (fake *FakeSnapshotDriver) Create(arg1 context.Context, arg2 resources.SnapshotDriverConfig) (resources.Snapshot, error) {
 	fake.createMutex.Lock()
 	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
-		arg1 resources.SnapshotDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.SnapshotDriverConfig
+	}{arg1, arg2})
 	stub := fake.CreateStub
 	fakeReturns := fake.createReturns
-	fake.recordInvocation("Create", []interface{}{arg1})
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
 	fake.createMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -49,17 +52,17 @@ func (fake *FakeSnapshotDriver) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeSnapshotDriver) CreateCalls(stub func(resources.SnapshotDriverConfig) (resources.Snapshot, error)) {
+func (fake *FakeSnapshotDriver) CreateCalls(stub func(context.Context, resources.SnapshotDriverConfig) (resources.Snapshot, error)) {
 	fake.createMutex.Lock()
 	defer fake.createMutex.Unlock()
 	fake.CreateStub = stub
 }
 
-func (fake *FakeSnapshotDriver) CreateArgsForCall(i int) resources.SnapshotDriverConfig {
+func (fake *FakeSnapshotDriver) CreateArgsForCall(i int) (context.Context, resources.SnapshotDriverConfig) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
 	argsForCall := fake.createArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeSnapshotDriver) CreateReturns(result1 resources.Snapshot, result2 error) {
@@ -91,8 +94,6 @@ func (fake *FakeSnapshotDriver) CreateReturnsOnCall(i int, result1 resources.Sna
 func (fake *FakeSnapshotDriver) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.createMutex.RLock()
-	defer fake.createMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,190 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package resourcesfakes
+
+import (
+	"context"
+	"light-stemcell-builder/resources"
+	"sync"
+)
+
+type FakeSweepDriver struct {
+	DeleteStub        func(context.Context, resources.Orphan) error
+	deleteMutex       sync.RWMutex
+	deleteArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.Orphan
+	}
+	deleteReturns struct {
+		result1 error
+	}
+	deleteReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FindOrphansStub        func(context.Context, resources.SweepFilter) ([]resources.Orphan, error)
+	findOrphansMutex       sync.RWMutex
+	findOrphansArgsForCall []struct {
+		arg1 context.Context
+		arg2 resources.SweepFilter
+	}
+	findOrphansReturns struct {
+		result1 []resources.Orphan
+		result2 error
+	}
+	findOrphansReturnsOnCall map[int]struct {
+		result1 []resources.Orphan
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeSweepDriver) Delete(arg1 context.Context, arg2 resources.Orphan) error {
+	fake.deleteMutex.Lock()
+	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
+	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.Orphan
+	}{arg1, arg2})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
+	fake.recordInvocation("Delete", []interface{}{arg1, arg2})
+	fake.deleteMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeSweepDriver) DeleteCallCount() int {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return len(fake.deleteArgsForCall)
+}
+
+func (fake *FakeSweepDriver) DeleteCalls(stub func(context.Context, resources.Orphan) error) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = stub
+}
+
+func (fake *FakeSweepDriver) DeleteArgsForCall(i int) (context.Context, resources.Orphan) {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	argsForCall := fake.deleteArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeSweepDriver) DeleteReturns(result1 error) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = nil
+	fake.deleteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSweepDriver) DeleteReturnsOnCall(i int, result1 error) {
+	fake.deleteMutex.Lock()
+	defer fake.deleteMutex.Unlock()
+	fake.DeleteStub = nil
+	if fake.deleteReturnsOnCall == nil {
+		fake.deleteReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deleteReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSweepDriver) FindOrphans(arg1 context.Context, arg2 resources.SweepFilter) ([]resources.Orphan, error) {
+	fake.findOrphansMutex.Lock()
+	ret, specificReturn := fake.findOrphansReturnsOnCall[len(fake.findOrphansArgsForCall)]
+	fake.findOrphansArgsForCall = append(fake.findOrphansArgsForCall, struct {
+		arg1 context.Context
+		arg2 resources.SweepFilter
+	}{arg1, arg2})
+	stub := fake.FindOrphansStub
+	fakeReturns := fake.findOrphansReturns
+	fake.recordInvocation("FindOrphans", []interface{}{arg1, arg2})
+	fake.findOrphansMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeSweepDriver) FindOrphansCallCount() int {
+	fake.findOrphansMutex.RLock()
+	defer fake.findOrphansMutex.RUnlock()
+	return len(fake.findOrphansArgsForCall)
+}
+
+func (fake *FakeSweepDriver) FindOrphansCalls(stub func(context.Context, resources.SweepFilter) ([]resources.Orphan, error)) {
+	fake.findOrphansMutex.Lock()
+	defer fake.findOrphansMutex.Unlock()
+	fake.FindOrphansStub = stub
+}
+
+func (fake *FakeSweepDriver) FindOrphansArgsForCall(i int) (context.Context, resources.SweepFilter) {
+	fake.findOrphansMutex.RLock()
+	defer fake.findOrphansMutex.RUnlock()
+	argsForCall := fake.findOrphansArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeSweepDriver) FindOrphansReturns(result1 []resources.Orphan, result2 error) {
+	fake.findOrphansMutex.Lock()
+	defer fake.findOrphansMutex.Unlock()
+	fake.FindOrphansStub = nil
+	fake.findOrphansReturns = struct {
+		result1 []resources.Orphan
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSweepDriver) FindOrphansReturnsOnCall(i int, result1 []resources.Orphan, result2 error) {
+	fake.findOrphansMutex.Lock()
+	defer fake.findOrphansMutex.Unlock()
+	fake.FindOrphansStub = nil
+	if fake.findOrphansReturnsOnCall == nil {
+		fake.findOrphansReturnsOnCall = make(map[int]struct {
+			result1 []resources.Orphan
+			result2 error
+		})
+	}
+	fake.findOrphansReturnsOnCall[i] = struct {
+		result1 []resources.Orphan
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSweepDriver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeSweepDriver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ resources.SweepDriver = new(FakeSweepDriver)
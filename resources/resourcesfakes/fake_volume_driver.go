@@ -2,15 +2,17 @@
 package resourcesfakes
 
 import (
+	"context"
 	"light-stemcell-builder/resources"
 	"sync"
 )
 
 type FakeVolumeDriver struct {
-	CreateStub        func(resources.VolumeDriverConfig) (resources.Volume, error)
+	CreateStub        func(context.Context, resources.VolumeDriverConfig) (resources.Volume, error)
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
-		arg1 resources.VolumeDriverConfig
+		arg1 context.Context
+		arg2 resources.VolumeDriverConfig
 	}
 	createReturns struct {
 		result1 resources.Volume
@@ -20,10 +22,11 @@ type FakeVolumeDriver struct {
 		result1 resources.Volume
 		result2 error
 	}
-	DeleteStub        func(resources.Volume) error
+	DeleteStub        func(context.Context, resources.Volume) error
 	deleteMutex       sync.RWMutex
 	deleteArgsForCall []struct {
-		arg1 resources.Volume
+		arg1 context.Context
+		arg2 resources.Volume
 	}
 	deleteReturns struct {
 		result1 error
@@ -35,18 +38,19 @@ type FakeVolumeDriver struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeVolumeDriver) Create(arg1 resources.VolumeDriverConfig) (resources.Volume, error) {
+func (fake *FakeVolumeDriver) Create(arg1 context.Context, arg2 resources.VolumeDriverConfig) (resources.Volume, error) {
 	fake.createMutex.Lock()
 	ret, specificReturn := fake.createReturnsOnCall[len(fake.createArgsForCall)]
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
-		arg1 resources.VolumeDriverConfig
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.VolumeDriverConfig
+	}{arg1, arg2})
 	stub := fake.CreateStub
 	fakeReturns := fake.createReturns
-	fake.recordInvocation("Create", []interface{}{arg1})
+	fake.recordInvocation("Create", []interface{}{arg1, arg2})
 	fake.createMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -60,17 +64,17 @@ func (fake *FakeVolumeDriver) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeVolumeDriver) CreateCalls(stub func(resources.VolumeDriverConfig) (resources.Volume, error)) {
+func (fake *FakeVolumeDriver) CreateCalls(stub func(context.Context, resources.VolumeDriverConfig) (resources.Volume, error)) {
 	fake.createMutex.Lock()
 	defer fake.createMutex.Unlock()
 	fake.CreateStub = stub
 }
 
-func (fake *FakeVolumeDriver) CreateArgsForCall(i int) resources.VolumeDriverConfig {
+func (fake *FakeVolumeDriver) CreateArgsForCall(i int) (context.Context, resources.VolumeDriverConfig) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
 	argsForCall := fake.createArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeVolumeDriver) CreateReturns(result1 resources.Volume, result2 error) {
@@ -99,18 +103,19 @@ func (fake *FakeVolumeDriver) CreateReturnsOnCall(i int, result1 resources.Volum
 	}{result1, result2}
 }
 
-func (fake *FakeVolumeDriver) Delete(arg1 resources.Volume) error {
+func (fake *FakeVolumeDriver) Delete(arg1 context.Context, arg2 resources.Volume) error {
 	fake.deleteMutex.Lock()
 	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
-		arg1 resources.Volume
-	}{arg1})
+		arg1 context.Context
+		arg2 resources.Volume
+	}{arg1, arg2})
 	stub := fake.DeleteStub
 	fakeReturns := fake.deleteReturns
-	fake.recordInvocation("Delete", []interface{}{arg1})
+	fake.recordInvocation("Delete", []interface{}{arg1, arg2})
 	fake.deleteMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -124,17 +129,17 @@ func (fake *FakeVolumeDriver) DeleteCallCount() int {
 	return len(fake.deleteArgsForCall)
 }
 
-func (fake *FakeVolumeDriver) DeleteCalls(stub func(resources.Volume) error) {
+func (fake *FakeVolumeDriver) DeleteCalls(stub func(context.Context, resources.Volume) error) {
 	fake.deleteMutex.Lock()
 	defer fake.deleteMutex.Unlock()
 	fake.DeleteStub = stub
 }
 
-func (fake *FakeVolumeDriver) DeleteArgsForCall(i int) resources.Volume {
+func (fake *FakeVolumeDriver) DeleteArgsForCall(i int) (context.Context, resources.Volume) {
 	fake.deleteMutex.RLock()
 	defer fake.deleteMutex.RUnlock()
 	argsForCall := fake.deleteArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeVolumeDriver) DeleteReturns(result1 error) {
@@ -163,10 +168,6 @@ func (fake *FakeVolumeDriver) DeleteReturnsOnCall(i int, result1 error) {
 func (fake *FakeVolumeDriver) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.createMutex.RLock()
-	defer fake.createMutex.RUnlock()
-	fake.deleteMutex.RLock()
-	defer fake.deleteMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -1,15 +1,19 @@
 package resources
 
+import "context"
+
 // SnapshotDriver abstracts the creation of a snapshot in AWS
 //
 //counterfeiter:generate . SnapshotDriver
 type SnapshotDriver interface {
-	Create(SnapshotDriverConfig) (Snapshot, error)
+	Create(context.Context, SnapshotDriverConfig) (Snapshot, error)
 }
 
 // Snapshot represents an EBS snapshot which can be used to create an AMI
 type Snapshot struct {
 	ID string
+	// VolumeSizeGB is the size of the volume of the snapshot
+	VolumeSizeGB int64
 }
 
 // SnapshotDriverConfig contains information used to create a snapshot from either an EBS volume or machine image
@@ -17,7 +21,14 @@ type SnapshotDriverConfig struct {
 	VolumeID string
 
 	MachineImageURL string
-	FileFormat      string
+	// MachineImagePath is the local machine image, for drivers that write it to the snapshot directly
+	MachineImagePath string
+	FileFormat       string
 	AmiProperties
 	KmsAlias
+
+	// ImportTaskID resumes waiting on an import snapshot task started by an earlier run
+	ImportTaskID string
+	// ImportTaskStarted, when set, is called with the ID of a newly started import snapshot task
+	ImportTaskStarted func(importTaskID string) error
 }
@@ -0,0 +1,46 @@
+package resources
+
+import (
+	"context"
+	"time"
+)
+
+// The builder tags the volumes and snapshots it creates so that they can be found if a run leaves them behind
+const (
+	CreatedByTagKey   = "created_by"
+	CreatedByTagValue = "light-stemcell-builder"
+)
+
+// Kinds of resources that a failed run can leave behind
+const (
+	OrphanS3Object = "s3-object"
+	OrphanVolume   = "volume"
+	OrphanSnapshot = "snapshot"
+	OrphanKmsAlias = "kms-alias"
+)
+
+// SweepDriver abstracts the API calls required to find and remove resources left behind by failed runs
+//
+//counterfeiter:generate . SweepDriver
+type SweepDriver interface {
+	FindOrphans(context.Context, SweepFilter) ([]Orphan, error)
+	Delete(context.Context, Orphan) error
+}
+
+// SweepFilter describes where to look for orphans. Resources created at or after CreatedBefore
+// may belong to a run that is still in progress and are never returned.
+type SweepFilter struct {
+	Region          string
+	BucketName      string
+	KmsKeyAliasName string
+	CreatedBefore   time.Time
+}
+
+// Orphan is a resource created by the builder that no AMI or run still uses
+type Orphan struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Region    string    `json:"region"`
+	Bucket    string    `json:"bucket,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
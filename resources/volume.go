@@ -1,5 +1,7 @@
 package resources
 
+import "context"
+
 // Volume properties which we do not expect to change
 const (
 	VolumeRawFormat    = "RAW"
@@ -9,8 +11,8 @@ const (
 
 //counterfeiter:generate . VolumeDriver
 type VolumeDriver interface {
-	Create(VolumeDriverConfig) (Volume, error)
-	Delete(Volume) error
+	Create(context.Context, VolumeDriverConfig) (Volume, error)
+	Delete(context.Context, Volume) error
 }
 
 type Volume struct {
@@ -19,4 +21,11 @@ type Volume struct {
 
 type VolumeDriverConfig struct {
 	MachineImageManifestURL string
+	// Tags are set on the volume
+	Tags map[string]string
+
+	// ConversionTaskID resumes waiting on an import volume task started by an earlier run
+	ConversionTaskID string
+	// ConversionTaskStarted, when set, is called with the ID of a newly started import volume task
+	ConversionTaskStarted func(conversionTaskID string) error
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"light-stemcell-builder/journal"
+)
+
+// resume continues a publish from the journal it recorded, reusing every
+// resource that the journal lists instead of creating it again
+func resume(sharedWriter io.Writer, args []string) {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	journalPath := flags.String("journal", "", "Path to the journal written by an earlier publish with --journal")
+	timeout := flags.Duration("timeout", 0, "Maximum duration of the publish, e.g. 2h. Defaults to no limit.")
+	rollbackOnFailure := flags.Bool("rollback-on-failure", false, "Remove the AMIs, snapshots and KMS aliases of the run if publishing to any region fails")
+	logOptions := addLogFlags(flags)
+	traceOptions := addTraceFlags(flags)
+
+	flags.Parse(args) //nolint:errcheck
+
+	if *journalPath == "" {
+		fmt.Fprintln(os.Stderr, "--journal flag is required")                     //nolint:errcheck
+		fmt.Fprintln(os.Stderr, "Usage of light-stemcell-builder/main.go resume") //nolint:errcheck
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	logger := logOptions.logger(sharedWriter)
+
+	j, err := journal.Load(*journalPath)
+	if err != nil {
+		fatal(logger, "Error loading journal: %s", err)
+	}
+
+	logger.Info("Resuming publish from journal", "path", *journalPath)
+
+	ctx, cancel := publishContext(*timeout)
+	defer cancel()
+
+	traceOptions.setup(ctx, logger)
+	publish(ctx, logger, sharedWriter, j.Inputs(), j, *rollbackOnFailure)
+}
+
+// absoluteInputs resolves the paths in inputs so that a resume does not depend
+// on the working directory of the original run
+func absoluteInputs(inputs journal.Inputs) (journal.Inputs, error) {
+	var err error
+	paths := []*string{&inputs.ConfigPath}
+	for _, path := range []*string{&inputs.MachineImagePath, &inputs.ManifestPath, &inputs.StemcellPath, &inputs.OutputTarball, &inputs.ReportPath, &inputs.MetricsPath} {
+		if *path != "" {
+			paths = append(paths, path)
+		}
+	}
+	inputs.IncludeFiles = append([]string(nil), inputs.IncludeFiles...)
+	for i := range inputs.IncludeFiles {
+		paths = append(paths, &inputs.IncludeFiles[i])
+	}
+
+	for _, path := range paths {
+		*path, err = filepath.Abs(*path)
+		if err != nil {
+			return journal.Inputs{}, fmt.Errorf("resolving %s: %s", *path, err)
+		}
+	}
+
+	return inputs, nil
+}
@@ -0,0 +1,163 @@
+package stemcell
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"light-stemcell-builder/resources"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RootImageName is the name of the machine image inside the image archive of a heavy stemcell
+const RootImageName = "root.img"
+
+// HeavyStemcell describes a heavy stemcell tarball that has been extracted to a directory
+type HeavyStemcell struct {
+	ManifestPath string
+	ImagePath    string
+	ExtraFiles   []string
+	FileFormat   string
+	VolumeSizeGB int
+}
+
+type heavyManifest struct {
+	CloudProperties struct {
+		DiskFormat string `yaml:"disk_format"`
+		Disk       int    `yaml:"disk"`
+	} `yaml:"cloud_properties"`
+}
+
+// Extract streams the heavy stemcell tarball at tarballPath into dir. The manifest and every
+// other top-level file are written as they are, and root.img is extracted from the nested
+// image archive without storing the archive itself. The format and size of the machine
+// image are taken from cloud_properties.disk_format and cloud_properties.disk of the manifest.
+func Extract(tarballPath string, dir string) (HeavyStemcell, error) {
+	f, err := os.Open(tarballPath)
+	if err != nil {
+		return HeavyStemcell{}, fmt.Errorf("opening stemcell: %s", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return HeavyStemcell{}, fmt.Errorf("reading stemcell %s: %s", tarballPath, err)
+	}
+
+	heavy := HeavyStemcell{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return HeavyStemcell{}, fmt.Errorf("reading stemcell %s: %s", tarballPath, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if strings.Contains(name, "/") {
+			continue
+		}
+
+		switch name {
+		case ManifestName:
+			heavy.ManifestPath = filepath.Join(dir, ManifestName)
+			err = writeFile(heavy.ManifestPath, tarReader)
+		case ImageName:
+			heavy.ImagePath = filepath.Join(dir, RootImageName)
+			err = extractRootImage(heavy.ImagePath, tarReader)
+		default:
+			extraFile := filepath.Join(dir, name)
+			heavy.ExtraFiles = append(heavy.ExtraFiles, extraFile)
+			err = writeFile(extraFile, tarReader)
+		}
+		if err != nil {
+			return HeavyStemcell{}, err
+		}
+	}
+
+	if heavy.ManifestPath == "" {
+		return HeavyStemcell{}, fmt.Errorf("stemcell %s does not contain %s", tarballPath, ManifestName)
+	}
+	if heavy.ImagePath == "" {
+		return HeavyStemcell{}, fmt.Errorf("stemcell %s does not contain an %s", tarballPath, ImageName)
+	}
+
+	manifestBytes, err := os.ReadFile(heavy.ManifestPath)
+	if err != nil {
+		return HeavyStemcell{}, fmt.Errorf("reading extracted manifest: %s", err)
+	}
+
+	m := heavyManifest{}
+	err = yaml.Unmarshal(manifestBytes, &m)
+	if err != nil {
+		return HeavyStemcell{}, fmt.Errorf("unmarshaling YAML to manifest: %s", err)
+	}
+
+	switch m.CloudProperties.DiskFormat {
+	case "raw":
+		heavy.FileFormat = resources.VolumeRawFormat
+	case "vmdk":
+		heavy.FileFormat = resources.VolumeVMDKFormat
+	default:
+		return HeavyStemcell{}, fmt.Errorf("unsupported disk_format %q in stemcell manifest, expected raw or vmdk", m.CloudProperties.DiskFormat)
+	}
+
+	// disk is given in MiB, volumes are sized in GiB
+	heavy.VolumeSizeGB = (m.CloudProperties.Disk + 1023) / 1024
+
+	return heavy, nil
+}
+
+func extractRootImage(imagePath string, imageArchive io.Reader) error {
+	gzipReader, err := gzip.NewReader(imageArchive)
+	if err != nil {
+		return fmt.Errorf("reading image archive: %s", err)
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return fmt.Errorf("image archive does not contain %s", RootImageName)
+		}
+		if err != nil {
+			return fmt.Errorf("reading image archive: %s", err)
+		}
+
+		if header.Typeflag == tar.TypeReg && path.Clean(header.Name) == RootImageName {
+			return writeFile(imagePath, tarReader)
+		}
+	}
+}
+
+func writeFile(path string, contents io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %s", path, err)
+	}
+
+	_, err = io.Copy(f, contents)
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return fmt.Errorf("extracting %s: %s", filepath.Base(path), err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("closing %s: %s", path, err)
+	}
+
+	return nil
+}
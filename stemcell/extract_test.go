@@ -0,0 +1,148 @@
+package stemcell_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/stemcell"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type tarEntry struct {
+	name     string
+	contents []byte
+}
+
+func gzipTar(entries ...tarEntry) []byte {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		Expect(tarWriter.WriteHeader(&tar.Header{
+			Name: entry.name,
+			Mode: 0644,
+			Size: int64(len(entry.contents)),
+		})).To(Succeed())
+		_, err := tarWriter.Write(entry.contents)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+
+	return buffer.Bytes()
+}
+
+var _ = Describe("Extract", func() {
+	var (
+		tmpDir       string
+		extractDir   string
+		stemcellPath string
+		manifest     string
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		extractDir = filepath.Join(tmpDir, "extracted")
+		Expect(os.Mkdir(extractDir, 0755)).To(Succeed())
+		stemcellPath = filepath.Join(tmpDir, "bosh-stemcell-1.42-aws-xen-hvm-ubuntu-jammy-go_agent.tgz")
+
+		manifest = `
+name: bosh-aws-xen-hvm-ubuntu-jammy-go_agent
+version: "1.42"
+operating_system: ubuntu-jammy
+cloud_properties:
+  disk: 5120
+  disk_format: raw
+`
+	})
+
+	writeStemcell := func(entries ...tarEntry) {
+		Expect(os.WriteFile(stemcellPath, gzipTar(entries...), 0644)).To(Succeed())
+	}
+
+	It("extracts the manifest, root.img and the other files and infers the image format", func() {
+		writeStemcell(
+			tarEntry{name: "./stemcell.MF", contents: []byte(manifest)},
+			tarEntry{name: "packages.txt", contents: []byte("openssl 3.0.2\n")},
+			tarEntry{name: "image", contents: gzipTar(tarEntry{name: "./root.img", contents: []byte("root image")})},
+		)
+
+		heavy, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(heavy.ManifestPath).To(Equal(filepath.Join(extractDir, "stemcell.MF")))
+		Expect(os.ReadFile(heavy.ManifestPath)).To(Equal([]byte(manifest)))
+		Expect(heavy.ImagePath).To(Equal(filepath.Join(extractDir, "root.img")))
+		Expect(os.ReadFile(heavy.ImagePath)).To(Equal([]byte("root image")))
+		Expect(heavy.ExtraFiles).To(Equal([]string{filepath.Join(extractDir, "packages.txt")}))
+		Expect(os.ReadFile(heavy.ExtraFiles[0])).To(Equal([]byte("openssl 3.0.2\n")))
+
+		Expect(heavy.FileFormat).To(Equal(resources.VolumeRawFormat))
+		Expect(heavy.VolumeSizeGB).To(Equal(5))
+
+		files, err := os.ReadDir(extractDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(3))
+	})
+
+	It("infers the vmdk format and rounds the volume size up", func() {
+		writeStemcell(
+			tarEntry{name: "stemcell.MF", contents: []byte("cloud_properties:\n  disk: 3000\n  disk_format: vmdk\n")},
+			tarEntry{name: "image", contents: gzipTar(tarEntry{name: "root.img", contents: []byte("root image")})},
+		)
+
+		heavy, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heavy.FileFormat).To(Equal(resources.VolumeVMDKFormat))
+		Expect(heavy.VolumeSizeGB).To(Equal(3))
+	})
+
+	It("fails for disk formats that cannot be imported", func() {
+		writeStemcell(
+			tarEntry{name: "stemcell.MF", contents: []byte("cloud_properties:\n  disk_format: qcow2\n")},
+			tarEntry{name: "image", contents: gzipTar(tarEntry{name: "root.img", contents: []byte("root image")})},
+		)
+
+		_, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).To(MatchError(ContainSubstring(`unsupported disk_format "qcow2"`)))
+	})
+
+	It("fails when the stemcell has no manifest", func() {
+		writeStemcell(tarEntry{name: "image", contents: gzipTar(tarEntry{name: "root.img", contents: []byte("root image")})})
+
+		_, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).To(MatchError(ContainSubstring("does not contain stemcell.MF")))
+	})
+
+	It("fails when the image archive has no root.img", func() {
+		writeStemcell(
+			tarEntry{name: "stemcell.MF", contents: []byte(manifest)},
+			tarEntry{name: "image", contents: gzipTar(tarEntry{name: "disk.vmdk", contents: []byte("disk")})},
+		)
+
+		_, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).To(MatchError(ContainSubstring("image archive does not contain root.img")))
+	})
+
+	It("ignores files in subdirectories", func() {
+		writeStemcell(
+			tarEntry{name: "stemcell.MF", contents: []byte(manifest)},
+			tarEntry{name: "../escape.txt", contents: []byte("outside")},
+			tarEntry{name: "docs/readme.txt", contents: []byte("nested")},
+			tarEntry{name: "image", contents: gzipTar(tarEntry{name: "root.img", contents: []byte("root image")})},
+		)
+
+		heavy, err := stemcell.Extract(stemcellPath, extractDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heavy.ExtraFiles).To(BeEmpty())
+		Expect(filepath.Join(tmpDir, "escape.txt")).ToNot(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,254 @@
+// Package stemcell assembles light stemcell tarballs that can be uploaded with bosh upload-stemcell.
+package stemcell
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"light-stemcell-builder/manifest"
+)
+
+// Names of the entries every light stemcell contains
+const (
+	ManifestName = "stemcell.MF"
+	ImageName    = "image"
+)
+
+// Sidecar formats that can be written next to a tarball
+const (
+	SHA256Sidecar   = "sha256"
+	MetalinkSidecar = "metalink"
+)
+
+// Checksums of a written tarball
+type Checksums struct {
+	SHA1   string
+	SHA256 string
+	Size   int64
+}
+
+// WriteTarball writes a gzipped light stemcell to path. It contains the manifest, an empty
+// image and extraFiles, which are added under their base names. The manifest sha1 is set to
+// the checksum of the image.
+func WriteTarball(path string, m *manifest.Manifest, extraFiles []string) (Checksums, error) {
+	image := []byte{}
+	imageSum := sha1.Sum(image)
+	m.Sha1 = hex.EncodeToString(imageSum[:])
+
+	manifestBuffer := &bytes.Buffer{}
+	err := m.Write(manifestBuffer)
+	if err != nil {
+		return Checksums{}, fmt.Errorf("writing manifest: %s", err)
+	}
+
+	seen := map[string]bool{ManifestName: true, ImageName: true}
+	for _, extraFile := range extraFiles {
+		name := filepath.Base(extraFile)
+		if seen[name] {
+			return Checksums{}, fmt.Errorf("%s would overwrite another file named %s in the stemcell", extraFile, name)
+		}
+		seen[name] = true
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return Checksums{}, fmt.Errorf("creating temporary tarball: %s", err)
+	}
+	defer os.Remove(tmpFile.Name()) //nolint:errcheck
+
+	sha1Hash := sha1.New()
+	sha256Hash := sha256.New()
+	counter := &countingWriter{}
+	gzipWriter := gzip.NewWriter(io.MultiWriter(tmpFile, sha1Hash, sha256Hash, counter))
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	modTime := time.Now()
+	err = addBytes(tarWriter, ManifestName, manifestBuffer.Bytes(), modTime)
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return Checksums{}, err
+	}
+
+	err = addBytes(tarWriter, ImageName, image, modTime)
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return Checksums{}, err
+	}
+
+	for _, extraFile := range extraFiles {
+		err = addFile(tarWriter, extraFile)
+		if err != nil {
+			tmpFile.Close() //nolint:errcheck
+			return Checksums{}, err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return Checksums{}, fmt.Errorf("finishing tarball: %s", err)
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return Checksums{}, fmt.Errorf("compressing tarball: %s", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return Checksums{}, fmt.Errorf("closing tarball: %s", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		return Checksums{}, fmt.Errorf("moving tarball to %s: %s", path, err)
+	}
+
+	return Checksums{
+		SHA1:   hex.EncodeToString(sha1Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		Size:   counter.n,
+	}, nil
+}
+
+// WriteSidecar writes the checksums of the tarball at path to a file next to it and returns the
+// name of that file. sha256 sidecars use the sha256sum format, metalink sidecars are RFC 5854 .meta4 files.
+func WriteSidecar(path string, format string, version string, checksums Checksums) (string, error) {
+	var sidecarPath string
+	var contents []byte
+
+	switch format {
+	case SHA256Sidecar:
+		sidecarPath = path + ".sha256"
+		contents = []byte(fmt.Sprintf("%s  %s\n", checksums.SHA256, filepath.Base(path)))
+	case MetalinkSidecar:
+		sidecarPath = path + ".meta4"
+
+		var err error
+		contents, err = metalink(filepath.Base(path), version, checksums)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown sidecar format %q, expected %s or %s", format, SHA256Sidecar, MetalinkSidecar)
+	}
+
+	err := os.WriteFile(sidecarPath, contents, 0644)
+	if err != nil {
+		return "", fmt.Errorf("writing %s: %s", sidecarPath, err)
+	}
+
+	return sidecarPath, nil
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkFile struct {
+	Name    string         `xml:"name,attr"`
+	Version string         `xml:"version,omitempty"`
+	Size    int64          `xml:"size"`
+	Hashes  []metalinkHash `xml:"hash"`
+}
+
+type metalinkDocument struct {
+	XMLName   xml.Name     `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string       `xml:"generator"`
+	File      metalinkFile `xml:"file"`
+}
+
+func metalink(name string, version string, checksums Checksums) ([]byte, error) {
+	doc := metalinkDocument{
+		Generator: "light-stemcell-builder",
+		File: metalinkFile{
+			Name:    name,
+			Version: version,
+			Size:    checksums.Size,
+			Hashes: []metalinkHash{
+				{Type: "sha-1", Value: checksums.SHA1},
+				{Type: "sha-256", Value: checksums.SHA256},
+			},
+		},
+	}
+
+	contents, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling metalink: %s", err)
+	}
+
+	return append([]byte(xml.Header), append(contents, '\n')...), nil
+}
+
+func addBytes(tarWriter *tar.Writer, name string, contents []byte, modTime time.Time) error {
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("adding %s to tarball: %s", name, err)
+	}
+
+	_, err = tarWriter.Write(contents)
+	if err != nil {
+		return fmt.Errorf("adding %s to tarball: %s", name, err)
+	}
+
+	return nil
+}
+
+func addFile(tarWriter *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %s", path, err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("reading %s: %s", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:    filepath.Base(path),
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return fmt.Errorf("adding %s to tarball: %s", path, err)
+	}
+
+	_, err = io.Copy(tarWriter, f)
+	if err != nil {
+		return fmt.Errorf("adding %s to tarball: %s", path, err)
+	}
+
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,172 @@
+package stemcell_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"light-stemcell-builder/manifest"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/stemcell"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stemcell", func() {
+	var (
+		tmpDir      string
+		tarballPath string
+		m           *manifest.Manifest
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		tarballPath = filepath.Join(tmpDir, "light-bosh-stemcell.tgz")
+
+		var err error
+		m, err = manifest.NewFromReader(strings.NewReader(`
+name: bosh-aws-xen-ubuntu-jammy-go_agent
+version: "1.42"
+api_version: 3
+bosh_protocol: 1
+sha1: sha1-of-the-heavy-image
+operating_system: ubuntu-jammy
+stemcell_formats:
+- aws-raw
+cloud_properties:
+  infrastructure: aws
+  architecture: x86_64`))
+		Expect(err).ToNot(HaveOccurred())
+		m.PublishedAmis = []resources.Ami{{Region: "us-east-1", ID: "ami-123", VirtualizationType: resources.HvmAmiVirtualization}}
+	})
+
+	readTarball := func(path string) ([]string, map[string]string) {
+		f, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		gzipReader, err := gzip.NewReader(f)
+		Expect(err).ToNot(HaveOccurred())
+
+		entries := map[string]string{}
+		names := []string{}
+		tarReader := tar.NewReader(gzipReader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := io.ReadAll(tarReader)
+			Expect(err).ToNot(HaveOccurred())
+			entries[header.Name] = string(contents)
+			names = append(names, header.Name)
+		}
+
+		return names, entries
+	}
+
+	Describe("WriteTarball", func() {
+		It("writes the manifest, an empty image and the extra files", func() {
+			packagesPath := filepath.Join(tmpDir, "packages.txt")
+			Expect(os.WriteFile(packagesPath, []byte("openssl 3.0.2\n"), 0644)).To(Succeed())
+
+			_, err := stemcell.WriteTarball(tarballPath, m, []string{packagesPath})
+			Expect(err).ToNot(HaveOccurred())
+
+			names, entries := readTarball(tarballPath)
+			Expect(names).To(Equal([]string{"stemcell.MF", "image", "packages.txt"}))
+			Expect(entries["image"]).To(BeEmpty())
+			Expect(entries["packages.txt"]).To(Equal("openssl 3.0.2\n"))
+			Expect(entries["stemcell.MF"]).To(ContainSubstring("stemcell_formats:\n- aws-light"))
+			Expect(entries["stemcell.MF"]).To(ContainSubstring("us-east-1: ami-123"))
+			Expect(entries["stemcell.MF"]).To(ContainSubstring("sha1: da39a3ee5e6b4b0d3255bfef95601890afd80709"))
+		})
+
+		It("returns the checksums and size of the tarball", func() {
+			checksums, err := stemcell.WriteTarball(tarballPath, m, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := os.ReadFile(tarballPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			sha1Sum := sha1.Sum(contents)
+			sha256Sum := sha256.Sum256(contents)
+			Expect(checksums.SHA1).To(Equal(hex.EncodeToString(sha1Sum[:])))
+			Expect(checksums.SHA256).To(Equal(hex.EncodeToString(sha256Sum[:])))
+			Expect(checksums.Size).To(Equal(int64(len(contents))))
+		})
+
+		It("rejects extra files that would replace another entry", func() {
+			otherDir := filepath.Join(tmpDir, "other")
+			Expect(os.Mkdir(otherDir, 0755)).To(Succeed())
+			for _, path := range []string{filepath.Join(tmpDir, "packages.txt"), filepath.Join(otherDir, "packages.txt")} {
+				Expect(os.WriteFile(path, []byte("contents"), 0644)).To(Succeed())
+			}
+
+			_, err := stemcell.WriteTarball(tarballPath, m, []string{filepath.Join(tmpDir, "packages.txt"), filepath.Join(otherDir, "packages.txt")})
+			Expect(err).To(MatchError(ContainSubstring("would overwrite another file named packages.txt")))
+
+			_, err = stemcell.WriteTarball(tarballPath, m, []string{filepath.Join(otherDir, "image")})
+			Expect(err).To(MatchError(ContainSubstring("would overwrite another file named image")))
+
+			Expect(tarballPath).ToNot(BeAnExistingFile())
+		})
+
+		It("does not leave a partial tarball behind when an extra file is missing", func() {
+			_, err := stemcell.WriteTarball(tarballPath, m, []string{filepath.Join(tmpDir, "missing.txt")})
+			Expect(err).To(MatchError(ContainSubstring("missing.txt")))
+
+			files, err := os.ReadDir(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+	})
+
+	Describe("WriteSidecar", func() {
+		var checksums stemcell.Checksums
+
+		BeforeEach(func() {
+			checksums = stemcell.Checksums{SHA1: "some-sha1", SHA256: "some-sha256", Size: 1234}
+		})
+
+		It("writes a sha256sum file", func() {
+			sidecarPath, err := stemcell.WriteSidecar(tarballPath, stemcell.SHA256Sidecar, "1.42", checksums)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sidecarPath).To(Equal(tarballPath + ".sha256"))
+
+			contents, err := os.ReadFile(sidecarPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-sha256  light-bosh-stemcell.tgz\n"))
+		})
+
+		It("writes a metalink file", func() {
+			sidecarPath, err := stemcell.WriteSidecar(tarballPath, stemcell.MetalinkSidecar, "1.42", checksums)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sidecarPath).To(Equal(tarballPath + ".meta4"))
+
+			contents, err := os.ReadFile(sidecarPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(`<metalink xmlns="urn:ietf:params:xml:ns:metalink">`))
+			Expect(string(contents)).To(ContainSubstring(`<file name="light-bosh-stemcell.tgz">`))
+			Expect(string(contents)).To(ContainSubstring("<version>1.42</version>"))
+			Expect(string(contents)).To(ContainSubstring("<size>1234</size>"))
+			Expect(string(contents)).To(ContainSubstring(`<hash type="sha-1">some-sha1</hash>`))
+			Expect(string(contents)).To(ContainSubstring(`<hash type="sha-256">some-sha256</hash>`))
+		})
+
+		It("rejects unknown formats", func() {
+			_, err := stemcell.WriteSidecar(tarballPath, "md5", "1.42", checksums)
+			Expect(err).To(MatchError(fmt.Sprintf("unknown sidecar format %q, expected sha256 or metalink", "md5")))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/config"
+	"light-stemcell-builder/driver"
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/sweep"
+)
+
+// runSweep lists the machine images, import volumes, snapshots and KMS aliases that
+// failed runs left behind in the configured regions and deletes them once confirmed
+func runSweep(sharedWriter io.Writer, args []string) {
+	flags := flag.NewFlagSet("sweep", flag.ExitOnError)
+	configPath := flags.String("c", "", "Path to the JSON configuration file of the publish")
+	olderThan := flags.Duration("older-than", 24*time.Hour, "Only remove resources created longer ago than this, so that runs in progress are left alone")
+	yes := flags.Bool("yes", false, "Delete the orphaned resources without asking for confirmation")
+	timeout := flags.Duration("timeout", 0, "Maximum duration of the sweep, e.g. 1h. Defaults to no limit.")
+	logOptions := addLogFlags(flags)
+
+	flags.Parse(args) //nolint:errcheck
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "-c flag is required")                           //nolint:errcheck
+		fmt.Fprintln(os.Stderr, "Usage of light-stemcell-builder/main.go sweep") //nolint:errcheck
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	logger := logOptions.logger(sharedWriter)
+
+	configFile, err := os.Open(*configPath)
+	if err != nil {
+		fatal(logger, "Error opening config file: %s", err)
+	}
+	c, err := config.NewFromReader(configFile)
+	configFile.Close() //nolint:errcheck
+	if err != nil {
+		fatal(logger, "Error parsing config file: %s. Message: %s", *configPath, err)
+	}
+	redactSecrets(sharedWriter, c)
+
+	createdBefore := time.Now().Add(-*olderThan)
+	var targets []sweep.Target
+	for _, regionConfig := range c.AmiRegions {
+		amiConfig := c.RegionAmiConfiguration(regionConfig)
+		setKmsKeyAliasName(logger, &amiConfig)
+
+		sweepDriver := driver.NewSweepDriver(logger, regionConfig.Credentials)
+		targets = append(targets, sweep.Target{
+			Driver: sweepDriver,
+			Filter: resources.SweepFilter{
+				Region:          regionConfig.RegionName,
+				BucketName:      regionConfig.BucketName,
+				KmsKeyAliasName: amiConfig.KmsKeyAliasName,
+				CreatedBefore:   createdBefore,
+			},
+		})
+		for _, destination := range regionConfig.DestinationNames() {
+			targets = append(targets, sweep.Target{
+				Driver: sweepDriver,
+				Filter: resources.SweepFilter{
+					Region:        destination,
+					CreatedBefore: createdBefore,
+				},
+			})
+		}
+	}
+
+	ctx, cancel := publishContext(*timeout)
+	defer cancel()
+
+	s := sweep.New(logger, targets)
+	orphans, err := s.Find(ctx)
+	if err != nil {
+		fatal(logger, "Error finding orphaned resources: %s", err)
+	}
+
+	if len(orphans) == 0 {
+		logger.Info("No orphaned resources found")
+		return
+	}
+
+	err = sweep.Print(os.Stdout, orphans)
+	if err != nil {
+		fatal(logger, "Error listing orphaned resources: %s", err)
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("Delete these %d resources?", len(orphans))) {
+		logger.Info("Nothing was deleted")
+		return
+	}
+
+	var removed, failed int
+	for _, result := range s.Delete(ctx, orphans) {
+		if result.Err != nil {
+			logger.Error("Sweep: " + result.String())
+			failed++
+		} else {
+			logger.Info("Sweep: " + result.String())
+			removed++
+		}
+	}
+
+	if failed > 0 {
+		fatal(logger, "Sweep finished: %d resources removed, %d could not be removed", removed, failed)
+	}
+	logger.Info("Sweep finished", "removed", removed)
+}
+
+// confirm asks question on stderr and reports whether the answer on stdin was yes
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question) //nolint:errcheck
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+// Package sweep finds and removes the resources that failed runs leave behind.
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"light-stemcell-builder/collection"
+	"light-stemcell-builder/logging"
+	"light-stemcell-builder/resources"
+)
+
+// Target is a region to look for orphans in, and the driver to use there
+type Target struct {
+	Driver resources.SweepDriver
+	Filter resources.SweepFilter
+}
+
+// Result is the outcome of removing a single orphan
+type Result struct {
+	Orphan resources.Orphan
+	Err    error
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("could not remove %s: %s", describe(r.Orphan), r.Err)
+	}
+	return fmt.Sprintf("removed %s", describe(r.Orphan))
+}
+
+// Sweeper finds orphans in a set of targets and removes them
+type Sweeper struct {
+	targets []Target
+	logger  *slog.Logger
+
+	// drivers remembers which driver found each orphan so that the same one removes it
+	drivers map[orphanKey]resources.SweepDriver
+}
+
+type orphanKey struct {
+	kind, region, bucket, id string
+}
+
+func keyOf(orphan resources.Orphan) orphanKey {
+	return orphanKey{orphan.Kind, orphan.Region, orphan.Bucket, orphan.ID}
+}
+
+// New creates a Sweeper for targets
+func New(logger *slog.Logger, targets []Target) *Sweeper {
+	return &Sweeper{
+		targets: targets,
+		logger:  logger,
+		drivers: map[orphanKey]resources.SweepDriver{},
+	}
+}
+
+// Find returns the orphans of every target. A resource found by several targets,
+// e.g. a copy destination shared by two source regions, is only returned once.
+func (s *Sweeper) Find(ctx context.Context) ([]resources.Orphan, error) {
+	var orphans []resources.Orphan
+	errCol := collection.Error{}
+
+	for _, target := range s.targets {
+		s.logger.InfoContext(ctx, "looking for orphaned resources", logging.Region(target.Filter.Region))
+
+		found, err := target.Driver.FindOrphans(ctx, target.Filter)
+		if err != nil {
+			errCol.Add(fmt.Errorf("finding orphaned resources in %s: %s", target.Filter.Region, err))
+			continue
+		}
+
+		for _, orphan := range found {
+			key := keyOf(orphan)
+			if _, ok := s.drivers[key]; ok {
+				continue
+			}
+			s.drivers[key] = target.Driver
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	return orphans, errCol.Error()
+}
+
+// Delete removes orphans returned by Find and reports the outcome of each removal
+func (s *Sweeper) Delete(ctx context.Context, orphans []resources.Orphan) []Result {
+	var results []Result
+	for _, orphan := range orphans {
+		driver, ok := s.drivers[keyOf(orphan)]
+		if !ok {
+			results = append(results, Result{Orphan: orphan, Err: fmt.Errorf("%s was not found by this sweeper", orphan.ID)})
+			continue
+		}
+
+		results = append(results, Result{Orphan: orphan, Err: driver.Delete(ctx, orphan)})
+	}
+
+	return results
+}
+
+// Print writes orphans to w as a table
+func Print(w io.Writer, orphans []resources.Orphan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tREGION\tID\tCREATED") //nolint:errcheck
+	for _, orphan := range orphans {
+		id := orphan.ID
+		if orphan.Bucket != "" {
+			id = fmt.Sprintf("s3://%s/%s", orphan.Bucket, orphan.ID)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", orphan.Kind, orphan.Region, id, orphan.CreatedAt.Format(time.RFC3339)) //nolint:errcheck
+	}
+	return tw.Flush()
+}
+
+func describe(orphan resources.Orphan) string {
+	if orphan.Bucket != "" {
+		return fmt.Sprintf("%s s3://%s/%s", orphan.Kind, orphan.Bucket, orphan.ID)
+	}
+	return fmt.Sprintf("%s %s in %s", orphan.Kind, orphan.ID, orphan.Region)
+}
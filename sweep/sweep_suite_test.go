@@ -0,0 +1,19 @@
+package sweep_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"light-stemcell-builder/logging"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// logger writes the log of the specs to the GinkgoWriter
+var logger = logging.New(GinkgoWriter, logging.TextFormat, slog.LevelInfo)
+
+func TestSweep(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sweep Suite")
+}
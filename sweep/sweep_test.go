@@ -0,0 +1,135 @@
+package sweep_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"light-stemcell-builder/resources"
+	"light-stemcell-builder/resources/resourcesfakes"
+	"light-stemcell-builder/sweep"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sweeper", func() {
+	const (
+		fakeRegion      = "fake region"
+		fakeDestination = "fake destination"
+		fakeBucketName  = "fake bucket name"
+	)
+
+	var (
+		createdAt      time.Time
+		fakeObject     resources.Orphan
+		fakeSnapshot   resources.Orphan
+		sourceDriver   *resourcesfakes.FakeSweepDriver
+		otherDriver    *resourcesfakes.FakeSweepDriver
+		sourceFilter   resources.SweepFilter
+		destFilter     resources.SweepFilter
+		sharedSnapshot resources.Orphan
+	)
+
+	BeforeEach(func() {
+		createdAt = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+		fakeObject = resources.Orphan{Kind: resources.OrphanS3Object, ID: "bosh-machine-image-1", Region: fakeRegion, Bucket: fakeBucketName, CreatedAt: createdAt}
+		fakeSnapshot = resources.Orphan{Kind: resources.OrphanSnapshot, ID: "snap-1", Region: fakeRegion, CreatedAt: createdAt}
+		sharedSnapshot = resources.Orphan{Kind: resources.OrphanSnapshot, ID: "snap-2", Region: fakeDestination, CreatedAt: createdAt}
+
+		sourceFilter = resources.SweepFilter{Region: fakeRegion, BucketName: fakeBucketName, KmsKeyAliasName: "alias/fake"}
+		destFilter = resources.SweepFilter{Region: fakeDestination}
+
+		sourceDriver = &resourcesfakes.FakeSweepDriver{}
+		sourceDriver.FindOrphansStub = func(_ context.Context, filter resources.SweepFilter) ([]resources.Orphan, error) {
+			if filter.Region == fakeRegion {
+				return []resources.Orphan{fakeObject, fakeSnapshot}, nil
+			}
+			return []resources.Orphan{sharedSnapshot}, nil
+		}
+
+		otherDriver = &resourcesfakes.FakeSweepDriver{}
+		otherDriver.FindOrphansReturns([]resources.Orphan{sharedSnapshot}, nil)
+	})
+
+	It("finds the orphans of every target once and removes them with the driver that found them", func() {
+		s := sweep.New(logger, []sweep.Target{
+			{Driver: sourceDriver, Filter: sourceFilter},
+			{Driver: sourceDriver, Filter: destFilter},
+			{Driver: otherDriver, Filter: destFilter},
+		})
+
+		orphans, err := s.Find(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(orphans).To(Equal([]resources.Orphan{fakeObject, fakeSnapshot, sharedSnapshot}))
+
+		Expect(sourceDriver.FindOrphansCallCount()).To(Equal(2))
+		_, filter := sourceDriver.FindOrphansArgsForCall(0)
+		Expect(filter).To(Equal(sourceFilter))
+
+		results := s.Delete(context.Background(), orphans)
+		Expect(results).To(HaveLen(3))
+		for _, result := range results {
+			Expect(result.Err).ToNot(HaveOccurred())
+		}
+
+		Expect(sourceDriver.DeleteCallCount()).To(Equal(3))
+		Expect(otherDriver.DeleteCallCount()).To(Equal(0))
+		_, deleted := sourceDriver.DeleteArgsForCall(2)
+		Expect(deleted).To(Equal(sharedSnapshot))
+	})
+
+	It("reports orphans that could not be removed", func() {
+		sourceDriver.DeleteStub = func(_ context.Context, orphan resources.Orphan) error {
+			if orphan.Kind == resources.OrphanSnapshot {
+				return errors.New("snapshot in use")
+			}
+			return nil
+		}
+
+		s := sweep.New(logger, []sweep.Target{{Driver: sourceDriver, Filter: sourceFilter}})
+		orphans, err := s.Find(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		results := s.Delete(context.Background(), orphans)
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].String()).To(Equal("removed s3-object s3://fake bucket name/bosh-machine-image-1"))
+		Expect(results[1].Err).To(MatchError("snapshot in use"))
+		Expect(results[1].String()).To(Equal("could not remove snapshot snap-1 in fake region: snapshot in use"))
+	})
+
+	It("does not remove orphans that it did not find", func() {
+		s := sweep.New(logger, []sweep.Target{{Driver: sourceDriver, Filter: sourceFilter}})
+
+		results := s.Delete(context.Background(), []resources.Orphan{fakeSnapshot})
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Err).To(HaveOccurred())
+		Expect(sourceDriver.DeleteCallCount()).To(Equal(0))
+	})
+
+	It("keeps looking in other targets when one fails", func() {
+		otherDriver.FindOrphansReturns(nil, errors.New("access denied"))
+
+		s := sweep.New(logger, []sweep.Target{
+			{Driver: otherDriver, Filter: destFilter},
+			{Driver: sourceDriver, Filter: sourceFilter},
+		})
+
+		orphans, err := s.Find(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("finding orphaned resources in fake destination: access denied")))
+		Expect(orphans).To(Equal([]resources.Orphan{fakeObject, fakeSnapshot}))
+	})
+
+	It("prints orphans as a table", func() {
+		output := &bytes.Buffer{}
+		Expect(sweep.Print(output, []resources.Orphan{fakeObject, fakeSnapshot})).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"KIND", "REGION", "ID", "CREATED"}))
+		Expect(lines[1]).To(MatchRegexp(`^s3-object +fake region +s3://fake bucket name/bosh-machine-image-1 +2024-01-31T00:00:00Z$`))
+		Expect(lines[2]).To(MatchRegexp(`^snapshot +fake region +snap-1 +2024-01-31T00:00:00Z$`))
+	})
+})
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"time"
+
+	"light-stemcell-builder/tracing"
+)
+
+// traceShutdownTimeout bounds the export of the remaining spans before exiting
+const traceShutdownTimeout = 30 * time.Second
+
+// traceOptions are the flags a publishing command configures the export of its spans with
+type traceOptions struct {
+	exporter tracing.Exporter
+	file     string
+}
+
+func addTraceFlags(flags *flag.FlagSet) *traceOptions {
+	options := &traceOptions{}
+	flags.TextVar(&options.exporter, "trace-exporter", tracing.NoExporter, "Where to export OpenTelemetry spans of the publish to: none, otlp (configured with the OTEL_EXPORTER_OTLP_* environment variables) or file")
+	flags.StringVar(&options.file, "trace-file", "", "Path to write the spans to as JSON when --trace-exporter is file")
+	return options
+}
+
+// setup starts exporting the spans of the process, or exits if the exporter cannot be created
+func (o *traceOptions) setup(ctx context.Context, logger *slog.Logger) {
+	err := tracing.Setup(ctx, o.exporter, o.file)
+	if err != nil {
+		fatal(logger, "Error setting up tracing: %s", err)
+	}
+}
+
+// shutdownTracing exports the spans that have not been exported yet. It is called before exiting, also after the
+// publish was interrupted.
+func shutdownTracing(logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+	defer cancel()
+
+	err := tracing.Shutdown(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
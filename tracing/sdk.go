@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// presignID is the ID of the middleware that presigns a request instead of sending it
+const presignID = "PresignHTTPRequest"
+
+// ConfigureSDK makes every call of the clients created from cfg a span, that is a child of the span of the
+// context the call is made with. Presigning a URL sends no request, so it is not a span.
+func ConfigureSDK(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignID); presign {
+			return nil
+		}
+		return stack.Initialize.Add(sdkSpan{}, middleware.After)
+	})
+}
+
+// sdkSpan is the middleware that starts the span of a call. It runs after the service and operation of the call
+// are known, and before the call is retried, so a span includes all attempts.
+type sdkSpan struct{}
+
+func (sdkSpan) ID() string {
+	return "light-stemcell-builder/tracing"
+}
+
+func (sdkSpan) HandleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+	out middleware.InitializeOutput, metadata middleware.Metadata, err error,
+) {
+	service := awsmiddleware.GetServiceID(ctx)
+	operation := awsmiddleware.GetOperationName(ctx)
+
+	ctx, span := Start(ctx, service+"."+operation,
+		attribute.String("rpc.system", "aws-api"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", operation),
+		attribute.String("aws.region", awsmiddleware.GetRegion(ctx)),
+	)
+
+	out, metadata, err = next.HandleInitialize(ctx, in)
+
+	if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		span.SetAttributes(attribute.String("aws.request_id", requestID))
+	}
+	if response, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+	}
+	End(span, err)
+
+	return out, metadata, err
+}
@@ -0,0 +1,200 @@
+// Package tracing exports OpenTelemetry spans of the publish: one for every region, step and copy of an AMI,
+// and one for every AWS call made within them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the name of the service the spans are exported for
+const ServiceName = "light-stemcell-builder"
+
+// Exporter is where the spans are exported to
+type Exporter string
+
+const (
+	// NoExporter does not record spans
+	NoExporter Exporter = "none"
+	// OTLPExporter sends the spans to an OTLP/HTTP endpoint, configured with the OTEL_EXPORTER_OTLP_* environment variables
+	OTLPExporter Exporter = "otlp"
+	// FileExporter writes the spans as JSON to a local file, so tracing works offline
+	FileExporter Exporter = "file"
+)
+
+// MarshalText implements encoding.TextMarshaler, so an Exporter can be used with flag.TextVar
+func (e Exporter) MarshalText() ([]byte, error) {
+	return []byte(e), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler and only accepts the known exporters
+func (e *Exporter) UnmarshalText(text []byte) error {
+	switch exporter := Exporter(text); exporter {
+	case NoExporter, OTLPExporter, FileExporter:
+		*e = exporter
+		return nil
+	default:
+		return fmt.Errorf("unknown trace exporter %q, must be one of: ['none', 'otlp', 'file']", text)
+	}
+}
+
+var (
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+	file     *os.File
+)
+
+// Setup makes the spans of the process be exported with exporter. The FileExporter writes to path. Shutdown
+// exports the spans that have not been exported yet.
+func Setup(ctx context.Context, exporter Exporter, path string) error {
+	var spanExporter sdktrace.SpanExporter
+	var f *os.File
+	var err error
+
+	switch exporter {
+	case NoExporter, "":
+		return nil
+	case OTLPExporter:
+		spanExporter, err = otlptracehttp.New(ctx)
+		if err != nil {
+			return fmt.Errorf("creating OTLP exporter: %s", err)
+		}
+	case FileExporter:
+		if path == "" {
+			return fmt.Errorf("the file exporter needs the path of a file to write to")
+		}
+		f, err = os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating trace file: %s", err)
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close() //nolint:errcheck
+			return fmt.Errorf("creating file exporter: %s", err)
+		}
+	default:
+		return fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return fmt.Errorf("creating trace resource: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	file = f
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Shutdown exports the remaining spans and stops exporting. It does nothing if Setup did not set up an exporter.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.Shutdown(ctx)
+	provider = nil
+	if file != nil {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		file = nil
+	}
+	if err != nil {
+		return fmt.Errorf("exporting spans: %s", err)
+	}
+	return nil
+}
+
+// Start starts a span that is a child of the span of ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ServiceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, as the outcome of span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetAttributes adds attrs to the span of ctx, e.g. the IDs of resources a driver creates
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// Region is the attribute of the region a span is about
+func Region(region string) attribute.KeyValue {
+	return attribute.String("region", region)
+}
+
+// DestinationRegion is the attribute of the region an AMI is copied to
+func DestinationRegion(region string) attribute.KeyValue {
+	return attribute.String("destination_region", region)
+}
+
+// ImageSize is the attribute of the size of the machine image in bytes
+func ImageSize(bytes int64) attribute.KeyValue {
+	return attribute.Int64("image_size_bytes", bytes)
+}
+
+// AmiID is the attribute of an AMI
+func AmiID(id string) attribute.KeyValue {
+	return attribute.String("ami_id", id)
+}
+
+// DestinationAmiID is the attribute of the copy of an AMI in its destination region
+func DestinationAmiID(id string) attribute.KeyValue {
+	return attribute.String("destination_ami_id", id)
+}
+
+// SnapshotID is the attribute of a snapshot
+func SnapshotID(id string) attribute.KeyValue {
+	return attribute.String("snapshot_id", id)
+}
+
+// VolumeID is the attribute of a volume
+func VolumeID(id string) attribute.KeyValue {
+	return attribute.String("volume_id", id)
+}
+
+// TaskID is the attribute of an import task
+func TaskID(id string) attribute.KeyValue {
+	return attribute.String("task_id", id)
+}
+
+// KmsKeyAlias is the attribute of a KMS alias
+func KmsKeyAlias(alias string) attribute.KeyValue {
+	return attribute.String("kms_key_alias", alias)
+}
+
+// S3Bucket is the attribute of the bucket the machine image is uploaded to
+func S3Bucket(bucket string) attribute.KeyValue {
+	return attribute.String("s3.bucket", bucket)
+}
+
+// S3Key is the attribute of the key the machine image is uploaded to
+func S3Key(key string) attribute.KeyValue {
+	return attribute.String("s3.key", key)
+}
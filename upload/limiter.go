@@ -0,0 +1,66 @@
+package upload
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// maxLimitedRead bounds a single read of a limited reader, so the rate stays smooth
+const maxLimitedRead = 256 << 10
+
+// Limiter caps the combined rate of the readers it wraps. A nil *Limiter does not limit.
+type Limiter struct {
+	bytesPerSecond float64
+
+	mu sync.Mutex
+	// next is the time at which the bytes read so far may have been read at the rate
+	next time.Time
+}
+
+// NewLimiter returns a Limiter of bytesPerSecond, or nil when bytesPerSecond is not positive
+func NewLimiter(bytesPerSecond float64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &Limiter{bytesPerSecond: bytesPerSecond}
+}
+
+// ReadCloser returns rc with its reads limited by l
+func (l *Limiter) ReadCloser(rc io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return rc
+	}
+
+	return &limitedReader{ReadCloser: rc, limiter: l}
+}
+
+// wait blocks until n more bytes may be read
+func (l *Limiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSecond * float64(time.Second)))
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	limiter *Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
@@ -0,0 +1,45 @@
+package upload_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"light-stemcell-builder/upload"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	It("does not limit when the rate is not positive", func() {
+		Expect(upload.NewLimiter(0)).To(BeNil())
+
+		reader := io.NopCloser(bytes.NewReader(nil))
+		Expect(upload.NewLimiter(0).ReadCloser(reader)).To(BeIdenticalTo(reader))
+	})
+
+	It("caps the combined rate of its readers", func() {
+		limiter := upload.NewLimiter(4 << 20)
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				reader := limiter.ReadCloser(io.NopCloser(bytes.NewReader(make([]byte, 1<<20))))
+				read, err := io.ReadAll(reader)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(read).To(HaveLen(1 << 20))
+			}()
+		}
+		wg.Wait()
+
+		// 2 MiB at 4 MiB/s, less the last read that is not waited for
+		Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+	})
+})
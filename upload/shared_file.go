@@ -0,0 +1,233 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// chunkSize is the size of the chunks a shared file is read in
+	chunkSize = 1 << 20
+
+	// bufferedChunks is how many chunks a reader may lag behind the read of a shared file
+	bufferedChunks = 8
+)
+
+// SharedFile lets the uploads of several regions share a single read of a file.
+// Each region either opens the file or releases it. Once every region did, the
+// file is read once and each chunk is handed to all open readers, so the uploads
+// advance at the pace of the slowest one.
+type SharedFile struct {
+	path    string
+	limiter *Limiter
+
+	mu      sync.Mutex
+	pending map[string]bool
+	readers []*sharedReader
+	started bool
+	sha256  string
+
+	// digestMu serializes the computation of the checksum without holding up Open and Release
+	digestMu sync.Mutex
+}
+
+// NewSharedFile returns a SharedFile of path for the uploads of regions, whose readers are limited by limiter
+func NewSharedFile(path string, regions []string, limiter *Limiter) *SharedFile {
+	pending := map[string]bool{}
+	for _, region := range regions {
+		pending[region] = true
+	}
+
+	return &SharedFile{
+		path:    path,
+		limiter: limiter,
+		pending: pending,
+	}
+}
+
+// Open returns a reader of the file for region. The reader reads the file
+// directly when region is the only one to read it, or when region was not
+// expected or reading already started.
+func (f *SharedFile) Open(region string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.pending[region] || (len(f.pending) == 1 && len(f.readers) == 0) {
+		delete(f.pending, region)
+
+		file, err := os.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		return f.limiter.ReadCloser(file), nil
+	}
+	delete(f.pending, region)
+
+	reader := &sharedReader{
+		chunks: make(chan []byte, bufferedChunks),
+		done:   make(chan struct{}),
+	}
+	f.readers = append(f.readers, reader)
+	f.startWhenReady()
+
+	return f.limiter.ReadCloser(reader), nil
+}
+
+// Release records that region does not read the file. It does nothing once region
+// opened the file, or when f is nil.
+func (f *SharedFile) Release(region string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.pending[region] {
+		return
+	}
+	delete(f.pending, region)
+	f.startWhenReady()
+}
+
+// Digest returns the hex encoded SHA-256 checksum of the file. The first call reads the
+// whole file, later calls return the same checksum. It returns an empty checksum when f is nil.
+func (f *SharedFile) Digest() (string, error) {
+	if f == nil {
+		return "", nil
+	}
+
+	f.digestMu.Lock()
+	defer f.digestMu.Unlock()
+
+	if checksum := f.SHA256(); checksum != "" {
+		return checksum, nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close() //nolint:errcheck
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %s", f.path, err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	err = f.RecordSHA256(checksum)
+	if err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// RecordSHA256 records the SHA-256 checksum of the file as it was uploaded. It returns an
+// error when it differs from the checksum of an earlier upload, as the file changed while it
+// was read. It does nothing when f is nil.
+func (f *SharedFile) RecordSHA256(checksum string) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sha256 != "" && f.sha256 != checksum {
+		return fmt.Errorf("SHA-256 checksum %s of %s differs from checksum %s of an earlier upload", checksum, f.path, f.sha256)
+	}
+	f.sha256 = checksum
+	return nil
+}
+
+// SHA256 returns the recorded SHA-256 checksum of the file, which is empty when none was recorded or f is nil
+func (f *SharedFile) SHA256() string {
+	if f == nil {
+		return ""
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sha256
+}
+
+// startWhenReady starts reading the file once every region opened or released it
+func (f *SharedFile) startWhenReady() {
+	if f.started || len(f.pending) > 0 || len(f.readers) == 0 {
+		return
+	}
+
+	f.started = true
+	go f.broadcast(f.readers)
+}
+
+// broadcast reads the file and sends each chunk to every reader that is not closed
+func (f *SharedFile) broadcast(readers []*sharedReader) {
+	file, err := os.Open(f.path)
+	if err == nil {
+		defer file.Close() //nolint:errcheck
+	}
+
+	for err == nil {
+		chunk := make([]byte, chunkSize)
+		n, readErr := io.ReadFull(file, chunk)
+		if n > 0 {
+			for _, reader := range readers {
+				select {
+				case reader.chunks <- chunk[:n]:
+				case <-reader.done:
+				}
+			}
+		}
+
+		switch readErr {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			err = io.EOF
+		default:
+			err = fmt.Errorf("reading %s: %s", f.path, readErr)
+		}
+	}
+
+	for _, reader := range readers {
+		reader.err = err
+		close(reader.chunks)
+	}
+}
+
+// sharedReader reads the chunks of a SharedFile
+type sharedReader struct {
+	chunks chan []byte
+	// err is set before chunks is closed
+	err     error
+	done    chan struct{}
+	closed  sync.Once
+	current []byte
+}
+
+func (r *sharedReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, r.err
+		}
+		r.current = chunk
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close stops the reader from holding up the read of the file
+func (r *sharedReader) Close() error {
+	r.closed.Do(func() { close(r.done) })
+	return nil
+}
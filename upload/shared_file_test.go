@@ -0,0 +1,151 @@
+package upload_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"light-stemcell-builder/upload"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SharedFile", func() {
+	var (
+		path     string
+		contents []byte
+	)
+
+	BeforeEach(func() {
+		// a few chunks and a partial one
+		contents = bytes.Repeat([]byte("0123456789abcdef"), 3*(1<<20)/16+1000)
+		path = filepath.Join(GinkgoT().TempDir(), "root.img")
+		Expect(os.WriteFile(path, contents, 0644)).To(Succeed())
+	})
+
+	readAll := func(reader io.ReadCloser) []byte {
+		defer reader.Close() //nolint:errcheck
+
+		read, err := io.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		return read
+	}
+
+	It("hands the whole file to every region that opened it", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1", "cn-north-1"}, nil)
+
+		var wg sync.WaitGroup
+		read := make([][]byte, 3)
+		for i, region := range []string{"us-east-1", "eu-west-1", "cn-north-1"} {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				reader, err := f.Open(region)
+				Expect(err).ToNot(HaveOccurred())
+				read[i] = readAll(reader)
+			}()
+		}
+		wg.Wait()
+
+		for i := range read {
+			Expect(bytes.Equal(read[i], contents)).To(BeTrue())
+		}
+	})
+
+	It("starts reading once the other regions released the file", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1", "eu-central-1"}, nil)
+
+		first, err := f.Open("us-east-1")
+		Expect(err).ToNot(HaveOccurred())
+		f.Release("eu-west-1")
+
+		read := make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			read <- readAll(first)
+		}()
+		Consistently(read, 100*time.Millisecond).ShouldNot(Receive())
+
+		f.Release("eu-central-1")
+		Eventually(read).Should(Receive(Equal(contents)))
+	})
+
+	It("keeps reading for the other regions when a reader is closed", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1"}, nil)
+
+		closed, err := f.Open("us-east-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(closed.Close()).To(Succeed())
+
+		reader, err := f.Open("eu-west-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readAll(reader)).To(Equal(contents))
+	})
+
+	It("reads the file directly for the only region that opens it", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1"}, nil)
+		f.Release("eu-west-1")
+
+		reader, err := f.Open("us-east-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader).To(BeAssignableToTypeOf(&os.File{}))
+		Expect(readAll(reader)).To(Equal(contents))
+	})
+
+	It("reads the file directly for a region that was not expected", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1"}, nil)
+
+		reader, err := f.Open("ap-south-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readAll(reader)).To(Equal(contents))
+	})
+
+	It("returns an error to every reader when the file cannot be read", func() {
+		f := upload.NewSharedFile(filepath.Join(filepath.Dir(path), "missing.img"), []string{"us-east-1", "eu-west-1"}, nil)
+
+		first, err := f.Open("us-east-1")
+		Expect(err).ToNot(HaveOccurred())
+		second, err := f.Open("eu-west-1")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = io.ReadAll(first)
+		Expect(err).To(MatchError(ContainSubstring("missing.img")))
+		_, err = io.ReadAll(second)
+		Expect(err).To(MatchError(ContainSubstring("missing.img")))
+	})
+	It("records the checksum of the file and rejects a different one", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1", "eu-west-1"}, nil)
+		Expect(f.SHA256()).To(BeEmpty())
+
+		Expect(f.RecordSHA256("some checksum")).To(Succeed())
+		Expect(f.RecordSHA256("some checksum")).To(Succeed())
+		Expect(f.RecordSHA256("other checksum")).To(MatchError(ContainSubstring("differs from checksum some checksum")))
+		Expect(f.SHA256()).To(Equal("some checksum"))
+	})
+	It("computes the checksum of the file once", func() {
+		f := upload.NewSharedFile(path, []string{"us-east-1"}, nil)
+
+		sum := sha256.Sum256(contents)
+		Expect(f.Digest()).To(Equal(hex.EncodeToString(sum[:])))
+		Expect(f.SHA256()).To(Equal(hex.EncodeToString(sum[:])))
+
+		Expect(os.WriteFile(path, []byte("other contents"), 0644)).To(Succeed())
+		Expect(f.Digest()).To(Equal(hex.EncodeToString(sum[:])))
+		Expect(f.RecordSHA256("other checksum")).ToNot(Succeed())
+	})
+
+	It("returns an error when the checksum of the file cannot be computed", func() {
+		f := upload.NewSharedFile(filepath.Join(filepath.Dir(path), "missing.img"), []string{"us-east-1"}, nil)
+
+		_, err := f.Digest()
+		Expect(err).To(MatchError(ContainSubstring("missing.img")))
+	})
+})